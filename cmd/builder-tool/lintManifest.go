@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/imagebuilder/builder"
+	"github.com/Cloud-Foundations/Dominator/lib/decoders"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func lintManifestSubcommand(args []string, logger log.DebugLogger) error {
+	if err := lintManifest(args[0], logger); err != nil {
+		return fmt.Errorf("error linting manifest: %s", err)
+	}
+	return nil
+}
+
+func lintManifest(manifestDirectory string, logger log.DebugLogger) error {
+	var variables map[string]string
+	if *variablesFilename != "" {
+		err := decoders.DecodeFile(*variablesFilename, &variables)
+		if err != nil {
+			return err
+		}
+	}
+	var srpcClient srpc.ClientI
+	if *lintWithSourceImage {
+		srpcClient = getImageServerClient()
+	}
+	messages, err := builder.LintManifest(srpcClient,
+		builder.BuildLocalOptions{
+			ManifestDirectory: manifestDirectory,
+			Variables:         variables,
+		},
+		logger)
+	if err != nil {
+		return err
+	}
+	var numErrors, numWarnings uint
+	for _, message := range messages {
+		fmt.Println(message)
+		if message.IsError {
+			numErrors++
+		} else {
+			numWarnings++
+		}
+	}
+	if numErrors > 0 {
+		return fmt.Errorf("%d errors, %d warnings", numErrors, numWarnings)
+	}
+	if numWarnings > 0 {
+		logger.Printf("%d warnings\n", numWarnings)
+	}
+	return nil
+}
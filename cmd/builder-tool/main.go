@@ -37,6 +37,8 @@ var (
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server")
+	lintWithSourceImage = flag.Bool("lintWithSourceImage", true,
+		"If true, lint-manifest will also check against the source image")
 	maxSourceAge = flag.Duration("maxSourceAge", time.Hour,
 		"Maximum age of a source image before it is rebuilt")
 	maximumBuildDuration = flag.Duration("maximumBuildDuration", 24*time.Hour,
@@ -88,9 +90,11 @@ var subcommands = []commands.Command{
 	{"enable-build-requests", "", 0, 0, enableBuildRequestsSubcommand},
 	{"get-dependencies", "", 0, 0, getDependenciesSubcommand},
 	{"get-digraph", "", 0, 0, getDirectedGraphSubcommand},
+	{"lint-manifest", "manifestDir", 1, 1, lintManifestSubcommand},
 	{"process-manifest", "manifestDir rootDir", 2, 2,
 		processManifestSubcommand},
 	{"replace-idle-slaves", "", 0, 0, replaceIdleSlavesSubcommand},
+	{"show-build-queue", "", 0, 0, showBuildQueueSubcommand},
 	{"start-auto-builds", "", 0, 0, startAutoBuildsSubcommand},
 }
 
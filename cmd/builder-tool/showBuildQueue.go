@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/imagebuilder/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func showBuildQueueSubcommand(args []string, logger log.DebugLogger) error {
+	if err := showBuildQueue(logger); err != nil {
+		return fmt.Errorf("error showing build queue: %s", err)
+	}
+	return nil
+}
+
+func showBuildQueue(logger log.Logger) error {
+	entries, err := client.GetBuildQueue(getImaginatorClient())
+	if err != nil {
+		return err
+	}
+	var position uint
+	for _, entry := range entries {
+		var state string
+		if entry.Running {
+			state = fmt.Sprintf("running for %s",
+				format.Duration(time.Since(entry.StartedAt)))
+		} else {
+			position++
+			state = fmt.Sprintf("#%d, waiting for %s", position,
+				format.Duration(time.Since(entry.QueuedAt)))
+		}
+		username := entry.Username
+		if username == "" {
+			username = "-"
+		}
+		fmt.Fprintf(os.Stdout, "%s %s %s %s\n",
+			entry.StreamName, entry.Priority, username, state)
+	}
+	return nil
+}
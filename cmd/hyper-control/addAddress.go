@@ -11,18 +11,22 @@ import (
 )
 
 func addAddressSubcommand(args []string, logger log.DebugLogger) error {
-	var ipAddr string
+	var ipAddr, ipv6Addr string
 	if len(args) > 1 {
 		ipAddr = args[1]
 	}
-	err := addAddress(args[0], ipAddr, logger)
+	if len(args) > 2 {
+		ipv6Addr = args[2]
+	}
+	err := addAddress(args[0], ipAddr, ipv6Addr, logger)
 	if err != nil {
 		return fmt.Errorf("error adding address: %s", err)
 	}
 	return nil
 }
 
-func addAddress(macAddr, ipAddr string, logger log.DebugLogger) error {
+func addAddress(macAddr, ipAddr, ipv6Addr string,
+	logger log.DebugLogger) error {
 	address := proto.Address{MacAddress: macAddr}
 	if ipAddr != "" {
 		address.IpAddress = net.ParseIP(ipAddr)
@@ -33,6 +37,12 @@ func addAddress(macAddr, ipAddr string, logger log.DebugLogger) error {
 				address.IpAddress[2], address.IpAddress[3])
 		}
 	}
+	if ipv6Addr != "" {
+		address.Ipv6Address = net.ParseIP(ipv6Addr)
+		if address.Ipv6Address == nil {
+			return fmt.Errorf("invalid IPv6 address: %s", ipv6Addr)
+		}
+	}
 	request := proto.ChangeAddressPoolRequest{
 		AddressesToAdd: []proto.Address{address}}
 	var reply proto.ChangeAddressPoolResponse
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	fmclient "github.com/Cloud-Foundations/Dominator/fleetmanager/client"
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func evacuateHypervisorSubcommand(args []string,
+	logger log.DebugLogger) error {
+	err := evacuateHypervisor(logger)
+	if err != nil {
+		return fmt.Errorf("error evacuating Hypervisor: %s", err)
+	}
+	return nil
+}
+
+func evacuateHypervisor(logger log.DebugLogger) error {
+	if *hypervisorHostname == "" {
+		return errors.New("unspecified Hypervisor")
+	}
+	client, err := dialFleetManager()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	request := fm_proto.EvacuateHypervisorRequest{
+		HypervisorHostname:          *hypervisorHostname,
+		HypervisorTagsToMatch:       hypervisorTagsToMatch,
+		LiveMigration:               *liveMigration,
+		Location:                    *location,
+		MaximumConcurrentMigrations: *maxConcurrent,
+	}
+	return fmclient.EvacuateHypervisor(client, request, logger)
+}
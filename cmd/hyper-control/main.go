@@ -46,6 +46,7 @@ var (
 	hypervisorPortNum = flag.Uint("hypervisorPortNum",
 		constants.HypervisorPortNumber, "Port number of hypervisor")
 	hypervisorTags         tags.Tags
+	hypervisorTagsToMatch  tags.MatchTags
 	ignoreMissingLocalTags = flag.Bool("ignoreMissingLocalTags", false,
 		"If true, ignore missing local tags when connecting to Fleet Manager")
 	imageServerHostname = flag.String("imageServerHostname", "localhost",
@@ -57,6 +58,8 @@ var (
 		"Name of default image stream for building bootable installer ISO")
 	installerPortNum = flag.Uint("installerPortNum",
 		constants.InstallerPortNumber, "Port number of installer")
+	liveMigration = flag.Bool("liveMigration", false,
+		"If true, try live migration first for evacuate-hypervisor")
 	location = flag.String("location", "",
 		"Location to search for hypervisors")
 	lockTimeout = flag.Duration("lockTimeout", 15*time.Second,
@@ -64,7 +67,7 @@ var (
 	offerTimeout = flag.Duration("offerTimeout", time.Minute+time.Second,
 		"How long to offer DHCP OFFERs and ACKs")
 	maxConcurrent = flag.Uint("maxConcurrent", 0,
-		"Maximum number of concurrent updates for rollout-image (default infinite)")
+		"Maximum number of concurrent updates for rollout-image (default infinite) or migrations for evacuate-hypervisor")
 	maxUpdates = flag.Uint64("maxUpdates", 0,
 		"Maximum number of updates to receive (default infinite)")
 	memory              = flagutil.Size(4 << 30)
@@ -107,6 +110,8 @@ func init() {
 	flag.Var(&externalLeaseHostnames, "externalLeaseHostnames",
 		"Optional list of hostnames for register-external-leases")
 	flag.Var(&hypervisorTags, "hypervisorTags", "Tags to apply to Hypervisor")
+	flag.Var(&hypervisorTagsToMatch, "hypervisorTagsToMatch",
+		"Tags to match when selecting destination Hypervisors")
 	flag.Var(&memory, "memory", "memory for VM")
 	flag.Var(&netbootFiles, "netbootFiles", "Extra files served by TFTP server")
 	flag.Var(&subnetIDs, "subnetIDs", "Subnet IDs for VM")
@@ -123,13 +128,14 @@ func printUsage() {
 }
 
 var subcommands = []commands.Command{
-	{"add-address", "MACaddr [IPaddr]", 1, 2, addAddressSubcommand},
+	{"add-address", "MACaddr [IPaddr [IPv6addr]]", 1, 3, addAddressSubcommand},
 	{"add-subnet", "ID IPgateway IPmask DNSserver...", 4, -1,
 		addSubnetSubcommand},
 	{"change-tags", "", 0, 0, changeTagsSubcommand},
 	{"connect-to-vm-manager", "IPaddr", 1, 1, connectToVmManagerSubcommand},
 	{"disable-hypervisor", "", 0, 0, disableHypervisorSubcommand},
 	{"enable-hypervisor", "", 0, 0, enableHypervisorSubcommand},
+	{"evacuate-hypervisor", "", 0, 0, evacuateHypervisorSubcommand},
 	{"get-capacity", "", 0, 0, getCapacitySubcommand},
 	{"get-identity-provider", "", 0, 0, getIdentityProviderSubcommand},
 	{"get-machine-info", "hostname", 1, 1, getMachineInfoSubcommand},
@@ -14,6 +14,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/hypervisor/httpd"
 	"github.com/Cloud-Foundations/Dominator/hypervisor/manager"
 	"github.com/Cloud-Foundations/Dominator/hypervisor/metadatad"
+	"github.com/Cloud-Foundations/Dominator/hypervisor/radvd"
 	"github.com/Cloud-Foundations/Dominator/hypervisor/rpcd"
 	"github.com/Cloud-Foundations/Dominator/hypervisor/tftpbootd"
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
@@ -62,6 +63,8 @@ var (
 		"Optional directory where local images can be fetched from")
 	networkBootImage = flag.String("networkBootImage", "pxelinux.%d",
 		"Name of boot image passed via DHCP option")
+	numaPlacement = flag.Bool("numaPlacement", false,
+		"If true, pin VMs to a single NUMA node when they fit")
 	objectCacheDirectory = flag.String("objectCacheDirectory", "",
 		"Directory to store object cache (default first volume directory parent)")
 	objectCacheSize = flagutil.Size(10 << 30)
@@ -202,6 +205,12 @@ func run() {
 	if err := dhcpServer.SetNetworkBootImage(*networkBootImage); err != nil {
 		logger.Fatalf("Cannot set NetworkBootImage name: %s\n", err)
 	}
+	var routerAdvertiser manager.RouterAdvertiser
+	if ra, err := radvd.New(logger); err != nil {
+		logger.Printf("Cannot start IPv6 router advertiser: %s\n", err)
+	} else {
+		routerAdvertiser = ra
+	}
 	imageServerAddress := fmt.Sprintf("%s:%d",
 		*imageServerHostname, *imageServerPortNum)
 	tftpbootServer, err := tftpbootd.New(imageServerAddress,
@@ -218,8 +227,10 @@ func run() {
 		LockLogTimeout:       *lockLogTimeout,
 		LocalImagesDirectory: *localImagesDirectory,
 		Logger:               logger,
+		NumaPlacement:        *numaPlacement,
 		ObjectCacheDirectory: *objectCacheDirectory,
 		ObjectCacheBytes:     uint64(objectCacheSize),
+		RouterAdvertiser:     routerAdvertiser,
 		ShowVgaConsole:       *showVGA,
 		StateDir:             *stateDir,
 		Username:             *username,
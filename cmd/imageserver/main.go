@@ -5,6 +5,7 @@ import (
 	"fmt"
 	_ "net/http/pprof"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Cloud-Foundations/Dominator/imageserver/httpd"
@@ -12,10 +13,12 @@ import (
 	"github.com/Cloud-Foundations/Dominator/imageserver/scanner"
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/flags/loadflags"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
 	"github.com/Cloud-Foundations/Dominator/lib/log/serverlogger"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc/setupserver"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
 	objectserverRpcd "github.com/Cloud-Foundations/Dominator/objectserver/rpcd"
 	"github.com/Cloud-Foundations/tricorder/go/healthserver"
 	"github.com/Cloud-Foundations/tricorder/go/tricorder"
@@ -31,6 +34,8 @@ var (
 		"If true, allow all users to call GetObjects method")
 	allowUnauthenticatedReads = flag.Bool("allowUnauthenticatedReads", false,
 		"If true, allow unauthenticated access to read-only methods")
+	buildCacheLifetime = flag.Duration("buildCacheLifetime", 336*time.Hour,
+		"Time to keep unused build cache objects")
 	debug = flag.Bool("debug", false,
 		"If true, show debugging output")
 	generateMissingWebcert = flag.Bool("generateMissingWebcert", false,
@@ -60,8 +65,33 @@ var (
 		"If true, run in insecure mode. This gives remote access to all")
 	portNum = flag.Uint("portNum", constants.ImageServerPortNumber,
 		"Port number to allocate and listen on for HTTP/RPC")
+	replicationPeers        flagutil.StringList
+	vulnerabilityEcosystems flagutil.StringList
+	vulnerabilityFeed       = flag.String("vulnerabilityFeed", "",
+		"Optional filename of OSV vulnerability feed to match against images")
 )
 
+func init() {
+	flag.Var(&replicationPeers, "replicationPeers",
+		"Comma separated list of peer image servers (multi-master mode)")
+	flag.Var(&vulnerabilityEcosystems, "vulnerabilityEcosystems",
+		"Comma separated list of OSV ecosystems to match (default all)")
+}
+
+// peerAddresses returns the peer addresses, adding the default port number
+// where it is missing.
+func peerAddresses() []string {
+	addresses := make([]string, 0, len(replicationPeers))
+	for _, address := range replicationPeers {
+		if !strings.Contains(address, ":") {
+			address = fmt.Sprintf("%s:%d", address,
+				constants.ImageServerPortNumber)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
 func main() {
 	if os.Geteuid() == 0 {
 		fmt.Fprintln(os.Stderr, "Do not run the Image Server as root")
@@ -105,9 +135,15 @@ func main() {
 		imageServerAddress = fmt.Sprintf("%s:%d", *imageServerHostname,
 			*imageServerPortNum)
 	}
+	var feed *vulnerability.Feed
+	if *vulnerabilityFeed != "" {
+		feed = vulnerability.WatchFeed(*vulnerabilityFeed,
+			vulnerabilityEcosystems, logger)
+	}
 	imdb, err := scanner.Load(
 		scanner.Config{
 			BaseDirectory:                       *imageDir,
+			BuildCacheLifetime:                  *buildCacheLifetime,
 			LockCheckInterval:                   *lockCheckInterval,
 			LockLogTimeout:                      *lockLogTimeout,
 			MaximumExpirationDuration:           *maximumExpirationDuration,
@@ -115,8 +151,9 @@ func main() {
 			ReplicationMaster:                   imageServerAddress,
 		},
 		scanner.Params{
-			Logger:       logger,
-			ObjectServer: objSrv,
+			Logger:            logger,
+			ObjectServer:      objSrv,
+			VulnerabilityFeed: feed,
 		})
 	if err != nil {
 		logger.Fatalf("Cannot load image database: %s\n", err)
@@ -129,6 +166,7 @@ func main() {
 			AllowUnauthenticatedReads:   *allowUnauthenticatedReads,
 			InformationDatabaseTemplate: *informationDatabaseTemplate,
 			ReplicationMaster:           imageServerAddress,
+			ReplicationPeers:            peerAddresses(),
 		},
 		imageserverRpcd.Params{
 			ImageDataBase: imdb,
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/util"
+	"github.com/Cloud-Foundations/Dominator/lib/image/oci"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+func exportOciSubcommand(args []string, logger log.DebugLogger) error {
+	objectsGetter := getObjectsGetter(logger)
+	if err := exportOci(objectsGetter, args[0], args[1]); err != nil {
+		return fmt.Errorf("error exporting image: %s", err)
+	}
+	return nil
+}
+
+func exportOci(objectsGetter objectserver.ObjectsGetter, imageName,
+	destination string) error {
+	img, name, err := getTypedImageAndName(imageName)
+	if err != nil {
+		return err
+	}
+	if *computedFilesRoot != "" {
+		objectsGetter, err = util.ReplaceComputedFiles(img.FileSystem,
+			&util.ComputedFilesData{RootDirectory: *computedFilesRoot},
+			objectsGetter)
+		if err != nil {
+			return err
+		}
+	}
+	params := oci.ExportParams{
+		Compress:  *compress,
+		Reference: name,
+	}
+	if !strings.HasSuffix(destination, ".tar") {
+		return oci.Export(destination, img, objectsGetter, params)
+	}
+	file, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := oci.ExportArchive(writer, img, objectsGetter, params); err != nil {
+		file.Close()
+		os.Remove(destination)
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(destination)
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/verstr"
+)
+
+func findImagesWithObjectSubcommand(args []string,
+	logger log.DebugLogger) error {
+	var hashVal hash.Hash
+	if err := hashVal.UnmarshalText([]byte(args[0])); err != nil {
+		return fmt.Errorf("error parsing hash: %s", err)
+	}
+	imageSClient, _ := getClients()
+	imageNames, err := client.FindImagesWithObject(imageSClient, hashVal)
+	if err != nil {
+		return fmt.Errorf("error finding images: %s", err)
+	}
+	printImageNames(imageNames)
+	return nil
+}
+
+func findImagesWithPackageSubcommand(args []string,
+	logger log.DebugLogger) error {
+	var version string
+	if len(args) > 1 {
+		version = args[1]
+	}
+	imageSClient, _ := getClients()
+	images, err := client.FindImagesWithPackage(imageSClient, args[0], version)
+	if err != nil {
+		return fmt.Errorf("error finding images: %s", err)
+	}
+	sort.Slice(images, func(left, right int) bool {
+		return verstr.Less(images[left].ImageName, images[right].ImageName)
+	})
+	for _, image := range images {
+		fmt.Printf("%s %s\n", image.ImageName, image.Version)
+	}
+	return nil
+}
+
+func findImagesWithPathSubcommand(args []string, logger log.DebugLogger) error {
+	imageSClient, _ := getClients()
+	imageNames, err := client.FindImagesWithPath(imageSClient, args[0])
+	if err != nil {
+		return fmt.Errorf("error finding images: %s", err)
+	}
+	printImageNames(imageNames)
+	return nil
+}
+
+func printImageNames(imageNames []string) {
+	verstr.Sort(imageNames)
+	for _, name := range imageNames {
+		fmt.Println(name)
+	}
+}
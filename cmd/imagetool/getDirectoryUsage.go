@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func getDirectoryUsageSubcommand(args []string, logger log.DebugLogger) error {
+	imageSClient, _ := getClients()
+	if err := getDirectoryUsage(imageSClient, args[0]); err != nil {
+		return fmt.Errorf("error getting directory usage: %s", err)
+	}
+	return nil
+}
+
+func getDirectoryUsage(imageSClient srpc.ClientI, dirname string) error {
+	usage, err := client.GetDirectoryUsage(imageSClient, dirname)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Images:  %d\n", usage.NumImages)
+	fmt.Printf("Objects: %d\n", usage.NumObjects)
+	fmt.Printf("Unique:  %s\n", format.FormatBytes(usage.UniqueBytes))
+	fmt.Printf("Shared:  %s\n", format.FormatBytes(usage.SharedBytes))
+	if usage.QuotaBytes > 0 {
+		fmt.Printf("Quota:   %s (%d%% used)\n",
+			format.FormatBytes(usage.QuotaBytes),
+			(usage.UniqueBytes+usage.SharedBytes)*100/usage.QuotaBytes)
+	}
+	return nil
+}
@@ -25,5 +25,12 @@ func getReplicationMaster(imageSClient *srpc.Client) error {
 	if len(replicationMaster) > 0 {
 		fmt.Println(replicationMaster)
 	}
+	replicationPeers, err := client.GetReplicationPeers(imageSClient)
+	if err != nil {
+		return err
+	}
+	for _, replicationPeer := range replicationPeers {
+		fmt.Printf("peer: %s\n", replicationPeer)
+	}
 	return nil
 }
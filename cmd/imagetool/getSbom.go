@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/image/sbom"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+func getSbomSubcommand(args []string, logger log.DebugLogger) error {
+	var outFileName string
+	if len(args) > 1 {
+		outFileName = args[1]
+	}
+	if err := getSbom(args[0], outFileName, logger); err != nil {
+		return fmt.Errorf("error getting SBOM: %s", err)
+	}
+	return nil
+}
+
+func getSbom(typedName, outFileName string, logger log.DebugLogger) error {
+	img, err := getTypedImage(typedName)
+	if err != nil {
+		return err
+	}
+	if *sbomFormat == "" && img.SBOM != nil && img.SBOM.Object != nil {
+		objectsGetter := getObjectsGetter(logger)
+		size, reader, err := objectserver.GetObject(objectsGetter,
+			*img.SBOM.Object)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if outFileName == "" {
+			_, err := io.CopyN(os.Stdout, reader, int64(size))
+			return err
+		}
+		return fsutil.CopyToFile(outFileName, fsutil.PublicFilePerms, reader,
+			size)
+	}
+	params := sbom.Params{Format: *sbomFormat, Name: typedName}
+	if outFileName == "" {
+		return sbom.Write(os.Stdout, img, params)
+	}
+	file, err := os.OpenFile(outFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return err
+	}
+	if err := sbom.Write(file, img, params); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/text"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
+)
+
+func getVulnerabilitiesSubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := getVulnerabilities(args[0]); err != nil {
+		return fmt.Errorf("error getting vulnerabilities: %s", err)
+	}
+	return nil
+}
+
+func getVulnerabilities(typedName string) error {
+	db, err := loadVulnerabilityFeed()
+	if err != nil {
+		return err
+	}
+	findings, err := getImageVulnerabilities(db, typedName)
+	if err != nil {
+		return err
+	}
+	columnCollector := &text.ColumnCollector{}
+	for _, finding := range findings {
+		columnCollector.AddField(finding.PackageName)
+		columnCollector.AddField(finding.PackageVersion)
+		columnCollector.AddField(finding.AdvisoryId)
+		columnCollector.AddField(strings.Join(finding.Aliases, ","))
+		columnCollector.AddField(finding.Severity)
+		columnCollector.AddField(finding.FixedVersion)
+		columnCollector.CompleteLine()
+	}
+	return columnCollector.WriteLeftAligned(os.Stdout)
+}
+
+// getImageVulnerabilities will get the findings for an image. If db is nil, the
+// imageserver is queried, otherwise the package list for the image is matched
+// against db.
+func getImageVulnerabilities(db *vulnerability.Database,
+	typedName string) ([]vulnerability.Finding, error) {
+	if db == nil {
+		imageSClient, _ := getClients()
+		return client.GetImageVulnerabilities(imageSClient, typedName)
+	}
+	packages, err := getTypedPackageList(typedName)
+	if err != nil {
+		return nil, err
+	}
+	return db.Match(packages), nil
+}
+
+// loadVulnerabilityFeed will load the vulnerability feed specified by the
+// -vulnerabilityFeed flag. If the flag is not specified, nil is returned.
+func loadVulnerabilityFeed() (*vulnerability.Database, error) {
+	if *vulnerabilityFeed == "" {
+		return nil, nil
+	}
+	return vulnerability.Load(*vulnerabilityFeed, vulnerabilityEcosystems)
+}
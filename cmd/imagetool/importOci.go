@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/oci"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func importOciSubcommand(args []string, logger log.DebugLogger) error {
+	imageSClient, objectClient := getClients()
+	err := importOci(imageSClient, objectClient, args[0], args[1], args[2],
+		args[3], logger)
+	if err != nil {
+		return fmt.Errorf("error importing image: \"%s\": %s", args[0], err)
+	}
+	return nil
+}
+
+func importOci(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient,
+	name, layoutName, filterFilename, triggersFilename string,
+	logger log.DebugLogger) error {
+	imageExists, err := client.CheckImage(imageSClient, name)
+	if err != nil {
+		return errors.New("error checking for image existence: " + err.Error())
+	}
+	if imageExists {
+		return errors.New("image exists")
+	}
+	newImage := new(image.Image)
+	if err := loadImageFiles(newImage, objectClient, filterFilename,
+		triggersFilename); err != nil {
+		return err
+	}
+	newImage.FileSystem, err = buildImageFromOci(imageSClient,
+		newImage.Filter, layoutName, logger)
+	if err != nil {
+		return errors.New("error building image: " + err.Error())
+	}
+	if err := copyMtimes(imageSClient, newImage, *copyMtimesFrom); err != nil {
+		return err
+	}
+	return addImage(imageSClient, name, newImage, logger)
+}
+
+func buildImageFromOci(imageSClient *srpc.Client, filter *filter.Filter,
+	layoutName string,
+	logger log.DebugLogger) (*filesystem.FileSystem, error) {
+	fi, err := os.Stat(layoutName)
+	if err != nil {
+		return nil, err
+	}
+	var h hasher
+	h.objQ, err = objectclient.NewObjectAdderQueue(imageSClient)
+	if err != nil {
+		return nil, err
+	}
+	startTime := time.Now()
+	var fs *filesystem.FileSystem
+	if fi.IsDir() {
+		fs, err = oci.Import(layoutName, &h, filter)
+	} else {
+		var file *os.File
+		if file, err = os.Open(layoutName); err == nil {
+			fs, err = oci.ImportArchive(file, &h, filter)
+			file.Close()
+		}
+	}
+	if err != nil {
+		h.objQ.Close()
+		return nil, err
+	}
+	if err := h.objQ.Close(); err != nil {
+		return nil, err
+	}
+	logger.Debugf(0, "Imported OCI image and uploaded %d objects (%s) in %s\n",
+		fs.NumRegularInodes, format.FormatBytes(fs.TotalDataBytes),
+		format.Duration(time.Since(startTime)))
+	return fs, nil
+}
@@ -101,6 +101,8 @@ var (
 		"power of 2 to round up raw image size")
 	runTriggers = flag.Bool("runTriggers", false,
 		"If true, run image triggers when patching /")
+	sbomFormat = flag.String("sbomFormat", "",
+		"SBOM format to generate (spdx or cyclonedx). Default: stored SBOM")
 	scanExcludeList flagutil.StringList = constants.ScanExcludeList
 	skipFields                          = flag.String("skipFields", "",
 		"Fields to skip when showing or diffing images")
@@ -108,6 +110,9 @@ var (
 	tagsToMatch tags.MatchTags
 	timeout     = flag.Duration("timeout", 0,
 		"Timeout for get and wait subcommands")
+	vulnerabilityEcosystems flagutil.StringList
+	vulnerabilityFeed       = flag.String("vulnerabilityFeed", "",
+		"Optional filename of OSV vulnerability feed (default: query imageserver)")
 
 	logger            log.DebugLogger
 	minimumExpiration = 15 * time.Minute
@@ -128,6 +133,8 @@ func init() {
 		"Comma separated list of patterns to exclude from scanning")
 	flag.Var(&tableType, "tableType", "Partition table type for make-raw-image")
 	flag.Var(&tagsToMatch, "tagsToMatch", "Tags to match when finding/listing")
+	flag.Var(&vulnerabilityEcosystems, "vulnerabilityEcosystems",
+		"Comma separated list of OSV ecosystems to match (default all)")
 }
 
 func printUsage() {
@@ -188,10 +195,16 @@ var subcommands = []commands.Command{
 		diffImagePackageListsSubcommand},
 	{"diff-triggers", "tool left right", 3, 3, diffTriggersInImagesSubcommand},
 	{"estimate-usage", "name", 1, 1, estimateImageUsageSubcommand},
+	{"export-oci", "name destination", 2, 2, exportOciSubcommand},
+	{"find-images-with-object", "hash", 1, 1, findImagesWithObjectSubcommand},
+	{"find-images-with-package", "name [version]", 1, 2,
+		findImagesWithPackageSubcommand},
+	{"find-images-with-path", "pathname", 1, 1, findImagesWithPathSubcommand},
 	{"find-latest-image", "directory", 1, 1, findLatestImageSubcommand},
 	{"get", "name directory", 2, 2, getImageSubcommand},
 	{"get-archive-data", "name outfile", 2, 2, getImageArchiveDataSubcommand},
 	{"get-build-log", "name [outfile]", 1, 2, getImageBuildLogSubcommand},
+	{"get-directory-usage", "dirname", 1, 1, getDirectoryUsageSubcommand},
 	{"get-file-in-image", "name imageFile [outfile]", 2, 3,
 		getFileInImageSubcommand},
 	{"get-image-expiration", "name", 1, 1, getImageExpirationSubcommand},
@@ -200,7 +213,11 @@ var subcommands = []commands.Command{
 		getObjectStatisticsForImagesSubcommand},
 	{"get-package-list", "name [outfile]", 1, 2, getImagePackageListSubcommand},
 	{"get-replication-master", "", 0, 0, getReplicationMasterSubcommand},
+	{"get-sbom", "name [outfile]", 1, 2, getSbomSubcommand},
+	{"get-vulnerabilities", "name", 1, 1, getVulnerabilitiesSubcommand},
 	{"import-fs-tree", "dirname treeUrl", 2, 2, importFsTreeSubcommand},
+	{"import-oci", "name layout filterfile triggerfile", 4, 4,
+		importOciSubcommand},
 	{"list", "", 0, 0, listImagesSubcommand},
 	{"list-mdb", "", 0, 0, listMdbImagesSubcommand},
 	{"list-not-in-mdb", "", 0, 0, listImagesNotInMdbSubcommand},
@@ -219,6 +236,7 @@ var subcommands = []commands.Command{
 	{"save-to-file", "name [outfile]", 1, 2, saveImageSubcommand},
 	{"scan-filtered-files", "name directory", 2, 2,
 		scanFilteredFilesSubcommand},
+	{"set-directory-quota", "dirname size", 2, 2, setDirectoryQuotaSubcommand},
 	{"show", "name", 1, 1, showImageSubcommand},
 	{"show-bad-computed-files", "", 0, 0, showBadComputedFilesSubcommand},
 	{"show-bad-image-subs", "", 0, 0, showBadImageSubsSubcommand},
@@ -228,6 +246,8 @@ var subcommands = []commands.Command{
 	{"show-inode", "name inodePath", 2, 2, showImageInodeSubcommand},
 	{"show-metadata", "name", 1, 1, showImageMetadataSubcommand},
 	{"show-triggers", "name", 1, 1, showImageTriggersSubcommand},
+	{"show-vulnerable-mdb-images", "", 0, 0,
+		showVulnerableMdbImagesSubcommand},
 	{"showunrefobj", "", 0, 0, showUnreferencedObjectsSubcommand},
 	{"tar", "name [file]", 1, 2, tarImageSubcommand},
 	{"test-download-speed", "name", 1, 1, testDownloadSpeedSubcommand},
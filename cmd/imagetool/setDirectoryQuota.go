@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func setDirectoryQuotaSubcommand(args []string, logger log.DebugLogger) error {
+	var quota flagutil.Size
+	if err := quota.Set(args[1]); err != nil {
+		return fmt.Errorf("error parsing quota: %s", err)
+	}
+	imageSClient, _ := getClients()
+	err := client.SetDirectoryQuota(imageSClient, args[0], uint64(quota))
+	if err != nil {
+		return fmt.Errorf("error setting directory quota: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/text"
+	"github.com/Cloud-Foundations/Dominator/proto/mdbserver"
+)
+
+type vulnerableImage struct {
+	advisories  []string
+	imageName   string
+	numFindings int
+	numMachines uint
+}
+
+func showVulnerableMdbImagesSubcommand(args []string,
+	logger log.DebugLogger) error {
+	mdbdSClient, err := dialMdbd()
+	if err != nil {
+		return err
+	}
+	if err := showVulnerableMdbImages(mdbdSClient); err != nil {
+		return fmt.Errorf("error showing vulnerable MDB images: %s", err)
+	}
+	return nil
+}
+
+func showVulnerableMdbImages(mdbdSClient srpc.ClientI) error {
+	db, err := loadVulnerabilityFeed()
+	if err != nil {
+		return err
+	}
+	request := mdbserver.GetMdbRequest{}
+	var reply mdbserver.GetMdbResponse
+	err = mdbdSClient.RequestReply("MdbServer.GetMdb", request, &reply)
+	if err != nil {
+		return err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return err
+	}
+	machinesPerImage := make(map[string]uint)
+	for _, machine := range reply.Machines {
+		if machine.RequiredImage != "" {
+			machinesPerImage[machine.RequiredImage]++
+		}
+	}
+	var images []vulnerableImage
+	for imageName, numMachines := range machinesPerImage {
+		findings, err := getImageVulnerabilities(db, imageName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", imageName, err)
+			continue
+		}
+		if len(findings) < 1 {
+			continue
+		}
+		advisories := make(map[string]struct{}, len(findings))
+		for _, finding := range findings {
+			advisories[finding.AdvisoryId] = struct{}{}
+		}
+		image := vulnerableImage{
+			imageName:   imageName,
+			numFindings: len(findings),
+			numMachines: numMachines,
+		}
+		for advisory := range advisories {
+			image.advisories = append(image.advisories, advisory)
+		}
+		sort.Strings(image.advisories)
+		images = append(images, image)
+	}
+	sort.Slice(images, func(left, right int) bool {
+		if images[left].numMachines != images[right].numMachines {
+			return images[left].numMachines > images[right].numMachines
+		}
+		return images[left].imageName < images[right].imageName
+	})
+	columnCollector := &text.ColumnCollector{}
+	for _, image := range images {
+		columnCollector.AddField(image.imageName)
+		columnCollector.AddField(
+			strconv.FormatUint(uint64(image.numMachines), 10))
+		columnCollector.AddField(strconv.Itoa(image.numFindings))
+		columnCollector.AddField(strings.Join(image.advisories, ","))
+		columnCollector.CompleteLine()
+	}
+	return columnCollector.WriteLeftAligned(os.Stdout)
+}
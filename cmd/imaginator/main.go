@@ -47,6 +47,13 @@ var (
 	maximumExpirationDurationPrivileged = flag.Duration(
 		"maximumExpirationDurationPrivileged", 730*time.Hour,
 		"Maximum expiration time for privileged users")
+	maximumRunningBuilds = flag.Uint("maximumRunningBuilds", 0,
+		"Maximum number of concurrent builds (0: no limit)")
+	maximumRunningBuildsPerStream = flag.Uint(
+		"maximumRunningBuildsPerStream", 1,
+		"Maximum number of concurrent builds per image stream")
+	maximumRunningBuildsPerUser = flag.Uint("maximumRunningBuildsPerUser", 0,
+		"Maximum number of concurrent builds requested by a user (0: no limit)")
 	minimumExpirationDuration = flag.Duration("minimumExpirationDuration",
 		15*time.Minute,
 		"Minimum permitted expiration duration")
@@ -57,6 +64,8 @@ var (
 		"Hostname of image server for links presentation")
 	slaveDriverConfigurationFile = flag.String("slaveDriverConfigurationFile",
 		"", "Name of configuration file for slave builders")
+	rebuildDependentStreams = flag.Bool("rebuildDependentStreams", false,
+		"If true, rebuild dependent image streams when a source image is built")
 	stateDir = flag.String("stateDir", "/var/lib/imaginator",
 		"Name of state directory")
 	variablesFile = flag.String("variablesFile", "",
@@ -126,8 +135,12 @@ func main() {
 			MaximumExpirationDuration:           *maximumExpirationDuration,
 			MaximumExpirationDurationPrivileged: *maximumExpirationDurationPrivileged,
 			MaximumBuildDuration:                *maximumBuildDuration,
+			MaximumRunningBuilds:                *maximumRunningBuilds,
+			MaximumRunningBuildsPerStream:       *maximumRunningBuildsPerStream,
+			MaximumRunningBuildsPerUser:         *maximumRunningBuildsPerUser,
 			MinimumExpirationDuration:           *minimumExpirationDuration,
 			PresentationImageServerAddress:      presentationImageServerAddress,
+			RebuildDependentStreams:             *rebuildDependentStreams,
 			StateDirectory:                      *stateDir,
 			VariablesFile:                       *variablesFile,
 		},
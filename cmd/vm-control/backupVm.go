@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func backupVmSubcommand(args []string, logger log.DebugLogger) error {
+	if err := backupVm(args[0], logger); err != nil {
+		return fmt.Errorf("error backing up VM: %s", err)
+	}
+	return nil
+}
+
+func backupVm(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return backupVmOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func backupVmOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	if *imageName == "" {
+		return errors.New("no imageName specified")
+	}
+	request := proto.BackupVmRequest{
+		ChunkSize:         uint64(backupChunkSize),
+		ExpiresIn:         *backupExpiresIn,
+		ForceIfNotStopped: *forceIfNotStopped,
+		ImageName:         *imageName,
+		IpAddress:         ipAddr,
+		Name:              *backupName,
+		Quiesce:           *quiesce,
+	}
+	if *imageServerHostname != "" {
+		request.ImageServer = fmt.Sprintf("%s:%d",
+			*imageServerHostname, *imageServerPortNum)
+	}
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	reply, err := hyperclient.BackupVm(client, request)
+	if err != nil {
+		return err
+	}
+	logger.Debugf(0, "sent %d of %d chunks (%s)\n",
+		reply.NewChunks, reply.TotalChunks, format.FormatBytes(reply.NewBytes))
+	fmt.Printf("%x\n", reply.ManifestHash)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func changeVmNetworkLimitsSubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := changeVmNetworkLimits(args[0], logger); err != nil {
+		return fmt.Errorf("error changing VM network limits: %s", err)
+	}
+	return nil
+}
+
+func changeVmNetworkLimits(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return changeVmNetworkLimitsOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func changeVmNetworkLimitsOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return hyperclient.ChangeVmNetworkLimits(client, ipAddr,
+		makeNetworkLimits())
+}
+
+func makeNetworkLimits() proto.NetworkLimits {
+	return proto.NetworkLimits{
+		EgressBitsPerSecond:     *networkEgressBitsPerSecond,
+		EgressPacketsPerSecond:  *networkEgressPacketsPerSecond,
+		IngressBitsPerSecond:    *networkIngressBitsPerSecond,
+		IngressPacketsPerSecond: *networkIngressPacketsPerSecond,
+	}
+}
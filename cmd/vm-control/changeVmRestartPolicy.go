@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func changeVmRestartPolicySubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := changeVmRestartPolicy(args[0], logger); err != nil {
+		return fmt.Errorf("error changing VM restart policy: %s", err)
+	}
+	return nil
+}
+
+func changeVmRestartPolicy(vmHostname string,
+	logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return changeVmRestartPolicyOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func changeVmRestartPolicyOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return hyperclient.ChangeVmRestartPolicy(client, ipAddr, restartPolicy)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func changeVmSnapshotScheduleSubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := changeVmSnapshotSchedule(args[0], logger); err != nil {
+		return fmt.Errorf("error changing VM snapshot schedule: %s", err)
+	}
+	return nil
+}
+
+func changeVmSnapshotSchedule(vmHostname string,
+	logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return changeVmSnapshotScheduleOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func changeVmSnapshotScheduleOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return hyperclient.ChangeVmSnapshotSchedule(client, ipAddr,
+		makeSnapshotSchedule())
+}
+
+func makeSnapshotSchedule() proto.SnapshotSchedule {
+	return proto.SnapshotSchedule{
+		Interval:       *snapshotInterval,
+		Quiesce:        *quiesce,
+		RetentionCount: *snapshotsToKeep,
+		RootOnly:       *snapshotRootOnly,
+	}
+}
@@ -51,12 +51,21 @@ func copyVmFromHypervisor(sourceHypervisorAddress string, vmIP net.IP,
 	if vmInfo.MilliCPUs < 1 {
 		vmInfo.MilliCPUs = sourceVmInfo.MilliCPUs
 	}
+	if vmInfo.NetworkLimits == nil {
+		vmInfo.NetworkLimits = sourceVmInfo.NetworkLimits
+	}
 	if len(vmInfo.OwnerGroups) < 1 {
 		vmInfo.OwnerGroups = sourceVmInfo.OwnerGroups
 	}
 	if len(vmInfo.OwnerUsers) < 1 {
 		vmInfo.OwnerUsers = sourceVmInfo.OwnerUsers
 	}
+	if vmInfo.RestartPolicy == hyper_proto.RestartPolicyNever {
+		vmInfo.RestartPolicy = sourceVmInfo.RestartPolicy
+	}
+	if vmInfo.SnapshotSchedule == nil {
+		vmInfo.SnapshotSchedule = sourceVmInfo.SnapshotSchedule
+	}
 	if len(vmInfo.Tags) < 1 {
 		vmInfo.Tags = sourceVmInfo.Tags
 	}
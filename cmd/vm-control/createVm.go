@@ -359,6 +359,7 @@ func createVmInfoFromFlags() (*hyper_proto.VmInfo, error) {
 	}
 	vmInfo := hyper_proto.VmInfo{
 		ArchitectureType:     architectureType,
+		CloudInitSeedVolume:  cloudInitSeedVolume,
 		ConsoleType:          consoleType,
 		CpuPriority:          *cpuPriority,
 		DestroyOnPowerdown:   *destroyOnPowerdown,
@@ -371,8 +372,10 @@ func createVmInfoFromFlags() (*hyper_proto.VmInfo, error) {
 		MemoryInMiB:          uint64(memory >> 20),
 		MilliCPUs:            *milliCPUs,
 		NetworkEntries:       networkEntries,
+		NoCloudSmbiosSerial:  *noCloudSmbiosSerial,
 		OwnerGroups:          ownerGroups,
 		OwnerUsers:           ownerUsers,
+		RestartPolicy:        restartPolicy,
 		Tags:                 vmTags,
 		SecondarySubnetIDs:   secondarySubnetIDs,
 		SpreadVolumes:        *spreadVolumes,
@@ -383,6 +386,20 @@ func createVmInfoFromFlags() (*hyper_proto.VmInfo, error) {
 		WatchdogAction:       watchdogAction,
 		WatchdogModel:        watchdogModel,
 	}
+	if *sshPublicKeysFile != "" {
+		keys, err := fsutil.LoadLines(*sshPublicKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		vmInfo.SshPublicKeys = keys
+	}
+	if *snapshotInterval > 0 {
+		snapshotSchedule := makeSnapshotSchedule()
+		vmInfo.SnapshotSchedule = &snapshotSchedule
+	}
+	if networkLimits := makeNetworkLimits(); !networkLimits.IsZero() {
+		vmInfo.NetworkLimits = &networkLimits
+	}
 	if len(requestIPs) > 0 && requestIPs[0] != "" {
 		ipAddr := net.ParseIP(requestIPs[0])
 		if ipAddr == nil {
@@ -14,6 +14,7 @@ import (
 type localVmInfo struct {
 	Hypervisor string
 	proto.VmInfo
+	Usage *proto.VmUsage `json:",omitempty"`
 }
 
 func getVmInfoSubcommand(args []string, logger log.DebugLogger) error {
@@ -38,12 +39,13 @@ func getVmInfoOnHypervisor(hypervisor string, ipAddr net.IP,
 		return err
 	}
 	defer client.Close()
-	if vmInfo, err := hyperclient.GetVmInfo(client, ipAddr); err != nil {
+	vmInfo, usage, err := hyperclient.GetVmInfoAndUsage(client, ipAddr)
+	if err != nil {
 		return err
-	} else {
-		return json.WriteWithIndent(os.Stdout, "    ", localVmInfo{
-			Hypervisor: hypervisor,
-			VmInfo:     vmInfo,
-		})
 	}
+	return json.WriteWithIndent(os.Stdout, "    ", localVmInfo{
+		Hypervisor: hypervisor,
+		VmInfo:     vmInfo,
+		Usage:      usage,
+	})
 }
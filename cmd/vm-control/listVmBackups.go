@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func listVmBackupsSubcommand(args []string, logger log.DebugLogger) error {
+	if err := listVmBackups(args[0], logger); err != nil {
+		return fmt.Errorf("error listing VM backups: %s", err)
+	}
+	return nil
+}
+
+func listVmBackups(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return listVmBackupsOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func listVmBackupsOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	vmInfo, err := hyperclient.GetVmInfo(client, ipAddr)
+	if err != nil {
+		return err
+	}
+	for _, backup := range vmInfo.Backups {
+		flags := " image=" + backup.ImageName
+		if backup.Name != "" {
+			flags += " name=" + backup.Name
+		}
+		if backup.ImageServer != "" {
+			flags += " imageServer=" + backup.ImageServer
+		}
+		if !backup.ExpiresAt.IsZero() {
+			flags += " expiresAt=" + backup.ExpiresAt.Format(time.RFC3339)
+		}
+		if backup.Quiesced {
+			flags += " quiesced"
+		}
+		fmt.Printf("%x  %s (%s ago)%s\n",
+			backup.ManifestHash, backup.CreatedOn.Format(time.RFC3339),
+			format.Duration(time.Since(backup.CreatedOn)), flags)
+	}
+	return nil
+}
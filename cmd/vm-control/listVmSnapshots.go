@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func listVmSnapshotsSubcommand(args []string, logger log.DebugLogger) error {
+	if err := listVmSnapshots(args[0], logger); err != nil {
+		return fmt.Errorf("error listing VM snapshots: %s", err)
+	}
+	return nil
+}
+
+func listVmSnapshots(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return listVmSnapshotsOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func listVmSnapshotsOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	vmInfo, err := hyperclient.GetVmInfo(client, ipAddr)
+	if err != nil {
+		return err
+	}
+	if schedule := vmInfo.SnapshotSchedule; schedule != nil {
+		fmt.Printf(
+			"Schedule: every %s, retain %d, root only: %t, quiesce: %t\n",
+			format.Duration(schedule.Interval), schedule.RetentionCount,
+			schedule.RootOnly, schedule.Quiesce)
+	}
+	for _, snapshot := range vmInfo.Snapshots {
+		var size uint64
+		for _, volume := range vmInfo.Volumes {
+			size += volume.Snapshots[snapshot.Name]
+		}
+		name := snapshot.Name
+		if name == "" {
+			name = "(default)"
+		}
+		var flags string
+		if snapshot.Scheduled {
+			flags += " scheduled"
+		}
+		if snapshot.Quiesced {
+			flags += " quiesced"
+		}
+		fmt.Printf("%s  %s (%s ago)  %s%s\n",
+			name, snapshot.CreatedOn.Format(time.RFC3339),
+			format.Duration(time.Since(snapshot.CreatedOn)),
+			format.FormatBytes(size), flags)
+	}
+	return nil
+}
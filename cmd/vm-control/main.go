@@ -31,8 +31,13 @@ var (
 	allocateTimeout = flag.Duration("allocateTimeout", 0,
 		"Time to wait before timing out on allocation request for VM (default infinite")
 	architectureType hyper_proto.ArchitectureType
-	consoleType      hyper_proto.ConsoleType
-	cpuPriority      = flag.Int("cpuPriority", 0,
+	backupChunkSize  flagutil.Size
+	backupExpiresIn  = flag.Duration("backupExpiresIn", 0,
+		"Time after which the backup image expires (default never)")
+	backupName          = flag.String("backupName", "", "Optional backup name")
+	cloudInitSeedVolume hyper_proto.SeedVolumeType
+	consoleType         hyper_proto.ConsoleType
+	cpuPriority         = flag.Int("cpuPriority", 0,
 		"CPU priority (-20:+19) for VM process on Hypervisor")
 	destroyOnDhcpTimeout = flag.Bool("destroyOnDhcpTimeout", false,
 		"If true, destroy newly created VM if DHCP timeout is reached")
@@ -93,15 +98,30 @@ var (
 		"Name of URL of image to boot with")
 	initialiseSecondaryVolumes = flag.Bool("initialiseSecondaryVolumes", false,
 		"If true, initialise secondary volumes")
+	liveMigration = flag.Bool("liveMigration", false,
+		"If true, try live migration first and fall back to cold migration")
 	localVmCreate = flag.String("localVmCreate", "",
 		"Command to make local VM when exporting. The VM name is given as the argument. The VM JSON is available on stdin")
 	localVmDestroy = flag.String("localVmDestroy", "",
 		"Command to destroy local VM when exporting. The VM name is given as the argument")
 	location = flag.String("location", "",
 		"Location to search for hypervisors")
-	machineType      hyper_proto.MachineType
-	memory           flagutil.Size
-	milliCPUs        = flag.Uint("milliCPUs", 0, "milli CPUs (default 250)")
+	machineType hyper_proto.MachineType
+	memory      flagutil.Size
+	milliCPUs   = flag.Uint("milliCPUs", 0,
+		"milli CPUs (default 250)")
+	networkEgressBitsPerSecond = flag.Uint64("networkEgressBitsPerSecond", 0,
+		"Limit for network traffic from the VM (bits/second)")
+	networkEgressPacketsPerSecond = flag.Uint64(
+		"networkEgressPacketsPerSecond", 0,
+		"Limit for network traffic from the VM (packets/second)")
+	networkIngressBitsPerSecond = flag.Uint64("networkIngressBitsPerSecond", 0,
+		"Limit for network traffic to the VM (bits/second)")
+	networkIngressPacketsPerSecond = flag.Uint64(
+		"networkIngressPacketsPerSecond", 0,
+		"Limit for network traffic to the VM (packets/second)")
+	noCloudSmbiosSerial = flag.Bool("noCloudSmbiosSerial", false,
+		"If true, direct cloud-init to the metadata service with the SMBIOS serial")
 	numNetworkQueues flagutil.UintList
 	placement        placementType
 	placementCommand = flag.String("placementCommand", "",
@@ -118,6 +138,8 @@ var (
 	patchLogFilename = flag.String("patchLogFilename", "",
 		"Name file to write VM patch log to")
 	probePortNum = flag.Uint("probePortNum", 0, "Port number on VM to probe")
+	quiesce      = flag.Bool("quiesce", false,
+		"If true, briefly freeze guest file-systems when snapshotting/backing up running VM")
 	probeTimeout = flag.Duration("probeTimeout", time.Minute*5,
 		"Time to wait before timing out on probing VM port")
 	requestFile = flag.String("requestFile", "",
@@ -136,6 +158,8 @@ var (
 		"If true, directly boot into the kernel")
 	skipMemoryCheck = flag.Bool("skipMemoryCheck", false,
 		"If true, skip memory availability check before creating VM")
+	sshPublicKeysFile = flag.String("sshPublicKeysFile", "",
+		"File containing SSH public keys made available to cloud-init in the VM")
 	spreadVolumes = flag.Bool("spreadVolumes", false,
 		"If true, spread the VM volumes across backing stores")
 	storageIndices flagutil.UintList
@@ -143,14 +167,19 @@ var (
 		"Index of volume backing store to move volume to")
 	subnetId = flag.String("subnetId", "",
 		"Subnet ID to launch VM in")
-	requestIPs   flagutil.StringList
-	roundupPower = flag.Uint64("roundupPower", 28,
+	requestIPs    flagutil.StringList
+	restartPolicy hyper_proto.RestartPolicy
+	roundupPower  = flag.Uint64("roundupPower", 28,
 		"power of 2 to round up root volume size")
 	scanFilename = flag.String("scanFilename", "",
 		"Name of file to write scanned VM root to")
+	snapshotInterval = flag.Duration("snapshotInterval", 0,
+		"Interval between scheduled snapshots (default no schedule)")
 	snapshotName     = flag.String("snapshotName", "", "Optional snapshot name")
 	snapshotRootOnly = flag.Bool("snapshotRootOnly", false,
 		"If true, snapshot only the root volume")
+	snapshotsToKeep = flag.Uint("snapshotsToKeep", 1,
+		"Number of scheduled snapshots to retain")
 	traceMetadata = flag.Bool("traceMetadata", false,
 		"If true, trace metadata calls until interrupted")
 	userDataFile = flag.String("userDataFile", "",
@@ -183,6 +212,10 @@ var (
 func init() {
 	flag.Var(&architectureType, "architectureType",
 		"Type of CPU architecture to emulate (default auto/Hypervisor native)")
+	flag.Var(&backupChunkSize, "backupChunkSize",
+		"Size of chunks when backing up VM volumes (default 4 MiB)")
+	flag.Var(&cloudInitSeedVolume, "cloudInitSeedVolume",
+		"type of cloud-init seed volume to attach: nocloud or configdrive (default none)")
 	flag.Var(&consoleType, "consoleType",
 		"type of graphical console (default none)")
 	flag.Var(&firmwareType, "firmwareType",
@@ -203,6 +236,8 @@ func init() {
 	flag.Var(&ownerGroups, "ownerGroups", "Groups who own the VM")
 	flag.Var(&ownerUsers, "ownerUsers", "Extra users who own the VM")
 	flag.Var(&requestIPs, "requestIPs", "Request specific IPs, if available")
+	flag.Var(&restartPolicy, "restartPolicy",
+		"Automatic restart policy for crashed/stopped VM (default never)")
 	flag.Var(&secondarySubnetIDs, "secondarySubnetIDs", "Secondary Subnet IDs")
 	flag.Var(&secondaryVolumeSizes, "secondaryVolumeSizes",
 		"Sizes for secondary volumes")
@@ -235,6 +270,7 @@ func printUsage() {
 
 var subcommands = []commands.Command{
 	{"add-vm-volumes", "IPaddr", 1, 1, addVmVolumesSubcommand},
+	{"backup-vm", "IPaddr", 1, 1, backupVmSubcommand},
 	{"become-primary-vm-owner", "IPaddr", 1, 1, becomePrimaryVmOwnerSubcommand},
 	{"change-vm-console-type", "IPaddr", 1, 1, changeVmConsoleTypeSubcommand},
 	{"change-vm-cpu-priority", "IPaddr", 1, 1, changeVmCpuPrioritySubcommand},
@@ -244,10 +280,16 @@ var subcommands = []commands.Command{
 	{"change-vm-hostname", "IPaddr", 1, 1, changeVmHostnameSubcommand},
 	{"change-vm-machine-type", "IPaddr", 1, 1, changeVmMachineTypeSubcommand},
 	{"change-vm-memory", "IPaddr", 1, 1, changeVmMemorySubcommand},
+	{"change-vm-network-limits", "IPaddr", 1, 1,
+		changeVmNetworkLimitsSubcommand},
 	{"change-vm-num-network-queues", "IPaddr", 1, 1,
 		changeVmNumNetworkQueuesSubcommand},
 	{"change-vm-owner-groups", "IPaddr", 1, 1, changeVmOwnerGroupsSubcommand},
 	{"change-vm-owner-users", "IPaddr", 1, 1, changeVmOwnerUsersSubcommand},
+	{"change-vm-restart-policy", "IPaddr", 1, 1,
+		changeVmRestartPolicySubcommand},
+	{"change-vm-snapshot-schedule", "IPaddr", 1, 1,
+		changeVmSnapshotScheduleSubcommand},
 	{"change-vm-subnet", "IPaddr", 1, 1, changeVmSubnetSubcommand},
 	{"change-vm-tags", "IPaddr", 1, 1, changeVmTagsSubcommand},
 	{"change-vm-vcpus", "IPaddr", 1, 1, changeVmVirtualCPUsSubcommand},
@@ -290,6 +332,8 @@ var subcommands = []commands.Command{
 		importVirshVmSubcommand},
 	{"list-hypervisors", "", 0, 0, listHypervisorsSubcommand},
 	{"list-locations", "[TopLocation]", 0, 1, listLocationsSubcommand},
+	{"list-vm-backups", "IPaddr", 1, 1, listVmBackupsSubcommand},
+	{"list-vm-snapshots", "IPaddr", 1, 1, listVmSnapshotsSubcommand},
 	{"list-vm-virtualiser-log-files", "IPaddr", 1, 1,
 		listVmVirtualiserLogFilesSubcommand},
 	{"list-vms", "", 0, 0, listVMsSubcommand},
@@ -306,6 +350,8 @@ var subcommands = []commands.Command{
 	{"replace-vm-image", "IPaddr", 1, 1, replaceVmImageSubcommand},
 	{"replace-vm-user-data", "IPaddr", 1, 1, replaceVmUserDataSubcommand},
 	{"restore-vm", "source", 1, 1, restoreVmSubcommand},
+	{"restore-vm-from-backup", "image-name|manifest-hash", 1, 1,
+		restoreVmFromBackupSubcommand},
 	{"restore-vm-from-snapshot", "IPaddr", 1, 1,
 		restoreVmFromSnapshotSubcommand},
 	{"restore-vm-image", "IPaddr", 1, 1, restoreVmImageSubcommand},
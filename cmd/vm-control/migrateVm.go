@@ -63,6 +63,7 @@ func migrateVmFromHypervisor(sourceHypervisorAddress string, vmIP net.IP,
 	request := hyper_proto.MigrateVmRequest{
 		AccessToken:      accessToken,
 		IpAddress:        vmIP,
+		Live:             *liveMigration,
 		SkipMemoryCheck:  *skipMemoryCheck,
 		SourceHypervisor: sourceHypervisorAddress,
 	}
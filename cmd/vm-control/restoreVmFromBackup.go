@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	imgclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type backupRestorer struct {
+	manifest proto.BackupManifest
+	objSrv   objectserver.ObjectsGetter
+}
+
+type backupVolumeReader struct {
+	numChunks     int
+	objectsReader objectserver.ObjectsReader
+	reader        io.ReadCloser
+}
+
+func restoreVmFromBackupSubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := restoreVmFromBackup(args[0], logger); err != nil {
+		return fmt.Errorf("error restoring VM from backup: %s", err)
+	}
+	return nil
+}
+
+// getBackupManifestHash returns the hash of the manifest for the backup
+// referenced by the specified image, or the manifest hash itself.
+func getBackupManifestHash(client srpc.ClientI, backup string) (
+	hash.Hash, error) {
+	var hashVal hash.Hash
+	if err := hashVal.UnmarshalText([]byte(backup)); err == nil {
+		return hashVal, nil
+	}
+	img, err := imgclient.GetImage(client, backup)
+	if err != nil {
+		return hashVal, err
+	}
+	if img == nil {
+		return hashVal, fmt.Errorf("image: %s not found", backup)
+	}
+	for _, dirent := range img.FileSystem.EntryList {
+		if dirent.Name != proto.BackupManifestFilename {
+			continue
+		}
+		inode := img.FileSystem.InodeTable[dirent.InodeNumber]
+		regularInode, ok := inode.(*filesystem.RegularInode)
+		if !ok {
+			break
+		}
+		return regularInode.Hash, nil
+	}
+	return hashVal, fmt.Errorf("image: %s is not a backup", backup)
+}
+
+func restoreVmFromBackup(backup string, logger log.DebugLogger) error {
+	client, err := getImageServerClient()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return errors.New("no image server specified")
+	}
+	hashVal, err := getBackupManifestHash(client, backup)
+	if err != nil {
+		return err
+	}
+	objClient := objectclient.AttachObjectClient(client)
+	defer objClient.Close()
+	logger.Debugln(0, "reading manifest")
+	_, reader, err := objClient.GetObject(hashVal)
+	if err != nil {
+		return err
+	}
+	restorer := &backupRestorer{objSrv: objClient}
+	err = json.NewDecoder(reader).Decode(&restorer.manifest)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	vmInfo := restorer.manifest.VmInfo
+	if len(vmInfo.Volumes) < 1 ||
+		len(vmInfo.Volumes) != len(restorer.manifest.Volumes) {
+		return errors.New("mismatched volumes in backup manifest")
+	}
+	vmInfo.ImageName = ""
+	vmInfo.ImageURL = ""
+	var userData []byte
+	if restorer.manifest.UserData != nil {
+		userData, err = readFromVmRestorer(restorer, "user-data.raw")
+		if err != nil {
+			return err
+		}
+	}
+	request := proto.CreateVmRequest{
+		DhcpTimeout:          *dhcpTimeout,
+		ImageDataSize:        restorer.manifest.Volumes[0].Size,
+		SecondaryVolumes:     vmInfo.Volumes[1:],
+		SecondaryVolumesData: true,
+		UserDataSize:         uint64(len(userData)),
+		VmInfo:               vmInfo,
+	}
+	hypervisor, err := getHypervisorAddress(request.VmInfo, logger)
+	if err != nil {
+		return err
+	}
+	logger.Debugf(0, "restoring VM on %s from backup created on %s\n",
+		hypervisor, restorer.manifest.CreatedOn)
+	return restoreVmOnHypervisor(hypervisor, request, restorer, userData,
+		backup, logger)
+}
+
+func (restorer *backupRestorer) Close() error {
+	return nil
+}
+
+// OpenReader will open a reader for the chunks of the volume or user data
+// with the specified filename, using the same filenames as save-vm.
+func (restorer *backupRestorer) OpenReader(filename string) (
+	io.ReadCloser, uint64, error) {
+	var volume *proto.BackupVolume
+	if filename == "root" {
+		volume = &restorer.manifest.Volumes[0]
+	} else if filename == "user-data.raw" {
+		volume = restorer.manifest.UserData
+	} else if suffix := strings.TrimPrefix(filename,
+		"secondary-volume."); suffix != filename {
+		index, err := strconv.ParseUint(suffix, 10, 32)
+		if err != nil {
+			return nil, 0, err
+		}
+		if index+1 < uint64(len(restorer.manifest.Volumes)) {
+			volume = &restorer.manifest.Volumes[index+1]
+		}
+	}
+	if volume == nil {
+		return nil, 0, &os.PathError{
+			Op:   "open",
+			Path: filename,
+			Err:  os.ErrNotExist,
+		}
+	}
+	objectsReader, err := restorer.objSrv.GetObjects(volume.Chunks)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &backupVolumeReader{
+		numChunks:     len(volume.Chunks),
+		objectsReader: objectsReader,
+	}, volume.Size, nil
+}
+
+func (r *backupVolumeReader) Close() error {
+	if r.reader != nil {
+		r.reader.Close()
+	}
+	return r.objectsReader.Close()
+}
+
+func (r *backupVolumeReader) Read(p []byte) (int, error) {
+	for {
+		if r.reader == nil {
+			if r.numChunks < 1 {
+				return 0, io.EOF
+			}
+			_, reader, err := r.objectsReader.NextObject()
+			if err != nil {
+				return 0, err
+			}
+			r.numChunks--
+			r.reader = reader
+		}
+		nRead, err := r.reader.Read(p)
+		if err == io.EOF {
+			r.reader.Close()
+			r.reader = nil
+			if nRead < 1 {
+				continue
+			}
+			err = nil
+		}
+		return nRead, err
+	}
+}
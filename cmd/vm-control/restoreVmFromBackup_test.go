@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	memoryobjserver "github.com/Cloud-Foundations/Dominator/lib/objectserver/memory"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const testChunkSize = 4096
+
+// addBackupVolume will store data in chunks in objSrv, the same way as the
+// Hypervisor does.
+func addBackupVolume(t *testing.T, objSrv *memoryobjserver.ObjectServer,
+	data []byte) proto.BackupVolume {
+	volume := proto.BackupVolume{Size: uint64(len(data))}
+	for offset := 0; offset < len(data); offset += testChunkSize {
+		end := offset + testChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		hashVal, _, err := objSrv.AddObject(
+			bytes.NewReader(data[offset:end]), uint64(end-offset), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		volume.Chunks = append(volume.Chunks, hashVal)
+	}
+	return volume
+}
+
+func makeTestVolumeData(size int, seed byte) []byte {
+	data := make([]byte, size)
+	for index := range data {
+		data[index] = byte(index/testChunkSize) + seed
+	}
+	return data
+}
+
+func readBackupFile(t *testing.T, restorer *backupRestorer,
+	filename string) []byte {
+	reader, size, err := restorer.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(data)) != size {
+		t.Errorf("%s: read %d bytes, size %d", filename, len(data), size)
+	}
+	return data
+}
+
+func TestRestoreFromBackup(t *testing.T) {
+	objSrv := memoryobjserver.NewObjectServer()
+	rootData := makeTestVolumeData(3*testChunkSize+100, 1)
+	// Identical chunks are stored once but must be restored for each use.
+	secondaryData := makeTestVolumeData(2*testChunkSize, 1)
+	userData := []byte("#cloud-config\n")
+	restorer := &backupRestorer{
+		manifest: proto.BackupManifest{
+			ChunkSize: testChunkSize,
+			Volumes: []proto.BackupVolume{
+				addBackupVolume(t, objSrv, rootData),
+				addBackupVolume(t, objSrv, secondaryData),
+			},
+		},
+		objSrv: objSrv,
+	}
+	userDataVolume := addBackupVolume(t, objSrv, userData)
+	restorer.manifest.UserData = &userDataVolume
+	for _, test := range []struct {
+		filename string
+		want     []byte
+	}{
+		{"root", rootData},
+		{"secondary-volume.0", secondaryData},
+		{"user-data.raw", userData},
+	} {
+		got := readBackupFile(t, restorer, test.filename)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: restored data differ", test.filename)
+		}
+	}
+	if _, _, err := restorer.OpenReader("secondary-volume.1"); err == nil {
+		t.Error("missing volume opened")
+	} else if !os.IsNotExist(err) {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestGetBackupManifestHash(t *testing.T) {
+	want := hash.Hash{1, 2, 3}
+	got, err := getBackupManifestHash(nil, fmt.Sprintf("%x", want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("getBackupManifestHash() = %x, want %x", got, want)
+	}
+}
@@ -30,6 +30,7 @@ func snapshotVmOnHypervisor(hypervisor string, ipAddr net.IP,
 		IpAddress:         ipAddr,
 		ForceIfNotStopped: *forceIfNotStopped,
 		Name:              *snapshotName,
+		Quiesce:           *quiesce,
 		RootOnly:          *snapshotRootOnly,
 	}
 	client, err := dialHypervisor(hypervisor)
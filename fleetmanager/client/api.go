@@ -1,6 +1,7 @@
 package client
 
 import (
+	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 )
@@ -14,6 +15,14 @@ func CancelAllocation(client srpc.ClientI, requestId proto.RequestId) error {
 	return cancelAllocation(client, requestId)
 }
 
+// EvacuateHypervisor will request the Fleet Manager to migrate all the VMs off
+// a Hypervisor. Progress messages are logged. An error is returned if any VM
+// could not be migrated.
+func EvacuateHypervisor(client srpc.ClientI,
+	request proto.EvacuateHypervisorRequest, logger log.DebugLogger) error {
+	return evacuateHypervisor(client, request, logger)
+}
+
 func PowerOnMachine(client srpc.ClientI, hostname string) error {
 	return powerOnMachine(client, hostname)
 }
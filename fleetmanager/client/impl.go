@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 )
@@ -39,6 +40,44 @@ func cancelAllocation(client srpc.ClientI, requestId proto.RequestId) error {
 	return nil
 }
 
+func evacuateHypervisor(client srpc.ClientI,
+	request proto.EvacuateHypervisorRequest, logger log.DebugLogger) error {
+	conn, err := client.Call("FleetManager.EvacuateHypervisor")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Encode(request); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for {
+		var reply proto.EvacuateHypervisorResponse
+		if err := conn.Decode(&reply); err != nil {
+			return err
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		if reply.VmError != "" {
+			logger.Printf("%s: migration failed: %s\n",
+				reply.VmIpAddress, reply.VmError)
+		} else if reply.ProgressMessage != "" {
+			if len(reply.VmIpAddress) > 0 {
+				logger.Debugf(0, "%s: %s\n",
+					reply.VmIpAddress, reply.ProgressMessage)
+			} else {
+				logger.Debugln(0, reply.ProgressMessage)
+			}
+		}
+		if reply.Final {
+			return nil
+		}
+	}
+}
+
 func powerOnMachine(client srpc.ClientI, hostname string) error {
 	request := proto.PowerOnMachineRequest{Hostname: hostname}
 	var reply proto.PowerOnMachineResponse
@@ -61,6 +61,13 @@ type ipStorer interface {
 	UnregisterHypervisor(hypervisor net.IP) error
 }
 
+// ipv6PairType is an address in the address pool of a Hypervisor which has
+// both IPv4 and IPv6 addresses.
+type ipv6PairType struct {
+	address    hyper_proto.Address
+	hypervisor *hypervisorType // Which registered the address.
+}
+
 type locationType struct {
 	notifiers map[<-chan fm_proto.Update]chan<- fm_proto.Update
 }
@@ -77,6 +84,7 @@ type Manager struct {
 	hypervisorsByHW  map[string]*hypervisorType // Key: hypervisor HW addr.
 	hypervisorsByIP  map[string]*hypervisorType // Key: hypervisor IP.
 	hypervisorsBySN  map[string]*hypervisorType // Key: serial number, nil: dup
+	ipv6Pairs        map[string]ipv6PairType    // Key: IPv4 or IPv6 address.
 	locations        map[string]*locationType   // Key: location.
 	migratingIPs     map[string]struct{}        // Key: VM IP address.
 	notifiers        map[<-chan fm_proto.Update]*locationType
@@ -147,6 +155,15 @@ func (m *Manager) CloseUpdateChannel(channel <-chan fm_proto.Update) {
 	m.closeUpdateChannel(channel)
 }
 
+// EvacuateHypervisor will disable a Hypervisor and migrate all its VMs to
+// other Hypervisors. Progress is reported by calling reportFunc, which is not
+// called concurrently.
+func (m *Manager) EvacuateHypervisor(request fm_proto.EvacuateHypervisorRequest,
+	authInfo *srpc.AuthInformation,
+	reportFunc func(fm_proto.EvacuateHypervisorResponse) error) error {
+	return m.evacuateHypervisor(request, authInfo, reportFunc)
+}
+
 func (m *Manager) GetHypervisorForVm(ipAddr net.IP) (string, error) {
 	return m.getHypervisorForVm(ipAddr)
 }
@@ -0,0 +1,387 @@
+package hypervisors
+
+import (
+	"errors"
+	"fmt"
+	stdlog "log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log/debuglogger"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const defaultMaximumConcurrentMigrations = 2
+
+type evacuationType struct {
+	manager      *Manager
+	request      fm_proto.EvacuateHypervisorRequest
+	reportFunc   func(fm_proto.EvacuateHypervisorResponse) error
+	source       *hypervisorType
+	sourceAddr   string
+	tagsToMatch  *tagmatcher.TagMatcher
+	mutex        sync.Mutex // Protect everything below.
+	numFailed    uint
+	reportError  error
+	reservations map[*hypervisorType]reservationType // In-flight migrations.
+}
+
+type reservationType struct {
+	memoryInMiB uint64
+	milliCPUs   uint64
+	volumeBytes uint64
+}
+
+// progressWriter sends each line written as a progress message for a VM.
+type progressWriter struct {
+	evacuation *evacuationType
+	ipAddr     net.IP
+}
+
+// checkSameOwners returns true if both machines have the same owners,
+// ignoring order and duplicates.
+func checkSameOwners(left, right *fm_proto.Machine) bool {
+	return checkSameStrings(left.OwnerUsers, right.OwnerUsers) &&
+		checkSameStrings(left.OwnerGroups, right.OwnerGroups)
+}
+
+func checkSameStrings(left, right []string) bool {
+	leftMap := stringutil.ConvertListToMap(left, true)
+	rightMap := stringutil.ConvertListToMap(right, true)
+	if len(leftMap) != len(rightMap) {
+		return false
+	}
+	for entry := range leftMap {
+		if _, ok := rightMap[entry]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) evacuateHypervisor(request fm_proto.EvacuateHypervisorRequest,
+	authInfo *srpc.AuthInformation,
+	reportFunc func(fm_proto.EvacuateHypervisorResponse) error) error {
+	if !*manageHypervisors {
+		return errors.New("this is a read-only Fleet Manager")
+	}
+	source, err := m.getLockedHypervisor(request.HypervisorHostname, false)
+	if err != nil {
+		return err
+	}
+	err = source.checkAuth(authInfo)
+	probeStatus := source.probeStatus
+	sourceAddr := source.address()
+	vms := make([]hyper_proto.VmInfo, 0, len(source.vms))
+	for _, vm := range source.vms {
+		vms = append(vms, vm.VmInfo)
+	}
+	source.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	if probeStatus != probeStatusConnected {
+		return fmt.Errorf("%s is %s", request.HypervisorHostname, probeStatus)
+	}
+	e := &evacuationType{
+		manager:      m,
+		request:      request,
+		reportFunc:   reportFunc,
+		source:       source,
+		sourceAddr:   sourceAddr,
+		tagsToMatch:  tagmatcher.New(request.HypervisorTagsToMatch, false),
+		reservations: make(map[*hypervisorType]reservationType),
+	}
+	if err := e.disableSource(); err != nil {
+		return err
+	}
+	if len(vms) < 1 {
+		return e.report(fm_proto.EvacuateHypervisorResponse{
+			ProgressMessage: "no VMs to migrate"})
+	}
+	// Place the largest VMs first, since they are the hardest to fit.
+	sort.SliceStable(vms, func(i, j int) bool {
+		return vms[i].MemoryInMiB > vms[j].MemoryInMiB
+	})
+	err = e.report(fm_proto.EvacuateHypervisorResponse{
+		ProgressMessage: fmt.Sprintf("migrating %d VMs", len(vms))})
+	if err != nil {
+		return err
+	}
+	maxConcurrent := request.MaximumConcurrentMigrations
+	if maxConcurrent < 1 {
+		maxConcurrent = defaultMaximumConcurrentMigrations
+	}
+	semaphore := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	for _, vm := range vms {
+		semaphore <- struct{}{}
+		if err := e.getReportError(); err != nil {
+			break // Client has gone away: do not start any more migrations.
+		}
+		wg.Add(1)
+		go func(vm hyper_proto.VmInfo) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			e.migrateVm(vm)
+		}(vm)
+	}
+	wg.Wait()
+	if err := e.getReportError(); err != nil {
+		return err
+	}
+	if e.numFailed > 0 {
+		return fmt.Errorf("%d of %d VMs failed to migrate",
+			e.numFailed, len(vms))
+	}
+	return nil
+}
+
+// disableSource will disable the Hypervisor being evacuated so that no new VMs
+// are created on it.
+func (e *evacuationType) disableSource() error {
+	client, err := srpc.DialHTTP("tcp", e.sourceAddr, time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := hyperclient.SetDisabledState(client, true); err != nil {
+		return err
+	}
+	return e.report(fm_proto.EvacuateHypervisorResponse{
+		ProgressMessage: "disabled " + e.request.HypervisorHostname})
+}
+
+func (e *evacuationType) getReportError() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.reportError
+}
+
+// migrateVm will migrate a VM to a selected destination, reporting progress.
+func (e *evacuationType) migrateVm(vm hyper_proto.VmInfo) {
+	ipAddr := vm.Address.IpAddress
+	destination, err := e.selectDestination(vm)
+	if err != nil {
+		e.reportVmError(ipAddr, "", err)
+		return
+	}
+	defer e.release(destination, vm)
+	destHostname := destination.getMachine().Hostname
+	e.report(fm_proto.EvacuateHypervisorResponse{
+		DestinationHypervisor: destHostname,
+		ProgressMessage:       "migrating to " + destHostname,
+		VmIpAddress:           ipAddr,
+	})
+	startTime := time.Now()
+	if err := e.migrateVmTo(vm, destination); err != nil {
+		e.reportVmError(ipAddr, destHostname, err)
+		return
+	}
+	e.report(fm_proto.EvacuateHypervisorResponse{
+		DestinationHypervisor: destHostname,
+		ProgressMessage: fmt.Sprintf("migrated to %s in %s",
+			destHostname, time.Since(startTime).Round(time.Millisecond)),
+		VmIpAddress: ipAddr,
+	})
+}
+
+func (e *evacuationType) migrateVmTo(vm hyper_proto.VmInfo,
+	destination *hypervisorType) error {
+	ipAddr := vm.Address.IpAddress
+	if vm.State == hyper_proto.StateMigrating {
+		return errors.New("VM is already migrating")
+	}
+	sourceClient, err := srpc.DialHTTP("tcp", e.sourceAddr, time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer sourceClient.Close()
+	accessToken, err := hyperclient.GetVmAccessToken(sourceClient, ipAddr,
+		time.Hour*24)
+	if err != nil {
+		return err
+	}
+	defer hyperclient.DiscardVmAccessToken(sourceClient, ipAddr, accessToken)
+	destClient, err := srpc.DialHTTP("tcp", destination.address(),
+		time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer destClient.Close()
+	logger := debuglogger.New(stdlog.New(&progressWriter{e, ipAddr}, "", 0))
+	logger.SetLevel(0)
+	request := hyper_proto.MigrateVmRequest{
+		AccessToken:      accessToken,
+		IpAddress:        ipAddr,
+		Live:             e.request.LiveMigration,
+		SourceHypervisor: e.sourceAddr,
+	}
+	return hyperclient.MigrateVm(destClient, request,
+		func() bool { return true }, logger)
+}
+
+// release will release the capacity reserved on the destination for the VM.
+func (e *evacuationType) release(destination *hypervisorType,
+	vm hyper_proto.VmInfo) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	reservation := e.reservations[destination]
+	reservation.memoryInMiB -= vm.MemoryInMiB
+	reservation.milliCPUs -= uint64(vm.MilliCPUs)
+	reservation.volumeBytes -= vm.TotalStorage()
+	if reservation == (reservationType{}) {
+		delete(e.reservations, destination)
+	} else {
+		e.reservations[destination] = reservation
+	}
+}
+
+func (e *evacuationType) report(
+	response fm_proto.EvacuateHypervisorResponse) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.reportError != nil {
+		return e.reportError
+	}
+	e.reportError = e.reportFunc(response)
+	return e.reportError
+}
+
+func (e *evacuationType) reportVmError(ipAddr net.IP, destination string,
+	err error) {
+	e.manager.logger.Printf("error evacuating VM: %s from: %s: %s\n",
+		ipAddr, e.request.HypervisorHostname, err)
+	e.mutex.Lock()
+	e.numFailed++
+	e.mutex.Unlock()
+	e.report(fm_proto.EvacuateHypervisorResponse{
+		DestinationHypervisor: destination,
+		VmError:               err.Error(),
+		VmIpAddress:           ipAddr,
+	})
+}
+
+// selectDestination will select the destination Hypervisor with the most free
+// memory which satisfies the constraints for the VM, and will reserve capacity
+// for the VM.
+func (e *evacuationType) selectDestination(vm hyper_proto.VmInfo) (
+	*hypervisorType, error) {
+	sourceMachine := e.source.getMachine()
+	e.source.mutex.RLock()
+	architectureType := e.source.ArchitectureType
+	e.source.mutex.RUnlock()
+	hypervisors, err := e.manager.listHypervisors(e.request.Location, showOK,
+		vm.SubnetId, architectureType, e.tagsToMatch)
+	if err != nil {
+		return nil, err
+	}
+	if len(vm.SecondarySubnetIDs) > 0 {
+		hypervisors = e.manager.filterHypervisorsWithSubnets(hypervisors,
+			vm.SecondarySubnetIDs)
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var bestHypervisor *hypervisorType
+	var bestFreeMemory uint64
+	for _, h := range hypervisors {
+		if h == e.source {
+			continue
+		}
+		freeMemory, ok := e.checkDestination(h, sourceMachine, vm)
+		if !ok {
+			continue
+		}
+		if bestHypervisor == nil || freeMemory > bestFreeMemory {
+			bestHypervisor = h
+			bestFreeMemory = freeMemory
+		}
+	}
+	if bestHypervisor == nil {
+		return nil, errors.New("no Hypervisor with sufficient capacity")
+	}
+	reservation := e.reservations[bestHypervisor]
+	reservation.memoryInMiB += vm.MemoryInMiB
+	reservation.milliCPUs += uint64(vm.MilliCPUs)
+	reservation.volumeBytes += vm.TotalStorage()
+	e.reservations[bestHypervisor] = reservation
+	return bestHypervisor, nil
+}
+
+// checkDestination returns the free memory (in MiB) on the Hypervisor after
+// placing the VM and true if the VM may be placed on the Hypervisor. The
+// Hypervisor must have the same owners as the source Hypervisor, so that VMs
+// are not moved onto or off dedicated Hypervisors. The evacuation lock must be
+// held.
+func (e *evacuationType) checkDestination(h *hypervisorType,
+	sourceMachine *fm_proto.Machine, vm hyper_proto.VmInfo) (uint64, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.disabled {
+		return 0, false
+	}
+	if !checkSameOwners(&h.Machine, sourceMachine) {
+		return 0, false
+	}
+	reservation := e.reservations[h]
+	allocatedMemory := h.AllocatedMemory + reservation.memoryInMiB
+	if vm.MemoryInMiB+allocatedMemory > h.MemoryInMiB {
+		return 0, false
+	}
+	if h.AvailableMemory > 0 &&
+		vm.MemoryInMiB+reservation.memoryInMiB >= h.AvailableMemory {
+		return 0, false
+	}
+	if uint64(vm.MilliCPUs)+h.AllocatedMilliCPUs+reservation.milliCPUs >
+		uint64(h.NumCPUs*1000) {
+		return 0, false
+	}
+	if vm.TotalStorage()+h.AllocatedVolumeBytes+reservation.volumeBytes >
+		h.TotalVolumeBytes {
+		return 0, false
+	}
+	if numFree, ok := h.NumFreeAddresses[vm.SubnetId]; ok && numFree < 1 {
+		return 0, false
+	}
+	return h.MemoryInMiB - allocatedMemory - vm.MemoryInMiB, true
+}
+
+func (m *Manager) filterHypervisorsWithSubnets(hypervisors []*hypervisorType,
+	subnetIDs []string) []*hypervisorType {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	filtered := make([]*hypervisorType, 0, len(hypervisors))
+	for _, h := range hypervisors {
+		hasAllSubnets := true
+		for _, subnetId := range subnetIDs {
+			hasSubnet, _ := m.topology.CheckIfMachineHasSubnet(
+				h.Machine.Hostname, subnetId)
+			if !hasSubnet {
+				hasAllSubnets = false
+				break
+			}
+		}
+		if hasAllSubnets {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.evacuation.report(fm_proto.EvacuateHypervisorResponse{
+		ProgressMessage: strings.TrimSpace(string(p)),
+		VmIpAddress:     w.ipAddr,
+	})
+	return len(p), nil
+}
@@ -0,0 +1,254 @@
+package hypervisors
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/fleetmanager/topology"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const testGiB = 1 << 30
+
+func makeTestHypervisor(hostname string, ipAddr byte, memoryInMiB uint64,
+	numCPUs uint, totalVolumeBytes uint64) *hypervisorType {
+	h := &hypervisorType{probeStatus: probeStatusConnected}
+	h.Machine = fm_proto.Machine{
+		MachineData: fm_proto.MachineData{
+			MemoryInMiB:      memoryInMiB,
+			NumCPUs:          numCPUs,
+			TotalVolumeBytes: totalVolumeBytes,
+		},
+		NetworkEntry: fm_proto.NetworkEntry{
+			Hostname:      hostname,
+			HostIpAddress: net.IPv4(10, 0, 0, ipAddr).To4(),
+		},
+	}
+	return h
+}
+
+func makeTestVm(memoryInMiB uint64, milliCPUs uint,
+	volumeSize uint64) hyper_proto.VmInfo {
+	return hyper_proto.VmInfo{
+		Address:     hyper_proto.Address{IpAddress: net.IPv4(10, 1, 0, 1)},
+		MemoryInMiB: memoryInMiB,
+		MilliCPUs:   milliCPUs,
+		Volumes:     []hyper_proto.Volume{{Size: volumeSize}},
+	}
+}
+
+// newTestEvacuation will create an evacuation of the source Hypervisor, with
+// the destination Hypervisors in the topology.
+func newTestEvacuation(t *testing.T, source *hypervisorType,
+	destinations ...*hypervisorType) *evacuationType {
+	topologyDir := t.TempDir()
+	hypervisors := append([]*hypervisorType{source}, destinations...)
+	machines := make([]fm_proto.Machine, 0, len(hypervisors))
+	hypervisorsMap := make(map[string]*hypervisorType, len(hypervisors))
+	for _, h := range hypervisors {
+		machines = append(machines, fm_proto.Machine{
+			NetworkEntry: h.Machine.NetworkEntry})
+		hypervisorsMap[h.Machine.Hostname] = h
+	}
+	err := json.WriteToFile(filepath.Join(topologyDir, "machines.json"),
+		fsutil.PublicFilePerms, "    ", machines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo, err := topology.Load(topologyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := &Manager{
+		hypervisors: hypervisorsMap,
+		logger:      testlogger.New(t),
+		topology:    topo,
+	}
+	return &evacuationType{
+		manager: manager,
+		reportFunc: func(fm_proto.EvacuateHypervisorResponse) error {
+			return nil
+		},
+		source:       source,
+		sourceAddr:   source.address(),
+		reservations: make(map[*hypervisorType]reservationType),
+	}
+}
+
+func TestCheckDestination(t *testing.T) {
+	var tests = []struct {
+		name        string
+		setup       func(h *hypervisorType)
+		reservation reservationType
+		vm          hyper_proto.VmInfo
+		wantFree    uint64
+		wantOk      bool
+	}{
+		{"fits", nil, reservationType{}, makeTestVm(1024, 1000, testGiB),
+			3072, true},
+		{"fits with reservation", nil,
+			reservationType{memoryInMiB: 2048, milliCPUs: 1000},
+			makeTestVm(1024, 1000, testGiB), 1024, true},
+		{"disabled", func(h *hypervisorType) { h.disabled = true },
+			reservationType{}, makeTestVm(1024, 1000, testGiB), 0, false},
+		{"different owners",
+			func(h *hypervisorType) { h.Machine.OwnerUsers = []string{"bob"} },
+			reservationType{}, makeTestVm(1024, 1000, testGiB), 0, false},
+		{"memory exhausted", func(h *hypervisorType) {
+			h.AllocatedMemory = 3584
+		}, reservationType{}, makeTestVm(1024, 1000, testGiB), 0, false},
+		{"memory exhausted by reservation", nil,
+			reservationType{memoryInMiB: 3584},
+			makeTestVm(1024, 1000, testGiB), 0, false},
+		{"available memory exhausted", func(h *hypervisorType) {
+			h.AvailableMemory = 1024
+		}, reservationType{}, makeTestVm(1024, 1000, testGiB), 0, false},
+		{"CPUs exhausted", func(h *hypervisorType) {
+			h.AllocatedMilliCPUs = 1500
+		}, reservationType{milliCPUs: 500},
+			makeTestVm(1024, 1000, testGiB), 0, false},
+		{"storage exhausted", func(h *hypervisorType) {
+			h.AllocatedVolumeBytes = 9 * testGiB
+		}, reservationType{volumeBytes: testGiB},
+			makeTestVm(1024, 1000, testGiB), 0, false},
+		{"no free addresses", func(h *hypervisorType) {
+			h.NumFreeAddresses = map[string]uint{"": 0}
+		}, reservationType{}, makeTestVm(1024, 1000, testGiB), 0, false},
+	}
+	source := makeTestHypervisor("source", 1, 4096, 2, 10*testGiB)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := makeTestHypervisor("dest", 2, 4096, 2, 10*testGiB)
+			if test.setup != nil {
+				test.setup(h)
+			}
+			e := &evacuationType{
+				reservations: map[*hypervisorType]reservationType{
+					h: test.reservation,
+				},
+			}
+			free, ok := e.checkDestination(h, source.getMachine(), test.vm)
+			if ok != test.wantOk {
+				t.Fatalf("checkDestination() ok = %t, want %t",
+					ok, test.wantOk)
+			}
+			if free != test.wantFree {
+				t.Errorf("checkDestination() free = %d, want %d",
+					free, test.wantFree)
+			}
+		})
+	}
+}
+
+func TestSelectDestination(t *testing.T) {
+	var tests = []struct {
+		name     string
+		vms      []hyper_proto.VmInfo
+		wantDest []string // Empty string: no destination.
+	}{
+		{"most free memory", []hyper_proto.VmInfo{
+			makeTestVm(1024, 500, testGiB),
+		}, []string{"big"}},
+		{"spread by reservations", []hyper_proto.VmInfo{
+			makeTestVm(3072, 500, testGiB),
+			makeTestVm(2048, 500, testGiB),
+			makeTestVm(1024, 500, testGiB),
+		}, []string{"big", "small", "big"}},
+		{"capacity exhausted", []hyper_proto.VmInfo{
+			makeTestVm(4096, 500, testGiB),
+			makeTestVm(3072, 500, testGiB),
+			makeTestVm(2560, 500, testGiB),
+		}, []string{"big", "small", ""}},
+		{"too large", []hyper_proto.VmInfo{
+			makeTestVm(8192, 500, testGiB),
+		}, []string{""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := makeTestHypervisor("source", 1, 16384, 8, 100*testGiB)
+			big := makeTestHypervisor("big", 2, 6144, 4, 100*testGiB)
+			small := makeTestHypervisor("small", 3, 4096, 4, 100*testGiB)
+			disabled := makeTestHypervisor("disabled", 4, 65536, 8,
+				100*testGiB)
+			disabled.disabled = true
+			e := newTestEvacuation(t, source, big, small, disabled)
+			for index, vm := range test.vms {
+				dest, err := e.selectDestination(vm)
+				var destName string
+				if err == nil {
+					destName = dest.Machine.Hostname
+				}
+				if destName != test.wantDest[index] {
+					t.Fatalf("VM %d: destination = %q, want %q (err: %v)",
+						index, destName, test.wantDest[index], err)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseReservation(t *testing.T) {
+	source := makeTestHypervisor("source", 1, 16384, 8, 100*testGiB)
+	dest := makeTestHypervisor("dest", 2, 4096, 4, 100*testGiB)
+	e := newTestEvacuation(t, source, dest)
+	vm0 := makeTestVm(2048, 1000, testGiB)
+	vm1 := makeTestVm(2048, 500, 2*testGiB)
+	for _, vm := range []hyper_proto.VmInfo{vm0, vm1} {
+		if _, err := e.selectDestination(vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The destination is full until a reservation is released.
+	if _, err := e.selectDestination(vm0); err == nil {
+		t.Fatal("selected a destination with exhausted capacity")
+	}
+	e.release(dest, vm0)
+	want := reservationType{memoryInMiB: 2048, milliCPUs: 500,
+		volumeBytes: 2 * testGiB}
+	if got := e.reservations[dest]; got != want {
+		t.Fatalf("reservation = %+v, want %+v", got, want)
+	}
+	if _, err := e.selectDestination(vm0); err != nil {
+		t.Fatalf("no destination after release: %s", err)
+	}
+	e.release(dest, vm0)
+	e.release(dest, vm1)
+	if _, ok := e.reservations[dest]; ok {
+		t.Fatal("empty reservation not deleted")
+	}
+}
+
+func TestFailedMigrationReleasesReservation(t *testing.T) {
+	source := makeTestHypervisor("source", 1, 16384, 8, 100*testGiB)
+	dest := makeTestHypervisor("dest", 2, 4096, 4, 100*testGiB)
+	e := newTestEvacuation(t, source, dest)
+	// Point the evacuation at a closed port so that the migration fails.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.sourceAddr = listener.Addr().String()
+	listener.Close()
+	var vmErrors []string
+	e.reportFunc = func(response fm_proto.EvacuateHypervisorResponse) error {
+		if response.VmError != "" {
+			vmErrors = append(vmErrors, response.VmError)
+		}
+		return nil
+	}
+	e.migrateVm(makeTestVm(2048, 1000, testGiB))
+	if e.numFailed != 1 {
+		t.Errorf("numFailed = %d, want 1", e.numFailed)
+	}
+	if len(vmErrors) != 1 {
+		t.Errorf("VM errors = %v, want one error", vmErrors)
+	}
+	if len(e.reservations) > 0 {
+		t.Fatalf("reservations not released: %+v", e.reservations)
+	}
+}
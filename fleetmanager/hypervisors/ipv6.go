@@ -0,0 +1,61 @@
+package hypervisors
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Cloud-Foundations/Dominator/fleetmanager/topology"
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+// makeIpv6Address returns the IPv6 address in the IPv6 prefix of the subnet
+// which is added to the address pool with the IPv4 address, or nil if the
+// subnet does not have an IPv6 prefix. The interface identifier is the IPv4
+// address, so the IPv6 addresses are as unique as the IPv4 addresses and
+// cannot collide with autoconfigured (EUI-64) addresses.
+func makeIpv6Address(tSubnet *topology.Subnet, ip net.IP) net.IP {
+	if len(tSubnet.Ipv6Prefix) < 1 {
+		return nil
+	}
+	ipv6Addr := util.CopyIP(tSubnet.Ipv6Prefix.To16())
+	copy(ipv6Addr[12:], ip.To4())
+	return ipv6Addr
+}
+
+// getAddressToMove returns the address in the address pool of a Hypervisor
+// which has the IPv4 or IPv6 address ip, so that the IPv4 and IPv6 addresses
+// are moved together. IPv6 addresses must be registered with a Hypervisor.
+func (m *Manager) getAddressToMove(ip net.IP) (hyper_proto.Address, error) {
+	m.mutex.RLock()
+	pair, ok := m.ipv6Pairs[ip.String()]
+	m.mutex.RUnlock()
+	if ok {
+		return pair.address, nil
+	}
+	if ip.To4() == nil {
+		return hyper_proto.Address{},
+			fmt.Errorf("IPv6 address: %s not registered", ip)
+	}
+	return hyper_proto.Address{IpAddress: ip.To4()}, nil
+}
+
+// setIpv6PairsForHypervisor will replace the addresses with IPv6 addresses
+// registered by the Hypervisor.
+// This must be called with the lock held.
+func (m *Manager) setIpv6PairsForHypervisor(h *hypervisorType,
+	addresses []hyper_proto.Address) {
+	for key, pair := range m.ipv6Pairs {
+		if pair.hypervisor == h {
+			delete(m.ipv6Pairs, key)
+		}
+	}
+	for _, address := range addresses {
+		if len(address.IpAddress) < 1 || len(address.Ipv6Address) < 1 {
+			continue
+		}
+		pair := ipv6PairType{address: address, hypervisor: h}
+		m.ipv6Pairs[address.IpAddress.String()] = pair
+		m.ipv6Pairs[address.Ipv6Address.String()] = pair
+	}
+}
@@ -0,0 +1,126 @@
+package hypervisors
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/fleetmanager/topology"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func makeTestPairAddress(ipAddr, ipv6Addr string) hyper_proto.Address {
+	address := hyper_proto.Address{IpAddress: net.ParseIP(ipAddr).To4()}
+	if ipv6Addr != "" {
+		address.Ipv6Address = net.ParseIP(ipv6Addr)
+	}
+	return address
+}
+
+func TestMakeIpv6Address(t *testing.T) {
+	tSubnet := &topology.Subnet{}
+	ip := net.IPv4(10, 1, 0, 5).To4()
+	if ipv6Addr := makeIpv6Address(tSubnet, ip); ipv6Addr != nil {
+		t.Errorf("IPv6 address: %s for subnet without prefix", ipv6Addr)
+	}
+	tSubnet.Ipv6Prefix = net.ParseIP("2001:db8:1::")
+	ipv6Addr := makeIpv6Address(tSubnet, ip)
+	if want := net.ParseIP("2001:db8:1::a01:5"); !ipv6Addr.Equal(want) {
+		t.Errorf("IPv6 address = %s, want %s", ipv6Addr, want)
+	}
+	if !tSubnet.Ipv6Prefix.Equal(net.ParseIP("2001:db8:1::")) {
+		t.Errorf("prefix modified: %s", tSubnet.Ipv6Prefix)
+	}
+}
+
+func TestGetAddressesToMove(t *testing.T) {
+	m := &Manager{ipv6Pairs: make(map[string]ipv6PairType)}
+	m.setIpv6PairsForHypervisor(&hypervisorType{}, []hyper_proto.Address{
+		makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+		makeTestPairAddress("10.1.0.6", ""),
+	})
+	var tests = []struct {
+		name    string
+		ips     []string
+		want    []hyper_proto.Address
+		wantErr bool
+	}{
+		{"IPv4 address with IPv6 address", []string{"10.1.0.5"},
+			[]hyper_proto.Address{
+				makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+			}, false},
+		{"IPv6 address", []string{"2001:db8:1::a01:5"},
+			[]hyper_proto.Address{
+				makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+			}, false},
+		{"both addresses", []string{"2001:db8:1::a01:5", "10.1.0.5"},
+			[]hyper_proto.Address{
+				makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+			}, false},
+		{"IPv4 address only", []string{"10.1.0.6", "10.1.0.7"},
+			[]hyper_proto.Address{
+				makeTestPairAddress("10.1.0.6", ""),
+				makeTestPairAddress("10.1.0.7", ""),
+			}, false},
+		{"unregistered IPv6 address", []string{"2001:db8:1::a01:6"}, nil,
+			true},
+		{"autoconfigured IPv6 address",
+			[]string{"2001:db8:1:0:5054:aff:fe01:5"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ips := make([]net.IP, 0, len(test.ips))
+			for _, ip := range test.ips {
+				ips = append(ips, net.ParseIP(ip))
+			}
+			addresses, err := m.getAddressesToMove(ips)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("addresses to move: %v", addresses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(addresses, test.want) {
+				t.Errorf("addresses = %v, want %v", addresses, test.want)
+			}
+		})
+	}
+}
+
+func TestSetIpv6PairsForHypervisor(t *testing.T) {
+	m := &Manager{ipv6Pairs: make(map[string]ipv6PairType)}
+	source := &hypervisorType{}
+	destination := &hypervisorType{}
+	m.setIpv6PairsForHypervisor(source, []hyper_proto.Address{
+		makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+		makeTestPairAddress("10.1.0.6", "2001:db8:1::a01:6"),
+	})
+	// Simulate moving an address: it is added to the destination before the
+	// source reports that it was removed.
+	m.setIpv6PairsForHypervisor(destination, []hyper_proto.Address{
+		makeTestPairAddress("10.1.0.6", "2001:db8:1::a01:6"),
+	})
+	m.setIpv6PairsForHypervisor(source, []hyper_proto.Address{
+		makeTestPairAddress("10.1.0.5", "2001:db8:1::a01:5"),
+	})
+	want := map[string]*hypervisorType{
+		"10.1.0.5":          source,
+		"2001:db8:1::a01:5": source,
+		"10.1.0.6":          destination,
+		"2001:db8:1::a01:6": destination,
+	}
+	got := make(map[string]*hypervisorType, len(m.ipv6Pairs))
+	for key, pair := range m.ipv6Pairs {
+		got[key] = pair.hypervisor
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs = %v, want %v", got, want)
+	}
+	m.setIpv6PairsForHypervisor(source, nil)
+	if len(m.ipv6Pairs) != 2 {
+		t.Errorf("%d pairs after deleting source, want 2", len(m.ipv6Pairs))
+	}
+}
@@ -12,7 +12,8 @@ import (
 	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
-func (m *Manager) addIp(hypervisorIpAddress, ip net.IP) error {
+func (m *Manager) addIp(hypervisorIpAddress net.IP,
+	address hyper_proto.Address) error {
 	client, err := srpc.DialHTTP("tcp",
 		fmt.Sprintf("%s:%d",
 			hypervisorIpAddress, constants.HypervisorPortNumber),
@@ -21,9 +22,11 @@ func (m *Manager) addIp(hypervisorIpAddress, ip net.IP) error {
 		return err
 	}
 	defer client.Close()
+	ip := address.IpAddress
 	request := hyper_proto.ChangeAddressPoolRequest{
 		AddressesToAdd: []hyper_proto.Address{{
-			IpAddress: ip,
+			IpAddress:   ip,
+			Ipv6Address: address.Ipv6Address,
 			MacAddress: fmt.Sprintf("52:54:%02x:%02x:%02x:%02x",
 				ip[0], ip[1], ip[2], ip[3]),
 		}},
@@ -36,6 +39,28 @@ func (m *Manager) addIp(hypervisorIpAddress, ip net.IP) error {
 	return errors.New(reply.Error)
 }
 
+// getAddressesToMove returns the addresses to move for the IPv4 and IPv6
+// addresses. IPv6 addresses are moved with the IPv4 address they were added to
+// the address pool with, and are registered using the IPv4 address.
+func (m *Manager) getAddressesToMove(ipAddresses []net.IP) (
+	[]hyper_proto.Address, error) {
+	addresses := make([]hyper_proto.Address, 0, len(ipAddresses))
+	ipsToMove := make(map[string]struct{}, len(ipAddresses))
+	for _, ip := range ipAddresses {
+		address, err := m.getAddressToMove(util.ShrinkIP(ip))
+		if err != nil {
+			return nil, err
+		}
+		ipAddr := address.IpAddress.String()
+		if _, ok := ipsToMove[ipAddr]; ok {
+			continue // Both addresses of a pair were specified.
+		}
+		ipsToMove[ipAddr] = struct{}{}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
 func (m *Manager) getHealthyHypervisorAddr(hostname string) (net.IP, error) {
 	hypervisor, err := m.getLockedHypervisor(hostname, false)
 	if err != nil {
@@ -67,22 +92,28 @@ func (m *Manager) markIPsForMigration(ipAddresses []net.IP) error {
 	return nil
 }
 
-func (m *Manager) moveIpAddresses(hostname string, ipAddresses []net.IP) error {
+func (m *Manager) moveIpAddresses(hostname string,
+	requestedIpAddresses []net.IP) error {
 	if !*manageHypervisors {
 		return errors.New("this is a read-only Fleet Manager")
 	}
-	if len(ipAddresses) < 1 {
+	if len(requestedIpAddresses) < 1 {
 		return nil
 	}
-	sourceHypervisorIPs := make([]net.IP, len(ipAddresses))
-	for index, ip := range ipAddresses {
-		ip = util.ShrinkIP(ip)
-		ipAddresses[index] = ip
-		sourceHypervisorIp, err := m.storer.GetHypervisorForIp(ip)
+	addresses, err := m.getAddressesToMove(requestedIpAddresses)
+	if err != nil {
+		return err
+	}
+	ipAddresses := make([]net.IP, 0, len(addresses))
+	sourceHypervisorIPs := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		sourceHypervisorIp, err := m.storer.GetHypervisorForIp(
+			address.IpAddress)
 		if err != nil {
 			return err
 		}
-		sourceHypervisorIPs[index] = sourceHypervisorIp
+		ipAddresses = append(ipAddresses, address.IpAddress)
+		sourceHypervisorIPs = append(sourceHypervisorIPs, sourceHypervisorIp)
 	}
 	hypervisorIpAddress, err := m.getHealthyHypervisorAddr(hostname)
 	if err != nil {
@@ -93,9 +124,9 @@ func (m *Manager) moveIpAddresses(hostname string, ipAddresses []net.IP) error {
 	}
 	defer m.unmarkIPsForMigration(ipAddresses)
 	// Move IPs.
-	for index, ip := range ipAddresses {
+	for index, address := range addresses {
 		err := m.moveIpAddress(hypervisorIpAddress, sourceHypervisorIPs[index],
-			ip)
+			address)
 		if err != nil {
 			return err
 		}
@@ -123,17 +154,18 @@ func (m *Manager) moveIpAddresses(hostname string, ipAddresses []net.IP) error {
 }
 
 func (m *Manager) moveIpAddress(destinationHypervisorIpAddress,
-	sourceHypervisorIpAddress, ipToMove net.IP) error {
+	sourceHypervisorIpAddress net.IP, addressToMove hyper_proto.Address) error {
 	if sourceHypervisorIpAddress != nil {
 		if sourceHypervisorIpAddress.Equal(destinationHypervisorIpAddress) {
 			return nil // IP address is already registered to dest Hypervisor.
 		}
-		err := m.removeIpAndWait(sourceHypervisorIpAddress, ipToMove)
+		err := m.removeIpAndWait(sourceHypervisorIpAddress,
+			addressToMove.IpAddress)
 		if err != nil {
 			return err
 		}
 	}
-	return m.addIp(destinationHypervisorIpAddress, ipToMove)
+	return m.addIp(destinationHypervisorIpAddress, addressToMove)
 }
 
 func (m *Manager) removeIpAndWait(hypervisorIpAddress, ipToMove net.IP) error {
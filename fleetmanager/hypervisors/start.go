@@ -29,6 +29,7 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		hypervisorsByHW:  make(map[string]*hypervisorType),
 		hypervisorsByIP:  make(map[string]*hypervisorType),
 		hypervisorsBySN:  make(map[string]*hypervisorType),
+		ipv6Pairs:        make(map[string]ipv6PairType),
 		migratingIPs:     make(map[string]struct{}),
 		subnets:          make(map[string]*subnetType),
 		topologyLoaded:   make(chan struct{}, 1),
@@ -336,6 +336,9 @@ func (m *Manager) updateTopology(t *topology.Topology) {
 		if err != nil {
 			m.logger.Println(err)
 		}
+		m.mutex.Lock()
+		m.setIpv6PairsForHypervisor(hypervisor, nil)
+		m.mutex.Unlock()
 		hypervisor.delete()
 	}
 	waitGroup.Wait()
@@ -626,6 +629,9 @@ func (m *Manager) processAddressPoolUpdates(h *hypervisorType,
 		if err != nil {
 			h.logger.Println(err)
 		}
+		m.mutex.Lock()
+		m.setIpv6PairsForHypervisor(h, update.AddressPool)
+		m.mutex.Unlock()
 	}
 	if !*manageHypervisors {
 		return
@@ -675,7 +681,8 @@ func (m *Manager) processAddressPoolUpdates(h *hypervisorType,
 			for _, ip := range freeIPs {
 				ipsToAdd = append(ipsToAdd, ip)
 				addressesToAdd = append(addressesToAdd, hyper_proto.Address{
-					IpAddress: ip,
+					IpAddress:   ip,
+					Ipv6Address: makeIpv6Address(tSubnet, ip),
 					MacAddress: fmt.Sprintf("52:54:%02x:%02x:%02x:%02x",
 						ip[0], ip[1], ip[2], ip[3]),
 				})
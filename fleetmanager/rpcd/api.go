@@ -50,6 +50,7 @@ func Setup(config Config, params Params) (
 				"Allocate",
 				"CancelAllocation",
 				"ChangeMachineTags",
+				"EvacuateHypervisor",
 				"GetAllocationUpdates",
 				"GetHypervisorForVM",
 				"GetHypervisorsInLocation",
@@ -0,0 +1,26 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func (t *srpcType) EvacuateHypervisor(conn *srpc.Conn) error {
+	var request proto.EvacuateHypervisorRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	err := t.hypervisorsManager.EvacuateHypervisor(request,
+		conn.GetAuthInformation(),
+		func(response proto.EvacuateHypervisorResponse) error {
+			if err := conn.Encode(response); err != nil {
+				return err
+			}
+			return conn.Flush()
+		})
+	if err != nil {
+		return conn.Encode(proto.EvacuateHypervisorResponse{
+			Error: err.Error()})
+	}
+	return conn.Encode(proto.EvacuateHypervisorResponse{Final: true})
+}
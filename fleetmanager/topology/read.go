@@ -134,6 +134,32 @@ func loadOwners(filename string) (*ownersType, error) {
 	return &owners, nil
 }
 
+func checkIpv6Prefix(subnet *Subnet) error {
+	if len(subnet.Ipv6Prefix) < 1 {
+		if len(subnet.Ipv6Gateway) > 0 {
+			return fmt.Errorf("subnet: %s has IPv6 gateway but no prefix",
+				subnet.Id)
+		}
+		return nil
+	}
+	if subnet.Ipv6Prefix.To4() != nil || subnet.Ipv6Prefix.To16() == nil {
+		return fmt.Errorf("subnet: %s has invalid IPv6 prefix: %s",
+			subnet.Id, subnet.Ipv6Prefix)
+	}
+	prefixMask := net.CIDRMask(64, 128)
+	if !subnet.Ipv6Prefix.Mask(prefixMask).Equal(subnet.Ipv6Prefix) {
+		return fmt.Errorf("subnet: %s IPv6 prefix: %s is not a /64",
+			subnet.Id, subnet.Ipv6Prefix)
+	}
+	if len(subnet.Ipv6Gateway) > 0 &&
+		!subnet.Ipv6Gateway.Mask(prefixMask).Equal(subnet.Ipv6Prefix) &&
+		!subnet.Ipv6Gateway.IsLinkLocalUnicast() {
+		return fmt.Errorf("subnet: %s IPv6 gateway: %s not in prefix: %s/64",
+			subnet.Id, subnet.Ipv6Gateway, subnet.Ipv6Prefix)
+	}
+	return nil
+}
+
 func loadSubnets(filename string) ([]*Subnet, error) {
 	var subnets []*Subnet
 	if err := json.ReadFromFile(filename, &subnets); err != nil {
@@ -151,6 +177,9 @@ func loadSubnets(filename string) ([]*Subnet, error) {
 		} else {
 			gatewayIPs[gatewayIp] = struct{}{}
 		}
+		if err := checkIpv6Prefix(subnet); err != nil {
+			return nil, err
+		}
 		subnet.reservedIpAddrs = make(map[string]struct{})
 		for _, ipAddr := range subnet.ReservedIPs {
 			subnet.reservedIpAddrs[ipAddr.String()] = struct{}{}
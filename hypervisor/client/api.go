@@ -33,6 +33,11 @@ func AddVmVolumes(client srpc.ClientI, ipAddress net.IP, sizes []uint64) error {
 	return addVmVolumes(client, ipAddress, sizes)
 }
 
+func BackupVm(client srpc.ClientI,
+	request proto.BackupVmRequest) (proto.BackupVmResponse, error) {
+	return backupVm(client, request)
+}
+
 func BecomePrimaryVmOwner(client srpc.ClientI, ipAddress net.IP) error {
 	return becomePrimaryVmOwner(client, ipAddress)
 }
@@ -62,6 +67,11 @@ func ChangeVmMachineType(client srpc.ClientI, ipAddress net.IP,
 	return changeVmMachineType(client, ipAddress, machineType)
 }
 
+func ChangeVmNetworkLimits(client srpc.ClientI, ipAddress net.IP,
+	limits proto.NetworkLimits) error {
+	return changeVmNetworkLimits(client, ipAddress, limits)
+}
+
 func ChangeVmNumNetworkQueues(client srpc.ClientI, ipAddress net.IP,
 	numQueuesPerInterface []uint) error {
 	return changeVmNumNetworkQueues(client, ipAddress, numQueuesPerInterface)
@@ -77,11 +87,21 @@ func ChangeVmOwnerUsers(client srpc.ClientI, ipAddress net.IP,
 	return changeVmOwnerUsers(client, ipAddress, ownerUsers)
 }
 
+func ChangeVmRestartPolicy(client srpc.ClientI, ipAddress net.IP,
+	restartPolicy proto.RestartPolicy) error {
+	return changeVmRestartPolicy(client, ipAddress, restartPolicy)
+}
+
 func ChangeVmSize(client srpc.ClientI,
 	request proto.ChangeVmSizeRequest) error {
 	return changeVmSize(client, request)
 }
 
+func ChangeVmSnapshotSchedule(client srpc.ClientI, ipAddress net.IP,
+	snapshotSchedule proto.SnapshotSchedule) error {
+	return changeVmSnapshotSchedule(client, ipAddress, snapshotSchedule)
+}
+
 func ChangeVmSubnet(client srpc.ClientI,
 	request proto.ChangeVmSubnetRequest) (proto.ChangeVmSubnetResponse, error) {
 	return changeVmSubnet(client, request)
@@ -213,6 +233,13 @@ func GetVmInfo(client srpc.ClientI, ipAddress net.IP) (proto.VmInfo, error) {
 	return getVmInfo(client, ipAddress)
 }
 
+// GetVmInfoAndUsage returns the VM information and the recent resource usage
+// for a VM. The usage is nil if not available.
+func GetVmInfoAndUsage(client srpc.ClientI, ipAddress net.IP) (
+	proto.VmInfo, *proto.VmUsage, error) {
+	return getVmInfoAndUsage(client, ipAddress)
+}
+
 func GetVmInfos(client srpc.ClientI,
 	request proto.GetVmInfosRequest) ([]proto.VmInfo, error) {
 	return getVmInfos(client, request)
@@ -41,6 +41,19 @@ func addVmVolumes(client srpc.ClientI, ipAddress net.IP, sizes []uint64) error {
 	return errors.New(reply.Error)
 }
 
+func backupVm(client srpc.ClientI,
+	request proto.BackupVmRequest) (proto.BackupVmResponse, error) {
+	var reply proto.BackupVmResponse
+	err := client.RequestReply("Hypervisor.BackupVm", request, &reply)
+	if err != nil {
+		return proto.BackupVmResponse{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return proto.BackupVmResponse{}, err
+	}
+	return reply, nil
+}
+
 func becomePrimaryVmOwner(client srpc.ClientI, ipAddress net.IP) error {
 	request := proto.BecomePrimaryVmOwnerRequest{ipAddress}
 	var reply proto.BecomePrimaryVmOwnerResponse
@@ -123,6 +136,21 @@ func changeVmMachineType(client srpc.ClientI, ipAddress net.IP,
 	return errors.New(reply.Error)
 }
 
+func changeVmNetworkLimits(client srpc.ClientI, ipAddress net.IP,
+	limits proto.NetworkLimits) error {
+	request := proto.ChangeVmNetworkLimitsRequest{
+		IpAddress:     ipAddress,
+		NetworkLimits: limits,
+	}
+	var reply proto.ChangeVmNetworkLimitsResponse
+	err := client.RequestReply("Hypervisor.ChangeVmNetworkLimits", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
+
 func changeVmNumNetworkQueues(client srpc.ClientI, ipAddress net.IP,
 	numQueuesPerInterface []uint) error {
 	request := proto.ChangeVmNumNetworkQueuesRequest{
@@ -161,6 +189,21 @@ func changeVmOwnerUsers(client srpc.ClientI, ipAddress net.IP,
 	return errors.New(reply.Error)
 }
 
+func changeVmRestartPolicy(client srpc.ClientI, ipAddress net.IP,
+	restartPolicy proto.RestartPolicy) error {
+	request := proto.ChangeVmRestartPolicyRequest{
+		IpAddress:     ipAddress,
+		RestartPolicy: restartPolicy,
+	}
+	var reply proto.ChangeVmRestartPolicyResponse
+	err := client.RequestReply("Hypervisor.ChangeVmRestartPolicy", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
+
 func changeVmSize(client srpc.ClientI,
 	request proto.ChangeVmSizeRequest) error {
 	var reply proto.ChangeVmSizeResponse
@@ -171,6 +214,21 @@ func changeVmSize(client srpc.ClientI,
 	return errors.New(reply.Error)
 }
 
+func changeVmSnapshotSchedule(client srpc.ClientI, ipAddress net.IP,
+	snapshotSchedule proto.SnapshotSchedule) error {
+	request := proto.ChangeVmSnapshotScheduleRequest{
+		IpAddress:        ipAddress,
+		SnapshotSchedule: snapshotSchedule,
+	}
+	var reply proto.ChangeVmSnapshotScheduleResponse
+	err := client.RequestReply("Hypervisor.ChangeVmSnapshotSchedule", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
+
 func changeVmSubnet(client srpc.ClientI,
 	request proto.ChangeVmSubnetRequest) (proto.ChangeVmSubnetResponse, error) {
 	var reply proto.ChangeVmSubnetResponse
@@ -667,16 +725,22 @@ func getVmCreateRequest(client srpc.ClientI, ipAddr net.IP) (
 }
 
 func getVmInfo(client srpc.ClientI, ipAddr net.IP) (proto.VmInfo, error) {
+	vmInfo, _, err := getVmInfoAndUsage(client, ipAddr)
+	return vmInfo, err
+}
+
+func getVmInfoAndUsage(client srpc.ClientI, ipAddr net.IP) (
+	proto.VmInfo, *proto.VmUsage, error) {
 	request := proto.GetVmInfoRequest{IpAddress: ipAddr}
 	var reply proto.GetVmInfoResponse
 	err := client.RequestReply("Hypervisor.GetVmInfo", request, &reply)
 	if err != nil {
-		return proto.VmInfo{}, err
+		return proto.VmInfo{}, nil, err
 	}
 	if err := errors.New(reply.Error); err != nil {
-		return proto.VmInfo{}, err
+		return proto.VmInfo{}, nil, err
 	}
-	return reply.VmInfo, nil
+	return reply.VmInfo, reply.Usage, nil
 }
 
 func getVmInfos(client srpc.ClientI,
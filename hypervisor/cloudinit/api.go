@@ -0,0 +1,67 @@
+package cloudinit
+
+import (
+	"io"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+// Filenames in a NoCloud seed volume or seed URL.
+const (
+	MetaDataFile      = "meta-data"
+	NetworkConfigFile = "network-config"
+	UserDataFile      = "user-data"
+	VendorDataFile    = "vendor-data"
+
+	SeedVolumeLabel = "cidata"
+)
+
+// Filenames in the openstack/latest directory of a ConfigDrive seed volume.
+const (
+	ConfigDriveMetaDataFile    = "meta_data.json"
+	ConfigDriveNetworkDataFile = "network_data.json"
+	ConfigDriveUserDataFile    = "user_data"
+	ConfigDriveVendorDataFile  = "vendor_data.json"
+
+	ConfigDriveLabel = "config-2"
+)
+
+// InstanceId returns the cloud-init instance ID for the VM. It is derived
+// from the primary IP address, so it does not change when the VM is restarted
+// or migrated.
+func InstanceId(vmInfo proto.VmInfo) string {
+	return instanceId(vmInfo)
+}
+
+// LocalHostname returns the hostname cloud-init should set for the VM.
+func LocalHostname(vmInfo proto.VmInfo) string {
+	return localHostname(vmInfo)
+}
+
+// MakeSeedVolume will write a seed volume of the specified type for the VM to
+// filename. A NoCloud seed volume is an ISO 9660 image with the "cidata" label
+// and a ConfigDrive seed volume is an ISO 9660 image with the "config-2" label
+// in the OpenStack format. The subnets for the VM are used to generate the
+// network configuration. The user data are read from userData, which may be
+// nil.
+func MakeSeedVolume(filename string, seedVolumeType proto.SeedVolumeType,
+	vmInfo proto.VmInfo, subnets []proto.Subnet, userData io.Reader) error {
+	return makeSeedVolume(filename, seedVolumeType, vmInfo, subnets, userData)
+}
+
+// WriteMetaData will write the NoCloud meta-data for the VM to writer.
+func WriteMetaData(writer io.Writer, vmInfo proto.VmInfo) error {
+	return writeMetaData(writer, vmInfo)
+}
+
+// WriteNetworkConfig will write the cloud-init network configuration (version
+// 2) for the VM to writer. Each interface is configured using DHCP. If the
+// address for an interface has an IPv6 address (assigned using DHCPv6), it is
+// also configured, otherwise if the subnet has an IPv6 prefix, the
+// autoconfigured IPv6 address is configured. The IPv6 gateway is configured for
+// the primary interface.
+// Subnets which the VM is not attached to are ignored.
+func WriteNetworkConfig(writer io.Writer, vmInfo proto.VmInfo,
+	subnets []proto.Subnet) error {
+	return writeNetworkConfig(writer, vmInfo, subnets)
+}
@@ -0,0 +1,130 @@
+package cloudinit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const configDriveDirectory = "openstack/latest/"
+
+type configDriveLink struct {
+	EthernetMacAddress string `json:"ethernet_mac_address"`
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+}
+
+type configDriveMetaData struct {
+	Hostname   string            `json:"hostname"`
+	Name       string            `json:"name"`
+	PublicKeys map[string]string `json:"public_keys,omitempty"`
+	Uuid       string            `json:"uuid"`
+}
+
+type configDriveNetwork struct {
+	Id        string             `json:"id"`
+	IpAddress string             `json:"ip_address,omitempty"`
+	Link      string             `json:"link"`
+	Netmask   string             `json:"netmask,omitempty"`
+	Routes    []configDriveRoute `json:"routes,omitempty"`
+	Type      string             `json:"type"`
+}
+
+type configDriveNetworkData struct {
+	Links    []configDriveLink    `json:"links"`
+	Networks []configDriveNetwork `json:"networks"`
+	Services []struct{}           `json:"services"`
+}
+
+type configDriveRoute struct {
+	Gateway string `json:"gateway"`
+	Netmask string `json:"netmask"`
+	Network string `json:"network"`
+}
+
+func makeConfigDriveSeedFiles(vmInfo proto.VmInfo, subnets []proto.Subnet,
+	userData io.Reader) []seedFileType {
+	seedFiles := []seedFileType{
+		{configDriveDirectory + ConfigDriveMetaDataFile,
+			func(w io.Writer) error {
+				return writeConfigDriveMetaData(w, vmInfo)
+			}},
+		{configDriveDirectory + ConfigDriveNetworkDataFile,
+			func(w io.Writer) error {
+				return writeConfigDriveNetworkData(w, vmInfo, subnets)
+			}},
+		{configDriveDirectory + ConfigDriveVendorDataFile,
+			func(w io.Writer) error {
+				_, err := io.WriteString(w, "{}\n")
+				return err
+			}},
+	}
+	// Unlike NoCloud, an empty user_data file is not the same as no user data.
+	if userData != nil {
+		seedFiles = append(seedFiles, seedFileType{
+			configDriveDirectory + ConfigDriveUserDataFile,
+			func(w io.Writer) error {
+				return copyUserData(w, userData)
+			}})
+	}
+	return seedFiles
+}
+
+func writeConfigDriveMetaData(writer io.Writer, vmInfo proto.VmInfo) error {
+	metaData := configDriveMetaData{
+		Hostname: localHostname(vmInfo),
+		Name:     localHostname(vmInfo),
+		Uuid:     instanceId(vmInfo),
+	}
+	if len(vmInfo.SshPublicKeys) > 0 {
+		metaData.PublicKeys = make(map[string]string,
+			len(vmInfo.SshPublicKeys))
+		for index, key := range vmInfo.SshPublicKeys {
+			metaData.PublicKeys[fmt.Sprintf("key-%d", index)] = key
+		}
+	}
+	return json.WriteWithIndent(writer, "    ", metaData)
+}
+
+func writeConfigDriveNetworkData(writer io.Writer, vmInfo proto.VmInfo,
+	subnets []proto.Subnet) error {
+	interfaces, err := getInterfaces(vmInfo, subnets)
+	if err != nil {
+		return err
+	}
+	networkData := configDriveNetworkData{Services: []struct{}{}}
+	for _, netInterface := range interfaces {
+		networkData.Links = append(networkData.Links, configDriveLink{
+			EthernetMacAddress: netInterface.macAddress,
+			Id:                 netInterface.name,
+			Type:               "phy",
+		})
+		networkData.Networks = append(networkData.Networks,
+			configDriveNetwork{
+				Id:   netInterface.name + "-ipv4",
+				Link: netInterface.name,
+				Type: "ipv4_dhcp",
+			})
+		if netInterface.ipv6Address == nil {
+			continue
+		}
+		network := configDriveNetwork{
+			Id:        netInterface.name + "-ipv6",
+			IpAddress: netInterface.ipv6Address.String(),
+			Link:      netInterface.name,
+			Netmask:   "ffff:ffff:ffff:ffff::",
+			Type:      "ipv6",
+		}
+		if netInterface.ipv6Gateway != nil {
+			network.Routes = []configDriveRoute{{
+				Gateway: netInterface.ipv6Gateway.String(),
+				Netmask: "::",
+				Network: "::",
+			}}
+		}
+		networkData.Networks = append(networkData.Networks, network)
+	}
+	return json.WriteWithIndent(writer, "    ", networkData)
+}
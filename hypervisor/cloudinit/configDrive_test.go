@@ -0,0 +1,171 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func makeTestVmInfo() (proto.VmInfo, []proto.Subnet) {
+	vmInfo := proto.VmInfo{
+		Address: proto.Address{
+			IpAddress:  net.ParseIP("10.1.2.3"),
+			MacAddress: "52:54:0a:01:02:03",
+		},
+		Hostname:           "test-vm",
+		SecondaryAddresses: []proto.Address{{MacAddress: "52:54:0a:02:02:03"}},
+		SecondarySubnetIDs: []string{"secondary"},
+		SshPublicKeys:      []string{"ssh-ed25519 key0", "ssh-ed25519 key1"},
+		SubnetId:           "primary",
+	}
+	subnets := []proto.Subnet{
+		{
+			Id:          "primary",
+			Ipv6Gateway: net.ParseIP("2001:db8:1::1"),
+			Ipv6Prefix:  net.ParseIP("2001:db8:1::"),
+		},
+		{Id: "secondary"},
+	}
+	return vmInfo, subnets
+}
+
+func TestWriteConfigDriveMetaData(t *testing.T) {
+	vmInfo, _ := makeTestVmInfo()
+	buffer := &bytes.Buffer{}
+	if err := writeConfigDriveMetaData(buffer, vmInfo); err != nil {
+		t.Fatal(err)
+	}
+	var got configDriveMetaData
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := configDriveMetaData{
+		Hostname: "test-vm",
+		Name:     "test-vm",
+		PublicKeys: map[string]string{
+			"key-0": "ssh-ed25519 key0",
+			"key-1": "ssh-ed25519 key1",
+		},
+		Uuid: "i-0a010203",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("meta_data = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteConfigDriveNetworkData(t *testing.T) {
+	vmInfo, subnets := makeTestVmInfo()
+	buffer := &bytes.Buffer{}
+	err := writeConfigDriveNetworkData(buffer, vmInfo, subnets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got configDriveNetworkData
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := configDriveNetworkData{
+		Links: []configDriveLink{
+			{"52:54:0a:01:02:03", "eth0", "phy"},
+			{"52:54:0a:02:02:03", "eth1", "phy"},
+		},
+		Networks: []configDriveNetwork{
+			{Id: "eth0-ipv4", Link: "eth0", Type: "ipv4_dhcp"},
+			{
+				Id:        "eth0-ipv6",
+				IpAddress: "2001:db8:1:0:5054:aff:fe01:203",
+				Link:      "eth0",
+				Netmask:   "ffff:ffff:ffff:ffff::",
+				Routes: []configDriveRoute{
+					{"2001:db8:1::1", "::", "::"},
+				},
+				Type: "ipv6",
+			},
+			{Id: "eth1-ipv4", Link: "eth1", Type: "ipv4_dhcp"},
+		},
+		Services: []struct{}{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("network_data = %+v, want %+v", got, want)
+	}
+}
+
+func TestMakeConfigDriveSeedFiles(t *testing.T) {
+	vmInfo, subnets := makeTestVmInfo()
+	tests := []struct {
+		name     string
+		userData []byte
+		want     []string
+	}{
+		{"no user data", nil, []string{
+			"openstack/latest/meta_data.json",
+			"openstack/latest/network_data.json",
+			"openstack/latest/vendor_data.json",
+		}},
+		{"user data", []byte("#cloud-config\n"), []string{
+			"openstack/latest/meta_data.json",
+			"openstack/latest/network_data.json",
+			"openstack/latest/vendor_data.json",
+			"openstack/latest/user_data",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var userData io.Reader
+			if test.userData != nil {
+				userData = bytes.NewReader(test.userData)
+			}
+			seedFiles := makeConfigDriveSeedFiles(vmInfo, subnets, userData)
+			var got []string
+			for _, seedFile := range seedFiles {
+				got = append(got, seedFile.filename)
+				buffer := &bytes.Buffer{}
+				if err := seedFile.write(buffer); err != nil {
+					t.Fatal(err)
+				}
+				if seedFile.filename == "openstack/latest/user_data" &&
+					!bytes.Equal(buffer.Bytes(), test.userData) {
+					t.Errorf("user_data = %q, want %q",
+						buffer.Bytes(), test.userData)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("seed files = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetInterfacesIpv6Address(t *testing.T) {
+	vmInfo, subnets := makeTestVmInfo()
+	tests := []struct {
+		name        string
+		ipv6Address net.IP
+		want        net.IP
+	}{
+		{"autoconfigured address", nil,
+			net.ParseIP("2001:db8:1:0:5054:aff:fe01:203")},
+		{"DHCPv6 address", net.ParseIP("2001:db8:1::a01:203"),
+			net.ParseIP("2001:db8:1::a01:203")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vmInfo.Address.Ipv6Address = test.ipv6Address
+			interfaces, err := getInterfaces(vmInfo, subnets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := interfaces[0].ipv6Address; !got.Equal(test.want) {
+				t.Errorf("IPv6 address = %s, want %s", got, test.want)
+			}
+			if interfaces[0].ipv6Gateway == nil {
+				t.Error("no IPv6 gateway")
+			}
+		})
+	}
+}
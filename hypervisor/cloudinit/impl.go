@@ -0,0 +1,242 @@
+package cloudinit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type ethernetConfig struct {
+	Addresses []string          `json:"addresses,omitempty"`
+	Dhcp4     bool              `json:"dhcp4"`
+	Match     map[string]string `json:"match"`
+	Routes    []routeConfig     `json:"routes,omitempty"`
+	SetName   string            `json:"set-name"`
+}
+
+type interfaceType struct {
+	ipv6Address net.IP
+	ipv6Gateway net.IP
+	macAddress  string
+	name        string
+}
+
+type networkConfig struct {
+	Ethernets map[string]ethernetConfig `json:"ethernets"`
+	Version   uint                      `json:"version"`
+}
+
+type routeConfig struct {
+	To  string `json:"to"`
+	Via string `json:"via"`
+}
+
+type seedFileType struct {
+	filename string
+	write    func(w io.Writer) error
+}
+
+// isoMakers lists the commands which may be used to make ISO 9660 images, in
+// order of preference.
+var isoMakers = [][]string{
+	{"genisoimage"},
+	{"mkisofs"},
+	{"xorriso", "-as", "mkisofs"},
+}
+
+func copyUserData(writer io.Writer, userData io.Reader) error {
+	if userData == nil {
+		return nil
+	}
+	_, err := io.Copy(writer, userData)
+	return err
+}
+
+func instanceId(vmInfo proto.VmInfo) string {
+	if ip4 := vmInfo.Address.IpAddress.To4(); ip4 != nil {
+		return fmt.Sprintf("i-%02x%02x%02x%02x", ip4[0], ip4[1], ip4[2], ip4[3])
+	}
+	return "i-" + strings.ReplaceAll(vmInfo.Address.MacAddress, ":", "")
+}
+
+func localHostname(vmInfo proto.VmInfo) string {
+	if vmInfo.Hostname != "" {
+		return vmInfo.Hostname
+	}
+	return "ip-" + strings.ReplaceAll(vmInfo.Address.IpAddress.String(), ".",
+		"-")
+}
+
+// getInterfaces returns the network interfaces for the VM. The primary
+// interface is first.
+func getInterfaces(vmInfo proto.VmInfo,
+	subnets []proto.Subnet) ([]interfaceType, error) {
+	subnetsById := make(map[string]proto.Subnet, len(subnets))
+	for _, subnet := range subnets {
+		subnetsById[subnet.Id] = subnet
+	}
+	addresses := append([]proto.Address{vmInfo.Address},
+		vmInfo.SecondaryAddresses...)
+	subnetIds := append([]string{vmInfo.SubnetId},
+		vmInfo.SecondarySubnetIDs...)
+	interfaces := make([]interfaceType, 0, len(addresses))
+	for index, address := range addresses {
+		var subnet proto.Subnet
+		if index < len(subnetIds) {
+			subnet = subnetsById[subnetIds[index]]
+		}
+		ipv6Addr := address.Ipv6Address
+		if len(ipv6Addr) < 1 {
+			var err error
+			ipv6Addr, err = subnet.MakeIpv6Address(address.MacAddress)
+			if err != nil {
+				return nil, err
+			}
+		}
+		netInterface := interfaceType{
+			ipv6Address: ipv6Addr,
+			macAddress:  address.MacAddress,
+			name:        fmt.Sprintf("eth%d", index),
+		}
+		// Only the primary interface gets a default route.
+		if ipv6Addr != nil && index == 0 && len(subnet.Ipv6Gateway) > 0 {
+			netInterface.ipv6Gateway = subnet.Ipv6Gateway
+		}
+		interfaces = append(interfaces, netInterface)
+	}
+	return interfaces, nil
+}
+
+func makeSeedVolume(filename string, seedVolumeType proto.SeedVolumeType,
+	vmInfo proto.VmInfo, subnets []proto.Subnet, userData io.Reader) error {
+	var command []string
+	for _, isoMaker := range isoMakers {
+		if _, err := exec.LookPath(isoMaker[0]); err == nil {
+			command = isoMaker
+			break
+		}
+	}
+	if command == nil {
+		return errors.New("no genisoimage, mkisofs or xorriso command found")
+	}
+	var label string
+	var seedFiles []seedFileType
+	switch seedVolumeType {
+	case proto.SeedVolumeNoCloud:
+		label = SeedVolumeLabel
+		seedFiles = makeNoCloudSeedFiles(vmInfo, subnets, userData)
+	case proto.SeedVolumeConfigDrive:
+		label = ConfigDriveLabel
+		seedFiles = makeConfigDriveSeedFiles(vmInfo, subnets, userData)
+	default:
+		return fmt.Errorf("unsupported seed volume type: %s", seedVolumeType)
+	}
+	dirname, err := os.MkdirTemp(filepath.Dir(filename), "cidata.")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dirname)
+	for _, seedFile := range seedFiles {
+		if err := writeSeedFile(dirname, seedFile); err != nil {
+			return err
+		}
+	}
+	tmpFilename := filename + "~"
+	cmd := exec.Command(command[0], append(command[1:],
+		"-output", tmpFilename,
+		"-volid", label,
+		"-joliet", "-rock", "-quiet",
+		dirname)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpFilename)
+		return fmt.Errorf("error running %s: %s: %s", command[0], err, output)
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+func makeNoCloudSeedFiles(vmInfo proto.VmInfo, subnets []proto.Subnet,
+	userData io.Reader) []seedFileType {
+	return []seedFileType{
+		{MetaDataFile, func(w io.Writer) error {
+			return writeMetaData(w, vmInfo)
+		}},
+		{NetworkConfigFile, func(w io.Writer) error {
+			return writeNetworkConfig(w, vmInfo, subnets)
+		}},
+		{UserDataFile, func(w io.Writer) error {
+			return copyUserData(w, userData)
+		}},
+		{VendorDataFile, func(w io.Writer) error {
+			return nil
+		}},
+	}
+}
+
+func writeMetaData(writer io.Writer, vmInfo proto.VmInfo) error {
+	// JSON is a subset of YAML, which cloud-init expects.
+	metaData := map[string]interface{}{
+		"instance-id":    instanceId(vmInfo),
+		"local-hostname": localHostname(vmInfo),
+	}
+	if len(vmInfo.SshPublicKeys) > 0 {
+		metaData["public-keys"] = vmInfo.SshPublicKeys
+	}
+	return json.WriteWithIndent(writer, "    ", metaData)
+}
+
+func writeNetworkConfig(writer io.Writer, vmInfo proto.VmInfo,
+	subnets []proto.Subnet) error {
+	interfaces, err := getInterfaces(vmInfo, subnets)
+	if err != nil {
+		return err
+	}
+	config := networkConfig{
+		Ethernets: make(map[string]ethernetConfig, len(interfaces)),
+		Version:   2,
+	}
+	for _, netInterface := range interfaces {
+		ethernet := ethernetConfig{
+			Dhcp4:   true,
+			Match:   map[string]string{"macaddress": netInterface.macAddress},
+			SetName: netInterface.name,
+		}
+		if netInterface.ipv6Address != nil {
+			ethernet.Addresses = []string{
+				netInterface.ipv6Address.String() + "/64"}
+		}
+		if netInterface.ipv6Gateway != nil {
+			ethernet.Routes = []routeConfig{{
+				To:  "::/0",
+				Via: netInterface.ipv6Gateway.String(),
+			}}
+		}
+		config.Ethernets[netInterface.name] = ethernet
+	}
+	return json.WriteWithIndent(writer, "    ", config)
+}
+
+func writeSeedFile(dirname string, seedFile seedFileType) error {
+	filename := filepath.Join(dirname, seedFile.filename)
+	if err := os.MkdirAll(filepath.Dir(filename), fsutil.DirPerms); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		fsutil.PrivateFilePerms)
+	if err != nil {
+		return err
+	}
+	if err := seedFile.write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
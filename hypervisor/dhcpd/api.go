@@ -20,6 +20,7 @@ type DhcpServer struct {
 	networkBootImage  string
 	requestInterface  string
 	routeTable        map[string]*util.RouteEntry // Key: interface name.
+	serverDuid        []byte                      // DHCPv6 server ID.
 	mutex             sync.RWMutex                // Protect everything below.
 	ackChannels       map[string]chan struct{}    // Key: IPaddr.
 	dynamicLeases     map[string]*leaseType       // Key: MACaddr.
@@ -0,0 +1,464 @@
+package dhcpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	dhcpv6ServerPort = 547
+
+	dhcpv6Solicit            = 1
+	dhcpv6Advertise          = 2
+	dhcpv6Request            = 3
+	dhcpv6Confirm            = 4
+	dhcpv6Renew              = 5
+	dhcpv6Rebind             = 6
+	dhcpv6Reply              = 7
+	dhcpv6Release            = 8
+	dhcpv6Decline            = 9
+	dhcpv6InformationRequest = 11
+
+	dhcpv6OptionClientId    = 1
+	dhcpv6OptionServerId    = 2
+	dhcpv6OptionIaNa        = 3
+	dhcpv6OptionIaAddr      = 5
+	dhcpv6OptionRequest     = 6
+	dhcpv6OptionStatusCode  = 13
+	dhcpv6OptionRapidCommit = 14
+	dhcpv6OptionDnsServers  = 23
+	dhcpv6OptionDomainList  = 24
+
+	dhcpv6StatusSuccess      = 0
+	dhcpv6StatusNoAddrsAvail = 2
+	dhcpv6StatusNotOnLink    = 4
+
+	duidTypeLinkLayerTime = 1
+	duidTypeLinkLayer     = 3
+	hardwareTypeEtherNet  = 1
+)
+
+var allDhcpv6Servers = net.ParseIP("ff02::1:2")
+
+type dhcpv6Message struct {
+	msgType       byte
+	transactionId [3]byte
+	options       []dhcpv6Option
+}
+
+type dhcpv6Option struct {
+	code uint16
+	data []byte
+}
+
+func appendDhcpv6Option(buffer []byte, code uint16, data []byte) []byte {
+	buffer = binary.BigEndian.AppendUint16(buffer, code)
+	buffer = binary.BigEndian.AppendUint16(buffer, uint16(len(data)))
+	return append(buffer, data...)
+}
+
+// getDuidHardwareAddr returns the EtherNet address in a link-layer DUID, or nil
+// if the DUID does not contain an EtherNet address.
+func getDuidHardwareAddr(duid []byte) net.HardwareAddr {
+	var hwAddr []byte
+	if len(duid) < 4 {
+		return nil
+	}
+	switch binary.BigEndian.Uint16(duid) {
+	case duidTypeLinkLayerTime:
+		hwAddr = duid[8:]
+	case duidTypeLinkLayer:
+		hwAddr = duid[4:]
+	default:
+		return nil
+	}
+	if binary.BigEndian.Uint16(duid[2:]) != hardwareTypeEtherNet ||
+		len(hwAddr) != 6 {
+		return nil
+	}
+	return net.HardwareAddr(hwAddr)
+}
+
+// makeDomainList encodes the domain name in the DNS format used by the
+// DHCPv6 Domain Search List option.
+func makeDomainList(domainName string) []byte {
+	var buffer []byte
+	for _, label := range strings.Split(strings.Trim(domainName, "."), ".") {
+		buffer = append(buffer, byte(len(label)))
+		buffer = append(buffer, label...)
+	}
+	return append(buffer, 0)
+}
+
+func makeDhcpv6StatusCode(code uint16, message string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, code), message...)
+}
+
+// makeServerDuid will make a link-layer DUID from the EtherNet address of the
+// first of the interfaces which has one.
+func makeServerDuid(ifIndices map[int]string) ([]byte, error) {
+	indices := make([]int, 0, len(ifIndices))
+	for index := range ifIndices {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		if len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		duid := binary.BigEndian.AppendUint16(nil, duidTypeLinkLayer)
+		duid = binary.BigEndian.AppendUint16(duid, hardwareTypeEtherNet)
+		return append(duid, iface.HardwareAddr...), nil
+	}
+	return nil, errors.New("no EtherNet interface for DUID")
+}
+
+func parseDhcpv6Message(data []byte) (*dhcpv6Message, error) {
+	if len(data) < 4 {
+		return nil, errors.New("short DHCPv6 message")
+	}
+	options, err := parseDhcpv6Options(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	message := &dhcpv6Message{msgType: data[0], options: options}
+	copy(message.transactionId[:], data[1:4])
+	return message, nil
+}
+
+func parseDhcpv6Options(data []byte) ([]dhcpv6Option, error) {
+	var options []dhcpv6Option
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("truncated DHCPv6 option")
+		}
+		code := binary.BigEndian.Uint16(data)
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("truncated DHCPv6 option: %d", code)
+		}
+		options = append(options,
+			dhcpv6Option{code: code, data: data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return options, nil
+}
+
+func (m *dhcpv6Message) addOption(code uint16, data []byte) {
+	m.options = append(m.options, dhcpv6Option{code: code, data: data})
+}
+
+// getOption returns the data for the first option with the specified code.
+func (m *dhcpv6Message) getOption(code uint16) ([]byte, bool) {
+	for _, option := range m.options {
+		if option.code == code {
+			return option.data, true
+		}
+	}
+	return nil, false
+}
+
+func (m *dhcpv6Message) marshal() []byte {
+	buffer := append([]byte{m.msgType}, m.transactionId[:]...)
+	for _, option := range m.options {
+		buffer = appendDhcpv6Option(buffer, option.code, option.data)
+	}
+	return buffer
+}
+
+// requested returns true if the option was requested in the Option Request
+// option.
+func (m *dhcpv6Message) requested(code uint16) bool {
+	oro, _ := m.getOption(dhcpv6OptionRequest)
+	for ; len(oro) >= 2; oro = oro[2:] {
+		if binary.BigEndian.Uint16(oro) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// startDhcpv6 will start serving DHCPv6 on the interfaces. Only static leases
+// with an IPv6 address are served: other clients are ignored.
+func (s *DhcpServer) startDhcpv6(ifIndices map[int]string) error {
+	serverDuid, err := makeServerDuid(ifIndices)
+	if err != nil {
+		return err
+	}
+	listener, err := net.ListenPacket("udp6",
+		fmt.Sprintf("[::]:%d", dhcpv6ServerPort))
+	if err != nil {
+		return err
+	}
+	pktConn := ipv6.NewPacketConn(listener)
+	if err := pktConn.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		listener.Close()
+		return err
+	}
+	for index, name := range ifIndices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		err = pktConn.JoinGroup(iface, &net.UDPAddr{IP: allDhcpv6Servers})
+		if err != nil {
+			s.logger.Printf("not serving DHCPv6 on: %s: %s\n", name, err)
+		}
+	}
+	s.serverDuid = serverDuid
+	go s.serveDhcpv6(pktConn, ifIndices)
+	return nil
+}
+
+// findDhcpv6Lease returns the static lease with an IPv6 address for the
+// client. The client is identified by the MAC address in its link-local source
+// address, or failing that, the MAC address in its DUID.
+// This must be called with the lock held.
+func (s *DhcpServer) findDhcpv6Lease(srcAddr net.IP,
+	clientId []byte) *leaseType {
+	for _, hwAddr := range []net.HardwareAddr{
+		util.GetEui64HardwareAddr(srcAddr),
+		getDuidHardwareAddr(clientId),
+	} {
+		if len(hwAddr) < 1 {
+			continue
+		}
+		lease, ok := s.staticLeases[hwAddr.String()]
+		if ok && len(lease.Ipv6Address) > 0 {
+			return &lease
+		}
+	}
+	return nil
+}
+
+// makeIaNa returns the IA_NA option data for the identity association in the
+// client request, with the address of the lease. Other addresses requested by
+// the client are returned with zero lifetimes, so that the client stops using
+// them. If lease is nil, the IA_NA contains the NoAddrsAvail status.
+func makeIaNa(request []byte, lease *leaseType) []byte {
+	iaNa := append([]byte{}, request[:4]...) // IAID.
+	if lease == nil {
+		iaNa = append(iaNa, make([]byte, 8)...)
+		return appendDhcpv6Option(iaNa, dhcpv6OptionStatusCode,
+			makeDhcpv6StatusCode(dhcpv6StatusNoAddrsAvail,
+				"no addresses available"))
+	}
+	preferredLifetime := uint32(staticLeaseTime / 2 / time.Second)
+	validLifetime := uint32(staticLeaseTime / time.Second)
+	iaNa = binary.BigEndian.AppendUint32(iaNa, preferredLifetime/2)
+	iaNa = binary.BigEndian.AppendUint32(iaNa, preferredLifetime/5*4)
+	iaAddr := append([]byte{}, lease.Ipv6Address.To16()...)
+	iaAddr = binary.BigEndian.AppendUint32(iaAddr, preferredLifetime)
+	iaAddr = binary.BigEndian.AppendUint32(iaAddr, validLifetime)
+	iaNa = appendDhcpv6Option(iaNa, dhcpv6OptionIaAddr, iaAddr)
+	options, _ := parseDhcpv6Options(request[12:])
+	for _, option := range options {
+		if option.code != dhcpv6OptionIaAddr || len(option.data) < 16 {
+			continue
+		}
+		if net.IP(option.data[:16]).Equal(lease.Ipv6Address) {
+			continue
+		}
+		iaAddr := append(option.data[:16:16], make([]byte, 8)...)
+		iaNa = appendDhcpv6Option(iaNa, dhcpv6OptionIaAddr, iaAddr)
+	}
+	return iaNa
+}
+
+// processDhcpv6Message returns the response to a DHCPv6 message from a client
+// with the specified source address, or nil if there is no response.
+func (s *DhcpServer) processDhcpv6Message(request *dhcpv6Message,
+	srcAddr net.IP, interfaceName string) *dhcpv6Message {
+	clientId, ok := request.getOption(dhcpv6OptionClientId)
+	if !ok && request.msgType != dhcpv6InformationRequest {
+		return nil
+	}
+	serverId, haveServerId := request.getOption(dhcpv6OptionServerId)
+	switch request.msgType {
+	case dhcpv6Solicit, dhcpv6Confirm, dhcpv6Rebind:
+		if haveServerId {
+			return nil
+		}
+	case dhcpv6Request, dhcpv6Renew, dhcpv6Release, dhcpv6Decline:
+		if !bytes.Equal(serverId, s.serverDuid) {
+			return nil // Message not for this DHCP server.
+		}
+	case dhcpv6InformationRequest:
+		if haveServerId && !bytes.Equal(serverId, s.serverDuid) {
+			return nil
+		}
+	default:
+		s.logger.Debugf(0, "Unsupported DHCPv6 message type: %d on: %s\n",
+			request.msgType, interfaceName)
+		return nil
+	}
+	s.mutex.RLock()
+	lease := s.findDhcpv6Lease(srcAddr, clientId)
+	s.mutex.RUnlock()
+	response := &dhcpv6Message{
+		msgType:       dhcpv6Reply,
+		transactionId: request.transactionId,
+	}
+	if len(clientId) > 0 {
+		response.addOption(dhcpv6OptionClientId, clientId)
+	}
+	response.addOption(dhcpv6OptionServerId, s.serverDuid)
+	switch request.msgType {
+	case dhcpv6Solicit:
+		if lease == nil {
+			return nil
+		}
+		if _, ok := request.getOption(dhcpv6OptionRapidCommit); ok {
+			response.addOption(dhcpv6OptionRapidCommit, nil)
+			s.logger.Debugf(0, "DHCPv6 Reply: %s for: %s on: %s\n",
+				lease.Ipv6Address, lease.MacAddress, interfaceName)
+		} else {
+			response.msgType = dhcpv6Advertise
+			s.logger.Debugf(0, "DHCPv6 Advertise: %s for: %s on: %s\n",
+				lease.Ipv6Address, lease.MacAddress, interfaceName)
+		}
+		s.addIaNaOptions(request, response, lease)
+	case dhcpv6Request, dhcpv6Renew, dhcpv6Rebind:
+		if lease == nil {
+			if request.msgType == dhcpv6Rebind {
+				return nil // Another server may have a lease.
+			}
+		} else {
+			s.logger.Debugf(0, "DHCPv6 Reply: %s for: %s on: %s\n",
+				lease.Ipv6Address, lease.MacAddress, interfaceName)
+		}
+		s.addIaNaOptions(request, response, lease)
+	case dhcpv6Confirm:
+		if lease == nil {
+			return nil
+		}
+		status := makeDhcpv6StatusCode(dhcpv6StatusSuccess, "")
+		if !confirmAddresses(request, lease) {
+			status = makeDhcpv6StatusCode(dhcpv6StatusNotOnLink,
+				"address not on link")
+		}
+		response.addOption(dhcpv6OptionStatusCode, status)
+		return response
+	case dhcpv6Release, dhcpv6Decline:
+		if request.msgType == dhcpv6Decline && lease != nil {
+			s.logger.Printf("DHCPv6 address: %s declined by: %s\n",
+				lease.Ipv6Address, lease.MacAddress)
+		}
+		response.addOption(dhcpv6OptionStatusCode,
+			makeDhcpv6StatusCode(dhcpv6StatusSuccess, ""))
+		return response
+	}
+	if lease != nil && lease.subnet != nil {
+		_, dnsServers := util.SplitIPs(lease.subnet.DomainNameServers)
+		if len(dnsServers) > 0 && request.requested(dhcpv6OptionDnsServers) {
+			var data []byte
+			for _, dnsServer := range dnsServers {
+				data = append(data, dnsServer.To16()...)
+			}
+			response.addOption(dhcpv6OptionDnsServers, data)
+		}
+		if lease.subnet.DomainName != "" &&
+			request.requested(dhcpv6OptionDomainList) {
+			response.addOption(dhcpv6OptionDomainList,
+				makeDomainList(lease.subnet.DomainName))
+		}
+	}
+	return response
+}
+
+// addIaNaOptions will add an IA_NA option to the response for each IA_NA
+// option in the request. Only the first is given the address of the lease.
+func (s *DhcpServer) addIaNaOptions(request, response *dhcpv6Message,
+	lease *leaseType) {
+	for _, option := range request.options {
+		if option.code != dhcpv6OptionIaNa || len(option.data) < 12 {
+			continue
+		}
+		response.addOption(dhcpv6OptionIaNa, makeIaNa(option.data, lease))
+		lease = nil
+	}
+}
+
+// confirmAddresses returns true if all the addresses in the IA_NA options of
+// the request are the address of the lease.
+func confirmAddresses(request *dhcpv6Message, lease *leaseType) bool {
+	for _, option := range request.options {
+		if option.code != dhcpv6OptionIaNa || len(option.data) < 12 {
+			continue
+		}
+		iaOptions, err := parseDhcpv6Options(option.data[12:])
+		if err != nil {
+			return false
+		}
+		for _, iaOption := range iaOptions {
+			if iaOption.code != dhcpv6OptionIaAddr ||
+				len(iaOption.data) < 16 {
+				continue
+			}
+			if !net.IP(iaOption.data[:16]).Equal(lease.Ipv6Address) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *DhcpServer) serveDhcpv6(conn *ipv6.PacketConn,
+	ifIndices map[int]string) {
+	buffer := make([]byte, 1500)
+	for {
+		length, cm, srcAddr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			s.logger.Println(err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if cm == nil {
+			continue
+		}
+		interfaceName, ok := ifIndices[cm.IfIndex]
+		if !ok {
+			continue
+		}
+		udpAddr, ok := srcAddr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		request, err := parseDhcpv6Message(buffer[:length])
+		if err != nil {
+			s.logger.Debugf(0, "%s from: %s on: %s\n",
+				err, udpAddr.IP, interfaceName)
+			continue
+		}
+		response := s.processDhcpv6Message(request, udpAddr.IP,
+			interfaceName)
+		if response == nil {
+			continue
+		}
+		_, err = conn.WriteTo(response.marshal(),
+			&ipv6.ControlMessage{IfIndex: cm.IfIndex},
+			&net.UDPAddr{
+				IP:   udpAddr.IP,
+				Port: udpAddr.Port,
+				Zone: interfaceName,
+			})
+		if err != nil {
+			s.logger.Printf("error sending DHCPv6 reply to: %s on: %s: %s\n",
+				udpAddr.IP, interfaceName, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package dhcpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+var (
+	testClientDuid = []byte{0, 3, 0, 1, 0x52, 0x54, 0x0a, 0, 0, 2}
+	testLinkLocal  = net.ParseIP("fe80::5054:aff:fe00:2")
+	testServerDuid = []byte{0, 3, 0, 1, 0x52, 0x54, 0, 0, 0, 1}
+)
+
+func makeTestDhcpv6Request(msgType byte,
+	options ...dhcpv6Option) *dhcpv6Message {
+	return &dhcpv6Message{
+		msgType:       msgType,
+		transactionId: [3]byte{1, 2, 3},
+		options:       options,
+	}
+}
+
+// makeTestIaNa returns an IA_NA option with the specified addresses.
+func makeTestIaNa(addresses ...string) dhcpv6Option {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint32(data, 7) // IAID.
+	for _, address := range addresses {
+		iaAddr := append(net.ParseIP(address).To16(), make([]byte, 8)...)
+		data = appendDhcpv6Option(data, dhcpv6OptionIaAddr, iaAddr)
+	}
+	return dhcpv6Option{code: dhcpv6OptionIaNa, data: data}
+}
+
+func newTestDhcpv6Server(t *testing.T) *DhcpServer {
+	return &DhcpServer{
+		logger:     testlogger.New(t),
+		serverDuid: testServerDuid,
+		staticLeases: map[string]leaseType{
+			"52:54:0a:00:00:02": {
+				Address: proto.Address{
+					IpAddress:   net.IPv4(10, 0, 0, 2).To4(),
+					Ipv6Address: net.ParseIP("2001:db8::a00:2"),
+					MacAddress:  "52:54:0a:00:00:02",
+				},
+				subnet: &subnetType{Subnet: proto.Subnet{
+					DomainName: "example.com",
+					DomainNameServers: []net.IP{
+						net.IPv4(10, 0, 0, 1).To4(),
+						net.ParseIP("2001:db8::53"),
+					},
+				}},
+			},
+			"52:54:0a:00:00:03": {
+				Address: proto.Address{
+					IpAddress:  net.IPv4(10, 0, 0, 3).To4(),
+					MacAddress: "52:54:0a:00:00:03",
+				},
+			},
+		},
+	}
+}
+
+// getIaAddresses returns the addresses in the IA_NA options of the response.
+// The value is true if the address has a non-zero valid lifetime.
+func getIaAddresses(t *testing.T, response *dhcpv6Message) map[string]bool {
+	addresses := make(map[string]bool)
+	for _, option := range response.options {
+		if option.code != dhcpv6OptionIaNa {
+			continue
+		}
+		iaOptions, err := parseDhcpv6Options(option.data[12:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, iaOption := range iaOptions {
+			if iaOption.code == dhcpv6OptionIaAddr {
+				addresses[net.IP(iaOption.data[:16]).String()] =
+					binary.BigEndian.Uint32(iaOption.data[20:]) > 0
+			}
+		}
+	}
+	return addresses
+}
+
+// getIaStatus returns the status code in the first IA_NA option of the
+// response, or -1 if there is no status code.
+func getIaStatus(t *testing.T, response *dhcpv6Message) int {
+	data, ok := response.getOption(dhcpv6OptionIaNa)
+	if !ok {
+		return -1
+	}
+	iaOptions, err := parseDhcpv6Options(data[12:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iaOption := range iaOptions {
+		if iaOption.code == dhcpv6OptionStatusCode {
+			return int(binary.BigEndian.Uint16(iaOption.data))
+		}
+	}
+	return -1
+}
+
+func TestProcessDhcpv6Message(t *testing.T) {
+	clientId := dhcpv6Option{code: dhcpv6OptionClientId, data: testClientDuid}
+	serverId := dhcpv6Option{code: dhcpv6OptionServerId, data: testServerDuid}
+	otherServerId := dhcpv6Option{code: dhcpv6OptionServerId,
+		data: []byte{0, 3, 0, 1, 0x52, 0x54, 0, 0, 0, 9}}
+	rapidCommit := dhcpv6Option{code: dhcpv6OptionRapidCommit}
+	otherLinkLocal := net.ParseIP("fe80::1234:5678:9abc:def0")
+	var tests = []struct {
+		name          string
+		request       *dhcpv6Message
+		srcAddr       net.IP
+		wantType      byte // Zero: no response.
+		wantAddresses map[string]bool
+		wantIaStatus  int
+	}{
+		{"solicit", makeTestDhcpv6Request(dhcpv6Solicit, clientId,
+			makeTestIaNa()),
+			testLinkLocal, dhcpv6Advertise,
+			map[string]bool{"2001:db8::a00:2": true}, -1},
+		{"solicit with rapid commit", makeTestDhcpv6Request(dhcpv6Solicit,
+			clientId, makeTestIaNa(), rapidCommit),
+			testLinkLocal, dhcpv6Reply,
+			map[string]bool{"2001:db8::a00:2": true}, -1},
+		{"solicit identified by DUID", makeTestDhcpv6Request(dhcpv6Solicit,
+			clientId, makeTestIaNa()),
+			otherLinkLocal, dhcpv6Advertise,
+			map[string]bool{"2001:db8::a00:2": true}, -1},
+		{"solicit without IPv6 address", makeTestDhcpv6Request(dhcpv6Solicit,
+			dhcpv6Option{code: dhcpv6OptionClientId,
+				data: []byte{0, 3, 0, 1, 0x52, 0x54, 0x0a, 0, 0, 3}},
+			makeTestIaNa()),
+			otherLinkLocal, 0, nil, -1},
+		{"solicit from unknown client", makeTestDhcpv6Request(dhcpv6Solicit,
+			dhcpv6Option{code: dhcpv6OptionClientId, data: []byte{0, 4, 1}},
+			makeTestIaNa()),
+			otherLinkLocal, 0, nil, -1},
+		{"request", makeTestDhcpv6Request(dhcpv6Request, clientId, serverId,
+			makeTestIaNa("2001:db8::a00:2")),
+			testLinkLocal, dhcpv6Reply,
+			map[string]bool{"2001:db8::a00:2": true}, -1},
+		{"request for other server", makeTestDhcpv6Request(dhcpv6Request,
+			clientId, otherServerId, makeTestIaNa("2001:db8::a00:2")),
+			testLinkLocal, 0, nil, -1},
+		{"request from unknown client", makeTestDhcpv6Request(dhcpv6Request,
+			dhcpv6Option{code: dhcpv6OptionClientId, data: []byte{0, 4, 1}},
+			serverId, makeTestIaNa()),
+			otherLinkLocal, dhcpv6Reply, map[string]bool{},
+			dhcpv6StatusNoAddrsAvail},
+		{"renew with stale address", makeTestDhcpv6Request(dhcpv6Renew,
+			clientId, serverId, makeTestIaNa("2001:db8::1")),
+			testLinkLocal, dhcpv6Reply,
+			map[string]bool{"2001:db8::a00:2": true, "2001:db8::1": false},
+			-1},
+		{"rebind from unknown client", makeTestDhcpv6Request(dhcpv6Rebind,
+			dhcpv6Option{code: dhcpv6OptionClientId, data: []byte{0, 4, 1}},
+			makeTestIaNa("2001:db8::1")),
+			otherLinkLocal, 0, nil, -1},
+		{"information request", makeTestDhcpv6Request(
+			dhcpv6InformationRequest),
+			testLinkLocal, dhcpv6Reply, map[string]bool{}, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestDhcpv6Server(t)
+			test.request.addOption(dhcpv6OptionRequest,
+				[]byte{0, dhcpv6OptionDnsServers, 0, dhcpv6OptionDomainList})
+			response := s.processDhcpv6Message(test.request, test.srcAddr,
+				"br0")
+			if test.wantType == 0 {
+				if response != nil {
+					t.Fatalf("unexpected response type: %d",
+						response.msgType)
+				}
+				return
+			}
+			if response == nil {
+				t.Fatal("no response")
+			}
+			if response.msgType != test.wantType {
+				t.Fatalf("response type = %d, want %d",
+					response.msgType, test.wantType)
+			}
+			if response.transactionId != test.request.transactionId {
+				t.Error("transaction ID not copied")
+			}
+			if id, _ := response.getOption(dhcpv6OptionServerId); !bytes.Equal(
+				id, testServerDuid) {
+				t.Errorf("server ID = %v, want %v", id, testServerDuid)
+			}
+			addresses := getIaAddresses(t, response)
+			if !reflect.DeepEqual(addresses, test.wantAddresses) {
+				t.Errorf("addresses = %v, want %v",
+					addresses, test.wantAddresses)
+			}
+			if status := getIaStatus(t, response); status != test.wantIaStatus {
+				t.Errorf("IA status = %d, want %d", status, test.wantIaStatus)
+			}
+			if test.srcAddr.Equal(testLinkLocal) {
+				dnsServers, _ := response.getOption(dhcpv6OptionDnsServers)
+				if !net.IP(dnsServers).Equal(net.ParseIP("2001:db8::53")) {
+					t.Errorf("DNS servers = %v", dnsServers)
+				}
+				domainList, _ := response.getOption(dhcpv6OptionDomainList)
+				want := []byte("\x07example\x03com\x00")
+				if !bytes.Equal(domainList, want) {
+					t.Errorf("domain list = %q, want %q", domainList, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmDhcpv6Addresses(t *testing.T) {
+	clientId := dhcpv6Option{code: dhcpv6OptionClientId, data: testClientDuid}
+	var tests = []struct {
+		name       string
+		addresses  []string
+		wantStatus uint16
+	}{
+		{"lease address", []string{"2001:db8::a00:2"}, dhcpv6StatusSuccess},
+		{"other address", []string{"2001:db8::1"}, dhcpv6StatusNotOnLink},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestDhcpv6Server(t)
+			response := s.processDhcpv6Message(
+				makeTestDhcpv6Request(dhcpv6Confirm, clientId,
+					makeTestIaNa(test.addresses...)),
+				testLinkLocal, "br0")
+			if response == nil {
+				t.Fatal("no response")
+			}
+			status, ok := response.getOption(dhcpv6OptionStatusCode)
+			if !ok {
+				t.Fatal("no status code")
+			}
+			if got := binary.BigEndian.Uint16(status); got != test.wantStatus {
+				t.Errorf("status = %d, want %d", got, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDhcpv6MessageRoundTrip(t *testing.T) {
+	request := makeTestDhcpv6Request(dhcpv6Solicit,
+		dhcpv6Option{code: dhcpv6OptionClientId, data: testClientDuid},
+		makeTestIaNa("2001:db8::1"))
+	parsed, err := parseDhcpv6Message(request.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, request) {
+		t.Errorf("parsed = %+v, want %+v", parsed, request)
+	}
+	if _, err := parseDhcpv6Message(request.marshal()[:9]); err == nil {
+		t.Error("truncated message parsed")
+	}
+}
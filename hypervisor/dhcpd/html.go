@@ -65,7 +65,7 @@ func (s *DhcpServer) writeDashboard(writer io.Writer) {
 	fmt.Fprintln(writer, "<b>Static leases</b><br>")
 	fmt.Fprintln(writer, `<table border="1">`)
 	tw, _ = html.NewTableWriter(writer, true,
-		"MAC", "IP", "Hostname", "SubnetID")
+		"MAC", "IP", "IPv6", "Hostname", "SubnetID")
 	staticLeases := make([]leaseType, 0, len(s.staticLeases))
 	for _, lease := range s.staticLeases {
 		staticLeases = append(staticLeases, lease)
@@ -75,8 +75,12 @@ func (s *DhcpServer) writeDashboard(writer io.Writer) {
 			staticLeases[j].Address.IpAddress.String())
 	})
 	for _, lease := range staticLeases {
+		var ipv6Addr string
+		if len(lease.Ipv6Address) > 0 {
+			ipv6Addr = lease.Ipv6Address.String()
+		}
 		tw.WriteRow("", "", lease.MacAddress, lease.IpAddress.String(),
-			lease.hostname, lease.subnet.Id)
+			ipv6Addr, lease.hostname, lease.subnet.Id)
 	}
 	tw.Close()
 	fmt.Fprintln(writer, "<br>")
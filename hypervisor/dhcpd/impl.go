@@ -171,6 +171,9 @@ func newServer(interfaceNames []string, dynamicLeasesFile string,
 			logger.Println(err)
 		}
 	}()
+	if err := dhcpServer.startDhcpv6(serveConn.ifIndices); err != nil {
+		logger.Printf("not serving DHCPv6: %s\n", err)
+	}
 	go dhcpServer.cleanupDynamicLeasesLoop(cleanupTriggerChannel)
 	html.HandleFunc("/showDhcpStatus", dhcpServer.showDhcpStatusHandler)
 	return dhcpServer, nil
@@ -710,7 +713,7 @@ func (s *DhcpServer) ServeDHCP(req dhcp.Packet, msgType dhcp.MessageType,
 				"did not request an IP, using: %s", reqIP.String()))
 		}
 		reqIP = util.ShrinkIP(reqIP)
-		s.notifyRequest(proto.Address{reqIP, macAddr})
+		s.notifyRequest(proto.Address{IpAddress: reqIP, MacAddress: macAddr})
 		server, ok := options[dhcp.OptionServerIdentifier]
 		if ok {
 			serverIP := net.IP(server)
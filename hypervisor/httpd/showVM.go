@@ -14,6 +14,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/html"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
 	"github.com/Cloud-Foundations/Dominator/lib/url"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
 var timeFormat string = "02 Jan 2006 15:04:05.99 MST"
@@ -86,6 +87,19 @@ func (s state) showVMHandler(w http.ResponseWriter, req *http.Request) {
 			writeString(writer, "Hostname", vm.Hostname)
 		}
 		writeString(writer, "MAC Address", vm.Address.MacAddress)
+		if len(vm.Address.Ipv6Address) > 0 {
+			writeString(writer, "IPv6 Address (DHCPv6)",
+				vm.Address.Ipv6Address.String())
+		}
+		for _, subnet := range s.manager.ListSubnets(false) {
+			if subnet.Id != vm.SubnetId {
+				continue
+			}
+			ipv6Addr, _ := subnet.MakeIpv6Address(vm.Address.MacAddress)
+			if ipv6Addr != nil {
+				writeString(writer, "IPv6 Address", ipv6Addr.String())
+			}
+		}
 		if vm.ImageName != "" {
 			image := fmt.Sprintf("<a href=\"http://%s/showImage?%s\">%s</a>",
 				s.manager.GetImageServerAddress(), vm.ImageName, vm.ImageName)
@@ -98,12 +112,53 @@ func (s state) showVMHandler(w http.ResponseWriter, req *http.Request) {
 		writeTime(writer, "Created on", vm.CreatedOn)
 		writeTime(writer, "Last state change", vm.ChangedStateOn)
 		writeString(writer, "State", vm.State.String())
+		if vm.RestartPolicy != proto.RestartPolicyNever {
+			writeString(writer, "Restart policy", vm.RestartPolicy.String())
+		}
+		if vm.NumRestarts > 0 {
+			writeUint64(writer, "Automatic restarts", uint64(vm.NumRestarts))
+			writeTime(writer, "Last automatic restart", vm.LastRestartTime)
+		}
 		writeString(writer, "RAM", format.FormatBytes(vm.MemoryInMiB<<20))
 		writeString(writer, "CPU", format.FormatMilli(uint64(vm.MilliCPUs)))
+		if placement := vm.NumaPlacement; placement != nil {
+			writeUint64(writer, "NUMA node", uint64(placement.NodeId))
+		}
 		writeStrings(writer, "Volume sizes", volumeSizes)
 		writeString(writer, "Total storage", format.FormatBytes(storage))
+		if limits := vm.NetworkLimits; !limits.IsZero() {
+			writeString(writer, "Network limits", formatNetworkLimits(limits))
+		}
 		writeStrings(writer, "Owner groups", vm.OwnerGroups)
 		writeStrings(writer, "Owner users", vm.OwnerUsers)
+		if schedule := vm.SnapshotSchedule; schedule != nil {
+			description := fmt.Sprintf("every %s, keep %d",
+				format.Duration(schedule.Interval), schedule.RetentionCount)
+			if schedule.Quiesce {
+				description += ", quiesce"
+			}
+			writeString(writer, "Snapshot schedule", description)
+		}
+		for _, snapshot := range vm.Snapshots {
+			var size uint64
+			for _, volume := range vm.Volumes {
+				size += volume.Snapshots[snapshot.Name]
+			}
+			writeString(writer, "Snapshot "+snapshot.Name,
+				fmt.Sprintf("%s, %s (%s ago)", format.FormatBytes(size),
+					snapshot.CreatedOn.Format(timeFormat),
+					format.Duration(time.Since(snapshot.CreatedOn))))
+		}
+		for _, backup := range vm.Backups {
+			description := fmt.Sprintf("%x", backup.ManifestHash[:8])
+			if backup.ImageName != "" {
+				description = backup.ImageName + ", " + description
+			}
+			writeString(writer, "Backup "+backup.Name,
+				fmt.Sprintf("%s, %s (%s ago)", description,
+					backup.CreatedOn.Format(timeFormat),
+					format.Duration(time.Since(backup.CreatedOn))))
+		}
 		if vm.IdentityName != "" {
 			writeString(writer, "Identity name",
 				fmt.Sprintf("%s, %s",
@@ -128,6 +183,8 @@ func (s state) showVMHandler(w http.ResponseWriter, req *http.Request) {
 					ipAddr))
 		}
 		fmt.Fprintln(writer, "</table>")
+		history, _ := s.manager.GetVmUsageHistory(netIpAddr)
+		writeVmUsage(writer, history)
 		fmt.Fprintln(writer, "<br>Tags:<br>")
 		fmt.Fprintln(writer, `<table border="1">`)
 		tw, _ := html.NewTableWriter(writer, true, "Name", "Value")
@@ -151,6 +208,27 @@ func (s state) showVMHandler(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func formatNetworkLimits(limits *proto.NetworkLimits) string {
+	var fields []string
+	if limits.EgressBitsPerSecond > 0 {
+		fields = append(fields, fmt.Sprintf("egress %d b/s",
+			limits.EgressBitsPerSecond))
+	}
+	if limits.EgressPacketsPerSecond > 0 {
+		fields = append(fields, fmt.Sprintf("egress %d packets/s",
+			limits.EgressPacketsPerSecond))
+	}
+	if limits.IngressBitsPerSecond > 0 {
+		fields = append(fields, fmt.Sprintf("ingress %d b/s",
+			limits.IngressBitsPerSecond))
+	}
+	if limits.IngressPacketsPerSecond > 0 {
+		fields = append(fields, fmt.Sprintf("ingress %d packets/s",
+			limits.IngressPacketsPerSecond))
+	}
+	return strings.Join(fields, ", ")
+}
+
 func makeExpiration(value time.Time) string {
 	expiresIn := time.Until(value)
 	if expiresIn >= 0 {
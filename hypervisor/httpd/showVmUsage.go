@@ -0,0 +1,123 @@
+package httpd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+var sparklineBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// makeSparkline returns a string of block characters, one for each value,
+// scaled to the maximum value.
+func makeSparkline(values []uint64) string {
+	var maxValue uint64
+	for _, value := range values {
+		if value > maxValue {
+			maxValue = value
+		}
+	}
+	var builder strings.Builder
+	for _, value := range values {
+		index := 0
+		if maxValue > 0 {
+			index = int(value * uint64(len(sparklineBlocks)-1) / maxValue)
+		}
+		builder.WriteRune(sparklineBlocks[index])
+	}
+	return builder.String()
+}
+
+func writeUsageRow(tw *html.TableWriter, name string,
+	history []proto.VmUsage, getValue func(proto.VmUsage) uint64,
+	formatValue func(uint64) string) {
+	values := make([]uint64, 0, len(history))
+	var maxValue uint64
+	for _, usage := range history {
+		value := getValue(usage)
+		values = append(values, value)
+		if value > maxValue {
+			maxValue = value
+		}
+	}
+	tw.WriteRow("", "",
+		name,
+		formatValue(values[len(values)-1]),
+		formatValue(maxValue),
+		"<tt>"+makeSparkline(values)+"</tt>")
+}
+
+// writeVmUsage writes a table showing the recent resource usage for a VM.
+func writeVmUsage(writer io.Writer, history []proto.VmUsage) {
+	if len(history) < 1 {
+		return
+	}
+	period := history[len(history)-1].SampleTime.Sub(history[0].SampleTime) +
+		history[0].Period
+	fmt.Fprintf(writer, "<br>Usage (last %s):<br>\n", format.Duration(period))
+	fmt.Fprintln(writer, `<table border="1">`)
+	tw, _ := html.NewTableWriter(writer, true, "Resource", "Current", "Peak",
+		"History")
+	formatBytes := func(value uint64) string {
+		return format.FormatBytes(value)
+	}
+	formatMilli := func(value uint64) string {
+		return format.FormatMilli(value)
+	}
+	formatRate := func(value uint64) string {
+		return format.FormatBytes(value) + "/s"
+	}
+	formatOpsRate := func(value uint64) string {
+		return fmt.Sprintf("%d/s", value)
+	}
+	writeUsageRow(tw, "CPU", history,
+		func(usage proto.VmUsage) uint64 { return usage.MilliCPUs },
+		formatMilli)
+	writeUsageRow(tw, "Memory", history,
+		func(usage proto.VmUsage) uint64 { return usage.MemoryInMiB << 20 },
+		formatBytes)
+	if history[len(history)-1].BalloonMemoryInMiB > 0 {
+		writeUsageRow(tw, "Balloon memory", history,
+			func(usage proto.VmUsage) uint64 {
+				return usage.BalloonMemoryInMiB << 20
+			},
+			formatBytes)
+	}
+	writeUsageRow(tw, "Block read", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.BlockRead.BytesPerSecond
+		},
+		formatRate)
+	writeUsageRow(tw, "Block write", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.BlockWrite.BytesPerSecond
+		},
+		formatRate)
+	writeUsageRow(tw, "Block requests", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.BlockRead.OperationsPerSecond +
+				usage.BlockWrite.OperationsPerSecond
+		},
+		formatOpsRate)
+	writeUsageRow(tw, "Network receive", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.NetworkReceive.BytesPerSecond
+		},
+		formatRate)
+	writeUsageRow(tw, "Network transmit", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.NetworkTransmit.BytesPerSecond
+		},
+		formatRate)
+	writeUsageRow(tw, "Network packets", history,
+		func(usage proto.VmUsage) uint64 {
+			return usage.NetworkReceive.OperationsPerSecond +
+				usage.NetworkTransmit.OperationsPerSecond
+		},
+		formatOpsRate)
+	tw.Close()
+}
@@ -70,6 +70,9 @@ func (m *Manager) addAddressesToPool(addresses []proto.Address) error {
 		if address.IpAddress != nil {
 			registeredIpAddresses[address.IpAddress.String()] = struct{}{}
 		}
+		if address.Ipv6Address != nil {
+			registeredIpAddresses[address.Ipv6Address.String()] = struct{}{}
+		}
 		registeredMacAddresses[address.MacAddress] = struct{}{}
 	}
 	ipAddressToVm := make(map[string]*vmInfoType, len(m.vms))
@@ -95,9 +98,24 @@ func (m *Manager) addAddressesToPool(addresses []proto.Address) error {
 						"VM %s has different MAC address: %s than is being added: %s",
 						ipAddrString, vm.Address.MacAddress, address.MacAddress)
 				}
+				if !proto.CompareIPs(address.Ipv6Address,
+					vm.Address.Ipv6Address) {
+					return fmt.Errorf(
+						"VM %s has different IPv6 address: %s than is being added: %s",
+						ipAddrString, vm.Address.Ipv6Address,
+						address.Ipv6Address)
+				}
 				used = vm
 			}
 		}
+		if err := m.checkIpv6Address(address); err != nil {
+			return err
+		}
+		if ipAddr := address.Ipv6Address; ipAddr != nil {
+			if _, ok := registeredIpAddresses[ipAddr.String()]; ok {
+				return fmt.Errorf("duplicate IP address: %s", ipAddr)
+			}
+		}
 		if _, ok := registeredMacAddresses[address.MacAddress]; ok {
 			return fmt.Errorf("duplicate MAC address: %s", address.MacAddress)
 		}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/backoffdelay"
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
 	"github.com/Cloud-Foundations/Dominator/lib/lockwatcher"
@@ -44,6 +45,11 @@ type DhcpServer interface {
 	RemoveSubnet(subnetId string)
 }
 
+type RouterAdvertiser interface {
+	AddSubnet(subnet proto.Subnet, interfaceName string)
+	RemoveSubnet(subnetId string)
+}
+
 type Manager struct {
 	StartOptions
 	healthStatusMutex sync.RWMutex
@@ -52,6 +58,9 @@ type Manager struct {
 	memTotalInMiB     uint64
 	notifiersMutex    sync.Mutex
 	notifiers         map[<-chan proto.Update]chan<- proto.Update
+	numactlPath       string
+	numaMutex         sync.Mutex // Lock VM NUMA allocations.
+	numaNodes         []numaNodeType
 	numCPUs           uint
 	objectCache       *cachingreader.ObjectServer
 	objectVolumeIndex int // -1: not on a volume mount, else index of mount.
@@ -87,8 +96,10 @@ type StartOptions struct {
 	LockLogTimeout       time.Duration
 	LocalImagesDirectory string
 	Logger               log.DebugLogger
+	NumaPlacement        bool
 	ObjectCacheDirectory string
 	ObjectCacheBytes     uint64
+	RouterAdvertiser     RouterAdvertiser // May be nil.
 	ShowVgaConsole       bool
 	StateDir             string
 	Username             string
@@ -111,6 +122,8 @@ type summaryData struct {
 
 type vmInfoType struct {
 	lockWatcher                *lockwatcher.LockWatcher
+	qmpMutex                   sync.Mutex // Serialise QMP clients.
+	usage                      vmUsageType
 	mutex                      sync.RWMutex
 	accessToken                []byte
 	accessTokenCleanupNotifier chan<- struct{}
@@ -122,13 +135,19 @@ type vmInfoType struct {
 	hasHealthAgent             bool
 	identityProviderNotifier   chan<- time.Time
 	identityProviderTransport  *http.Transport
+	incomingLiveMigration      bool // Start QEMU paused, waiting for state.
 	ipAddress                  string
+	lastSnapshotAttempt        time.Time                    // Scheduled snapshots.
+	liveMigrationStreams       chan liveMigrationStreamType // Source only.
 	logger                     log.DebugLogger
 	manager                    *Manager
 	metadataChannels           map[chan<- string]struct{}
 	monitorSockname            string
+	numaAllocation             *numaAllocationType // Manager.numaMutex.
 	blockMutations             bool
 	ownerUsers                 map[string]struct{}
+	restartBackoff             *backoffdelay.Exponential
+	restartTimes               []time.Time // Automatic restarts.
 	serialInput                io.Writer
 	serialOutput               chan<- byte
 	stoppedNotifier            chan<- struct{}
@@ -158,6 +177,11 @@ func (m *Manager) AddVmVolumes(ipAddr net.IP,
 	return m.addVmVolumes(ipAddr, authInfo, volumeSizes)
 }
 
+func (m *Manager) BackupVm(authInfo *srpc.AuthInformation,
+	request proto.BackupVmRequest) (*proto.BackupVmResponse, error) {
+	return m.backupVm(authInfo, request)
+}
+
 func (m *Manager) BecomePrimaryVmOwner(ipAddr net.IP,
 	authInfo *srpc.AuthInformation) error {
 	return m.becomePrimaryVmOwner(ipAddr, authInfo)
@@ -192,6 +216,11 @@ func (m *Manager) ChangeVmMachineType(ipAddr net.IP,
 	return m.changeVmMachineType(ipAddr, authInfo, machineType)
 }
 
+func (m *Manager) ChangeVmNetworkLimits(ipAddr net.IP,
+	authInfo *srpc.AuthInformation, limits proto.NetworkLimits) error {
+	return m.changeVmNetworkLimits(ipAddr, authInfo, limits)
+}
+
 func (m *Manager) ChangeVmNumNetworkQueues(ipAddr net.IP,
 	authInfo *srpc.AuthInformation, numQueuesPerInterface []uint) error {
 	return m.changeVmNumNetworkQueues(ipAddr, authInfo, numQueuesPerInterface)
@@ -207,11 +236,22 @@ func (m *Manager) ChangeVmOwnerUsers(ipAddr net.IP,
 	return m.changeVmOwnerUsers(ipAddr, authInfo, extraUsers)
 }
 
+func (m *Manager) ChangeVmRestartPolicy(ipAddr net.IP,
+	authInfo *srpc.AuthInformation, restartPolicy proto.RestartPolicy) error {
+	return m.changeVmRestartPolicy(ipAddr, authInfo, restartPolicy)
+}
+
 func (m *Manager) ChangeVmSize(authInfo *srpc.AuthInformation,
 	req proto.ChangeVmSizeRequest) error {
 	return m.changeVmSize(authInfo, req)
 }
 
+func (m *Manager) ChangeVmSnapshotSchedule(ipAddr net.IP,
+	authInfo *srpc.AuthInformation,
+	snapshotSchedule proto.SnapshotSchedule) error {
+	return m.changeVmSnapshotSchedule(ipAddr, authInfo, snapshotSchedule)
+}
+
 func (m *Manager) ChangeVmSubnet(authInfo *srpc.AuthInformation,
 	req proto.ChangeVmSubnetRequest) (*proto.ChangeVmSubnetResponse, error) {
 	return m.changeVmSubnet(authInfo, req)
@@ -265,6 +305,10 @@ func (m *Manager) ConnectToVmConsole(ipAddr net.IP,
 	return m.connectToVmConsole(ipAddr, authInfo)
 }
 
+func (m *Manager) ConnectToVmLiveMigration(conn *srpc.Conn) error {
+	return m.connectToVmLiveMigration(conn)
+}
+
 func (m *Manager) ConnectToVmManager(ipAddr net.IP) (
 	chan<- byte, <-chan byte, error) {
 	return m.connectToVmManager(ipAddr)
@@ -428,6 +472,18 @@ func (m *Manager) GetVmVirtualiserLogFile(ipAddr net.IP,
 	return m.getVmVirtualiserLogFile(ipAddr, authInfo, filename)
 }
 
+// GetVmUsage returns the recent resource usage for a VM, or nil if not
+// available.
+func (m *Manager) GetVmUsage(ipAddr net.IP) (*proto.VmUsage, error) {
+	return m.getVmUsage(ipAddr)
+}
+
+// GetVmUsageHistory returns the resource usage for a VM for each recent
+// collection interval, oldest first.
+func (m *Manager) GetVmUsageHistory(ipAddr net.IP) ([]proto.VmUsage, error) {
+	return m.getVmUsageHistory(ipAddr)
+}
+
 func (m *Manager) GetVmVolume(conn *srpc.Conn) error {
 	return m.getVmVolume(conn)
 }
@@ -456,6 +512,14 @@ func (m *Manager) ImportLocalVm(authInfo *srpc.AuthInformation,
 	return m.importLocalVm(authInfo, request)
 }
 
+// InstallIpv6SourceFilters will (re)create the ebtables filters which ensure
+// that IPv6 requests to the metadata service from each running VM have a source
+// address belonging to the VM. It must be called after the ebtables filter
+// table is flushed.
+func (m *Manager) InstallIpv6SourceFilters() error {
+	return m.installIpv6SourceFilters()
+}
+
 func (m *Manager) ListAvailableAddresses() []proto.Address {
 	return m.listAvailableAddresses()
 }
@@ -481,6 +545,14 @@ func (m *Manager) ListVolumeDirectories() []string {
 	return m.volumeDirectories
 }
 
+// LookupVmByIpv6Address returns the primary IP address of the VM which has
+// an interface with the autoconfigured (link-local or global) IPv6 address
+// ipAddr. The address is only trustworthy for requests which have passed the
+// filters installed by InstallIpv6SourceFilters.
+func (m *Manager) LookupVmByIpv6Address(ipAddr net.IP) (net.IP, error) {
+	return m.lookupVmByIpv6Address(ipAddr)
+}
+
 func (m *Manager) MakeSubnetChannel() <-chan proto.Subnet {
 	return m.makeSubnetChannel()
 }
@@ -587,6 +659,10 @@ func (m *Manager) ScanVmRoot(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	return m.scanVmRoot(ipAddr, authInfo, scanFilter)
 }
 
+func (m *Manager) ServeVmLiveMigration(conn *srpc.Conn) error {
+	return m.serveVmLiveMigration(conn)
+}
+
 func (m *Manager) SetDisabledState(disable bool) error {
 	return m.setDisabledState(disable)
 }
@@ -596,9 +672,10 @@ func (m *Manager) ShutdownVMsAndExit() {
 }
 
 func (m *Manager) SnapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
-	forceIfNotStopped, snapshotRootOnly bool, snapshotName string) error {
+	forceIfNotStopped, snapshotRootOnly, quiesce bool,
+	snapshotName string) error {
 	return m.snapshotVm(ipAddr, authInfo, forceIfNotStopped, snapshotRootOnly,
-		snapshotName)
+		quiesce, snapshotName)
 }
 
 func (m *Manager) StartVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
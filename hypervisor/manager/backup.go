@@ -0,0 +1,341 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	imclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	backupCheckBatchSize   = 16 // Number of chunks to check at a time.
+	backupDefaultChunkSize = 4 << 20
+	backupMaximumChunkSize = 64 << 20
+	backupMinimumChunkSize = 64 << 10
+	backupMinimumLifetime  = 15 * time.Minute
+)
+
+type backupChunkType struct {
+	data    []byte
+	hashVal hash.Hash
+}
+
+type backupWriterType struct {
+	chunkSize  uint64
+	chunkSizes map[hash.Hash]uint64 // Chunks known to be in object server.
+	objSrv     objectserver.ObjectServer
+	pending    []backupChunkType
+	response   *proto.BackupVmResponse
+}
+
+// makeBackupImage will make an image which references the backup manifest and
+// chunks, so that the image server will not garbage collect them until the
+// image is deleted or expires.
+func makeBackupImage(manifestHash hash.Hash, manifestSize uint64,
+	chunkSizes map[hash.Hash]uint64, expiresAt time.Time) *image.Image {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	fs.DirectoryInode.Mode = filesystem.FileMode(0755)
+	addFile := func(name string, hashVal hash.Hash, size uint64) {
+		inode := &filesystem.RegularInode{
+			Mode: filesystem.FileMode(0444),
+			Hash: hashVal,
+			Size: size,
+		}
+		inodeNumber := uint64(len(fs.InodeTable) + 1)
+		fs.InodeTable[inodeNumber] = inode
+		dirent := &filesystem.DirectoryEntry{
+			Name:        name,
+			InodeNumber: inodeNumber,
+		}
+		dirent.SetInode(inode)
+		fs.DirectoryInode.EntryList = append(fs.DirectoryInode.EntryList,
+			dirent)
+	}
+	addFile(proto.BackupManifestFilename, manifestHash, manifestSize)
+	for hashVal, size := range chunkSizes {
+		addFile(fmt.Sprintf("%x", hashVal), hashVal, size)
+	}
+	sort.Slice(fs.DirectoryInode.EntryList, func(left, right int) bool {
+		return fs.DirectoryInode.EntryList[left].Name <
+			fs.DirectoryInode.EntryList[right].Name
+	})
+	fs.ComputeTotalDataBytes()
+	return &image.Image{ExpiresAt: expiresAt, FileSystem: fs}
+}
+
+// removeExpiredBackups will remove the backups whose images have expired from
+// the list of backups. The VM lock must be held.
+func (vm *vmInfoType) removeExpiredBackups(now time.Time) {
+	backups := make([]proto.BackupInfo, 0, len(vm.Backups))
+	for _, backup := range vm.Backups {
+		if backup.ExpiresAt.IsZero() || backup.ExpiresAt.After(now) {
+			backups = append(backups, backup)
+		}
+	}
+	vm.Backups = backups
+}
+
+func (m *Manager) backupVm(authInfo *srpc.AuthInformation,
+	request proto.BackupVmRequest) (*proto.BackupVmResponse, error) {
+	if request.ImageName == "" {
+		return nil, errors.New("no image name specified for backup")
+	}
+	chunkSize := request.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = backupDefaultChunkSize
+	} else if chunkSize < backupMinimumChunkSize {
+		return nil, errors.New("chunk size must be at least " +
+			format.FormatBytes(backupMinimumChunkSize))
+	} else if chunkSize > backupMaximumChunkSize {
+		return nil, errors.New("chunk size must be at most " +
+			format.FormatBytes(backupMaximumChunkSize))
+	}
+	if request.ExpiresIn > 0 && request.ExpiresIn < backupMinimumLifetime {
+		return nil, errors.New("backup lifetime must be at least " +
+			format.Duration(backupMinimumLifetime))
+	}
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true, authInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	vm.blockMutations = true
+	state := vm.State
+	vm.mutex.Unlock()
+	defer vm.allowMutationsAndUnlock(false)
+	if vm.getActiveInitrdPath() != "" || vm.getActiveKernelPath() != "" {
+		return nil,
+			errors.New("cannot back up VM with separate kernel or initrd")
+	}
+	if state != proto.StateStopped {
+		if !request.ForceIfNotStopped {
+			return nil, errors.New("VM is not stopped")
+		}
+	}
+	if request.Quiesce {
+		if err := checkQuiescableVolumes(vm.Volumes); err != nil {
+			return nil, err
+		}
+	}
+	address := request.ImageServer
+	if address == "" {
+		address = m.ImageServerAddress
+	}
+	client, err := srpc.DialHTTP("tcp", address, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to image server: %s: %s",
+			address, err)
+	}
+	defer client.Close()
+	if exists, err := imclient.CheckImage(client, request.ImageName); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, fmt.Errorf("image: %s already exists", request.ImageName)
+	}
+	objClient := objectclient.AttachObjectClient(client)
+	defer objClient.Close()
+	response := &proto.BackupVmResponse{}
+	writer := &backupWriterType{
+		chunkSize:  chunkSize,
+		chunkSizes: make(map[hash.Hash]uint64),
+		objSrv:     objClient,
+		response:   response,
+	}
+	startTime := time.Now()
+	vm.mutex.RLock()
+	manifest := proto.BackupManifest{
+		ChunkSize: chunkSize,
+		CreatedOn: startTime,
+		Name:      request.Name,
+		VmInfo:    vm.VmInfo,
+	}
+	manifest.VmInfo.Volumes = make([]proto.Volume, len(vm.Volumes))
+	copy(manifest.VmInfo.Volumes, vm.Volumes)
+	volumeLocations := make([]proto.LocalVolume, len(vm.VolumeLocations))
+	copy(volumeLocations, vm.VolumeLocations)
+	vm.mutex.RUnlock()
+	// Backups and snapshots are local to this VM: they cannot be restored.
+	manifest.VmInfo.Backups = nil
+	manifest.VmInfo.Snapshots = nil
+	manifest.VmInfo.SnapshotSchedule = nil
+	for index := range manifest.VmInfo.Volumes {
+		manifest.VmInfo.Volumes[index].Snapshots = nil
+	}
+	filenames := make([]string, 0, len(volumeLocations))
+	for _, volume := range volumeLocations {
+		filenames = append(filenames, volume.Filename)
+	}
+	if request.Quiesce && state == proto.StateRunning {
+		// Copy the volumes at a single point in time and back up the copies.
+		copyFilenames := make([]string, 0, len(volumeLocations))
+		for _, filename := range filenames {
+			copyFilename := filename + ".backup"
+			if err := removeFile(copyFilename); err != nil {
+				return nil, err
+			}
+			copyFilenames = append(copyFilenames, copyFilename)
+		}
+		manifest.Quiesced, err = vm.copyVolumesQuiesced(volumeLocations,
+			copyFilenames)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			for _, filename := range copyFilenames {
+				os.Remove(filename)
+			}
+		}()
+		filenames = copyFilenames
+	}
+	for _, filename := range filenames {
+		backupVolume, err := writer.writeFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Volumes = append(manifest.Volumes, *backupVolume)
+	}
+	userData, err := writer.writeFile(filepath.Join(vm.dirname, UserDataFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		manifest.UserData = userData
+	}
+	buffer := &bytes.Buffer{}
+	if err := json.WriteWithIndent(buffer, "    ", manifest); err != nil {
+		return nil, err
+	}
+	manifestSize := uint64(buffer.Len())
+	response.ManifestHash, _, err = objClient.AddObject(buffer, manifestSize,
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("error adding backup manifest: %s", err)
+	}
+	var expiresAt time.Time
+	if request.ExpiresIn > 0 {
+		expiresAt = startTime.Add(request.ExpiresIn)
+	}
+	img := makeBackupImage(response.ManifestHash, manifestSize,
+		writer.chunkSizes, expiresAt)
+	if err := imclient.AddImage(client, request.ImageName, img); err != nil {
+		return nil, fmt.Errorf("error adding backup image: %s", err)
+	}
+	vm.logger.Printf(
+		"backed up to: %s:%s in %s, sent %d of %d chunks (%s)\n",
+		address, request.ImageName, format.Duration(time.Since(startTime)),
+		response.NewChunks, response.TotalChunks,
+		format.FormatBytes(response.NewBytes))
+	vm.mutex.Lock()
+	vm.removeExpiredBackups(time.Now())
+	vm.Backups = append(vm.Backups, proto.BackupInfo{
+		CreatedOn:    startTime,
+		ExpiresAt:    expiresAt,
+		ImageName:    request.ImageName,
+		ImageServer:  request.ImageServer,
+		ManifestHash: response.ManifestHash,
+		Name:         request.Name,
+		Quiesced:     manifest.Quiesced,
+	})
+	vm.writeAndSendInfo()
+	vm.mutex.Unlock()
+	return response, nil
+}
+
+// flush will check which of the pending chunks are missing from the object
+// server and will add them.
+func (w *backupWriterType) flush() error {
+	if len(w.pending) < 1 {
+		return nil
+	}
+	hashes := make([]hash.Hash, 0, len(w.pending))
+	for _, chunk := range w.pending {
+		hashes = append(hashes, chunk.hashVal)
+	}
+	sizes, err := w.objSrv.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	for index, chunk := range w.pending {
+		if sizes[index] > 0 {
+			continue
+		}
+		_, _, err := w.objSrv.AddObject(bytes.NewReader(chunk.data),
+			uint64(len(chunk.data)), &chunk.hashVal)
+		if err != nil {
+			return err
+		}
+		w.response.NewBytes += uint64(len(chunk.data))
+		w.response.NewChunks++
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// write will split size bytes from reader into chunks and will add chunks
+// which are not already present to the object server.
+func (w *backupWriterType) write(reader io.Reader, size uint64) (
+	*proto.BackupVolume, error) {
+	volume := &proto.BackupVolume{
+		Chunks: make([]hash.Hash, 0, (size+w.chunkSize-1)/w.chunkSize),
+		Size:   size,
+	}
+	for offset := uint64(0); offset < size; {
+		length := w.chunkSize
+		if length > size-offset {
+			length = size - offset
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		offset += length
+		hashVal := hash.Hash(sha512.Sum512(data))
+		volume.Chunks = append(volume.Chunks, hashVal)
+		w.response.TotalChunks++
+		if _, ok := w.chunkSizes[hashVal]; ok {
+			continue
+		}
+		w.chunkSizes[hashVal] = length
+		w.pending = append(w.pending,
+			backupChunkType{data: data, hashVal: hashVal})
+		if len(w.pending) >= backupCheckBatchSize {
+			if err := w.flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
+func (w *backupWriterType) writeFile(filename string) (
+	*proto.BackupVolume, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return w.write(file, uint64(fi.Size()))
+}
@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/memory"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const testChunkSize = 4096
+
+func makeBackupData(fills ...byte) []byte {
+	data := make([]byte, 0, len(fills)*testChunkSize)
+	for _, fill := range fills {
+		data = append(data, bytes.Repeat([]byte{fill}, testChunkSize)...)
+	}
+	return data
+}
+
+func newTestBackupWriter(objSrv objectserver.ObjectServer) *backupWriterType {
+	return &backupWriterType{
+		chunkSize:  testChunkSize,
+		chunkSizes: make(map[hash.Hash]uint64),
+		objSrv:     objSrv,
+		response:   &proto.BackupVmResponse{},
+	}
+}
+
+func writeTestBackup(t *testing.T, writer *backupWriterType,
+	data []byte) *proto.BackupVolume {
+	volume, err := writer.write(bytes.NewReader(data), uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return volume
+}
+
+func TestBackupWriterChunking(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	writer := newTestBackupWriter(objSrv)
+	// The first two chunks are identical and the last chunk is short.
+	data := append(makeBackupData(0, 0, 1), 2, 3)
+	volume := writeTestBackup(t, writer, data)
+	if volume.Size != uint64(len(data)) {
+		t.Errorf("Size = %d, want %d", volume.Size, len(data))
+	}
+	var wantChunks []hash.Hash
+	for offset := 0; offset < len(data); offset += testChunkSize {
+		end := offset + testChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		wantChunks = append(wantChunks, sha512.Sum512(data[offset:end]))
+	}
+	if len(volume.Chunks) != len(wantChunks) {
+		t.Fatalf("got %d chunks, want %d",
+			len(volume.Chunks), len(wantChunks))
+	}
+	for index, hashVal := range volume.Chunks {
+		if hashVal != wantChunks[index] {
+			t.Errorf("chunk: %d has wrong hash", index)
+		}
+	}
+	response := writer.response
+	if response.TotalChunks != 4 || response.NewChunks != 3 {
+		t.Errorf("TotalChunks = %d, NewChunks = %d, want 4, 3",
+			response.TotalChunks, response.NewChunks)
+	}
+	if response.NewBytes != 2*testChunkSize+2 {
+		t.Errorf("NewBytes = %d, want %d",
+			response.NewBytes, 2*testChunkSize+2)
+	}
+	if size := writer.chunkSizes[wantChunks[3]]; size != 2 {
+		t.Errorf("short chunk size = %d, want 2", size)
+	}
+}
+
+func TestBackupWriterIncremental(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	data := makeBackupData(1, 2, 3, 4)
+	first := writeTestBackup(t, newTestBackupWriter(objSrv), data)
+	// Change one chunk and back up again with a new writer, as for a later
+	// backup. Only the changed chunk should be sent.
+	copy(data[testChunkSize:], makeBackupData(5))
+	writer := newTestBackupWriter(objSrv)
+	second := writeTestBackup(t, writer, data)
+	if writer.response.NewChunks != 1 {
+		t.Errorf("NewChunks = %d, want 1", writer.response.NewChunks)
+	}
+	if writer.response.NewBytes != testChunkSize {
+		t.Errorf("NewBytes = %d, want %d",
+			writer.response.NewBytes, testChunkSize)
+	}
+	for index := range first.Chunks {
+		changed := first.Chunks[index] != second.Chunks[index]
+		if changed != (index == 1) {
+			t.Errorf("chunk: %d changed: %t", index, changed)
+		}
+	}
+}
+
+func TestBackupSurvivesGarbageCollection(t *testing.T) {
+	objSrv, err := filesystem.NewObjectServer(t.TempDir(), testlogger.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := newTestBackupWriter(objSrv)
+	volume := writeTestBackup(t, writer, append(makeBackupData(1, 1, 2), 3))
+	manifest := []byte(`{"ChunkSize": 4096}`)
+	manifestHash, _, err := objSrv.AddObject(bytes.NewReader(manifest),
+		uint64(len(manifest)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated := []byte("unreferenced")
+	unrelatedHash, _, err := objSrv.AddObject(bytes.NewReader(unrelated),
+		uint64(len(unrelated)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := makeBackupImage(manifestHash, uint64(len(manifest)),
+		writer.chunkSizes, time.Time{})
+	if err := img.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	// This is what the image server does when the image is added.
+	if err := objSrv.AdjustRefcounts(true, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := objSrv.DeleteUnreferenced(100, 0); err != nil {
+		t.Fatal(err)
+	}
+	hashes := append([]hash.Hash{manifestHash, unrelatedHash},
+		volume.Chunks...)
+	sizes, err := objSrv.CheckObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes[1] != 0 {
+		t.Error("unreferenced object not garbage collected")
+	}
+	if sizes[0] != uint64(len(manifest)) {
+		t.Error("manifest garbage collected")
+	}
+	for index, size := range sizes[2:] {
+		if size < 1 {
+			t.Errorf("chunk: %d garbage collected", index)
+		}
+	}
+	if img.FileSystem.TotalDataBytes != uint64(len(manifest))+
+		2*testChunkSize+1 {
+		t.Errorf("TotalDataBytes = %d", img.FileSystem.TotalDataBytes)
+	}
+}
+
+func TestBackupExpiration(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	img := makeBackupImage(hash.Hash{}, 0, nil, expiresAt)
+	if !img.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("image ExpiresAt = %s, want %s", img.ExpiresAt, expiresAt)
+	}
+	vm := &vmInfoType{}
+	vm.Backups = []proto.BackupInfo{
+		{ImageName: "expired", ExpiresAt: now.Add(-time.Minute)},
+		{ImageName: "permanent"},
+		{ImageName: "current", ExpiresAt: expiresAt},
+	}
+	vm.removeExpiredBackups(now)
+	var names []string
+	for _, backup := range vm.Backups {
+		names = append(names, backup.ImageName)
+	}
+	if len(names) != 2 || names[0] != "permanent" || names[1] != "current" {
+		t.Errorf("backups after expiry = %v, want [permanent current]",
+			names)
+	}
+}
@@ -13,6 +13,7 @@ func (m *Manager) getCapacity() (proto.GetCapacityResponse, error) {
 	return proto.GetCapacityResponse{
 		AvailableMemoryInMiB: memInfo.Available >> 20,
 		MemoryInMiB:          m.memTotalInMiB,
+		NumaNodes:            m.getNumaCapacity(),
 		NumCPUs:              m.numCPUs,
 		TotalVolumeBytes:     m.totalVolumeBytes,
 	}, nil
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Cloud-Foundations/Dominator/hypervisor/cloudinit"
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	cloudInitSeedVolumeFile = "cloud-init-seed.iso"
+
+	cloudInitSmbiosSerial = "ds=nocloud;s=" + constants.MetadataUrl +
+		constants.MetadataNoCloudPrefix
+)
+
+// getSmbiosArg returns the SMBIOS argument for QEMU. If requested for the VM,
+// the serial number directs cloud-init in the VM to the NoCloud datasource
+// served by the metadata service. With a seed volume the serial number is not
+// set, as it would take precedence over the seed volume.
+func (vm *vmInfoType) getSmbiosArg() string {
+	if vm.NoCloudSmbiosSerial &&
+		vm.CloudInitSeedVolume == proto.SeedVolumeNone {
+		return "type=1,product=SmallStack,serial=" + cloudInitSmbiosSerial
+	}
+	return "type=1,product=SmallStack"
+}
+
+// writeCloudInitSeedVolume will (re)write the seed volume for the VM so that it
+// reflects the current VM information and user data. It returns the filename
+// of the seed volume.
+func (vm *vmInfoType) writeCloudInitSeedVolume(haveManagerLock bool) (
+	string, error) {
+	filename := filepath.Join(vm.dirname, cloudInitSeedVolumeFile)
+	var userData io.Reader
+	file, err := os.Open(filepath.Join(vm.dirname, UserDataFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	} else {
+		defer file.Close()
+		userData = file
+	}
+	err = cloudinit.MakeSeedVolume(filename, vm.CloudInitSeedVolume, vm.VmInfo,
+		vm.getSubnets(haveManagerLock), userData)
+	if err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// getSubnets returns the subnets the VM is attached to.
+func (vm *vmInfoType) getSubnets(haveManagerLock bool) []proto.Subnet {
+	if !haveManagerLock {
+		vm.manager.mutex.RLock()
+		defer vm.manager.mutex.RUnlock()
+	}
+	subnets := make([]proto.Subnet, 0, len(vm.SecondarySubnetIDs)+1)
+	for _, subnetId := range append([]string{vm.SubnetId},
+		vm.SecondarySubnetIDs...) {
+		if subnet, ok := vm.manager.subnets[subnetId]; ok {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
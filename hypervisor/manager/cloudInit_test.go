@@ -0,0 +1,40 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestGetSmbiosArg(t *testing.T) {
+	tests := []struct {
+		name                string
+		noCloudSmbiosSerial bool
+		seedVolumeType      proto.SeedVolumeType
+		wantSerial          bool
+	}{
+		{"default", false, proto.SeedVolumeNone, false},
+		{"serial", true, proto.SeedVolumeNone, true},
+		{"nocloud seed volume", false, proto.SeedVolumeNoCloud, false},
+		{"configdrive seed volume", false, proto.SeedVolumeConfigDrive,
+			false},
+		{"serial with seed volume", true, proto.SeedVolumeNoCloud, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &vmInfoType{}
+			vm.CloudInitSeedVolume = test.seedVolumeType
+			vm.NoCloudSmbiosSerial = test.noCloudSmbiosSerial
+			arg := vm.getSmbiosArg()
+			if !strings.HasPrefix(arg, "type=1,product=SmallStack") {
+				t.Errorf("unexpected SMBIOS argument: %s", arg)
+			}
+			gotSerial := strings.Contains(arg, "serial="+cloudInitSmbiosSerial)
+			if gotSerial != test.wantSerial {
+				t.Errorf("SMBIOS argument: %s, want serial: %t",
+					arg, test.wantSerial)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+const (
+	guestAgentChardevId      = "guest-agent"
+	guestAgentCommandTimeout = 30 * time.Second
+	guestAgentPortName       = "org.qemu.guest_agent.0"
+	guestAgentSockFilename   = "guest-agent.sock"
+	guestAgentSyncTimeout    = 5 * time.Second
+)
+
+// guestAgentClient sends commands to the QEMU guest agent (qemu-ga) in a VM,
+// over the virtio-serial channel which QEMU exposes as a Unix socket in the VM
+// directory.
+type guestAgentClient struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	reader  *bufio.Reader
+}
+
+type guestAgentCommandType struct {
+	Arguments interface{} `json:"arguments,omitempty"`
+	Execute   string      `json:"execute"`
+}
+
+type guestAgentResponseType struct {
+	Error  *qmpErrorType   `json:"error,omitempty"`
+	Return json.RawMessage `json:"return,omitempty"`
+}
+
+// getGuestAgentArgs returns the QEMU arguments which add the virtio-serial
+// channel for the guest agent.
+func (vm *vmInfoType) getGuestAgentArgs() []string {
+	return []string{
+		"-chardev", fmt.Sprintf("socket,id=%s,path=%s,server,nowait",
+			guestAgentChardevId,
+			filepath.Join(vm.dirname, guestAgentSockFilename)),
+		"-device", "virtio-serial",
+		"-device", fmt.Sprintf("virtserialport,chardev=%s,name=%s",
+			guestAgentChardevId, guestAgentPortName),
+	}
+}
+
+// newGuestAgentClient will connect to the guest agent channel and will
+// synchronise with the guest agent. An error is returned if the guest agent
+// does not respond, which is the case if it is not running in the VM.
+func (vm *vmInfoType) newGuestAgentClient() (*guestAgentClient, error) {
+	conn, err := net.DialTimeout("unix",
+		filepath.Join(vm.dirname, guestAgentSockFilename),
+		guestAgentSyncTimeout)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	client := &guestAgentClient{conn: conn, reader: reader}
+	if err := client.sync(uint64(time.Now().UnixNano())); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("guest agent not responding: %s", err)
+	}
+	return client, nil
+}
+
+func (c *guestAgentClient) close() error {
+	return c.conn.Close()
+}
+
+// execute will send a command and wait for the response. If result is not
+// nil, the response is decoded into it.
+func (c *guestAgentClient) execute(command string, arguments interface{},
+	result interface{}) error {
+	if err := c.conn.SetDeadline(
+		time.Now().Add(guestAgentCommandTimeout)); err != nil {
+		return err
+	}
+	if err := c.send(command, arguments); err != nil {
+		return err
+	}
+	var response guestAgentResponseType
+	if err := c.decoder.Decode(&response); err != nil {
+		return fmt.Errorf("error reading response to %s: %s", command, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %s", command, response.Error.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Return, result)
+}
+
+func (c *guestAgentClient) send(command string, arguments interface{}) error {
+	data, err := json.Marshal(guestAgentCommandType{
+		Arguments: arguments,
+		Execute:   command,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+// sync will discard any stale data in the channel (from an earlier client or
+// from a guest agent which was restarted) and will wait for the guest agent to
+// echo the specified identifier. A 0xFF byte resets the guest agent parser and
+// the guest agent sends a 0xFF byte before the response.
+func (c *guestAgentClient) sync(id uint64) error {
+	if err := c.conn.SetDeadline(
+		time.Now().Add(guestAgentSyncTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write([]byte{0xff}); err != nil {
+		return err
+	}
+	err := c.send("guest-sync-delimited", map[string]uint64{"id": id})
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := c.reader.ReadBytes(0xff); err != nil {
+			return err
+		}
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		var response guestAgentResponseType
+		if err := json.Unmarshal(line, &response); err != nil {
+			continue // Garbage after a stray delimiter: keep looking.
+		}
+		var returnedId uint64
+		if json.Unmarshal(response.Return, &returnedId) == nil &&
+			returnedId == id {
+			c.decoder = json.NewDecoder(c.reader)
+			return nil
+		}
+	}
+}
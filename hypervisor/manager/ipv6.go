@@ -0,0 +1,263 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+// metadataIpv6Chain is the ebtables chain for IPv6 requests to the metadata
+// service. It jumps to a chain for each tap device (named with the
+// ipv6SourceFilterChainPrefix) which only accepts requests with a source
+// address belonging to the VM. Requests from anything else are dropped, so that
+// a VM cannot impersonate another VM by using an address with the interface
+// identifier of the other VM.
+const (
+	ipv6SourceFilterChainPrefix = "M6-"
+	metadataIpv6Chain           = "METADATA6"
+)
+
+// checkIpv6Address checks that the IPv6 address (if any) of an address which
+// is being added to the address pool is in the IPv6 prefix of the subnet for
+// the IPv4 address. This must be called with the lock held.
+func (m *Manager) checkIpv6Address(address proto.Address) error {
+	if len(address.Ipv6Address) < 1 {
+		return nil
+	}
+	if address.Ipv6Address.To4() != nil {
+		return fmt.Errorf("not an IPv6 address: %s", address.Ipv6Address)
+	}
+	if len(address.IpAddress) < 1 {
+		return fmt.Errorf("no IPv4 address for: %s", address.Ipv6Address)
+	}
+	subnet := m.subnets[m.getMatchingSubnet(address.IpAddress)]
+	if len(subnet.Ipv6Prefix) < 1 {
+		return fmt.Errorf("no IPv6 prefix for subnet of: %s",
+			address.IpAddress)
+	}
+	ipv6PrefixMask := net.CIDRMask(64, 8*net.IPv6len)
+	if !address.Ipv6Address.Mask(ipv6PrefixMask).Equal(subnet.Ipv6Prefix) {
+		return fmt.Errorf("%s is not in the prefix: %s/64 for subnet: %s",
+			address.Ipv6Address, subnet.Ipv6Prefix, subnet.Id)
+	}
+	return nil
+}
+
+// deleteIpv6SourceFilterChains will delete the ebtables chains for IPv6
+// requests to the metadata service. The chains must not be referenced.
+func deleteIpv6SourceFilterChains() error {
+	output, err := exec.Command("ebtables", "-t", "filter", "-L").Output()
+	if err != nil {
+		return fmt.Errorf("error listing ebtables chains: %s", err)
+	}
+	for _, chain := range listIpv6SourceFilterChains(string(output)) {
+		runEbtables([]string{"-F", chain})
+		if err := runEbtables([]string{"-X", chain}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listIpv6SourceFilterChains returns the chains for IPv6 requests to the
+// metadata service in the output of ebtables -L. The chain which jumps to the
+// per tap device chains is listed first, so that those may be deleted after
+// it.
+func listIpv6SourceFilterChains(output string) []string {
+	var chains []string
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "Bridge chain: ") {
+			continue
+		}
+		chain := strings.TrimPrefix(line, "Bridge chain: ")
+		if index := strings.IndexByte(chain, ','); index >= 0 {
+			chain = chain[:index]
+		}
+		if chain == metadataIpv6Chain {
+			chains = append([]string{chain}, chains...)
+		} else if strings.HasPrefix(chain, ipv6SourceFilterChainPrefix) {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+func (m *Manager) lookupVmByIpv6Address(ipAddr net.IP) (net.IP, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for ipStr, vm := range m.vms {
+		for _, address := range append([]proto.Address{vm.Address},
+			vm.SecondaryAddresses...) {
+			if address.Ipv6Address.Equal(ipAddr) {
+				return net.ParseIP(ipStr), nil
+			}
+		}
+	}
+	hwAddr := util.GetEui64HardwareAddr(ipAddr)
+	if hwAddr == nil {
+		return nil, fmt.Errorf("no VM with IPv6 address: %s found", ipAddr)
+	}
+	macAddr := hwAddr.String()
+	for ipStr, vm := range m.vms {
+		if vm.Address.MacAddress == macAddr {
+			return net.ParseIP(ipStr), nil
+		}
+		for _, address := range vm.SecondaryAddresses {
+			if address.MacAddress == macAddr {
+				return net.ParseIP(ipStr), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no VM with IPv6 address: %s found", ipAddr)
+}
+
+// installIpv6SourceFilters will (re)create the filter chain for IPv6 requests
+// to the metadata service and the filters for the tap devices of each running
+// VM. Failures for individual VMs are logged: their IPv6 metadata requests
+// will be dropped. Only the chains for IPv6 requests to the metadata service
+// are replaced: other chains are left alone.
+func (m *Manager) installIpv6SourceFilters() error {
+	runEbtables([]string{"-D", "FORWARD", "-p", "IPv6",
+		"--ip6-dst", constants.LinklocalIpv6Address,
+		"-j", metadataIpv6Chain}) // The jump may not exist yet.
+	if err := deleteIpv6SourceFilterChains(); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"-N", metadataIpv6Chain},
+		{"-P", metadataIpv6Chain, "DROP"},
+		{"-A", "FORWARD", "-p", "IPv6",
+			"--ip6-dst", constants.LinklocalIpv6Address,
+			"-j", metadataIpv6Chain},
+	} {
+		if err := runEbtables(args); err != nil {
+			return err
+		}
+	}
+	m.mutex.RLock()
+	vms := make([]*vmInfoType, 0, len(m.vms))
+	for _, vm := range m.vms {
+		vms = append(vms, vm)
+	}
+	m.mutex.RUnlock()
+	for _, vm := range vms {
+		vm.mutex.RLock()
+		running := vm.State == proto.StateRunning
+		vm.mutex.RUnlock()
+		if !running {
+			continue
+		}
+		pid, err := vm.readPid()
+		if err != nil {
+			vm.logger.Printf("error installing IPv6 source filters: %s\n", err)
+			continue
+		}
+		tapNames, err := findTapDevices(pid)
+		if err != nil {
+			vm.logger.Printf("error installing IPv6 source filters: %s\n", err)
+			continue
+		}
+		for _, tapName := range tapNames {
+			if err := vm.installIpv6SourceFilter(tapName, false); err != nil {
+				vm.logger.Println(err)
+			}
+		}
+	}
+	return nil
+}
+
+// getIpv6SourceAddresses returns the IPv6 addresses which the VM may use as
+// the source address for requests to the metadata service. These are the
+// link-local, subnet autoconfigured and DHCPv6 addresses for each of its
+// interfaces.
+func (vm *vmInfoType) getIpv6SourceAddresses(haveManagerLock bool) (
+	[]net.IP, error) {
+	linklocalPrefix := net.ParseIP("fe80::")
+	subnets := vm.getSubnets(haveManagerLock)
+	var addresses []net.IP
+	for _, address := range append([]proto.Address{vm.Address},
+		vm.SecondaryAddresses...) {
+		hwAddr, err := net.ParseMAC(address.MacAddress)
+		if err != nil {
+			return nil, err
+		}
+		ipAddr, err := util.MakeEui64Address(linklocalPrefix, hwAddr)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, ipAddr)
+		for _, subnet := range subnets {
+			ipAddr, err := subnet.MakeIpv6Address(address.MacAddress)
+			if err != nil {
+				return nil, err
+			}
+			if ipAddr != nil {
+				addresses = append(addresses, ipAddr)
+			}
+		}
+		if len(address.Ipv6Address) > 0 {
+			addresses = append(addresses, address.Ipv6Address)
+		}
+	}
+	return addresses, nil
+}
+
+// installIpv6SourceFilter will install the filter for IPv6 requests to the
+// metadata service from the tap device, replacing any stale filter for a tap
+// device with the same name.
+func (vm *vmInfoType) installIpv6SourceFilter(tapName string,
+	haveManagerLock bool) error {
+	addresses, err := vm.getIpv6SourceAddresses(haveManagerLock)
+	if err != nil {
+		return err
+	}
+	cleanup, install := makeIpv6SourceFilterArgs(tapName, addresses)
+	for _, args := range cleanup {
+		runEbtables(args) // The chain and jump may not exist yet.
+	}
+	for _, args := range install {
+		if err := runEbtables(args); err != nil {
+			return fmt.Errorf("error installing IPv6 source filter for: %s: %s",
+				tapName, err)
+		}
+	}
+	return nil
+}
+
+// makeIpv6SourceFilterArgs returns the ebtables arguments to remove any
+// previous filter for the tap device and then to install a filter which only
+// accepts IPv6 requests to the metadata service with one of the specified
+// source addresses.
+func makeIpv6SourceFilterArgs(tapName string, addresses []net.IP) (
+	[][]string, [][]string) {
+	chain := ipv6SourceFilterChainPrefix + tapName
+	cleanup := [][]string{
+		{"-D", metadataIpv6Chain, "-i", tapName, "-j", chain},
+		{"-N", chain},
+	}
+	install := [][]string{
+		{"-F", chain},
+		{"-P", chain, "DROP"},
+	}
+	for _, ipAddr := range addresses {
+		install = append(install, []string{"-A", chain,
+			"-p", "IPv6", "--ip6-src", ipAddr.String(), "-j", "ACCEPT"})
+	}
+	install = append(install,
+		[]string{"-A", metadataIpv6Chain, "-i", tapName, "-j", chain})
+	return cleanup, install
+}
+
+func runEbtables(args []string) error {
+	cmd := exec.Command("ebtables",
+		append([]string{"-t", "filter"}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running ebtables: %s: %s", err, output)
+	}
+	return nil
+}
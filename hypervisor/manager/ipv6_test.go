@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestCheckIpv6Address(t *testing.T) {
+	m := &Manager{
+		subnets: map[string]proto.Subnet{
+			"dual": {
+				Id:         "dual",
+				IpGateway:  net.IPv4(10, 1, 0, 1).To4(),
+				IpMask:     net.IPv4(255, 255, 255, 0).To4(),
+				Ipv6Prefix: net.ParseIP("2001:db8:1::"),
+			},
+			"ipv4": {
+				Id:        "ipv4",
+				IpGateway: net.IPv4(10, 2, 0, 1).To4(),
+				IpMask:    net.IPv4(255, 255, 255, 0).To4(),
+			},
+		},
+	}
+	var tests = []struct {
+		name    string
+		address proto.Address
+		wantErr bool
+	}{
+		{"IPv4 only", proto.Address{IpAddress: net.IPv4(10, 2, 0, 5)}, false},
+		{"in prefix", proto.Address{
+			IpAddress:   net.IPv4(10, 1, 0, 5).To4(),
+			Ipv6Address: net.ParseIP("2001:db8:1::a01:5"),
+		}, false},
+		{"outside prefix", proto.Address{
+			IpAddress:   net.IPv4(10, 1, 0, 5).To4(),
+			Ipv6Address: net.ParseIP("2001:db8:2::a01:5"),
+		}, true},
+		{"subnet without prefix", proto.Address{
+			IpAddress:   net.IPv4(10, 2, 0, 5).To4(),
+			Ipv6Address: net.ParseIP("2001:db8:1::a02:5"),
+		}, true},
+		{"no IPv4 address", proto.Address{
+			Ipv6Address: net.ParseIP("2001:db8:1::a01:5"),
+		}, true},
+		{"IPv4 as IPv6 address", proto.Address{
+			IpAddress:   net.IPv4(10, 1, 0, 5).To4(),
+			Ipv6Address: net.IPv4(10, 1, 0, 6),
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := m.checkIpv6Address(test.address)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("checkIpv6Address() error = %v, want error: %t",
+					err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetIpv6SourceAddresses(t *testing.T) {
+	vm := &vmInfoType{
+		manager: &Manager{
+			subnets: map[string]proto.Subnet{
+				"primary": {
+					Id:         "primary",
+					Ipv6Prefix: net.ParseIP("2001:db8:1::"),
+				},
+				"secondary": {Id: "secondary"},
+				"other": {
+					Id:         "other",
+					Ipv6Prefix: net.ParseIP("2001:db8:2::"),
+				},
+			},
+		},
+	}
+	vm.Address = proto.Address{
+		Ipv6Address: net.ParseIP("2001:db8:1::a01:203"),
+		MacAddress:  "52:54:0a:01:02:03",
+	}
+	vm.SecondaryAddresses = []proto.Address{{MacAddress: "52:54:0a:02:02:03"}}
+	vm.SecondarySubnetIDs = []string{"secondary"}
+	vm.SubnetId = "primary"
+	addresses, err := vm.getIpv6SourceAddresses(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ipAddr := range addresses {
+		got = append(got, ipAddr.String())
+	}
+	// Addresses on subnets the VM is not attached to are not permitted.
+	want := []string{
+		"fe80::5054:aff:fe01:203",
+		"2001:db8:1:0:5054:aff:fe01:203",
+		"2001:db8:1::a01:203",
+		"fe80::5054:aff:fe02:203",
+		"2001:db8:1:0:5054:aff:fe02:203",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %v, want %v", got, want)
+	}
+}
+
+func TestMakeIpv6SourceFilterArgs(t *testing.T) {
+	cleanup, install := makeIpv6SourceFilterArgs("tap3",
+		[]net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::1")})
+	wantCleanup := [][]string{
+		{"-D", "METADATA6", "-i", "tap3", "-j", "M6-tap3"},
+		{"-N", "M6-tap3"},
+	}
+	if !reflect.DeepEqual(cleanup, wantCleanup) {
+		t.Errorf("cleanup = %v, want %v", cleanup, wantCleanup)
+	}
+	// Stale rules must be flushed and the default must be to drop before the
+	// chain is used.
+	wantInstall := [][]string{
+		{"-F", "M6-tap3"},
+		{"-P", "M6-tap3", "DROP"},
+		{"-A", "M6-tap3", "-p", "IPv6", "--ip6-src", "fe80::1",
+			"-j", "ACCEPT"},
+		{"-A", "M6-tap3", "-p", "IPv6", "--ip6-src", "2001:db8::1",
+			"-j", "ACCEPT"},
+		{"-A", "METADATA6", "-i", "tap3", "-j", "M6-tap3"},
+	}
+	if !reflect.DeepEqual(install, wantInstall) {
+		t.Errorf("install = %v, want %v", install, wantInstall)
+	}
+}
+
+func TestListIpv6SourceFilterChains(t *testing.T) {
+	output := `Bridge table: filter
+
+Bridge chain: INPUT, entries: 1, policy: ACCEPT
+-p IPv4 -i eth0 --ip-src 169.254.0.0/16 -j DROP
+
+Bridge chain: FORWARD, entries: 0, policy: ACCEPT
+
+Bridge chain: M6-tap3, entries: 1, policy: DROP
+-p IPv6 --ip6-src fe80::1 -j ACCEPT
+
+Bridge chain: OTHER, entries: 0, policy: ACCEPT
+
+Bridge chain: METADATA6, entries: 1, policy: DROP
+-i tap3 -j M6-tap3
+
+Bridge chain: M6-tap4, entries: 0, policy: DROP
+`
+	// The chain which references the per tap device chains must be first, so
+	// that it is deleted before them. Other chains are not deleted.
+	want := []string{"METADATA6", "M6-tap3", "M6-tap4"}
+	if got := listIpv6SourceFilterChains(output); !reflect.DeepEqual(got,
+		want) {
+		t.Errorf("chains = %v, want %v", got, want)
+	}
+}
+
+func TestLookupVmByIpv6Address(t *testing.T) {
+	vm := &vmInfoType{}
+	vm.Address = proto.Address{
+		IpAddress:   net.IPv4(10, 1, 0, 5).To4(),
+		Ipv6Address: net.ParseIP("2001:db8:1::a01:5"),
+		MacAddress:  "52:54:0a:01:00:05",
+	}
+	vm.SecondaryAddresses = []proto.Address{{
+		IpAddress:   net.IPv4(10, 2, 0, 5).To4(),
+		Ipv6Address: net.ParseIP("2001:db8:2::a02:5"),
+		MacAddress:  "52:54:0a:02:00:05",
+	}}
+	m := &Manager{vms: map[string]*vmInfoType{"10.1.0.5": vm}}
+	var tests = []struct {
+		name    string
+		ipAddr  string
+		wantErr bool
+	}{
+		{"DHCPv6 address", "2001:db8:1::a01:5", false},
+		{"secondary DHCPv6 address", "2001:db8:2::a02:5", false},
+		{"autoconfigured address", "2001:db8:1:0:5054:aff:fe01:5", false},
+		{"secondary link-local address", "fe80::5054:aff:fe02:5", false},
+		{"unknown DHCPv6 address", "2001:db8:1::a01:6", true},
+		{"unknown autoconfigured address", "fe80::5054:aff:fe01:6", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ipAddr, err := m.lookupVmByIpv6Address(net.ParseIP(test.ipAddr))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("found VM: %s", ipAddr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ipAddr.Equal(net.IPv4(10, 1, 0, 5)) {
+				t.Errorf("VM = %s, want 10.1.0.5", ipAddr)
+			}
+		})
+	}
+}
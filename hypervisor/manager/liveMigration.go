@@ -0,0 +1,1159 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/bufwriter"
+	liberrors "github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	liveMigrationDowntimeLimit    = 300 // Milliseconds.
+	liveMigrationMemoryName       = "livemigration-memory"
+	liveMigrationNbdName          = "livemigration-nbd"
+	liveMigrationNbdSockname      = "livemigration-nbd.sock"
+	liveMigrationPollInterval     = time.Second
+	liveMigrationProgressInterval = time.Second * 5
+	liveMigrationStreamTimeout    = time.Minute
+	liveMigrationSwitchTimeout    = time.Second * 30
+)
+
+type liveMigrationSourceType struct {
+	committed bool
+	conn      *srpc.Conn
+	continues <-chan bool
+	jobs      []string // Mirror job IDs.
+	migrating bool
+	qmp       *qmpClient
+	targets   []string // Mirror target node names.
+	vm        *vmInfoType
+}
+
+type liveMigrationStreamType struct {
+	file        *os.File // The end of the stream which is passed to QEMU.
+	memory      bool
+	volumeIndex uint
+}
+
+type qmpBlockInfo struct {
+	Device   string `json:"device"`
+	Inserted *struct {
+		File     string `json:"file"`
+		NodeName string `json:"node-name"`
+	} `json:"inserted"`
+}
+
+type qmpBlockJobInfo struct {
+	Device string `json:"device"` // The job ID.
+	Length uint64 `json:"len"`
+	Offset uint64 `json:"offset"`
+	Ready  bool   `json:"ready"`
+}
+
+type qmpMigrationInfo struct {
+	Downtime         uint64 `json:"downtime"` // Milliseconds.
+	ErrorDescription string `json:"error-desc"`
+	Ram              *struct {
+		Remaining   uint64 `json:"remaining"`
+		Total       uint64 `json:"total"`
+		Transferred uint64 `json:"transferred"`
+	} `json:"ram"`
+	Status string `json:"status"`
+}
+
+type qmpStatusInfo struct {
+	Running bool   `json:"running"`
+	Status  string `json:"status"`
+}
+
+type volumeNodeType struct {
+	device   string // May be empty.
+	nodeName string
+}
+
+func checkLiveMigratableVolumes(volumes []proto.Volume) error {
+	for index, volume := range volumes {
+		if volume.Format != proto.VolumeFormatRaw {
+			return fmt.Errorf("volume: %d format: %s not supported",
+				index, volume.Format)
+		}
+		if volume.Interface == proto.VolumeInterfaceDFM {
+			return fmt.Errorf("volume: %d interface: %s not supported",
+				index, volume.Interface)
+		}
+	}
+	return nil
+}
+
+func liveMigrationVolumeName(index int) string {
+	return fmt.Sprintf("livemigration-vol%d", index)
+}
+
+// makeSocketPair will return a connected pair of sockets. The first is to be
+// passed to QEMU and the second is for local use.
+func makeSocketPair() (*os.File, net.Conn, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX,
+		syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	qemuFile := os.NewFile(uintptr(fds[0]), "qemu")
+	localFile := os.NewFile(uintptr(fds[1]), "local")
+	defer localFile.Close()
+	localConn, err := net.FileConn(localFile)
+	if err != nil {
+		qemuFile.Close()
+		return nil, nil, err
+	}
+	return qemuFile, localConn, nil
+}
+
+// pipeLiveMigrationStream will copy data in both directions between the local
+// socket and the remote connection until either side is closed.
+func pipeLiveMigrationStream(local net.Conn, remote *srpc.Conn) error {
+	errorChannel := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(bufwriter.NewAutoFlushWriter(remote), local)
+		errorChannel <- err
+	}()
+	go func() {
+		_, err := io.Copy(local, remote)
+		errorChannel <- err
+	}()
+	err := <-errorChannel
+	local.Close()
+	return err
+}
+
+// readLiveMigrationContinues will read the decisions from the destination
+// Hypervisor (to start and then to commit the migration) and send them to the
+// channel, which is closed once the commit decision has been read, the
+// migration is abandoned or the connection fails. The done channel is closed
+// when no more messages will be read from the connection.
+func readLiveMigrationContinues(conn *srpc.Conn, continues chan<- bool,
+	done chan<- struct{}) {
+	defer close(done)
+	defer close(continues)
+	for numDecisions := 0; numDecisions < 2; numDecisions++ {
+		var message proto.ServeVmLiveMigrationResponseResponse
+		if err := conn.Decode(&message); err != nil {
+			return
+		}
+		continues <- message.Continue
+		if !message.Continue {
+			return
+		}
+	}
+}
+
+// abandonVmLiveMigration will tell the source Hypervisor to abandon the
+// migration and will wait for it to resume the VM.
+func abandonVmLiveMigration(source *srpc.Conn) {
+	message := proto.ServeVmLiveMigrationResponseResponse{Continue: false}
+	if err := source.Encode(message); err != nil {
+		return
+	}
+	if err := source.Flush(); err != nil {
+		return
+	}
+	for {
+		var reply proto.ServeVmLiveMigrationResponse
+		if err := source.Decode(&reply); err != nil {
+			return
+		}
+		if reply.Final || reply.Error != "" {
+			return
+		}
+	}
+}
+
+func connectToVmLiveMigration(hypervisor *srpc.Client,
+	request proto.ConnectToVmLiveMigrationRequest, local net.Conn,
+	logger interface{ Println(v ...interface{}) }) error {
+	conn, err := hypervisor.Call("Hypervisor.ConnectToVmLiveMigration")
+	if err != nil {
+		local.Close()
+		return err
+	}
+	if err := conn.Encode(request); err != nil {
+		conn.Close()
+		local.Close()
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		conn.Close()
+		local.Close()
+		return err
+	}
+	var response proto.ConnectToVmLiveMigrationResponse
+	if err := conn.Decode(&response); err != nil {
+		conn.Close()
+		local.Close()
+		return err
+	}
+	if err := liberrors.New(response.Error); err != nil {
+		conn.Close()
+		local.Close()
+		return err
+	}
+	go func() {
+		defer conn.Close()
+		if err := pipeLiveMigrationStream(local, conn); err != nil {
+			logger.Println(err)
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) connectToVmLiveMigration(conn *srpc.Conn) error {
+	var request proto.ConnectToVmLiveMigrationRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	local, err := m.makeLiveMigrationStream(request,
+		conn.GetAuthInformation())
+	if err != nil {
+		return conn.Encode(
+			proto.ConnectToVmLiveMigrationResponse{Error: err.Error()})
+	}
+	defer local.Close()
+	if err := conn.Encode(proto.ConnectToVmLiveMigrationResponse{}); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	if err := pipeLiveMigrationStream(local, conn); err != nil {
+		return err
+	}
+	return srpc.ErrorCloseClient
+}
+
+// makeLiveMigrationStream will create a stream for a VM which is being live
+// migrated from this Hypervisor. The QEMU end of the stream is sent to the
+// goroutine serving the migration and the local end is returned.
+func (m *Manager) makeLiveMigrationStream(
+	request proto.ConnectToVmLiveMigrationRequest,
+	authInfo *srpc.AuthInformation) (net.Conn, error) {
+	vm, err := m.getVmLockAndAuth(request.IpAddress, false, authInfo,
+		request.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	streams := vm.liveMigrationStreams
+	numVolumes := uint(len(vm.VolumeLocations))
+	vm.mutex.RUnlock()
+	if streams == nil {
+		return nil, errors.New("VM is not being live migrated")
+	}
+	if !request.Memory && request.VolumeIndex >= numVolumes {
+		return nil, errors.New("index too large")
+	}
+	qemuFile, local, err := makeSocketPair()
+	if err != nil {
+		return nil, err
+	}
+	stream := liveMigrationStreamType{
+		file:        qemuFile,
+		memory:      request.Memory,
+		volumeIndex: request.VolumeIndex,
+	}
+	select {
+	case streams <- stream:
+		return local, nil
+	default:
+		qemuFile.Close()
+		local.Close()
+		return nil, errors.New("too many live migration streams")
+	}
+}
+
+// migrateVmLive will migrate a running VM from the source Hypervisor whilst it
+// continues to run. The volumes are mirrored using QEMU block jobs (which track
+// the blocks written during the copy) and then the memory state is migrated,
+// pausing the VM only for the final switch over. The data are carried over
+// ConnectToVmLiveMigration connections to the source Hypervisor. The VM is
+// only resumed here once the migration was committed on the source Hypervisor
+// and QEMU there has quit, so that it never runs on both. If an error is
+// returned and the returned bool is true, the VM is running on the source
+// Hypervisor and cold migration may be attempted.
+func (m *Manager) migrateVmLive(conn *srpc.Conn,
+	request proto.MigrateVmRequest, hypervisor *srpc.Client) (bool, error) {
+	vm, err := m.makeMigratingVm(request, hypervisor)
+	if err != nil {
+		return false, err
+	}
+	var qmp *qmpClient
+	var source *srpc.Conn
+	defer func() { // Evaluate vm at return time, not defer time.
+		if qmp != nil {
+			defer qmp.close()
+		}
+		if vm == nil {
+			return
+		}
+		vm.cleanup()
+		if qmp != nil {
+			qmp.waitForClose(liveMigrationSwitchTimeout)
+		}
+		if source != nil {
+			abandonVmLiveMigration(source)
+			source.Close()
+		}
+	}()
+	if vm.State != proto.StateRunning {
+		return true, errors.New("VM is not running")
+	}
+	if err := checkLiveMigratableVolumes(vm.Volumes); err != nil {
+		return true, err
+	}
+	if err := sendVmMigrationMessage(conn, "preparing live migration"); err != nil {
+		return false, err
+	}
+	source, err = hypervisor.Call("Hypervisor.ServeVmLiveMigration")
+	if err != nil {
+		return true, err
+	}
+	err = source.Encode(proto.ServeVmLiveMigrationRequest{
+		AccessToken: request.AccessToken,
+		IpAddress:   request.IpAddress,
+	})
+	if err != nil {
+		return true, err
+	}
+	if err := source.Flush(); err != nil {
+		return true, err
+	}
+	var reply proto.ServeVmLiveMigrationResponse
+	if err := source.Decode(&reply); err != nil {
+		return true, err
+	}
+	if err := liberrors.New(reply.Error); err != nil {
+		source.Close()
+		source = nil
+		return true, err
+	}
+	err = writeMigratedExtraFiles(vm.VolumeLocations[0].DirectoryToCleanup,
+		reply.ExtraFiles)
+	if err != nil {
+		return true, err
+	}
+	for index, volume := range vm.VolumeLocations {
+		err := createSparseFile(volume.Filename, vm.Volumes[index].Size)
+		if err != nil {
+			return true, err
+		}
+	}
+	err = migratevmUserData(hypervisor,
+		filepath.Join(vm.dirname, UserDataFile),
+		request.IpAddress, request.AccessToken)
+	if err != nil {
+		return true, err
+	}
+	err = sendVmMigrationMessage(conn, "starting VM for incoming migration")
+	if err != nil {
+		return false, err
+	}
+	vm.incomingLiveMigration = true
+	vm.State = proto.StateStarting
+	m.mutex.Lock()
+	m.vms[vm.ipAddress] = vm
+	m.mutex.Unlock()
+	_, err = vm.startManaging(0, false, false)
+	vm.incomingLiveMigration = false
+	if err != nil {
+		return true, err
+	}
+	if qmp, err = vm.newQmpClient(); err != nil {
+		return true, err
+	}
+	nbdListener, err := vm.startLiveMigrationNbdServer(qmp)
+	if err != nil {
+		return true, err
+	}
+	defer nbdListener.Close()
+	memoryConn, err := startLiveMigrationIncoming(qmp)
+	if err != nil {
+		return true, err
+	}
+	err = connectToVmLiveMigration(hypervisor,
+		proto.ConnectToVmLiveMigrationRequest{
+			AccessToken: request.AccessToken,
+			IpAddress:   request.IpAddress,
+			Memory:      true,
+		},
+		memoryConn, vm.logger)
+	if err != nil {
+		return true, err
+	}
+	for index := range vm.VolumeLocations {
+		volumeConn, err := net.Dial("unix", nbdListener.Addr().String())
+		if err != nil {
+			return true, err
+		}
+		err = connectToVmLiveMigration(hypervisor,
+			proto.ConnectToVmLiveMigrationRequest{
+				AccessToken: request.AccessToken,
+				IpAddress:   request.IpAddress,
+				VolumeIndex: uint(index),
+			},
+			volumeConn, vm.logger)
+		if err != nil {
+			return true, err
+		}
+	}
+	err = source.Encode(proto.ServeVmLiveMigrationResponseResponse{
+		Continue: true})
+	if err != nil {
+		return true, err
+	}
+	if err := source.Flush(); err != nil {
+		return true, err
+	}
+	for {
+		var reply proto.ServeVmLiveMigrationResponse
+		if err := source.Decode(&reply); err != nil {
+			return true, err
+		}
+		if err := liberrors.New(reply.Error); err != nil {
+			// The source Hypervisor is waiting for the commit decision.
+			source.Encode(proto.ServeVmLiveMigrationResponseResponse{})
+			source.Close()
+			source = nil
+			return true, err
+		}
+		if reply.ProgressMessage != "" {
+			err := sendVmMigrationMessage(conn, reply.ProgressMessage)
+			if err != nil {
+				return true, err
+			}
+		}
+		if reply.SwitchedOver {
+			break
+		}
+	}
+	if err := waitForLiveMigrationIncoming(qmp); err != nil {
+		return true, err
+	}
+	if err := requestVmMigrationCommit(conn); err != nil {
+		return false, err
+	}
+	// The source Hypervisor commits the migration and stops QEMU. Only once
+	// QEMU on the source has quit may the VM be resumed here, otherwise both
+	// may run. Until then the VM may be resumed on the source.
+	err = source.Encode(proto.ServeVmLiveMigrationResponseResponse{
+		Continue: true})
+	if err != nil {
+		return false, err
+	}
+	if err := source.Flush(); err != nil {
+		return false, err
+	}
+	for {
+		var reply proto.ServeVmLiveMigrationResponse
+		if err := source.Decode(&reply); err != nil {
+			return false, err
+		}
+		if err := liberrors.New(reply.Error); err != nil {
+			source.Close()
+			source = nil
+			return false, err
+		}
+		if reply.Final {
+			break
+		}
+	}
+	source.Close()
+	source = nil
+	if err := qmp.execute("nbd-server-stop", nil, nil); err != nil {
+		vm.logger.Println(err)
+	}
+	if err := qmp.execute("cont", nil, nil); err != nil {
+		return false, err
+	}
+	// The VM is running here and not on the source, so it must not be
+	// destroyed from now on.
+	migratedVm := vm
+	vm = nil
+	migratedVm.logger.Println("VM resumed after live migration")
+	if err := sendVmMigrationMessage(conn, "VM resumed"); err != nil {
+		migratedVm.logger.Println(err)
+	}
+	err = migratedVm.finishMigration(hypervisor, request.AccessToken)
+	if err != nil {
+		migratedVm.logger.Printf("error finishing live migration: %s\n", err)
+		return false, err
+	}
+	return false, nil
+}
+
+func createSparseFile(filename string, size uint64) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		fsutil.PrivateFilePerms)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Truncate(int64(size))
+}
+
+// startLiveMigrationIncoming will prepare QEMU to receive the memory state
+// and will return the local end of the stream.
+func startLiveMigrationIncoming(qmp *qmpClient) (net.Conn, error) {
+	qemuFile, local, err := makeSocketPair()
+	if err != nil {
+		return nil, err
+	}
+	defer qemuFile.Close()
+	if err := qmp.passFile(liveMigrationMemoryName, qemuFile); err != nil {
+		local.Close()
+		return nil, err
+	}
+	err = qmp.execute("migrate-incoming",
+		map[string]string{"uri": "fd:" + liveMigrationMemoryName}, nil)
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+	return local, nil
+}
+
+// waitForLiveMigrationIncoming will wait for QEMU to receive all the memory
+// state.
+func waitForLiveMigrationIncoming(qmp *qmpClient) error {
+	stopTime := time.Now().Add(liveMigrationSwitchTimeout)
+	for ; time.Until(stopTime) > 0; time.Sleep(liveMigrationPollInterval) {
+		var info qmpMigrationInfo
+		if err := qmp.execute("query-migrate", nil, &info); err != nil {
+			return err
+		}
+		switch info.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("incoming migration %s: %s",
+				info.Status, info.ErrorDescription)
+		}
+	}
+	return errors.New("timed out waiting for incoming migration")
+}
+
+// getVolumeNodes will return the block nodes for the volumes.
+func (c *qmpClient) getVolumeNodes(volumes []proto.LocalVolume) (
+	[]volumeNodeType, error) {
+	var blockInfos []qmpBlockInfo
+	if err := c.execute("query-block", nil, &blockInfos); err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]volumeNodeType, len(blockInfos))
+	for _, blockInfo := range blockInfos {
+		if blockInfo.Inserted != nil {
+			nodes[blockInfo.Inserted.File] = volumeNodeType{
+				device:   blockInfo.Device,
+				nodeName: blockInfo.Inserted.NodeName,
+			}
+		}
+	}
+	volumeNodes := make([]volumeNodeType, 0, len(volumes))
+	for index, volume := range volumes {
+		if node, ok := nodes[volume.Filename]; !ok {
+			return nil, fmt.Errorf("no block device for volume: %d", index)
+		} else {
+			volumeNodes = append(volumeNodes, node)
+		}
+	}
+	return volumeNodes, nil
+}
+
+// startLiveMigrationNbdServer will start a NBD server in QEMU which exports
+// the volumes for writing. The listener for the server is returned.
+func (vm *vmInfoType) startLiveMigrationNbdServer(qmp *qmpClient) (
+	*net.UnixListener, error) {
+	sockname := filepath.Join(vm.dirname, liveMigrationNbdSockname)
+	os.Remove(sockname)
+	listener, err := net.ListenUnix("unix",
+		&net.UnixAddr{Name: sockname, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	doClose := true
+	defer func() {
+		if doClose {
+			listener.Close()
+		}
+	}()
+	file, err := listener.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := qmp.passFile(liveMigrationNbdName, file); err != nil {
+		return nil, err
+	}
+	err = qmp.execute("nbd-server-start", map[string]interface{}{
+		"addr": map[string]interface{}{
+			"type": "fd",
+			"data": map[string]string{"str": liveMigrationNbdName},
+		},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := qmp.getVolumeNodes(vm.VolumeLocations)
+	if err != nil {
+		return nil, err
+	}
+	for index, node := range nodes {
+		name := liveMigrationVolumeName(index)
+		err := qmp.execute("block-export-add", map[string]interface{}{
+			"id":        name,
+			"name":      name,
+			"node-name": node.nodeName,
+			"type":      "nbd",
+			"writable":  true,
+		}, nil)
+		if err != nil { // Older versions of QEMU.
+			err = qmp.execute("nbd-server-add", map[string]interface{}{
+				"device":   node.nodeName,
+				"name":     name,
+				"writable": true,
+			}, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	doClose = false
+	return listener, nil
+}
+
+// serveVmLiveMigration will serve the source side of a live migration and
+// will send the final response. The goroutine which reads the decisions from
+// the destination Hypervisor is joined before returning, so that it cannot
+// consume a subsequent request on the connection.
+func (m *Manager) serveVmLiveMigration(conn *srpc.Conn) error {
+	readerDone, err := m.sourceVmLiveMigration(conn)
+	response := proto.ServeVmLiveMigrationResponse{Final: true}
+	if err != nil {
+		response = proto.ServeVmLiveMigrationResponse{Error: err.Error()}
+	}
+	if err := conn.Encode(response); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	if readerDone == nil {
+		return nil
+	}
+	// If the migration failed before the commit decision, the destination
+	// Hypervisor will close the connection after receiving the error.
+	timer := time.NewTimer(liveMigrationStreamTimeout)
+	defer timer.Stop()
+	select {
+	case <-readerDone:
+		return nil
+	case <-timer.C:
+		return errors.New("timed out waiting for live migration decision")
+	}
+}
+
+// sourceVmLiveMigration will migrate the VM to the destination Hypervisor. If
+// a goroutine was started to read the decisions from the destination
+// Hypervisor, the returned channel is closed when it has finished.
+func (m *Manager) sourceVmLiveMigration(conn *srpc.Conn) (
+	<-chan struct{}, error) {
+	var request proto.ServeVmLiveMigrationRequest
+	if err := conn.Decode(&request); err != nil {
+		return nil, err
+	}
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true,
+		conn.GetAuthInformation(), request.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	extraFiles, err := vm.prepareLiveMigration()
+	if err != nil {
+		vm.mutex.Unlock()
+		return nil, err
+	}
+	streams := make(chan liveMigrationStreamType, len(vm.VolumeLocations)+1)
+	vm.blockMutations = true
+	vm.liveMigrationStreams = streams
+	vm.mutex.Unlock()
+	defer func() {
+		vm.mutex.Lock()
+		vm.liveMigrationStreams = nil
+		vm.allowMutationsAndUnlock(true)
+		for keepReading := true; keepReading; {
+			select {
+			case stream := <-streams:
+				stream.file.Close()
+			default:
+				keepReading = false
+			}
+		}
+	}()
+	err = conn.Encode(proto.ServeVmLiveMigrationResponse{
+		ExtraFiles: extraFiles})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	continues := make(chan bool, 1)
+	readerDone := make(chan struct{})
+	go readLiveMigrationContinues(conn, continues, readerDone)
+	if proceed := <-continues; !proceed {
+		return readerDone, errors.New("live migration abandoned")
+	}
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		return readerDone, err
+	}
+	defer qmp.close()
+	lm := &liveMigrationSourceType{
+		conn:      conn,
+		continues: continues,
+		qmp:       qmp,
+		vm:        vm,
+	}
+	defer lm.restore()
+	vm.logger.Println("starting live migration")
+	startTime := time.Now()
+	if err := lm.migrate(); err != nil {
+		vm.logger.Printf("live migration failed: %s\n", err)
+		return readerDone, err
+	}
+	vm.logger.Printf("live migrated in %s\n",
+		format.Duration(time.Since(startTime)))
+	return readerDone, nil
+}
+
+// prepareLiveMigration will check if the VM may be live migrated and will
+// return the extra files for the VM. The VM lock must be held.
+func (vm *vmInfoType) prepareLiveMigration() (map[string][]byte, error) {
+	if vm.State != proto.StateRunning {
+		return nil, errors.New("VM is not running")
+	}
+	if vm.Uncommitted {
+		return nil, errors.New("VM is uncommitted")
+	}
+	if vm.liveMigrationStreams != nil {
+		return nil, errors.New("VM is already being live migrated")
+	}
+	if err := checkLiveMigratableVolumes(vm.Volumes); err != nil {
+		return nil, err
+	}
+	extraFiles := make(map[string][]byte)
+	if initrdPath := vm.getActiveInitrdPath(); initrdPath != "" {
+		if data, err := os.ReadFile(initrdPath); err != nil {
+			return nil, err
+		} else {
+			extraFiles["initrd"] = data
+		}
+	}
+	if kernelPath := vm.getActiveKernelPath(); kernelPath != "" {
+		if data, err := os.ReadFile(kernelPath); err != nil {
+			return nil, err
+		} else {
+			extraFiles["kernel"] = data
+		}
+	}
+	return extraFiles, nil
+}
+
+// commit will mark the VM as migrated, releasing its addresses, and will stop
+// QEMU, waiting for it to quit so that the VM may be resumed on the destination
+// Hypervisor.
+func (lm *liveMigrationSourceType) commit() error {
+	if err := lm.commitAndQuit(); err != nil {
+		return err
+	}
+	if err := lm.qmp.waitForClose(liveMigrationSwitchTimeout); err != nil {
+		return fmt.Errorf("error waiting for QEMU to quit: %s", err)
+	}
+	lm.vm.logger.Println("QEMU quit after live migration commit")
+	return nil
+}
+
+func (lm *liveMigrationSourceType) commitAndQuit() error {
+	vm := lm.vm
+	m := vm.manager
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	if err := m.unregisterAddress(vm.Address, true); err != nil {
+		return err
+	}
+	for index, address := range vm.SecondaryAddresses {
+		if err := m.unregisterAddress(address, true); err != nil {
+			m.registerAddress(vm.Address)
+			for _, address := range vm.SecondaryAddresses[:index] {
+				m.registerAddress(address)
+			}
+			return err
+		}
+	}
+	lm.committed = true
+	vm.Uncommitted = true
+	vm.setState(proto.StateMigrating)
+	if vm.commandInput != nil {
+		vm.commandInput <- "quit"
+	}
+	return nil
+}
+
+// getStreams will wait for the destination Hypervisor to connect all the
+// streams.
+func (lm *liveMigrationSourceType) getStreams() (*os.File, []*os.File,
+	error) {
+	var memory *os.File
+	volumes := make([]*os.File, len(lm.vm.VolumeLocations))
+	closeAll := func() {
+		if memory != nil {
+			memory.Close()
+		}
+		for _, file := range volumes {
+			if file != nil {
+				file.Close()
+			}
+		}
+	}
+	timer := time.NewTimer(liveMigrationStreamTimeout)
+	defer timer.Stop()
+	for numStreams := 0; numStreams < len(volumes)+1; {
+		select {
+		case stream := <-lm.vm.liveMigrationStreams:
+			if stream.memory {
+				if memory != nil {
+					stream.file.Close()
+					closeAll()
+					return nil, nil, errors.New("duplicate memory stream")
+				}
+				memory = stream.file
+			} else {
+				if volumes[stream.volumeIndex] != nil {
+					stream.file.Close()
+					closeAll()
+					return nil, nil, fmt.Errorf(
+						"duplicate stream for volume: %d", stream.volumeIndex)
+				}
+				volumes[stream.volumeIndex] = stream.file
+			}
+			numStreams++
+		case <-lm.continues:
+			closeAll()
+			return nil, nil, errors.New("live migration abandoned")
+		case <-timer.C:
+			closeAll()
+			return nil, nil, errors.New("timed out waiting for streams")
+		}
+	}
+	return memory, volumes, nil
+}
+
+// migrate will mirror the volumes and migrate the memory state to the
+// destination Hypervisor. Once the VM is paused it waits for the decision to
+// commit the migration.
+func (lm *liveMigrationSourceType) migrate() error {
+	memory, volumes, err := lm.getStreams()
+	if err != nil {
+		return err
+	}
+	defer memory.Close()
+	err = lm.mirrorVolumes(volumes)
+	for _, file := range volumes {
+		file.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := lm.migrateMemory(memory); err != nil {
+		return err
+	}
+	if err := lm.completeMirrors(); err != nil {
+		return err
+	}
+	err = lm.sendResponse(proto.ServeVmLiveMigrationResponse{
+		ProgressMessage: "switching over",
+		SwitchedOver:    true,
+	})
+	if err != nil {
+		return err
+	}
+	if proceed := <-lm.continues; !proceed {
+		return errors.New("live migration abandoned")
+	}
+	return lm.commit()
+}
+
+// migrateMemory will migrate the memory state and wait for completion, after
+// which the VM is paused.
+func (lm *liveMigrationSourceType) migrateMemory(memory *os.File) error {
+	if err := lm.qmp.passFile(liveMigrationMemoryName, memory); err != nil {
+		return err
+	}
+	err := lm.qmp.execute("migrate-set-parameters",
+		map[string]uint{"downtime-limit": liveMigrationDowntimeLimit}, nil)
+	if err != nil {
+		lm.vm.logger.Println(err)
+	}
+	err = lm.qmp.execute("migrate",
+		map[string]string{"uri": "fd:" + liveMigrationMemoryName}, nil)
+	if err != nil {
+		return err
+	}
+	lm.migrating = true
+	var lastProgressTime time.Time
+	for {
+		var info qmpMigrationInfo
+		if err := lm.qmp.execute("query-migrate", nil, &info); err != nil {
+			return err
+		}
+		switch info.Status {
+		case "completed":
+			lm.migrating = false
+			lm.vm.logger.Printf("memory migrated, downtime: %dms\n",
+				info.Downtime)
+			return nil
+		case "failed", "cancelled":
+			lm.migrating = false
+			return fmt.Errorf("memory migration %s: %s",
+				info.Status, info.ErrorDescription)
+		}
+		if info.Ram != nil && time.Since(lastProgressTime) >=
+			liveMigrationProgressInterval {
+			err := lm.sendResponse(proto.ServeVmLiveMigrationResponse{
+				ProgressMessage: fmt.Sprintf(
+					"copying memory: %s of %s transferred, %s remaining",
+					format.FormatBytes(info.Ram.Transferred),
+					format.FormatBytes(info.Ram.Total),
+					format.FormatBytes(info.Ram.Remaining)),
+			})
+			if err != nil {
+				return err
+			}
+			lastProgressTime = time.Now()
+		}
+		if err := lm.sleep(); err != nil {
+			return err
+		}
+	}
+}
+
+// mirrorVolumes will start block jobs which copy the volumes to the
+// destination Hypervisor and will wait until they are synchronised. The jobs
+// continue to copy the blocks which are written.
+func (lm *liveMigrationSourceType) mirrorVolumes(volumes []*os.File) error {
+	nodes, err := lm.qmp.getVolumeNodes(lm.vm.VolumeLocations)
+	if err != nil {
+		return err
+	}
+	for index, file := range volumes {
+		name := liveMigrationVolumeName(index)
+		if err := lm.qmp.passFile(name, file); err != nil {
+			return err
+		}
+		err := lm.qmp.execute("blockdev-add", map[string]interface{}{
+			"driver":    "nbd",
+			"export":    name,
+			"node-name": name,
+			"server":    map[string]string{"type": "fd", "str": name},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		lm.targets = append(lm.targets, name)
+		device := nodes[index].device
+		if device == "" {
+			device = nodes[index].nodeName
+		}
+		err = lm.qmp.execute("blockdev-mirror", map[string]interface{}{
+			"device": device,
+			"job-id": name,
+			"sync":   "full",
+			"target": name,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		lm.jobs = append(lm.jobs, name)
+	}
+	var lastProgressTime time.Time
+	for {
+		jobs, err := lm.queryJobs()
+		if err != nil {
+			return err
+		}
+		var length, offset uint64
+		numReady := 0
+		for _, name := range lm.jobs {
+			if job, ok := jobs[name]; !ok {
+				return fmt.Errorf("mirror job: %s failed", name)
+			} else {
+				length += job.Length
+				offset += job.Offset
+				if job.Ready {
+					numReady++
+				}
+			}
+		}
+		if numReady == len(lm.jobs) {
+			return nil
+		}
+		if time.Since(lastProgressTime) >= liveMigrationProgressInterval {
+			var percent uint64
+			if length > 0 {
+				percent = offset * 100 / length
+			}
+			err := lm.sendResponse(proto.ServeVmLiveMigrationResponse{
+				ProgressMessage: fmt.Sprintf(
+					"copying volume(s): %d%% of %s", percent,
+					format.FormatBytes(length)),
+			})
+			if err != nil {
+				return err
+			}
+			lastProgressTime = time.Now()
+		}
+		if err := lm.sleep(); err != nil {
+			return err
+		}
+	}
+}
+
+// completeMirrors will complete the mirror jobs once the VM is paused, leaving
+// a consistent copy of the volumes on the destination Hypervisor.
+func (lm *liveMigrationSourceType) completeMirrors() error {
+	for _, name := range lm.jobs {
+		err := lm.qmp.execute("block-job-cancel",
+			map[string]string{"device": name}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if err := lm.waitForJobs(); err != nil {
+		return err
+	}
+	lm.jobs = nil
+	for _, name := range lm.targets {
+		err := lm.qmp.execute("blockdev-del",
+			map[string]string{"node-name": name}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	lm.targets = nil
+	return nil
+}
+
+func (lm *liveMigrationSourceType) queryJobs() (
+	map[string]qmpBlockJobInfo, error) {
+	var jobInfos []qmpBlockJobInfo
+	if err := lm.qmp.execute("query-block-jobs", nil, &jobInfos); err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]qmpBlockJobInfo, len(jobInfos))
+	for _, job := range jobInfos {
+		jobs[job.Device] = job
+	}
+	return jobs, nil
+}
+
+// restore will cancel the migration (if not committed) and will ensure that
+// the VM is running.
+func (lm *liveMigrationSourceType) restore() {
+	if lm.committed {
+		return
+	}
+	logger := lm.vm.logger
+	if lm.migrating {
+		if err := lm.qmp.execute("migrate_cancel", nil, nil); err != nil {
+			logger.Println(err)
+		}
+	}
+	for _, name := range lm.jobs {
+		err := lm.qmp.execute("block-job-cancel",
+			map[string]interface{}{"device": name, "force": true}, nil)
+		if err != nil {
+			logger.Println(err)
+		}
+	}
+	if err := lm.waitForJobs(); err != nil {
+		logger.Println(err)
+	}
+	for _, name := range lm.targets {
+		err := lm.qmp.execute("blockdev-del",
+			map[string]string{"node-name": name}, nil)
+		if err != nil {
+			logger.Println(err)
+		}
+	}
+	var status qmpStatusInfo
+	if err := lm.qmp.execute("query-status", nil, &status); err != nil {
+		logger.Println(err)
+		return
+	}
+	if !status.Running {
+		if err := lm.qmp.execute("cont", nil, nil); err != nil {
+			logger.Println(err)
+			return
+		}
+		logger.Printf("VM resumed after live migration abandoned (was: %s)\n",
+			status.Status)
+	}
+}
+
+func (lm *liveMigrationSourceType) sendResponse(
+	response proto.ServeVmLiveMigrationResponse) error {
+	if err := lm.conn.Encode(response); err != nil {
+		return err
+	}
+	return lm.conn.Flush()
+}
+
+// sleep will wait for the poll interval, returning an error if the migration
+// is abandoned.
+func (lm *liveMigrationSourceType) sleep() error {
+	timer := time.NewTimer(liveMigrationPollInterval)
+	defer timer.Stop()
+	select {
+	case <-lm.continues:
+		return errors.New("live migration abandoned")
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitForJobs will wait for the mirror jobs to finish.
+func (lm *liveMigrationSourceType) waitForJobs() error {
+	stopTime := time.Now().Add(liveMigrationSwitchTimeout)
+	for ; time.Until(stopTime) > 0; time.Sleep(liveMigrationPollInterval) {
+		jobs, err := lm.queryJobs()
+		if err != nil {
+			return err
+		}
+		numRunning := 0
+		for _, name := range lm.jobs {
+			if _, ok := jobs[name]; ok {
+				numRunning++
+			}
+		}
+		if numRunning < 1 {
+			return nil
+		}
+	}
+	return errors.New("timed out waiting for mirror jobs")
+}
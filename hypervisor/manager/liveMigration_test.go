@@ -0,0 +1,290 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+// newTestLiveMigrationSource returns a liveMigrationSourceType for a VM served
+// by a fake QEMU. The responses sent to the destination are written to the
+// returned buffer.
+func newTestLiveMigrationSource(t *testing.T, handler fakeQemuHandler) (
+	*liveMigrationSourceType, *fakeQemuType, *bytes.Buffer) {
+	vm, fakeQemu := newFakeQemuVm(t, handler)
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(qmp.close)
+	buffer := &bytes.Buffer{}
+	conn := &srpc.Conn{
+		Encoder: gob.NewEncoder(buffer),
+		ReadWriter: bufio.NewReadWriter(bufio.NewReader(&bytes.Buffer{}),
+			bufio.NewWriter(io.Discard)),
+	}
+	return &liveMigrationSourceType{
+		conn:      conn,
+		continues: make(chan bool),
+		qmp:       qmp,
+		vm:        vm,
+	}, fakeQemu, buffer
+}
+
+// readProgressMessages returns the progress messages sent to the destination.
+func readProgressMessages(t *testing.T, buffer *bytes.Buffer) []string {
+	var messages []string
+	decoder := gob.NewDecoder(buffer)
+	for {
+		var response proto.ServeVmLiveMigrationResponse
+		if err := decoder.Decode(&response); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			return messages
+		}
+		messages = append(messages, response.ProgressMessage)
+	}
+}
+
+func TestReadLiveMigrationContinues(t *testing.T) {
+	tests := []struct {
+		name       string
+		sent       []bool
+		wantRead   []bool
+		wantUnread int
+	}{
+		{"commit", []bool{true, true, true}, []bool{true, true}, 1},
+		{"abandonAtStart", []bool{false, true}, []bool{false}, 1},
+		{"abandonBeforeCommit", []bool{true, false}, []bool{true, false}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			encoder := gob.NewEncoder(buffer)
+			for _, proceed := range test.sent {
+				err := encoder.Encode(
+					proto.ServeVmLiveMigrationResponseResponse{
+						Continue: proceed,
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			decoder := gob.NewDecoder(buffer)
+			continues := make(chan bool, 1)
+			done := make(chan struct{})
+			go readLiveMigrationContinues(&srpc.Conn{Decoder: decoder},
+				continues, done)
+			var read []bool
+			for proceed := range continues {
+				read = append(read, proceed)
+			}
+			<-done
+			if !reflect.DeepEqual(read, test.wantRead) {
+				t.Errorf("read: %v != %v", read, test.wantRead)
+			}
+			var numUnread int
+			for {
+				var message proto.ServeVmLiveMigrationResponseResponse
+				if err := decoder.Decode(&message); err != nil {
+					break
+				}
+				numUnread++
+			}
+			if numUnread != test.wantUnread {
+				t.Errorf("unread messages: %d != %d",
+					numUnread, test.wantUnread)
+			}
+		})
+	}
+}
+
+func TestLiveMigrationMigrateMemory(t *testing.T) {
+	var numQueries int
+	lm, _, buffer := newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "getfd", "migrate", "migrate-set-parameters":
+				return nil, nil
+			case "query-migrate":
+				if numQueries++; numQueries < 2 {
+					return json.RawMessage(`{"status": "active", "ram": {
+						"remaining": 1024, "total": 4096,
+						"transferred": 3072}}`), nil
+				}
+				return qmpMigrationInfo{Downtime: 10, Status: "completed"},
+					nil
+			}
+			return nil, errors.New("unsupported command: " + command)
+		})
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if err := lm.migrateMemory(writer); err != nil {
+		t.Fatal(err)
+	}
+	if lm.migrating {
+		t.Error("still migrating after completion")
+	}
+	messages := readProgressMessages(t, buffer)
+	if len(messages) != 1 ||
+		!strings.HasPrefix(messages[0], "copying memory: 3 KiB of 4 KiB") {
+		t.Errorf("unexpected progress messages: %v", messages)
+	}
+}
+
+func TestLiveMigrationMigrateMemoryFailed(t *testing.T) {
+	lm, _, _ := newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "getfd", "migrate", "migrate-set-parameters":
+				return nil, nil
+			case "query-migrate":
+				return qmpMigrationInfo{
+					ErrorDescription: "connection reset",
+					Status:           "failed",
+				}, nil
+			}
+			return nil, errors.New("unsupported command: " + command)
+		})
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if err := lm.migrateMemory(writer); err == nil {
+		t.Fatal("failed migration did not return an error")
+	}
+	if lm.migrating {
+		t.Error("still migrating after failure")
+	}
+}
+
+func TestLiveMigrationMirrorVolumes(t *testing.T) {
+	var mirrorArguments map[string]string
+	var numQueries int
+	lm, _, buffer := newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "blockdev-add", "getfd":
+				return nil, nil
+			case "blockdev-mirror":
+				return nil, json.Unmarshal(arguments, &mirrorArguments)
+			case "query-block":
+				return json.RawMessage(`[{"device": "drive0", "inserted": {
+					"file": "/vol0", "node-name": "node0"}}]`), nil
+			case "query-block-jobs":
+				// The job is not ready until the dirty blocks are copied.
+				numQueries++
+				return []qmpBlockJobInfo{{
+					Device: liveMigrationVolumeName(0),
+					Length: 100,
+					Offset: 50,
+					Ready:  numQueries > 1,
+				}}, nil
+			}
+			return nil, errors.New("unsupported command: " + command)
+		})
+	lm.vm.VolumeLocations = []proto.LocalVolume{{Filename: "/vol0"}}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if err := lm.mirrorVolumes([]*os.File{writer}); err != nil {
+		t.Fatal(err)
+	}
+	name := liveMigrationVolumeName(0)
+	if mirrorArguments["device"] != "drive0" ||
+		mirrorArguments["sync"] != "full" ||
+		mirrorArguments["target"] != name {
+		t.Errorf("unexpected mirror arguments: %v", mirrorArguments)
+	}
+	if !reflect.DeepEqual(lm.jobs, []string{name}) ||
+		!reflect.DeepEqual(lm.targets, []string{name}) {
+		t.Errorf("jobs: %v, targets: %v", lm.jobs, lm.targets)
+	}
+	messages := readProgressMessages(t, buffer)
+	if len(messages) != 1 ||
+		!strings.HasPrefix(messages[0], "copying volume(s): 50%") {
+		t.Errorf("unexpected progress messages: %v", messages)
+	}
+}
+
+func TestLiveMigrationCompleteMirrors(t *testing.T) {
+	name := liveMigrationVolumeName(0)
+	lm, fakeQemu, _ := newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "block-job-cancel", "blockdev-del":
+				return nil, nil
+			case "query-block-jobs":
+				return []qmpBlockJobInfo{}, nil
+			}
+			return nil, errors.New("unsupported command: " + command)
+		})
+	lm.jobs = []string{name}
+	lm.targets = []string{name}
+	if err := lm.completeMirrors(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lm.jobs) != 0 || len(lm.targets) != 0 {
+		t.Errorf("jobs: %v, targets: %v", lm.jobs, lm.targets)
+	}
+	want := []string{"block-job-cancel", "query-block-jobs", "blockdev-del"}
+	if commands := fakeQemu.getCommands(); !reflect.DeepEqual(commands,
+		want) {
+		t.Errorf("commands: %v != %v", commands, want)
+	}
+}
+
+func TestLiveMigrationRestore(t *testing.T) {
+	name := liveMigrationVolumeName(0)
+	lm, fakeQemu, _ := newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "block-job-cancel", "blockdev-del", "cont", "migrate_cancel":
+				return nil, nil
+			case "query-block-jobs":
+				return []qmpBlockJobInfo{}, nil
+			case "query-status":
+				return qmpStatusInfo{Status: "postmigrate"}, nil
+			}
+			return nil, errors.New("unsupported command: " + command)
+		})
+	lm.jobs = []string{name}
+	lm.migrating = true
+	lm.targets = []string{name}
+	lm.restore()
+	want := []string{"migrate_cancel", "block-job-cancel", "query-block-jobs",
+		"blockdev-del", "query-status", "cont"}
+	if commands := fakeQemu.getCommands(); !reflect.DeepEqual(commands,
+		want) {
+		t.Errorf("commands: %v != %v", commands, want)
+	}
+	lm, fakeQemu, _ = newTestLiveMigrationSource(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			return nil, errors.New("unsupported command: " + command)
+		})
+	lm.committed = true
+	lm.restore()
+	if commands := fakeQemu.getCommands(); len(commands) != 0 {
+		t.Errorf("commands sent after commit: %v", commands)
+	}
+}
@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	minimumBitsPerSecond    = 64000
+	minimumBurstBytes       = 64 << 10
+	minimumBurstPackets     = 16
+	minimumPacketsPerSecond = 10
+)
+
+// applyNetworkLimits will replace the traffic control policers on the tap
+// device with policers for the specified limits. Packets exceeding a limit are
+// dropped.
+func applyNetworkLimits(tapName string, limits *proto.NetworkLimits) error {
+	// Ignore errors: there may not be any policers yet.
+	exec.Command("tc", "qdisc", "del", "dev", tapName, "clsact").Run()
+	if limits.IsZero() {
+		return nil
+	}
+	cmd := exec.Command("tc", "qdisc", "add", "dev", tapName, "clsact")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error adding clsact qdisc to: %s: %s: %s",
+			tapName, err, output)
+	}
+	for _, args := range makePolicerArgs(tapName, *limits) {
+		cmd := exec.Command("tc", args...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error adding %s policer to: %s: %s: %s",
+				args[4], tapName, err, output)
+		}
+	}
+	return nil
+}
+
+// makePolicerArgs returns the tc arguments to add a policer filter for each
+// limit to the tap device. Traffic from the VM is ingress traffic for the tap
+// device and traffic to the VM is egress traffic.
+func makePolicerArgs(tapName string, limits proto.NetworkLimits) [][]string {
+	var policers [][]string
+	pref := 0
+	for _, policer := range []struct {
+		direction        string
+		bitsPerSecond    uint64
+		packetsPerSecond uint64
+	}{
+		{"ingress", limits.EgressBitsPerSecond, limits.EgressPacketsPerSecond},
+		{"egress", limits.IngressBitsPerSecond, limits.IngressPacketsPerSecond},
+	} {
+		var rates [][]string
+		if policer.bitsPerSecond > 0 {
+			burst := policer.bitsPerSecond / 80 // 100 ms.
+			if burst < minimumBurstBytes {
+				burst = minimumBurstBytes
+			}
+			rates = append(rates, []string{
+				"rate", strconv.FormatUint(policer.bitsPerSecond, 10) + "bit",
+				"burst", strconv.FormatUint(burst, 10),
+			})
+		}
+		if policer.packetsPerSecond > 0 {
+			burst := policer.packetsPerSecond / 10 // 100 ms.
+			if burst < minimumBurstPackets {
+				burst = minimumBurstPackets
+			}
+			rates = append(rates, []string{
+				"pkts_rate", strconv.FormatUint(policer.packetsPerSecond, 10),
+				"pkts_burst", strconv.FormatUint(burst, 10),
+			})
+		}
+		for _, rate := range rates {
+			pref++
+			// A conforming packet continues on to the next policer.
+			args := []string{"filter", "add", "dev", tapName, policer.direction,
+				"pref", strconv.Itoa(pref), "matchall", "action", "police"}
+			args = append(args, rate...)
+			args = append(args, "conform-exceed", "drop/continue")
+			policers = append(policers, args)
+		}
+	}
+	return policers
+}
+
+// changeTapNetworkLimits will apply newLimits to each tap device. If applying
+// the limits fails, the tap devices which were changed (including the
+// partially changed one) are restored to oldLimits, so that the limits on all
+// the tap devices are unchanged.
+func changeTapNetworkLimits(tapNames []string,
+	oldLimits, newLimits *proto.NetworkLimits,
+	applyFunc func(string, *proto.NetworkLimits) error,
+	logger log.Logger) error {
+	for index, tapName := range tapNames {
+		if err := applyFunc(tapName, newLimits); err != nil {
+			for _, tapName := range tapNames[:index+1] {
+				if err := applyFunc(tapName, oldLimits); err != nil {
+					logger.Printf(
+						"error restoring network limits for: %s: %s\n",
+						tapName, err)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func checkNetworkLimits(limits proto.NetworkLimits) error {
+	for _, bitsPerSecond := range []uint64{
+		limits.EgressBitsPerSecond,
+		limits.IngressBitsPerSecond,
+	} {
+		if bitsPerSecond > 0 && bitsPerSecond < minimumBitsPerSecond {
+			return fmt.Errorf("bit rate limit must be at least %d b/s",
+				minimumBitsPerSecond)
+		}
+	}
+	for _, packetsPerSecond := range []uint64{
+		limits.EgressPacketsPerSecond,
+		limits.IngressPacketsPerSecond,
+	} {
+		if packetsPerSecond > 0 && packetsPerSecond < minimumPacketsPerSecond {
+			return fmt.Errorf("packet rate limit must be at least %d p/s",
+				minimumPacketsPerSecond)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) changeVmNetworkLimits(ipAddr net.IP,
+	authInfo *srpc.AuthInformation, limits proto.NetworkLimits) error {
+	if err := checkNetworkLimits(limits); err != nil {
+		return err
+	}
+	vm, err := m.getVmLockAndAuth(ipAddr, true, authInfo, nil)
+	if err != nil {
+		return err
+	}
+	defer vm.mutex.Unlock()
+	var newLimits *proto.NetworkLimits
+	if !limits.IsZero() {
+		newLimits = &limits
+	}
+	if vm.State == proto.StateRunning {
+		pid, err := vm.readPid()
+		if err != nil {
+			return err
+		}
+		tapNames, err := findTapDevices(pid)
+		if err != nil {
+			return err
+		}
+		if len(tapNames) < 1 {
+			return errors.New("no tap devices found for VM")
+		}
+		err = changeTapNetworkLimits(tapNames, vm.NetworkLimits, newLimits,
+			applyNetworkLimits, vm.logger)
+		if err != nil {
+			return err
+		}
+	}
+	vm.NetworkLimits = newLimits
+	vm.writeAndSendInfo()
+	return nil
+}
@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestCheckNetworkLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  proto.NetworkLimits
+		wantErr bool
+	}{
+		{"none", proto.NetworkLimits{}, false},
+		{"valid", proto.NetworkLimits{
+			EgressBitsPerSecond:     minimumBitsPerSecond,
+			EgressPacketsPerSecond:  minimumPacketsPerSecond,
+			IngressBitsPerSecond:    1e9,
+			IngressPacketsPerSecond: 1e5,
+		}, false},
+		{"low egress bit rate", proto.NetworkLimits{
+			EgressBitsPerSecond: minimumBitsPerSecond - 1,
+		}, true},
+		{"low ingress bit rate", proto.NetworkLimits{
+			IngressBitsPerSecond: 1,
+		}, true},
+		{"low egress packet rate", proto.NetworkLimits{
+			EgressPacketsPerSecond: minimumPacketsPerSecond - 1,
+		}, true},
+		{"low ingress packet rate", proto.NetworkLimits{
+			IngressPacketsPerSecond: 1,
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkNetworkLimits(test.limits)
+			if test.wantErr && err == nil {
+				t.Error("invalid limits accepted")
+			} else if !test.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMakePolicerArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits proto.NetworkLimits
+		want   []string
+	}{
+		{"none", proto.NetworkLimits{}, nil},
+		{"egress bit rate", proto.NetworkLimits{EgressBitsPerSecond: 80e6},
+			[]string{
+				"filter add dev tap0 ingress pref 1 matchall action police" +
+					" rate 80000000bit burst 1000000" +
+					" conform-exceed drop/continue",
+			}},
+		{"minimum bursts", proto.NetworkLimits{
+			IngressBitsPerSecond:    minimumBitsPerSecond,
+			IngressPacketsPerSecond: minimumPacketsPerSecond,
+		}, []string{
+			"filter add dev tap0 egress pref 1 matchall action police" +
+				" rate 64000bit burst 65536 conform-exceed drop/continue",
+			"filter add dev tap0 egress pref 2 matchall action police" +
+				" pkts_rate 10 pkts_burst 16 conform-exceed drop/continue",
+		}},
+		{"all", proto.NetworkLimits{
+			EgressBitsPerSecond:     1e9,
+			EgressPacketsPerSecond:  1e5,
+			IngressBitsPerSecond:    1e8,
+			IngressPacketsPerSecond: 1e4,
+		}, []string{
+			"filter add dev tap0 ingress pref 1 matchall action police" +
+				" rate 1000000000bit burst 12500000" +
+				" conform-exceed drop/continue",
+			"filter add dev tap0 ingress pref 2 matchall action police" +
+				" pkts_rate 100000 pkts_burst 10000" +
+				" conform-exceed drop/continue",
+			"filter add dev tap0 egress pref 3 matchall action police" +
+				" rate 100000000bit burst 1250000" +
+				" conform-exceed drop/continue",
+			"filter add dev tap0 egress pref 4 matchall action police" +
+				" pkts_rate 10000 pkts_burst 1000" +
+				" conform-exceed drop/continue",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, args := range makePolicerArgs("tap0", test.limits) {
+				got = append(got, strings.Join(args, " "))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("makePolicerArgs() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChangeTapNetworkLimits(t *testing.T) {
+	oldLimits := &proto.NetworkLimits{EgressBitsPerSecond: 1e6}
+	newLimits := &proto.NetworkLimits{EgressBitsPerSecond: 2e6}
+	tests := []struct {
+		name     string
+		failTap  string
+		wantErr  bool
+		wantTaps map[string]*proto.NetworkLimits
+	}{
+		{"success", "", false, map[string]*proto.NetworkLimits{
+			"tap0": newLimits, "tap1": newLimits, "tap2": newLimits,
+		}},
+		{"failure rolled back", "tap1", true,
+			map[string]*proto.NetworkLimits{
+				"tap0": oldLimits, "tap1": oldLimits, "tap2": oldLimits,
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tapLimits := map[string]*proto.NetworkLimits{
+				"tap0": oldLimits, "tap1": oldLimits, "tap2": oldLimits,
+			}
+			applyFunc := func(tapName string,
+				limits *proto.NetworkLimits) error {
+				if tapName == test.failTap && limits == newLimits {
+					tapLimits[tapName] = nil // Partially changed.
+					return errors.New("tc failed")
+				}
+				tapLimits[tapName] = limits
+				return nil
+			}
+			err := changeTapNetworkLimits([]string{"tap0", "tap1", "tap2"},
+				oldLimits, newLimits, applyFunc, testlogger.New(t))
+			if test.wantErr && err == nil {
+				t.Error("failure not reported")
+			} else if !test.wantErr && err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(tapLimits, test.wantTaps) {
+				t.Errorf("tap limits = %v, want %v", tapLimits, test.wantTaps)
+			}
+		})
+	}
+}
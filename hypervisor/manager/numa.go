@@ -0,0 +1,451 @@
+package manager
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"golang.org/x/sys/unix"
+)
+
+const sysNodeDirectory = "/sys/devices/system/node"
+
+type numaAllocationType struct {
+	cpus        []uint // Host CPU for each vCPU.
+	memoryInMiB uint64
+	milliCPUs   uint
+	nodeId      uint
+}
+
+type numaNodeType struct {
+	cpus        []uint
+	id          uint
+	memoryInMiB uint64
+}
+
+// chooseNumaNode returns the index of the node with the most unallocated
+// memory which a VM with the specified resources fits on, or -1 if the VM does
+// not fit on any node. The VM must also fit in the memory currently available
+// on the node.
+func chooseNumaNode(capacities []proto.NumaNodeCapacity,
+	availableMemory []uint64, nCpus, milliCPUs uint, memoryInMiB uint64) int {
+	bestIndex := -1
+	var bestUnallocatedMemory uint64
+	for index, capacity := range capacities {
+		if nCpus > capacity.NumCPUs ||
+			milliCPUs > capacity.UnallocatedMilliCPUs ||
+			memoryInMiB > capacity.UnallocatedMemoryInMiB ||
+			memoryInMiB >= availableMemory[index] {
+			continue
+		}
+		if bestIndex < 0 ||
+			capacity.UnallocatedMemoryInMiB > bestUnallocatedMemory {
+			bestIndex = index
+			bestUnallocatedMemory = capacity.UnallocatedMemoryInMiB
+		}
+	}
+	return bestIndex
+}
+
+// discoverNumaNodes returns the NUMA nodes which have CPUs, sorted by ID.
+func discoverNumaNodes() ([]numaNodeType, error) {
+	dirEntries, err := os.ReadDir(sysNodeDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []numaNodeType
+	for _, dirEntry := range dirEntries {
+		var nodeId uint
+		name := dirEntry.Name()
+		if _, err := fmt.Sscanf(name, "node%d", &nodeId); err != nil {
+			continue
+		}
+		if name != "node"+strconv.FormatUint(uint64(nodeId), 10) {
+			continue
+		}
+		data, err := os.ReadFile(
+			filepath.Join(sysNodeDirectory, name, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCpuList(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CPU list for: %s: %s",
+				name, err)
+		}
+		if len(cpus) < 1 {
+			continue // Memory-only node.
+		}
+		memoryInMiB, _, err := readNumaNodeMemInfo(nodeId)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, numaNodeType{
+			cpus:        cpus,
+			id:          nodeId,
+			memoryInMiB: memoryInMiB,
+		})
+	}
+	if len(nodes) < 1 {
+		return nil, errors.New("no NUMA nodes with CPUs found")
+	}
+	sort.Slice(nodes, func(left, right int) bool {
+		return nodes[left].id < nodes[right].id
+	})
+	return nodes, nil
+}
+
+// parseCpuList parses a list of CPUs in the kernel format (e.g. "0-3,8-11").
+func parseCpuList(cpuList string) ([]uint, error) {
+	var cpus []uint
+	if cpuList == "" {
+		return nil, nil
+	}
+	for _, field := range strings.Split(cpuList, ",") {
+		first, last, isRange := strings.Cut(field, "-")
+		firstCpu, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		lastCpu := firstCpu
+		if isRange {
+			lastCpu, err = strconv.ParseUint(last, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if lastCpu < firstCpu {
+			return nil, fmt.Errorf("invalid CPU range: %s", field)
+		}
+		for cpu := firstCpu; cpu <= lastCpu; cpu++ {
+			cpus = append(cpus, uint(cpu))
+		}
+	}
+	return cpus, nil
+}
+
+// parseVirtualCpuThreadName returns the vCPU index for a virtualiser thread
+// name of the form "CPU 3/KVM".
+func parseVirtualCpuThreadName(name string) (uint, bool) {
+	cpuName, accelerator, ok := strings.Cut(name, "/")
+	if !ok || accelerator != "KVM" {
+		return 0, false
+	}
+	index, ok := strings.CutPrefix(cpuName, "CPU ")
+	if !ok {
+		return 0, false
+	}
+	vCpu, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(vCpu), true
+}
+
+// readNumaNodeMemInfo returns the total memory and the memory which is free or
+// easily reclaimable for a NUMA node.
+func readNumaNodeMemInfo(nodeId uint) (uint64, uint64, error) {
+	file, err := os.Open(filepath.Join(sysNodeDirectory,
+		"node"+strconv.FormatUint(uint64(nodeId), 10), "meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	var available, total uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines are of the form: "Node 0 MemTotal:       65799600 kB".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[2] {
+		case "MemTotal:":
+			total = value >> 10
+		case "MemFree:", "Inactive(file):":
+			available += value >> 10
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return total, available, nil
+}
+
+// selectCpuForVirtualCpu returns the CPU a vCPU should be pinned to from the
+// CPUs selected for the VM.
+func selectCpuForVirtualCpu(cpus []uint, vCpu uint) uint {
+	return cpus[vCpu%uint(len(cpus))]
+}
+
+// selectCpusForVirtualCpus returns a CPU of the node for each vCPU, choosing
+// the CPUs with the fewest vCPUs of other VMs pinned to them (lowest CPU first
+// if equal), so that VMs on a node are spread over its CPUs. The vCPUs of a VM
+// are pinned to distinct CPUs if the node has enough CPUs.
+func selectCpusForVirtualCpus(nodeCpus []uint, numPinned map[uint]uint,
+	nCpus uint) []uint {
+	candidates := make([]uint, len(nodeCpus))
+	copy(candidates, nodeCpus)
+	sort.SliceStable(candidates, func(left, right int) bool {
+		return numPinned[candidates[left]] < numPinned[candidates[right]]
+	})
+	cpus := make([]uint, 0, nCpus)
+	for vCpu := uint(0); vCpu < nCpus; vCpu++ {
+		cpus = append(cpus, candidates[vCpu%uint(len(candidates))])
+	}
+	return cpus
+}
+
+// stateHoldsNumaAllocation returns true if a VM in the specified state may
+// have a running virtualiser and thus should hold its NUMA allocation.
+func stateHoldsNumaAllocation(state proto.State) bool {
+	switch state {
+	case proto.StateCrashed, proto.StateExporting, proto.StateFailedToStart,
+		proto.StateStopped:
+		return false
+	}
+	return true
+}
+
+// computeNumaCapacityWithLock computes the capacity of each NUMA node, ignoring
+// the allocation for a specified VM. The Manager lock and numaMutex must be
+// held.
+func (m *Manager) computeNumaCapacityWithLock(
+	excluded *vmInfoType) []proto.NumaNodeCapacity {
+	if len(m.numaNodes) < 1 {
+		return nil
+	}
+	unallocatedMemory := make(map[uint]int64, len(m.numaNodes))
+	unallocatedMilliCPUs := make(map[uint]int64, len(m.numaNodes))
+	for _, node := range m.numaNodes {
+		unallocatedMemory[node.id] = int64(node.memoryInMiB)
+		unallocatedMilliCPUs[node.id] = int64(len(node.cpus)) * 1000
+	}
+	for _, vm := range m.vms {
+		if vm == excluded || vm.numaAllocation == nil {
+			continue
+		}
+		allocation := vm.numaAllocation
+		unallocatedMemory[allocation.nodeId] -= int64(allocation.memoryInMiB)
+		unallocatedMilliCPUs[allocation.nodeId] -= int64(allocation.milliCPUs)
+	}
+	capacities := make([]proto.NumaNodeCapacity, 0, len(m.numaNodes))
+	for _, node := range m.numaNodes {
+		capacity := proto.NumaNodeCapacity{
+			MemoryInMiB: node.memoryInMiB,
+			NodeId:      node.id,
+			NumCPUs:     uint(len(node.cpus)),
+		}
+		if memory := unallocatedMemory[node.id]; memory > 0 {
+			capacity.UnallocatedMemoryInMiB = uint64(memory)
+		}
+		if milliCPUs := unallocatedMilliCPUs[node.id]; milliCPUs > 0 {
+			capacity.UnallocatedMilliCPUs = uint(milliCPUs)
+		}
+		capacities = append(capacities, capacity)
+	}
+	return capacities
+}
+
+// countPinnedVirtualCpusWithLock returns the number of vCPUs pinned to each
+// CPU, ignoring a specified VM. The Manager lock and numaMutex must be held.
+func (m *Manager) countPinnedVirtualCpusWithLock(
+	excluded *vmInfoType) map[uint]uint {
+	numPinned := make(map[uint]uint)
+	for _, vm := range m.vms {
+		if vm == excluded || vm.numaAllocation == nil {
+			continue
+		}
+		for _, cpu := range vm.numaAllocation.cpus {
+			numPinned[cpu]++
+		}
+	}
+	return numPinned
+}
+
+func (m *Manager) getNumaCapacity() []proto.NumaNodeCapacity {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	m.numaMutex.Lock()
+	defer m.numaMutex.Unlock()
+	return m.computeNumaCapacityWithLock(nil)
+}
+
+func (m *Manager) setupNumaPlacement() error {
+	if !m.NumaPlacement {
+		return nil
+	}
+	numactlPath, err := exec.LookPath("numactl")
+	if err != nil {
+		return fmt.Errorf("NUMA placement requires numactl: %s", err)
+	}
+	nodes, err := discoverNumaNodes()
+	if err != nil {
+		return fmt.Errorf("error discovering NUMA topology: %s", err)
+	}
+	m.numactlPath = numactlPath
+	m.numaNodes = nodes
+	m.Logger.Printf("NUMA placement enabled, %d nodes\n", len(nodes))
+	return nil
+}
+
+// loadNumaAllocation restores the allocation for the NUMA placement of the VM.
+// This should only be called when loading VMs.
+func (vm *vmInfoType) loadNumaAllocation() {
+	placement := vm.NumaPlacement
+	if placement == nil {
+		return
+	}
+	if !stateHoldsNumaAllocation(vm.State) {
+		vm.NumaPlacement = nil
+		return
+	}
+	for _, node := range vm.manager.numaNodes {
+		if node.id == placement.NodeId {
+			vm.numaAllocation = &numaAllocationType{
+				cpus:        placement.CPUs,
+				memoryInMiB: vm.MemoryInMiB,
+				milliCPUs:   vm.MilliCPUs,
+				nodeId:      node.id,
+			}
+			return
+		}
+	}
+}
+
+// pinVirtualCPUs will pin each vCPU thread of the virtualiser to the CPU of the
+// NUMA node selected for the vCPU. The virtualiser must be started with thread
+// names enabled so that the vCPU threads can be found.
+func (vm *vmInfoType) pinVirtualCPUs() error {
+	placement := vm.NumaPlacement
+	if placement == nil || len(placement.CPUs) < 1 {
+		return nil
+	}
+	pid, err := vm.readPid()
+	if err != nil {
+		return fmt.Errorf("unable to read virtualiser PID: %w", err)
+	}
+	taskDirectory := filepath.Join("/proc", strconv.Itoa(pid), "task")
+	dirEntries, err := os.ReadDir(taskDirectory)
+	if err != nil {
+		return err
+	}
+	var numPinned uint
+	for _, dirEntry := range dirEntries {
+		tid, err := strconv.Atoi(dirEntry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(
+			filepath.Join(taskDirectory, dirEntry.Name(), "comm"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // Thread exited.
+			}
+			return err
+		}
+		vCpu, ok := parseVirtualCpuThreadName(strings.TrimSpace(string(comm)))
+		if !ok {
+			continue
+		}
+		cpu := selectCpuForVirtualCpu(placement.CPUs, vCpu)
+		var cpuSet unix.CPUSet
+		cpuSet.Set(int(cpu))
+		if err := unix.SchedSetaffinity(tid, &cpuSet); err != nil {
+			return fmt.Errorf("error pinning vCPU: %d to CPU: %d: %s",
+				vCpu, cpu, err)
+		}
+		numPinned++
+	}
+	if numPinned < 1 {
+		return errors.New("no vCPU threads found to pin")
+	}
+	vm.logger.Debugf(0, "pinned %d vCPUs to NUMA node: %d\n",
+		numPinned, placement.NodeId)
+	return nil
+}
+
+// allocateNumaNodeWithLock will choose the NUMA node with the most unallocated
+// memory which the VM fits on, will select the CPUs for the vCPUs and will
+// record the placement. If the VM does not fit on any node, the VM is not placed. The
+// Manager lock and numaMutex must be held.
+func (vm *vmInfoType) allocateNumaNodeWithLock(nCpus uint,
+	availableMemory []uint64) {
+	m := vm.manager
+	vm.numaAllocation = nil
+	vm.NumaPlacement = nil
+	capacities := m.computeNumaCapacityWithLock(vm)
+	index := chooseNumaNode(capacities, availableMemory, nCpus, vm.MilliCPUs,
+		vm.MemoryInMiB)
+	if index < 0 {
+		vm.logger.Println("VM does not fit on a NUMA node, not pinning")
+		return
+	}
+	bestNode := m.numaNodes[index]
+	cpus := selectCpusForVirtualCpus(bestNode.cpus,
+		m.countPinnedVirtualCpusWithLock(vm), nCpus)
+	vm.numaAllocation = &numaAllocationType{
+		cpus:        cpus,
+		memoryInMiB: vm.MemoryInMiB,
+		milliCPUs:   vm.MilliCPUs,
+		nodeId:      bestNode.id,
+	}
+	vm.NumaPlacement = &proto.NumaPlacement{
+		CPUs:   cpus,
+		NodeId: bestNode.id,
+	}
+	vm.logger.Debugf(0, "placed on NUMA node: %d, CPUs: %v\n",
+		bestNode.id, cpus)
+}
+
+// placeOnNumaNode will choose the NUMA node with the most unallocated memory
+// which the VM fits on and will record the placement. If NUMA placement is
+// disabled or the VM does not fit on any node, the VM is not placed. The VM
+// lock must be held.
+func (vm *vmInfoType) placeOnNumaNode(nCpus uint, haveManagerLock bool) {
+	m := vm.manager
+	if len(m.numaNodes) < 1 {
+		vm.NumaPlacement = nil
+		return
+	}
+	if !haveManagerLock {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+	}
+	m.numaMutex.Lock()
+	defer m.numaMutex.Unlock()
+	availableMemory := make([]uint64, len(m.numaNodes))
+	for index, node := range m.numaNodes {
+		_, available, err := readNumaNodeMemInfo(node.id)
+		if err != nil {
+			vm.logger.Println(err)
+			continue // Leave available memory as 0 so the node is skipped.
+		}
+		availableMemory[index] = available
+	}
+	vm.allocateNumaNodeWithLock(nCpus, availableMemory)
+}
+
+// releaseNumaAllocation will release the NUMA node capacity allocated to the
+// VM. This should be called when the virtualiser is no longer running.
+func (vm *vmInfoType) releaseNumaAllocation() {
+	vm.manager.numaMutex.Lock()
+	defer vm.manager.numaMutex.Unlock()
+	if vm.numaAllocation != nil {
+		vm.logger.Debugf(0, "released NUMA node: %d\n",
+			vm.numaAllocation.nodeId)
+	}
+	vm.numaAllocation = nil
+	vm.NumaPlacement = nil
+}
@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestParseCpuList(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuList string
+		want    []uint
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"single", "3", []uint{3}, false},
+		{"range", "0-3", []uint{0, 1, 2, 3}, false},
+		{"mixed", "0-1,4,8-9", []uint{0, 1, 4, 8, 9}, false},
+		{"reversed range", "3-1", nil, true},
+		{"bad number", "0-x", nil, true},
+		{"empty field", "0,,2", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCpuList(test.cpuList)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("invalid CPU list accepted: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseCpuList(%q) = %v, want %v",
+					test.cpuList, got, test.want)
+			}
+		})
+	}
+}
+
+func TestChooseNumaNode(t *testing.T) {
+	capacities := []proto.NumaNodeCapacity{
+		{
+			NodeId:                 0,
+			NumCPUs:                4,
+			UnallocatedMemoryInMiB: 4096,
+			UnallocatedMilliCPUs:   4000,
+		},
+		{
+			NodeId:                 1,
+			NumCPUs:                8,
+			UnallocatedMemoryInMiB: 8192,
+			UnallocatedMilliCPUs:   1000,
+		},
+	}
+	plenty := []uint64{16384, 16384}
+	tests := []struct {
+		name            string
+		availableMemory []uint64
+		nCpus           uint
+		milliCPUs       uint
+		memoryInMiB     uint64
+		want            int
+	}{
+		{"most unallocated memory", plenty, 1, 1000, 1024, 1},
+		{"too many milliCPUs", plenty, 2, 2000, 1024, 0},
+		{"too many vCPUs", plenty, 6, 1000, 1024, 1},
+		{"too much memory", plenty, 1, 1000, 6144, 1},
+		{"fits nowhere", plenty, 1, 1000, 10240, -1},
+		{"low available memory", []uint64{16384, 1024}, 1, 1000, 1024, 0},
+		{"no available memory", []uint64{0, 0}, 1, 1000, 1024, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := chooseNumaNode(capacities, test.availableMemory,
+				test.nCpus, test.milliCPUs, test.memoryInMiB)
+			if got != test.want {
+				t.Errorf("chooseNumaNode() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVirtualCpuThreadName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   uint
+		wantOk bool
+	}{
+		{"CPU 0/KVM", 0, true},
+		{"CPU 12/KVM", 12, true},
+		{"CPU 1/TCG", 0, false},
+		{"IO mon_iothread", 0, false},
+		{"qemu-system-x86", 0, false},
+		{"CPU x/KVM", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := parseVirtualCpuThreadName(test.name)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("parseVirtualCpuThreadName(%q) = %d, %t, want %d, %t",
+				test.name, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestSelectCpuForVirtualCpu(t *testing.T) {
+	cpus := []uint{4, 5, 6}
+	var got []uint
+	for vCpu := uint(0); vCpu < 5; vCpu++ {
+		got = append(got, selectCpuForVirtualCpu(cpus, vCpu))
+	}
+	if want := []uint{4, 5, 6, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CPUs = %v, want %v", got, want)
+	}
+}
+
+func TestSelectCpusForVirtualCpus(t *testing.T) {
+	nodeCpus := []uint{4, 5, 6, 7}
+	tests := []struct {
+		name      string
+		numPinned map[uint]uint
+		nCpus     uint
+		want      []uint
+	}{
+		{"no pinned vCPUs", nil, 2, []uint{4, 5}},
+		{"some pinned vCPUs", map[uint]uint{4: 1, 5: 1}, 2, []uint{6, 7}},
+		{"least pinned", map[uint]uint{4: 2, 5: 1, 6: 2, 7: 1}, 3,
+			[]uint{5, 7, 4}},
+		{"more vCPUs than CPUs", nil, 6, []uint{4, 5, 6, 7, 4, 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := selectCpusForVirtualCpus(nodeCpus, test.numPinned,
+				test.nCpus)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CPUs = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTwoVmsOnOneNumaNode(t *testing.T) {
+	m := &Manager{
+		numaNodes: []numaNodeType{
+			{cpus: []uint{0, 1, 2, 3}, id: 0, memoryInMiB: 4096},
+		},
+		vms: make(map[string]*vmInfoType),
+	}
+	availableMemory := []uint64{4096}
+	var vms []*vmInfoType
+	for _, ipAddr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		vm := &vmInfoType{
+			ipAddress: ipAddr,
+			logger:    testlogger.New(t),
+			manager:   m,
+		}
+		vm.MemoryInMiB = 1024
+		vm.MilliCPUs = 1000
+		m.vms[ipAddr] = vm
+		vms = append(vms, vm)
+	}
+	vms[0].allocateNumaNodeWithLock(2, availableMemory)
+	vms[1].allocateNumaNodeWithLock(2, availableMemory)
+	for index, want := range [][]uint{{0, 1}, {2, 3}} {
+		placement := vms[index].NumaPlacement
+		if placement == nil {
+			t.Fatalf("VM %d not placed", index)
+		}
+		if !reflect.DeepEqual(placement.CPUs, want) {
+			t.Errorf("VM %d CPUs = %v, want %v", index, placement.CPUs, want)
+		}
+	}
+	// Once the first VM is released, its CPUs are used again.
+	vms[0].releaseNumaAllocation()
+	vms[2].allocateNumaNodeWithLock(1, availableMemory)
+	if got := vms[2].NumaPlacement.CPUs; !reflect.DeepEqual(got, []uint{0}) {
+		t.Errorf("CPUs = %v, want [0]", got)
+	}
+}
+
+func TestNumaAllocationReleasedOnStop(t *testing.T) {
+	m := &Manager{
+		numaNodes: []numaNodeType{
+			{cpus: []uint{0, 1}, id: 0, memoryInMiB: 4096},
+		},
+		vms: make(map[string]*vmInfoType),
+	}
+	var runningVm *vmInfoType
+	for ipAddr, state := range map[string]proto.State{
+		"10.0.0.1": proto.StateRunning,
+		"10.0.0.2": proto.StateStopped,
+	} {
+		vm := &vmInfoType{
+			dirname:   t.TempDir(),
+			ipAddress: ipAddr,
+			logger:    testlogger.New(t),
+			manager:   m,
+		}
+		vm.MemoryInMiB = 1024
+		vm.MilliCPUs = 500
+		vm.NumaPlacement = &proto.NumaPlacement{CPUs: []uint{0, 1}}
+		vm.State = state
+		vm.loadNumaAllocation()
+		m.vms[ipAddr] = vm
+		if state == proto.StateRunning {
+			runningVm = vm
+		} else if vm.numaAllocation != nil || vm.NumaPlacement != nil {
+			t.Error("allocation restored for stopped VM")
+		}
+	}
+	if got := m.getNumaCapacity()[0].UnallocatedMemoryInMiB; got != 3072 {
+		t.Errorf("UnallocatedMemoryInMiB = %d, want 3072", got)
+	}
+	runningVm.setState(proto.StateCrashed)
+	if runningVm.numaAllocation != nil || runningVm.NumaPlacement != nil {
+		t.Error("allocation not released for crashed VM")
+	}
+	capacity := m.getNumaCapacity()[0]
+	if capacity.UnallocatedMemoryInMiB != 4096 ||
+		capacity.UnallocatedMilliCPUs != 2000 {
+		t.Errorf("capacity = %+v, want all unallocated", capacity)
+	}
+}
@@ -126,6 +126,7 @@ func (vm *vmInfoType) processMonitorResponses(monitorSock net.Conn,
 			} else {
 				vm.setState(proto.StateStopped)
 				vm.logger.Debugln(0, "VM stopped due to guest powerdown")
+				vm.scheduleRestart(false)
 			}
 		} else if !vm.manager.shuttingDown && watchdogPowerOff {
 			if vm.DestroyOnPowerdown && !vm.DestroyProtection {
@@ -134,9 +135,11 @@ func (vm *vmInfoType) processMonitorResponses(monitorSock net.Conn,
 			} else {
 				vm.setState(proto.StateCrashed)
 				vm.logger.Debugln(0, "VM crashed due to watchdog poweroff")
+				vm.scheduleRestart(true)
 			}
 		} else {
 			vm.setState(proto.StateCrashed)
+			vm.scheduleRestart(true)
 		}
 		select {
 		case vm.stoppedNotifier <- struct{}{}:
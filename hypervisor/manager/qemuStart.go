@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem/util"
@@ -23,14 +24,19 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 	if vm.ArchitectureType == proto.ArchitectureTypeRuntime {
 		machine = append(machine, "accel=kvm")
 	}
+	name := vm.ipAddress
+	if vm.NumaPlacement != nil {
+		// Name the vCPU threads so that they can be pinned once started.
+		name += ",debug-threads=on"
+	}
 	cmd := exec.Command(filepath.Join(bindir, qemuInfo.command),
 		"-machine", strings.Join(machine, ","),
 		"-cpu", qemuInfo.cpuModel,
 		"-rtc", "base=utc,clock=host", // TODO(rgooch): consider if needed.
 		"-nodefaults",
-		"-name", vm.ipAddress,
+		"-name", name,
 		"-m", fmt.Sprintf("%dM", vm.MemoryInMiB),
-		"-smbios", "type=1,product=SmallStack",
+		"-smbios", vm.getSmbiosArg(),
 		"-smp", fmt.Sprintf("cpus=%d", nCpus),
 		"-serial",
 		"unix:"+filepath.Join(vm.dirname, serialSockFilename)+",server,nowait",
@@ -63,6 +69,7 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 	var interfaceDriver string
 	if !vm.DisableVirtIO {
 		interfaceDriver = ",if=virtio"
+		cmd.Args = append(cmd.Args, vm.getGuestAgentArgs()...)
 	}
 	if debugRoot := vm.getDebugRoot(); debugRoot != "" {
 		options := interfaceDriver + ",discard=off"
@@ -161,6 +168,15 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 			return fmt.Errorf("invalid volume interface: %v", volumeInterface)
 		}
 	}
+	if vm.CloudInitSeedVolume != proto.SeedVolumeNone {
+		filename, err := vm.writeCloudInitSeedVolume(haveManagerLock)
+		if err != nil {
+			return err
+		}
+		cmd.Args = append(cmd.Args,
+			"-drive", "file="+filename+",format=raw,readonly=on"+
+				interfaceDriver)
+	}
 	if cid, err := vm.manager.GetVmCID(vm.Address.IpAddress); err != nil {
 		return err
 	} else if cid > 2 {
@@ -169,11 +185,27 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 			fmt.Sprintf("vhost-vsock-pci,id=vhost-vsock-pci0,guest-cid=%d",
 				cid))
 	}
+	if vm.incomingLiveMigration {
+		cmd.Args = append(cmd.Args, "-S", "-incoming", "defer")
+	}
 	if vm.WatchdogModel != proto.WatchdogModelNone {
 		cmd.Args = append(cmd.Args,
 			"-watchdog-action", vm.WatchdogAction.String(),
 			"-device", vm.WatchdogModel.String())
 	}
+	if placement := vm.NumaPlacement; placement != nil {
+		// Restrict all virtualiser threads to the CPUs of the node and bind the
+		// guest memory to the node.
+		nodeId := strconv.FormatUint(uint64(placement.NodeId), 10)
+		cmd.Args = append([]string{
+			"numactl",
+			"--cpunodebind=" + nodeId,
+			"--membind=" + nodeId,
+			"--",
+			cmd.Path,
+		}, cmd.Args[1:]...)
+		cmd.Path = vm.manager.numactlPath
+	}
 	os.Remove(vm.getBootLogFilename())
 	cmd.Dir = vm.getLogsDirectory()
 	cmd.Env = os.Environ()
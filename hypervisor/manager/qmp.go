@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const qmpCommandTimeout = time.Minute
+
+// qmpClient sends QMP commands to the monitor for a VM and decodes the
+// responses and events from the copy of the monitor output. Only one qmpClient
+// may be used for a VM at a time, so it must be closed after use.
+type qmpClient struct {
+	decoder *json.Decoder
+	events  []qmpMessageType
+	nextId  uint64
+	reader  *qmpReader
+	vm      *vmInfoType
+}
+
+type qmpCommandType struct {
+	Arguments interface{} `json:"arguments,omitempty"`
+	Execute   string      `json:"execute"`
+	Id        string      `json:"id"`
+}
+
+type qmpErrorType struct {
+	Class       string `json:"class"`
+	Description string `json:"desc"`
+}
+
+type qmpMessageType struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  *qmpErrorType   `json:"error,omitempty"`
+	Event  string          `json:"event,omitempty"`
+	Id     string          `json:"id,omitempty"`
+	Return json.RawMessage `json:"return,omitempty"`
+}
+
+type qmpReader struct {
+	deadline time.Time
+	output   <-chan byte
+}
+
+// newQmpClient will wait for any other qmpClient for the VM to be closed and
+// will then return a new qmpClient.
+func (vm *vmInfoType) newQmpClient() (*qmpClient, error) {
+	vm.qmpMutex.Lock()
+	return vm.makeQmpClient()
+}
+
+// tryNewQmpClient will return a new qmpClient if no other qmpClient is in use
+// for the VM, else it returns nil.
+func (vm *vmInfoType) tryNewQmpClient() (*qmpClient, error) {
+	if !vm.qmpMutex.TryLock() {
+		return nil, nil
+	}
+	return vm.makeQmpClient()
+}
+
+// makeQmpClient must be called with the QMP lock held. The lock is released if
+// an error is returned.
+func (vm *vmInfoType) makeQmpClient() (*qmpClient, error) {
+	vm.mutex.RLock()
+	output := vm.commandOutput
+	vm.mutex.RUnlock()
+	if output == nil {
+		vm.qmpMutex.Unlock()
+		return nil, errors.New("no monitor for VM")
+	}
+	// Drain any previous output.
+	for keepReading := true; keepReading; {
+		select {
+		case <-output:
+		default:
+			keepReading = false
+		}
+	}
+	reader := &qmpReader{output: output}
+	return &qmpClient{
+		decoder: json.NewDecoder(reader),
+		reader:  reader,
+		vm:      vm,
+	}, nil
+}
+
+// sendMonitorFd will send a raw JSON command along with a file descriptor to
+// the monitor. The command is of the form: "fd JSON".
+func sendMonitorFd(monitorSock net.Conn, command string) error {
+	fields := strings.SplitN(command, " ", 2)
+	if len(fields) != 2 {
+		return fmt.Errorf("bad file descriptor command: %s", command)
+	}
+	fd, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+	unixConn, ok := monitorSock.(*net.UnixConn)
+	if !ok {
+		return errors.New("monitor socket is not a Unix socket")
+	}
+	_, _, err = unixConn.WriteMsgUnix([]byte(fields[1]+"\n"),
+		syscall.UnixRights(fd), nil)
+	return err
+}
+
+// close will release the qmpClient so that another may be used.
+func (c *qmpClient) close() {
+	c.vm.qmpMutex.Unlock()
+}
+
+// execute will send a command and wait for the response. If result is not
+// nil, the response is decoded into it.
+func (c *qmpClient) execute(command string, arguments interface{},
+	result interface{}) error {
+	return c.executeWithFile(command, arguments, result, nil)
+}
+
+// executeWithFile will send a command and wait for the response. If file is
+// not nil, the file descriptor is passed along with the command.
+func (c *qmpClient) executeWithFile(command string, arguments interface{},
+	result interface{}, file *os.File) error {
+	c.nextId++
+	id := "dominator-" + strconv.FormatUint(c.nextId, 10)
+	data, err := json.Marshal(qmpCommandType{
+		Arguments: arguments,
+		Execute:   command,
+		Id:        id,
+	})
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		err = c.send("\\" + string(data))
+	} else {
+		err = c.send(fmt.Sprintf("#%d %s", file.Fd(), data))
+	}
+	if err != nil {
+		return err
+	}
+	c.reader.deadline = time.Now().Add(qmpCommandTimeout)
+	for {
+		var message qmpMessageType
+		if err := c.decoder.Decode(&message); err != nil {
+			return fmt.Errorf("error reading response to %s: %s", command, err)
+		}
+		if message.Event != "" {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message.Id != id {
+			continue // Response to another command.
+		}
+		if message.Error != nil {
+			return fmt.Errorf("%s: %s", command, message.Error.Description)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(message.Return, result)
+	}
+}
+
+// passFile will pass a file descriptor to QEMU, which may later be referred to
+// by name.
+func (c *qmpClient) passFile(name string, file *os.File) error {
+	return c.executeWithFile("getfd", map[string]string{"fdname": name},
+		nil, file)
+}
+
+func (c *qmpClient) send(command string) error {
+	c.vm.mutex.RLock()
+	defer c.vm.mutex.RUnlock()
+	if c.vm.commandInput == nil {
+		return errors.New("monitor closed")
+	}
+	c.vm.commandInput <- command
+	return nil
+}
+
+// waitForClose will wait until the monitor connection is closed (i.e. QEMU
+// has exited).
+func (c *qmpClient) waitForClose(timeout time.Duration) error {
+	c.reader.deadline = time.Now().Add(timeout)
+	_, err := io.Copy(io.Discard, c.reader)
+	return err
+}
+
+func (r *qmpReader) Read(p []byte) (int, error) {
+	if len(p) < 1 {
+		return 0, nil
+	}
+	timer := time.NewTimer(time.Until(r.deadline))
+	defer timer.Stop()
+	select {
+	case ch, ok := <-r.output:
+		if !ok {
+			return 0, io.EOF
+		}
+		p[0] = ch
+	case <-timer.C:
+		return 0, errors.New("timed out reading from monitor")
+	}
+	for count := 1; count < len(p); count++ {
+		select {
+		case ch, ok := <-r.output:
+			if !ok {
+				return count, nil
+			}
+			p[count] = ch
+		default:
+			return count, nil
+		}
+	}
+	return len(p), nil
+}
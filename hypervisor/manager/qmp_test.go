@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+)
+
+// fakeQemuHandler is called for each QMP command sent to a fake QEMU. The
+// returned result is encoded as the response.
+type fakeQemuHandler func(command string, arguments json.RawMessage) (
+	interface{}, error)
+
+// fakeQemuType records the QMP commands sent to a fake QEMU.
+type fakeQemuType struct {
+	mutex    sync.Mutex
+	commands []string
+}
+
+// newFakeQemuVm returns a VM whose monitor is served by handler.
+func newFakeQemuVm(t *testing.T, handler fakeQemuHandler) (
+	*vmInfoType, *fakeQemuType) {
+	commandInput := make(chan string, 1)
+	commandOutput := make(chan byte, 1<<16)
+	vm := &vmInfoType{
+		commandInput:  commandInput,
+		commandOutput: commandOutput,
+		logger:        testlogger.New(t),
+	}
+	fakeQemu := &fakeQemuType{}
+	go func() {
+		for line := range commandInput {
+			if strings.HasPrefix(line, "\\") {
+				line = line[1:]
+			} else if strings.HasPrefix(line, "#") {
+				line = strings.SplitN(line, " ", 2)[1]
+			}
+			var command struct {
+				Arguments json.RawMessage `json:"arguments"`
+				Execute   string          `json:"execute"`
+				Id        string          `json:"id"`
+			}
+			if err := json.Unmarshal([]byte(line), &command); err != nil {
+				panic(err)
+			}
+			fakeQemu.mutex.Lock()
+			fakeQemu.commands = append(fakeQemu.commands, command.Execute)
+			fakeQemu.mutex.Unlock()
+			message := qmpMessageType{Id: command.Id}
+			if result, err := handler(command.Execute,
+				command.Arguments); err != nil {
+				message.Error = &qmpErrorType{
+					Class:       "GenericError",
+					Description: err.Error(),
+				}
+			} else {
+				message.Return, _ = json.Marshal(result)
+			}
+			data, _ := json.Marshal(message)
+			for _, ch := range append(data, '\n') {
+				commandOutput <- ch
+			}
+		}
+	}()
+	t.Cleanup(func() { close(commandInput) })
+	return vm, fakeQemu
+}
+
+func (fakeQemu *fakeQemuType) getCommands() []string {
+	fakeQemu.mutex.Lock()
+	defer fakeQemu.mutex.Unlock()
+	return append([]string(nil), fakeQemu.commands...)
+}
+
+func TestQmpExecute(t *testing.T) {
+	vm, _ := newFakeQemuVm(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "query-status":
+				return qmpStatusInfo{Running: true, Status: "running"}, nil
+			}
+			return nil, errors.New("unsupported command")
+		})
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qmp.close()
+	var status qmpStatusInfo
+	if err := qmp.execute("query-status", nil, &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.Status != "running" {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if err := qmp.execute("bogus", nil, nil); err == nil {
+		t.Error("bogus command did not fail")
+	}
+	if other, err := vm.tryNewQmpClient(); err != nil {
+		t.Fatal(err)
+	} else if other != nil {
+		t.Error("second qmpClient created while first in use")
+	}
+}
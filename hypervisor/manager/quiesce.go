@@ -0,0 +1,253 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	copyJobPollInterval = time.Second
+	quiesceTimeout      = 30 * time.Second
+)
+
+type qmpJobInfo struct {
+	Error  string `json:"error"`
+	Id     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// quiescerFunc will freeze the guest file-systems and will return a function
+// which thaws them. The thaw function returns true if the file-systems were
+// frozen until it was called.
+type quiescerFunc func() (func() bool, error)
+
+func checkQuiescableVolumes(volumes []proto.Volume) error {
+	for index, volume := range volumes {
+		if volume.Format != proto.VolumeFormatRaw {
+			return fmt.Errorf("cannot quiesce: volume: %d format: %s",
+				index, volume.Format)
+		}
+	}
+	return nil
+}
+
+func copyJobName(index int) string {
+	return fmt.Sprintf("copy-vol%d", index)
+}
+
+// copyVolumesQuiesced will copy the volumes of a running VM to the target files
+// at a single point in time, asking the QEMU guest agent (if any) to freeze the
+// guest file-systems while the copies are started. The file-systems are thawed
+// before the data are copied. It returns true if the copies were quiesced.
+func (vm *vmInfoType) copyVolumesQuiesced(volumes []proto.LocalVolume,
+	targets []string) (bool, error) {
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		return false, err
+	}
+	defer qmp.close()
+	return qmp.copyVolumes(volumes, targets, vm.quiesce, vm.logger)
+}
+
+// quiesce will ask the QEMU guest agent in the VM to flush and freeze the guest
+// file-systems (guest-fsfreeze-freeze). The returned function must be called to
+// thaw them (guest-fsfreeze-thaw). It returns true if the file-systems were
+// still frozen when it was called.
+func (vm *vmInfoType) quiesce() (func() bool, error) {
+	client, err := vm.newGuestAgentClient()
+	if err != nil {
+		return nil, err
+	}
+	var numFrozen int
+	err = client.execute("guest-fsfreeze-freeze", nil, &numFrozen)
+	if err != nil {
+		// Some file-systems may have been frozen before the failure.
+		client.execute("guest-fsfreeze-thaw", nil, nil)
+		client.close()
+		return nil, err
+	}
+	vm.logger.Debugf(0, "froze %d file-systems\n", numFrozen)
+	return func() bool {
+		defer client.close()
+		var status string
+		err := client.execute("guest-fsfreeze-status", nil, &status)
+		if err != nil {
+			vm.logger.Println(err)
+		}
+		if err := client.execute("guest-fsfreeze-thaw", nil, nil); err != nil {
+			vm.logger.Printf("error thawing file-systems: %s\n", err)
+			return false
+		}
+		if status != "frozen" {
+			vm.logger.Printf("file-systems were not frozen, status: %s\n",
+				status)
+			return false
+		}
+		return true
+	}, nil
+}
+
+// copyVolumes will copy the volumes to the target files using backup jobs,
+// which copy the blocks as they were when the jobs were started. If quiescer
+// is not nil, it is called to freeze the guest file-systems just before the
+// jobs are started and they are thawed just after. It returns true if the
+// copies were quiesced. On failure, the target files are removed.
+func (c *qmpClient) copyVolumes(volumes []proto.LocalVolume, targets []string,
+	quiescer quiescerFunc, logger log.DebugLogger) (bool, error) {
+	if len(targets) != len(volumes) {
+		return false, errors.New("mismatched number of volumes and targets")
+	}
+	nodes, err := c.getVolumeNodes(volumes)
+	if err != nil {
+		return false, err
+	}
+	var created, jobs, nodeNames []string
+	succeeded := false
+	defer func() {
+		c.cleanupCopyJobs(jobs, nodeNames, !succeeded, logger)
+		if !succeeded {
+			for _, filename := range created {
+				os.Remove(filename)
+			}
+		}
+	}()
+	actions := make([]map[string]interface{}, 0, len(volumes))
+	for index, volume := range volumes {
+		fi, err := os.Stat(volume.Filename)
+		if err != nil {
+			return false, err
+		}
+		err = createSparseFile(targets[index], uint64(fi.Size()))
+		if err != nil {
+			return false, err
+		}
+		created = append(created, targets[index])
+		name := copyJobName(index)
+		err = c.execute("blockdev-add", map[string]interface{}{
+			"driver":    "raw",
+			"node-name": name,
+			"file": map[string]string{
+				"driver":   "file",
+				"filename": targets[index],
+			},
+		}, nil)
+		if err != nil {
+			return false, err
+		}
+		nodeNames = append(nodeNames, name)
+		device := nodes[index].device
+		if device == "" {
+			device = nodes[index].nodeName
+		}
+		actions = append(actions, map[string]interface{}{
+			"type": "blockdev-backup",
+			"data": map[string]interface{}{
+				"auto-dismiss": false,
+				"device":       device,
+				"job-id":       name,
+				"sync":         "full",
+				"target":       name,
+			},
+		})
+	}
+	var thaw func() bool
+	if quiescer != nil {
+		if thaw, err = quiescer(); err != nil {
+			logger.Printf("not quiescing: %s\n", err)
+			thaw = nil
+		}
+	}
+	err = c.execute("transaction",
+		map[string]interface{}{"actions": actions}, nil)
+	var quiesced bool
+	if thaw != nil {
+		quiesced = thaw()
+	}
+	if err != nil {
+		return false, err
+	}
+	jobs = nodeNames
+	if err := c.waitForCopyJobs(jobs, 0); err != nil {
+		return false, err
+	}
+	succeeded = true
+	return quiesced, nil
+}
+
+// cleanupCopyJobs will cancel (if requested) and dismiss the copy jobs and
+// will delete the target block nodes.
+func (c *qmpClient) cleanupCopyJobs(jobs, nodeNames []string, cancel bool,
+	logger log.DebugLogger) {
+	if cancel && len(jobs) > 0 {
+		for _, name := range jobs {
+			err := c.execute("job-cancel", map[string]string{"id": name}, nil)
+			if err != nil {
+				logger.Println(err)
+			}
+		}
+		if err := c.waitForCopyJobs(jobs, quiesceTimeout); err != nil {
+			logger.Println(err)
+		}
+	}
+	for _, name := range jobs {
+		err := c.execute("job-dismiss", map[string]string{"id": name}, nil)
+		if err != nil {
+			logger.Println(err)
+		}
+	}
+	for _, name := range nodeNames {
+		err := c.execute("blockdev-del",
+			map[string]string{"node-name": name}, nil)
+		if err != nil {
+			logger.Println(err)
+		}
+	}
+}
+
+// waitForCopyJobs will wait for the copy jobs to conclude, returning the first
+// error reported by a job. If timeout is zero, it will wait indefinitely.
+func (c *qmpClient) waitForCopyJobs(jobs []string,
+	timeout time.Duration) error {
+	var stopTime time.Time
+	if timeout > 0 {
+		stopTime = time.Now().Add(timeout)
+	}
+	for {
+		var jobInfos []qmpJobInfo
+		if err := c.execute("query-jobs", nil, &jobInfos); err != nil {
+			return err
+		}
+		jobInfoMap := make(map[string]qmpJobInfo, len(jobInfos))
+		for _, jobInfo := range jobInfos {
+			jobInfoMap[jobInfo.Id] = jobInfo
+		}
+		var firstError error
+		numConcluded := 0
+		for _, name := range jobs {
+			jobInfo, ok := jobInfoMap[name]
+			if !ok {
+				return fmt.Errorf("copy job: %s disappeared", name)
+			}
+			if jobInfo.Status != "concluded" {
+				continue
+			}
+			numConcluded++
+			if jobInfo.Error != "" && firstError == nil {
+				firstError = fmt.Errorf("copy job: %s failed: %s",
+					name, jobInfo.Error)
+			}
+		}
+		if numConcluded == len(jobs) {
+			return firstError
+		}
+		if !stopTime.IsZero() && time.Until(stopTime) <= 0 {
+			return errors.New("timed out waiting for copy jobs")
+		}
+		time.Sleep(copyJobPollInterval)
+	}
+}
@@ -0,0 +1,299 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type eventRecorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) getEvents() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *eventRecorder) record(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+// makeCopyVolumes returns two volume files and the targets to copy them to.
+func makeCopyVolumes(t *testing.T) ([]proto.LocalVolume, []string) {
+	dirname := t.TempDir()
+	var targets []string
+	var volumes []proto.LocalVolume
+	for _, name := range []string{"root", "secondary-volume.0"} {
+		filename := filepath.Join(dirname, name)
+		if err := os.WriteFile(filename, make([]byte, 4096), 0600); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, filename+".snapshot")
+		volumes = append(volumes, proto.LocalVolume{Filename: filename})
+	}
+	return volumes, targets
+}
+
+// newCopyFakeQemuVm returns a VM with a fake QEMU which serves the volumes and
+// reports the specified error for the second copy job.
+func newCopyFakeQemuVm(t *testing.T, volumes []proto.LocalVolume,
+	jobError string, recorder *eventRecorder) *vmInfoType {
+	vm, _ := newFakeQemuVm(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			recorder.record(command)
+			switch command {
+			case "query-block":
+				blockInfos := make([]qmpBlockInfo, len(volumes))
+				for index, volume := range volumes {
+					blockInfos[index].Device = copyJobName(index) + "-device"
+					blockInfos[index].Inserted = &struct {
+						File     string `json:"file"`
+						NodeName string `json:"node-name"`
+					}{File: volume.Filename}
+				}
+				return blockInfos, nil
+			case "query-jobs":
+				return []qmpJobInfo{
+					{Id: copyJobName(0), Status: "concluded"},
+					{Id: copyJobName(1), Status: "concluded", Error: jobError},
+				}, nil
+			case "blockdev-add", "blockdev-del", "job-cancel", "job-dismiss",
+				"transaction":
+				return struct{}{}, nil
+			}
+			return nil, errors.New("unsupported command")
+		})
+	return vm
+}
+
+// startFakeGuestAgent will serve the guest agent socket for the VM, recording
+// the commands and replying with a fixed response for each command. A stale
+// response is sent before the response to the first synchronisation request.
+func startFakeGuestAgent(t *testing.T, vm *vmInfoType,
+	responses map[string]string, recorder *eventRecorder) {
+	listener, err := net.Listen("unix",
+		filepath.Join(vm.dirname, guestAgentSockFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("\xff{\"return\": 1}\n"))
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var command struct {
+				Arguments json.RawMessage `json:"arguments"`
+				Execute   string          `json:"execute"`
+			}
+			line := strings.TrimLeft(scanner.Text(), "\xff")
+			if err := json.Unmarshal([]byte(line), &command); err != nil {
+				panic(err)
+			}
+			if command.Execute == "guest-sync-delimited" {
+				var arguments struct {
+					Id uint64 `json:"id"`
+				}
+				json.Unmarshal(command.Arguments, &arguments)
+				data, _ := json.Marshal(map[string]uint64{
+					"return": arguments.Id})
+				conn.Write(append(append([]byte{0xff}, data...), '\n'))
+				continue
+			}
+			recorder.record(command.Execute)
+			response, ok := responses[command.Execute]
+			if !ok {
+				response = `{"error": {"class": "CommandNotFound",` +
+					` "desc": "unsupported command"}}`
+			}
+			conn.Write([]byte(response + "\n"))
+		}
+	}()
+}
+
+func makeTestQuiescer(recorder *eventRecorder, err error) quiescerFunc {
+	return func() (func() bool, error) {
+		if err != nil {
+			return nil, err
+		}
+		recorder.record("freeze")
+		return func() bool {
+			recorder.record("thaw")
+			return true
+		}, nil
+	}
+}
+
+func TestCopyVolumesQuiesced(t *testing.T) {
+	volumes, targets := makeCopyVolumes(t)
+	recorder := &eventRecorder{}
+	vm := newCopyFakeQemuVm(t, volumes, "", recorder)
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qmp.close()
+	quiesced, err := qmp.copyVolumes(volumes, targets,
+		makeTestQuiescer(recorder, nil), testlogger.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quiesced {
+		t.Error("copy not quiesced")
+	}
+	// The file-systems must be thawed before waiting for the data to be
+	// copied.
+	want := []string{"query-block", "blockdev-add", "blockdev-add", "freeze",
+		"transaction", "thaw", "query-jobs", "job-dismiss", "job-dismiss",
+		"blockdev-del", "blockdev-del"}
+	if got := recorder.getEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	for _, target := range targets {
+		if fi, err := os.Stat(target); err != nil {
+			t.Error(err)
+		} else if fi.Size() != 4096 {
+			t.Errorf("%s: size = %d, want 4096", target, fi.Size())
+		}
+	}
+}
+
+func TestCopyVolumesQuiesceFailed(t *testing.T) {
+	volumes, targets := makeCopyVolumes(t)
+	recorder := &eventRecorder{}
+	vm := newCopyFakeQemuVm(t, volumes, "", recorder)
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qmp.close()
+	quiesced, err := qmp.copyVolumes(volumes, targets,
+		makeTestQuiescer(recorder, errors.New("no such method")),
+		testlogger.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quiesced {
+		t.Error("copy quiesced without guest agent support")
+	}
+}
+
+func TestCopyVolumesJobFailed(t *testing.T) {
+	volumes, targets := makeCopyVolumes(t)
+	recorder := &eventRecorder{}
+	vm := newCopyFakeQemuVm(t, volumes, "No space left on device", recorder)
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qmp.close()
+	_, err = qmp.copyVolumes(volumes, targets,
+		makeTestQuiescer(recorder, nil), testlogger.New(t))
+	if err == nil {
+		t.Fatal("failed copy job not reported")
+	}
+	events := recorder.getEvents()
+	var numCancelled, numDeleted int
+	for _, event := range events {
+		switch event {
+		case "job-cancel":
+			numCancelled++
+		case "blockdev-del":
+			numDeleted++
+		}
+	}
+	if numCancelled != 2 || numDeleted != 2 {
+		t.Errorf("jobs not cleaned up: %v", events)
+	}
+	for _, target := range targets {
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Errorf("%s: not removed", target)
+		}
+	}
+}
+
+func TestQuiesceGuestAgent(t *testing.T) {
+	var tests = []struct {
+		name         string
+		responses    map[string]string
+		wantErr      bool
+		wantEvents   []string
+		wantQuiesced bool
+	}{
+		{"frozen", map[string]string{
+			"guest-fsfreeze-freeze": `{"return": 2}`,
+			"guest-fsfreeze-status": `{"return": "frozen"}`,
+			"guest-fsfreeze-thaw":   `{"return": 2}`,
+		}, false, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-status",
+			"guest-fsfreeze-thaw"}, true},
+		{"thawed early", map[string]string{
+			"guest-fsfreeze-freeze": `{"return": 2}`,
+			"guest-fsfreeze-status": `{"return": "thawed"}`,
+			"guest-fsfreeze-thaw":   `{"return": 0}`,
+		}, false, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-status",
+			"guest-fsfreeze-thaw"}, false},
+		{"freeze failed", map[string]string{
+			"guest-fsfreeze-thaw": `{"return": 1}`,
+		}, true, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"},
+			false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &vmInfoType{dirname: t.TempDir(), logger: testlogger.New(t)}
+			recorder := &eventRecorder{}
+			startFakeGuestAgent(t, vm, test.responses, recorder)
+			thaw, err := vm.quiesce()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("freeze failure not reported")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if quiesced := thaw(); quiesced != test.wantQuiesced {
+				t.Errorf("quiesced = %t, want %t",
+					quiesced, test.wantQuiesced)
+			}
+			got := recorder.getEvents()
+			if !reflect.DeepEqual(got, test.wantEvents) {
+				t.Errorf("commands = %v, want %v", got, test.wantEvents)
+			}
+		})
+	}
+}
+
+func TestQuiesceNoGuestAgent(t *testing.T) {
+	vm := &vmInfoType{dirname: t.TempDir(), logger: testlogger.New(t)}
+	if _, err := vm.quiesce(); err == nil {
+		t.Fatal("quiesced without a guest agent")
+	}
+}
+
+func TestCheckQuiescableVolumes(t *testing.T) {
+	volumes := []proto.Volume{{Format: proto.VolumeFormatRaw}}
+	if err := checkQuiescableVolumes(volumes); err != nil {
+		t.Error(err)
+	}
+	volumes = append(volumes, proto.Volume{Format: proto.VolumeFormatQCOW2})
+	if err := checkQuiescableVolumes(volumes); err == nil {
+		t.Error("QCOW2 volume accepted")
+	}
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/backoffdelay"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	restartMaximumDelay   = 5 * time.Minute
+	restartMinimumDelay   = 5 * time.Second
+	restartRateInterval   = time.Hour
+	restartRateMaximum    = 10
+	restartStableInterval = 15 * time.Minute
+)
+
+// restart is called after a restart delay to start a VM which crashed or
+// stopped unexpectedly. The restart is abandoned if the VM state changed in the
+// meantime (i.e. it was started, destroyed or migrated), if the restart policy
+// no longer applies or if the Hypervisor cannot start VMs.
+func (vm *vmInfoType) restart(changedStateOn time.Time) {
+	vm.mutex.Lock()
+	doUnlock := true
+	defer func() {
+		if doUnlock {
+			vm.mutex.Unlock()
+		}
+	}()
+	if !vm.ChangedStateOn.Equal(changedStateOn) {
+		return
+	}
+	if !vm.restartPolicyApplies(vm.State == proto.StateCrashed) {
+		return
+	}
+	if vm.manager.shuttingDown {
+		return
+	}
+	if vm.manager.disabled {
+		vm.logger.Println("not restarting VM: Hypervisor is disabled")
+		return
+	}
+	if err := checkAvailableMemory(vm.MemoryInMiB); err != nil {
+		vm.logger.Printf("not restarting VM: %s\n", err)
+		return
+	}
+	vm.LastRestartTime = time.Now()
+	vm.NumRestarts++
+	vm.restartTimes = append(vm.restartTimes, vm.LastRestartTime)
+	vm.logger.Printf("restarting VM (restart policy: %s, restart: %d)\n",
+		vm.RestartPolicy, vm.NumRestarts)
+	vm.setState(proto.StateStarting)
+	vm.mutex.Unlock()
+	doUnlock = false
+	if _, err := vm.startManaging(0, false, false); err != nil {
+		vm.logger.Printf("error restarting VM: %s\n", err)
+	}
+}
+
+// restartPolicyApplies returns true if the restart policy for the VM requires
+// it to be restarted, given whether it crashed or was stopped by the guest. The
+// VM must be either crashed or stopped.
+func (vm *vmInfoType) restartPolicyApplies(crashed bool) bool {
+	switch vm.State {
+	case proto.StateCrashed, proto.StateStopped:
+	default:
+		return false
+	}
+	switch vm.RestartPolicy {
+	case proto.RestartPolicyOnCrash:
+		return crashed
+	case proto.RestartPolicyAlways:
+		return true
+	}
+	return false
+}
+
+// restartDelay returns the delay before the next automatic restart of the VM
+// and true, or false if the VM has been restarted too many times recently.
+// Successive restarts are delayed with an exponential backoff, which is reset
+// once the VM has been running long enough to be considered stable. The VM lock
+// must be held.
+func (vm *vmInfoType) restartDelay(now time.Time) (time.Duration, bool) {
+	if vm.restartBackoff == nil {
+		vm.restartBackoff = backoffdelay.NewExponential(restartMinimumDelay,
+			restartMaximumDelay, 0)
+	} else if now.Sub(vm.LastRestartTime) >= restartStableInterval {
+		vm.restartBackoff.Reset()
+	}
+	cutoff := now.Add(-restartRateInterval)
+	restartTimes := vm.restartTimes[:0]
+	for _, restartTime := range vm.restartTimes {
+		if restartTime.After(cutoff) {
+			restartTimes = append(restartTimes, restartTime)
+		}
+	}
+	vm.restartTimes = restartTimes
+	if len(vm.restartTimes) >= restartRateMaximum {
+		return 0, false
+	}
+	vm.restartBackoff.StartInterval()
+	return vm.restartBackoff.RemainingInterval(), true
+}
+
+// scheduleRestart will schedule an automatic restart of a VM which crashed or
+// was stopped by the guest, if the restart policy for the VM requires it. If
+// the VM has been restarted too many times recently it is left down. The VM
+// lock must be held.
+func (vm *vmInfoType) scheduleRestart(crashed bool) {
+	if vm.manager.shuttingDown || !vm.restartPolicyApplies(crashed) {
+		return
+	}
+	delay, ok := vm.restartDelay(time.Now())
+	if !ok {
+		vm.logger.Printf(
+			"not restarting VM: %d restarts in the last %s, leaving down\n",
+			len(vm.restartTimes), restartRateInterval)
+		return
+	}
+	changedStateOn := vm.ChangedStateOn
+	vm.logger.Printf("will restart VM in %s\n", format.Duration(delay))
+	time.AfterFunc(delay, func() { vm.restart(changedStateOn) })
+}
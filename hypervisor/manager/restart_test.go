@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func makeRestartTimes(now time.Time, age time.Duration,
+	num int) []time.Time {
+	restartTimes := make([]time.Time, 0, num)
+	for index := 0; index < num; index++ {
+		restartTimes = append(restartTimes,
+			now.Add(-age-time.Duration(index)*time.Second))
+	}
+	return restartTimes
+}
+
+func TestRestartRateLimit(t *testing.T) {
+	now := time.Now()
+	var tests = []struct {
+		name             string
+		restartTimes     []time.Time
+		wantOk           bool
+		wantRestartTimes int
+	}{
+		{"no restarts", nil, true, 0},
+		{"below limit",
+			makeRestartTimes(now, time.Minute, restartRateMaximum-1),
+			true, restartRateMaximum - 1},
+		{"at limit", makeRestartTimes(now, time.Minute, restartRateMaximum),
+			false, restartRateMaximum},
+		{"old restarts", makeRestartTimes(now,
+			restartRateInterval+time.Minute, 2*restartRateMaximum),
+			true, 0},
+		{"old and recent restarts", append(
+			makeRestartTimes(now, time.Minute, restartRateMaximum-1),
+			makeRestartTimes(now, restartRateInterval+time.Minute,
+				restartRateMaximum)...),
+			true, restartRateMaximum - 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &vmInfoType{restartTimes: test.restartTimes}
+			_, ok := vm.restartDelay(now)
+			if ok != test.wantOk {
+				t.Errorf("restartDelay() ok = %t, want %t", ok, test.wantOk)
+			}
+			if len(vm.restartTimes) != test.wantRestartTimes {
+				t.Errorf("%d recent restarts kept, want %d",
+					len(vm.restartTimes), test.wantRestartTimes)
+			}
+		})
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	vm := &vmInfoType{}
+	checkDelay := func(want time.Duration) {
+		t.Helper()
+		now := time.Now()
+		delay, ok := vm.restartDelay(now)
+		if !ok {
+			t.Fatal("restart rate limited")
+		}
+		if got := delay.Round(time.Second); got != want {
+			t.Fatalf("delay = %s, want %s", got, want)
+		}
+		vm.LastRestartTime = now
+	}
+	checkDelay(restartMinimumDelay)
+	checkDelay(2 * restartMinimumDelay)
+	checkDelay(4 * restartMinimumDelay)
+	// A VM which ran long enough to be stable restarts with the minimum delay.
+	vm.LastRestartTime = time.Now().Add(-restartStableInterval)
+	checkDelay(restartMinimumDelay)
+	checkDelay(2 * restartMinimumDelay)
+	// The delay does not grow beyond the maximum.
+	for index := 0; index < restartRateMaximum; index++ {
+		vm.restartDelay(time.Now())
+	}
+	checkDelay(restartMaximumDelay)
+}
+
+func TestRestartChangedStateOnGuard(t *testing.T) {
+	changedStateOn := time.Now()
+	var tests = []struct {
+		name           string
+		changedStateOn time.Time
+		state          proto.State
+		shuttingDown   bool
+	}{
+		{"state changed again", changedStateOn.Add(time.Second),
+			proto.StateCrashed, false},
+		{"VM started", changedStateOn, proto.StateRunning, false},
+		{"shutting down", changedStateOn, proto.StateCrashed, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &vmInfoType{
+				logger:  testlogger.New(t),
+				manager: &Manager{shuttingDown: test.shuttingDown},
+			}
+			vm.ChangedStateOn = test.changedStateOn
+			vm.RestartPolicy = proto.RestartPolicyAlways
+			vm.State = test.state
+			vm.restart(changedStateOn)
+			if vm.NumRestarts != 0 || len(vm.restartTimes) != 0 {
+				t.Errorf("VM restarted %d times", vm.NumRestarts)
+			}
+			if vm.State != test.state {
+				t.Errorf("state = %s, want %s", vm.State, test.state)
+			}
+			if !vm.ChangedStateOn.Equal(test.changedStateOn) {
+				t.Error("ChangedStateOn modified")
+			}
+		})
+	}
+}
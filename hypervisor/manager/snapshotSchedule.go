@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	snapshotCheckInterval   = time.Minute
+	snapshotMinimumInterval = 10 * time.Minute
+	snapshotNamePrefix      = "scheduled-"
+)
+
+func checkSnapshotSchedule(schedule proto.SnapshotSchedule) error {
+	if schedule.Interval == 0 {
+		return nil
+	}
+	if schedule.Interval < snapshotMinimumInterval {
+		return errors.New("snapshot interval must be at least " +
+			snapshotMinimumInterval.String())
+	}
+	if schedule.RetentionCount < 1 {
+		return errors.New("snapshot retention count must be at least 1")
+	}
+	return nil
+}
+
+// isSnapshotDue returns true if a scheduled snapshot of a VM in the specified
+// state should be taken at time now. The scheduled snapshots must be sorted
+// oldest first.
+func isSnapshotDue(schedule proto.SnapshotSchedule, state proto.State,
+	lastAttempt time.Time, scheduledSnapshots []proto.SnapshotInfo,
+	now time.Time) bool {
+	switch state {
+	case proto.StateRunning, proto.StateStopped:
+	default:
+		return false
+	}
+	if numSnapshots := len(scheduledSnapshots); numSnapshots > 0 {
+		lastCreatedOn := scheduledSnapshots[numSnapshots-1].CreatedOn
+		if lastCreatedOn.After(lastAttempt) {
+			lastAttempt = lastCreatedOn
+		}
+	}
+	return now.Sub(lastAttempt) >= schedule.Interval
+}
+
+func (m *Manager) loopCheckSnapshotSchedules() {
+	for ; ; time.Sleep(snapshotCheckInterval) {
+		m.mutex.RLock()
+		if m.shuttingDown {
+			m.mutex.RUnlock()
+			return
+		}
+		vms := make([]*vmInfoType, 0, len(m.vms))
+		for _, vm := range m.vms {
+			vms = append(vms, vm)
+		}
+		m.mutex.RUnlock()
+		for _, vm := range vms {
+			vm.checkSnapshotSchedule()
+		}
+	}
+}
+
+// checkSnapshotSchedule will take a scheduled snapshot of the VM if one is due
+// and will then discard the oldest scheduled snapshots which exceed the
+// retention count. The VM lock is grabbed and released.
+func (vm *vmInfoType) checkSnapshotSchedule() {
+	vm.mutex.Lock()
+	if vm.SnapshotSchedule == nil || vm.blockMutations {
+		vm.mutex.Unlock()
+		return
+	}
+	schedule := *vm.SnapshotSchedule
+	scheduledSnapshots := vm.getScheduledSnapshots()
+	snapshotDue := isSnapshotDue(schedule, vm.State, vm.lastSnapshotAttempt,
+		scheduledSnapshots, time.Now())
+	numScheduledSnapshots := uint(len(scheduledSnapshots))
+	if !snapshotDue && numScheduledSnapshots <= schedule.RetentionCount {
+		vm.mutex.Unlock()
+		return
+	}
+	if snapshotDue {
+		vm.lastSnapshotAttempt = time.Now()
+	}
+	vm.blockMutations = true
+	vm.mutex.Unlock()
+	defer vm.allowMutationsAndUnlock(false)
+	if snapshotDue {
+		snapshotName := snapshotNamePrefix +
+			vm.lastSnapshotAttempt.UTC().Format("20060102-150405")
+		snapshotSuffix, err := sanitiseSnapshotName(snapshotName)
+		if err == nil {
+			err = vm.snapshot(snapshotName, snapshotSuffix, true,
+				schedule.RootOnly, schedule.Quiesce, true)
+		}
+		if err != nil {
+			vm.logger.Printf("error taking scheduled snapshot: %s\n", err)
+		} else {
+			vm.logger.Debugf(0, "took scheduled snapshot: %s\n", snapshotName)
+		}
+	}
+	vm.pruneScheduledSnapshots(schedule.RetentionCount)
+}
+
+// getScheduledSnapshots returns the scheduled snapshots, oldest first. The VM
+// lock must be held.
+func (vm *vmInfoType) getScheduledSnapshots() []proto.SnapshotInfo {
+	var snapshots []proto.SnapshotInfo
+	for _, snapshot := range vm.Snapshots {
+		if snapshot.Scheduled {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(left, right int) bool {
+		return snapshots[left].CreatedOn.Before(snapshots[right].CreatedOn)
+	})
+	return snapshots
+}
+
+// pruneScheduledSnapshots will discard the oldest scheduled snapshots until no
+// more than retentionCount remain. Mutations must be blocked and the VM lock
+// must not be held.
+func (vm *vmInfoType) pruneScheduledSnapshots(retentionCount uint) {
+	vm.mutex.RLock()
+	snapshots := vm.getScheduledSnapshots()
+	vm.mutex.RUnlock()
+	var changed bool
+	for uint(len(snapshots)) > retentionCount {
+		snapshotName := snapshots[0].Name
+		snapshots = snapshots[1:]
+		snapshotSuffix, err := sanitiseSnapshotName(snapshotName)
+		if err != nil {
+			vm.logger.Println(err)
+			continue
+		}
+		cng, err := vm.discardSnapshot(snapshotName, snapshotSuffix)
+		if cng {
+			changed = true
+		}
+		if err != nil {
+			vm.logger.Printf("error discarding scheduled snapshot: %s: %s\n",
+				snapshotName, err)
+			break
+		}
+		vm.logger.Debugf(0, "discarded scheduled snapshot: %s\n", snapshotName)
+	}
+	if changed {
+		vm.writeAndSendInfo()
+	}
+}
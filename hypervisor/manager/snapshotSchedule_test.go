@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestCheckSnapshotSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule proto.SnapshotSchedule
+		wantErr  bool
+	}{
+		{"disabled", proto.SnapshotSchedule{}, false},
+		{"valid", proto.SnapshotSchedule{
+			Interval:       time.Hour,
+			RetentionCount: 24,
+		}, false},
+		{"short interval", proto.SnapshotSchedule{
+			Interval:       time.Minute,
+			RetentionCount: 24,
+		}, true},
+		{"no retention", proto.SnapshotSchedule{Interval: time.Hour}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkSnapshotSchedule(test.schedule)
+			if test.wantErr && err == nil {
+				t.Error("invalid schedule accepted")
+			} else if !test.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestIsSnapshotDue(t *testing.T) {
+	now := time.Now()
+	schedule := proto.SnapshotSchedule{Interval: time.Hour, RetentionCount: 2}
+	snapshots := func(ages ...time.Duration) []proto.SnapshotInfo {
+		var snapshots []proto.SnapshotInfo
+		for _, age := range ages {
+			snapshots = append(snapshots, proto.SnapshotInfo{
+				CreatedOn: now.Add(-age),
+				Scheduled: true,
+			})
+		}
+		return snapshots
+	}
+	tests := []struct {
+		name        string
+		state       proto.State
+		lastAttempt time.Time
+		snapshots   []proto.SnapshotInfo
+		want        bool
+	}{
+		{"first", proto.StateRunning, time.Time{}, nil, true},
+		{"stopped", proto.StateStopped, time.Time{}, nil, true},
+		{"starting", proto.StateStarting, time.Time{}, nil, false},
+		{"migrating", proto.StateMigrating, time.Time{}, nil, false},
+		{"recent snapshot", proto.StateRunning, time.Time{},
+			snapshots(2*time.Hour, 30*time.Minute), false},
+		{"old snapshot", proto.StateRunning, time.Time{},
+			snapshots(3*time.Hour, 2*time.Hour), true},
+		{"recent failure", proto.StateRunning, now.Add(-10 * time.Minute),
+			snapshots(2 * time.Hour), false},
+		{"old failure", proto.StateRunning, now.Add(-time.Hour),
+			snapshots(2 * time.Hour), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := isSnapshotDue(schedule, test.state, test.lastAttempt,
+				test.snapshots, now)
+			if got != test.want {
+				t.Errorf("isSnapshotDue() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPruneScheduledSnapshots(t *testing.T) {
+	dirname := t.TempDir()
+	rootFilename := filepath.Join(dirname, "root")
+	now := time.Now()
+	vm := &vmInfoType{
+		dirname:   dirname,
+		ipAddress: "0.0.0.0",
+		logger:    testlogger.New(t),
+		manager:   &Manager{},
+	}
+	vm.VolumeLocations = []proto.LocalVolume{{Filename: rootFilename}}
+	vm.Volumes = []proto.Volume{{Snapshots: make(map[string]uint64)}}
+	// Scheduled snapshots are not recorded in age order.
+	for _, snapshot := range []struct {
+		name      string
+		age       time.Duration
+		scheduled bool
+	}{
+		{"scheduled-2", 2 * time.Hour, true},
+		{"manual", 5 * time.Hour, false},
+		{"scheduled-1", time.Hour, true},
+		{"scheduled-4", 4 * time.Hour, true},
+		{"scheduled-3", 3 * time.Hour, true},
+	} {
+		filename := rootFilename + ".snapshot:" + snapshot.name
+		if err := os.WriteFile(filename, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		vm.Volumes[0].Snapshots[snapshot.name] = 0
+		vm.Snapshots = append(vm.Snapshots, proto.SnapshotInfo{
+			CreatedOn: now.Add(-snapshot.age),
+			Name:      snapshot.name,
+			Scheduled: snapshot.scheduled,
+		})
+	}
+	vm.pruneScheduledSnapshots(2)
+	var names []string
+	for _, snapshot := range vm.Snapshots {
+		names = append(names, snapshot.Name)
+	}
+	want := []string{"scheduled-2", "manual", "scheduled-1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("snapshots = %v, want %v", names, want)
+	}
+	for _, name := range []string{"manual", "scheduled-1", "scheduled-2",
+		"scheduled-3", "scheduled-4"} {
+		_, err := os.Stat(rootFilename + ".snapshot:" + name)
+		_, recorded := vm.Volumes[0].Snapshots[name]
+		if name == "scheduled-3" || name == "scheduled-4" {
+			if !os.IsNotExist(err) || recorded {
+				t.Errorf("%s: not discarded", name)
+			}
+		} else if err != nil || !recorded {
+			t.Errorf("%s: discarded", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dirname, "info.json")); err != nil {
+		t.Error("VM information not written")
+	}
+}
@@ -95,6 +95,9 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 	if err := manager.checkVsockets(); err != nil {
 		return nil, err
 	}
+	if err := manager.setupNumaPlacement(); err != nil {
+		return nil, err
+	}
 	if err := manager.loadKeys(); err != nil {
 		return nil, err
 	}
@@ -151,6 +154,7 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		vmInfo.metadataChannels = make(map[chan<- string]struct{})
 		manager.vms[ipAddr] = &vmInfo
 		vmInfo.setupLockWatcher()
+		vmInfo.loadNumaAllocation()
 		if err := vmInfo.loadIdentityRequestorCert(); err != nil {
 			vmInfo.logger.Printf(
 				"failed to load identity requestor certificate: %s\n", err)
@@ -235,6 +239,7 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		manager.writeAddressPoolWithLock(manager.addressPool, false)
 	}
 	go manager.loopCheckHealthStatus()
+	go manager.loopCheckSnapshotSchedules()
 	lockCheckInterval := startOptions.LockCheckInterval
 	if lockCheckInterval > time.Second {
 		// Leveraged for dashboard, so keep it fresh.
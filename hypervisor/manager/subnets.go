@@ -70,6 +70,28 @@ func getHypervisorSubnet() (proto.Subnet, error) {
 	}, nil
 }
 
+// advertiseSubnet will advertise the IPv6 prefix for the subnet (if any) on
+// the bridge for the subnet. Subnets which are reached using a VLAN tag on a
+// trunk bridge are not advertised.
+func (m *Manager) advertiseSubnet(subnet proto.Subnet) {
+	if m.RouterAdvertiser == nil || len(subnet.Ipv6Prefix) < 1 {
+		return
+	}
+	bridge, vlanOption, err := m.getBridgeForSubnet(subnet)
+	if err != nil {
+		m.Logger.Printf("not advertising IPv6 prefix for subnet: %s: %s\n",
+			subnet.Id, err)
+		return
+	}
+	if vlanOption != "" {
+		m.Logger.Printf(
+			"not advertising IPv6 prefix for subnet: %s on trunk bridge: %s\n",
+			subnet.Id, bridge)
+		return
+	}
+	m.RouterAdvertiser.AddSubnet(subnet, bridge)
+}
+
 func (m *Manager) getBridgeForSubnet(subnet proto.Subnet) (
 	string, string, error) {
 	mapName := fmt.Sprintf("br@%s", subnet.Id)
@@ -202,6 +224,7 @@ func (m *Manager) loadSubnets() error {
 	}
 	for _, subnet := range m.subnets {
 		m.DhcpServer.AddSubnet(subnet)
+		m.advertiseSubnet(subnet)
 	}
 	return nil
 }
@@ -229,6 +252,7 @@ func (m *Manager) updateSubnets(request proto.UpdateSubnetsRequest) error {
 	}
 	for _, subnet := range request.Add {
 		m.DhcpServer.AddSubnet(subnet)
+		m.advertiseSubnet(subnet)
 		for _, ch := range m.subnetChannels {
 			ch <- subnet
 		}
@@ -236,10 +260,17 @@ func (m *Manager) updateSubnets(request proto.UpdateSubnetsRequest) error {
 	for _, subnet := range request.Change {
 		m.DhcpServer.RemoveSubnet(subnet.Id)
 		m.DhcpServer.AddSubnet(subnet)
+		if m.RouterAdvertiser != nil {
+			m.RouterAdvertiser.RemoveSubnet(subnet.Id)
+		}
+		m.advertiseSubnet(subnet)
 		// TOOO(rgooch): Design a clean way to send updates to the channels.
 	}
 	for _, subnetId := range request.Delete {
 		m.DhcpServer.RemoveSubnet(subnetId)
+		if m.RouterAdvertiser != nil {
+			m.RouterAdvertiser.RemoveSubnet(subnetId)
+		}
 		// TOOO(rgooch): Design a clean way to send deletes to the channels.
 	}
 	return nil
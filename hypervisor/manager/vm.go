@@ -421,6 +421,14 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 	if req.ArchitectureType == proto.ArchitectureTypeAuto {
 		req.ArchitectureType = proto.ArchitectureTypeRuntime
 	}
+	if err := req.CloudInitSeedVolume.CheckValid(); err != nil {
+		return nil, err
+	}
+	if req.NoCloudSmbiosSerial &&
+		req.CloudInitSeedVolume != proto.SeedVolumeNone {
+		return nil,
+			errors.New("cannot use NoCloud SMBIOS serial with a seed volume")
+	}
 	if err := req.ConsoleType.CheckValid(); err != nil {
 		return nil, err
 	}
@@ -430,6 +438,26 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 	if err := req.MachineType.CheckValid(); err != nil {
 		return nil, err
 	}
+	if err := req.RestartPolicy.CheckValid(); err != nil {
+		return nil, err
+	}
+	if req.NetworkLimits != nil {
+		if err := checkNetworkLimits(*req.NetworkLimits); err != nil {
+			return nil, err
+		}
+		if req.NetworkLimits.IsZero() {
+			req.NetworkLimits = nil
+		}
+	}
+	if req.SnapshotSchedule != nil {
+		err := checkSnapshotSchedule(*req.SnapshotSchedule)
+		if err != nil {
+			return nil, err
+		}
+		if req.SnapshotSchedule.Interval == 0 {
+			req.SnapshotSchedule = nil
+		}
+	}
 	if req.MemoryInMiB < 1 {
 		return nil, errors.New("no memory specified")
 	}
@@ -510,6 +538,7 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 			VmInfo: proto.VmInfo{
 				Address:              address,
 				ArchitectureType:     req.ArchitectureType,
+				CloudInitSeedVolume:  req.CloudInitSeedVolume,
 				CreatedOn:            time.Now(),
 				ConsoleType:          req.ConsoleType,
 				CpuPriority:          req.CpuPriority,
@@ -524,10 +553,15 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 				MachineType:          req.MachineType,
 				MemoryInMiB:          req.MemoryInMiB,
 				MilliCPUs:            req.MilliCPUs,
+				NetworkLimits:        req.NetworkLimits,
+				NoCloudSmbiosSerial:  req.NoCloudSmbiosSerial,
 				OwnerGroups:          req.OwnerGroups,
+				RestartPolicy:        req.RestartPolicy,
 				SpreadVolumes:        req.SpreadVolumes,
 				SecondaryAddresses:   secondaryAddresses,
 				SecondarySubnetIDs:   req.SecondarySubnetIDs,
+				SnapshotSchedule:     req.SnapshotSchedule,
+				SshPublicKeys:        req.SshPublicKeys,
 				State:                proto.StateStopped,
 				SubnetId:             subnetId,
 				Tags:                 req.Tags,
@@ -805,6 +839,21 @@ func (m *Manager) changeVmOwnerUsers(ipAddr net.IP,
 	return nil
 }
 
+func (m *Manager) changeVmRestartPolicy(ipAddr net.IP,
+	authInfo *srpc.AuthInformation, restartPolicy proto.RestartPolicy) error {
+	if err := restartPolicy.CheckValid(); err != nil {
+		return err
+	}
+	vm, err := m.getVmLockAndAuth(ipAddr, true, authInfo, nil)
+	if err != nil {
+		return err
+	}
+	defer vm.mutex.Unlock()
+	vm.RestartPolicy = restartPolicy
+	vm.writeAndSendInfo()
+	return nil
+}
+
 func (m *Manager) changeVmSize(authInfo *srpc.AuthInformation,
 	req proto.ChangeVmSizeRequest) error {
 	vm, err := m.getVmLockAndAuth(req.IpAddress, true, authInfo, nil)
@@ -833,6 +882,35 @@ func (m *Manager) changeVmSize(authInfo *srpc.AuthInformation,
 	return err
 }
 
+func (m *Manager) changeVmSnapshotSchedule(ipAddr net.IP,
+	authInfo *srpc.AuthInformation,
+	snapshotSchedule proto.SnapshotSchedule) error {
+	if err := checkSnapshotSchedule(snapshotSchedule); err != nil {
+		return err
+	}
+	vm, err := m.getVmLockAndAuth(ipAddr, true, authInfo, nil)
+	if err != nil {
+		return err
+	}
+	defer vm.mutex.Unlock()
+	if snapshotSchedule.Interval == 0 {
+		vm.SnapshotSchedule = nil
+	} else {
+		if vm.getActiveInitrdPath() != "" || vm.getActiveKernelPath() != "" {
+			return errors.New(
+				"cannot snapshot root volume with separate kernel or initrd")
+		}
+		if snapshotSchedule.Quiesce {
+			if err := checkQuiescableVolumes(vm.Volumes); err != nil {
+				return err
+			}
+		}
+		vm.SnapshotSchedule = &snapshotSchedule
+	}
+	vm.writeAndSendInfo()
+	return nil
+}
+
 func (m *Manager) changeVmSubnet(authInfo *srpc.AuthInformation,
 	req proto.ChangeVmSubnetRequest) (*proto.ChangeVmSubnetResponse, error) {
 	if req.SubnetId == "" {
@@ -1161,19 +1239,28 @@ func (m *Manager) connectToVmConsole(ipAddr net.IP,
 	return console, nil
 }
 
+// connectToVmManager holds the QMP lock for the VM until the input channel is
+// closed, so that the session does not share the monitor with a qmpClient.
 func (m *Manager) connectToVmManager(ipAddr net.IP) (
 	chan<- byte, <-chan byte, error) {
 	input := make(chan byte, 256)
-	vm, err := m.getVmAndLock(ipAddr, true)
+	vm, err := m.getVmAndLock(ipAddr, false)
 	if err != nil {
 		return nil, nil, err
 	}
+	vm.mutex.RUnlock()
+	// qmpClient users take the VM lock while holding the QMP lock, so wait for
+	// the QMP lock without holding the VM lock.
+	vm.qmpMutex.Lock()
+	vm.mutex.Lock()
 	defer vm.mutex.Unlock()
 	if vm.State != proto.StateRunning {
+		vm.qmpMutex.Unlock()
 		return nil, nil, errors.New("VM is not running")
 	}
 	commandInput := vm.commandInput
 	if commandInput == nil {
+		vm.qmpMutex.Unlock()
 		return nil, nil, errors.New("no commandInput for VM")
 	}
 	// Drain any previous output.
@@ -1186,6 +1273,7 @@ func (m *Manager) connectToVmManager(ipAddr net.IP) (
 		}
 	}
 	go func(input <-chan byte, output chan<- string) {
+		defer vm.qmpMutex.Unlock()
 		for char := range input {
 			if char == '\r' {
 				continue
@@ -2632,56 +2720,33 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 		hypervisor.RequestReply("Hypervisor.DiscardVmAccessToken",
 			req, &reply)
 	}()
-	ipAddress := request.IpAddress.String()
-	m.mutex.RLock()
-	_, ok := m.vms[ipAddress]
-	subnetId := m.getMatchingSubnet(request.IpAddress)
-	m.mutex.RUnlock()
-	if ok {
-		return errors.New("cannot migrate to the same hypervisor")
-	}
-	if subnetId == "" {
-		return fmt.Errorf("no matching subnet for: %s\n", request.IpAddress)
-	}
-	getInfoRequest := proto.GetVmInfoRequest{request.IpAddress}
-	var getInfoReply proto.GetVmInfoResponse
-	err = hypervisor.RequestReply("Hypervisor.GetVmInfo", getInfoRequest,
-		&getInfoReply)
-	if err != nil {
-		return err
+	if request.Live {
+		fallback, err := m.migrateVmLive(conn, request, hypervisor)
+		if err == nil {
+			return nil
+		}
+		if !fallback {
+			return err
+		}
+		m.Logger.Printf("live migration of %s failed: %s\n",
+			request.IpAddress, err)
+		err = sendVmMigrationMessage(conn, fmt.Sprintf(
+			"live migration failed: %s, falling back to cold migration", err))
+		if err != nil {
+			return err
+		}
 	}
+	return m.migrateVmCold(conn, request, hypervisor)
+}
+
+func (m *Manager) migrateVmCold(conn *srpc.Conn,
+	request proto.MigrateVmRequest, hypervisor *srpc.Client) error {
 	accessToken := request.AccessToken
-	vmInfo := getInfoReply.VmInfo
-	if subnetId != vmInfo.SubnetId {
-		return fmt.Errorf("subnet ID changing from: %s to: %s",
-			vmInfo.SubnetId, subnetId)
-	}
-	if !request.IpAddress.Equal(vmInfo.Address.IpAddress) {
-		return fmt.Errorf("inconsistent IP address: %s",
-			vmInfo.Address.IpAddress)
-	}
-	if err := m.migrateVmChecks(vmInfo, request.SkipMemoryCheck); err != nil {
-		return err
-	}
-	volumeDirectories, err := m.getVolumeDirectories(vmInfo.Volumes[0],
-		vmInfo.Volumes[1:], vmInfo.SpreadVolumes, nil)
+	vm, err := m.makeMigratingVm(request, hypervisor)
 	if err != nil {
 		return err
 	}
-	vm := &vmInfoType{
-		LocalVmInfo: proto.LocalVmInfo{
-			VmInfo: vmInfo,
-			VolumeLocations: make([]proto.LocalVolume, 0,
-				len(volumeDirectories)),
-		},
-		manager:          m,
-		dirname:          filepath.Join(m.StateDir, "VMs", ipAddress),
-		doNotWriteOrSend: true,
-		ipAddress:        ipAddress,
-		logger:           prefixlogger.New(ipAddress+": ", m.Logger),
-		metadataChannels: make(map[chan<- string]struct{}),
-	}
-	vm.Uncommitted = true
+	vmInfo := vm.VmInfo
 	defer func() { // Evaluate vm at return time, not defer time.
 		vm.cleanup()
 		hyperclient.PrepareVmForMigration(hypervisor, request.IpAddress,
@@ -2690,20 +2755,6 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 			hyperclient.StartVm(hypervisor, request.IpAddress, accessToken)
 		}
 	}()
-	vm.ownerUsers = stringutil.ConvertListToMap(vm.OwnerUsers, false)
-	if err := os.MkdirAll(vm.dirname, fsutil.DirPerms); err != nil {
-		return err
-	}
-	for index, _dirname := range volumeDirectories {
-		dirname := filepath.Join(_dirname, ipAddress)
-		if err := os.MkdirAll(dirname, fsutil.DirPerms); err != nil {
-			return err
-		}
-		vm.VolumeLocations = append(vm.VolumeLocations, proto.LocalVolume{
-			DirectoryToCleanup: dirname,
-			Filename:           filepath.Join(dirname, indexToName(index)),
-		})
-	}
 	if vmInfo.State == proto.StateStopped {
 		err := hyperclient.PrepareVmForMigration(hypervisor, request.IpAddress,
 			request.AccessToken, true)
@@ -2757,7 +2808,7 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 	}
 	vm.State = proto.StateStarting
 	m.mutex.Lock()
-	m.vms[ipAddress] = vm
+	m.vms[vm.ipAddress] = vm
 	m.mutex.Unlock()
 	dhcpTimedOut, err := vm.startManaging(request.DhcpTimeout, false, false)
 	if err != nil {
@@ -2766,7 +2817,94 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 	if dhcpTimedOut {
 		return fmt.Errorf("DHCP timed out")
 	}
-	err = conn.Encode(proto.MigrateVmResponse{RequestCommit: true})
+	if err := requestVmMigrationCommit(conn); err != nil {
+		return err
+	}
+	if err := vm.finishMigration(hypervisor, accessToken); err != nil {
+		return err
+	}
+	vm = nil // Cancel cleanup.
+	return nil
+}
+
+// makeMigratingVm will check that the VM may be migrated to this Hypervisor
+// and will create the VM directories. The caller is responsible for calling
+// cleanup() if the migration is abandoned.
+func (m *Manager) makeMigratingVm(request proto.MigrateVmRequest,
+	hypervisor *srpc.Client) (*vmInfoType, error) {
+	ipAddress := request.IpAddress.String()
+	m.mutex.RLock()
+	_, ok := m.vms[ipAddress]
+	subnetId := m.getMatchingSubnet(request.IpAddress)
+	m.mutex.RUnlock()
+	if ok {
+		return nil, errors.New("cannot migrate to the same hypervisor")
+	}
+	if subnetId == "" {
+		return nil, fmt.Errorf("no matching subnet for: %s\n",
+			request.IpAddress)
+	}
+	getInfoRequest := proto.GetVmInfoRequest{request.IpAddress}
+	var getInfoReply proto.GetVmInfoResponse
+	err := hypervisor.RequestReply("Hypervisor.GetVmInfo", getInfoRequest,
+		&getInfoReply)
+	if err != nil {
+		return nil, err
+	}
+	vmInfo := getInfoReply.VmInfo
+	if subnetId != vmInfo.SubnetId {
+		return nil, fmt.Errorf("subnet ID changing from: %s to: %s",
+			vmInfo.SubnetId, subnetId)
+	}
+	if !request.IpAddress.Equal(vmInfo.Address.IpAddress) {
+		return nil, fmt.Errorf("inconsistent IP address: %s",
+			vmInfo.Address.IpAddress)
+	}
+	if err := m.migrateVmChecks(vmInfo, request.SkipMemoryCheck); err != nil {
+		return nil, err
+	}
+	volumeDirectories, err := m.getVolumeDirectories(vmInfo.Volumes[0],
+		vmInfo.Volumes[1:], vmInfo.SpreadVolumes, nil)
+	if err != nil {
+		return nil, err
+	}
+	vm := &vmInfoType{
+		LocalVmInfo: proto.LocalVmInfo{
+			VmInfo: vmInfo,
+			VolumeLocations: make([]proto.LocalVolume, 0,
+				len(volumeDirectories)),
+		},
+		manager:          m,
+		dirname:          filepath.Join(m.StateDir, "VMs", ipAddress),
+		doNotWriteOrSend: true,
+		ipAddress:        ipAddress,
+		logger:           prefixlogger.New(ipAddress+": ", m.Logger),
+		metadataChannels: make(map[chan<- string]struct{}),
+	}
+	vm.Uncommitted = true
+	vm.ownerUsers = stringutil.ConvertListToMap(vm.OwnerUsers, false)
+	if err := os.MkdirAll(vm.dirname, fsutil.DirPerms); err != nil {
+		vm.cleanup()
+		return nil, err
+	}
+	for index, _dirname := range volumeDirectories {
+		dirname := filepath.Join(_dirname, ipAddress)
+		if err := os.MkdirAll(dirname, fsutil.DirPerms); err != nil {
+			vm.cleanup()
+			return nil, err
+		}
+		vm.VolumeLocations = append(vm.VolumeLocations, proto.LocalVolume{
+			DirectoryToCleanup: dirname,
+			Filename:           filepath.Join(dirname, indexToName(index)),
+		})
+	}
+	return vm, nil
+}
+
+// requestVmMigrationCommit will ask the client whether to commit the migrated
+// VM. An error is returned if the migration is abandoned.
+func requestVmMigrationCommit(conn *srpc.Conn) error {
+	err := conn.Encode(proto.MigrateVmResponse{RequestCommit: true})
 	if err != nil {
 		return err
 	}
@@ -2780,6 +2918,14 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 	if !reply.Commit {
 		return fmt.Errorf("VM migration abandoned")
 	}
+	return nil
+}
+
+// finishMigration will commit a migrated VM and will destroy the VM on the
+// source Hypervisor.
+func (vm *vmInfoType) finishMigration(hypervisor *srpc.Client,
+	accessToken []byte) error {
+	m := vm.manager
 	if err := m.registerAddress(vm.Address); err != nil {
 		return err
 	}
@@ -2791,12 +2937,12 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 	vm.doNotWriteOrSend = false
 	vm.Uncommitted = false
 	vm.writeAndSendInfo()
-	err = hyperclient.DestroyVm(hypervisor, request.IpAddress, accessToken)
+	err := hyperclient.DestroyVm(hypervisor, vm.Address.IpAddress, accessToken)
 	if err != nil {
-		m.Logger.Printf("error cleaning up old migrated VM: %s\n", ipAddress)
+		m.Logger.Printf("error cleaning up old migrated VM: %s\n",
+			vm.ipAddress)
 	}
 	vm.setupLockWatcher()
-	vm = nil // Cancel cleanup.
 	return nil
 }
 
@@ -2955,7 +3101,12 @@ func migrateVmVolume(hypervisor *srpc.Client, directory, filename string,
 	if !getExtraFiles {
 		return nil
 	}
-	for name, data := range response.ExtraFiles {
+	return writeMigratedExtraFiles(directory, response.ExtraFiles)
+}
+
+func writeMigratedExtraFiles(directory string,
+	extraFiles map[string][]byte) error {
+	for name, data := range extraFiles {
 		if name != "initrd" && name != "kernel" {
 			return fmt.Errorf("received unsupported extra file: %s", name)
 		}
@@ -3740,6 +3891,11 @@ func (m *Manager) restoreVmFromSnapshot(req proto.RestoreVmFromSnapshotRequest,
 		}
 		changed = true
 	}
+	if !req.Retain {
+		vm.mutex.Lock()
+		vm.forgetSnapshot(req.Name)
+		vm.mutex.Unlock()
+	}
 	return nil
 }
 
@@ -3916,7 +4072,8 @@ func (m *Manager) sendVmInfo(ipAddress string, vm *proto.VmInfo) {
 }
 
 func (m *Manager) snapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
-	forceIfNotStopped, snapshotRootOnly bool, snapshotName string) error {
+	forceIfNotStopped, snapshotRootOnly, quiesce bool,
+	snapshotName string) error {
 	snapshotSuffix, err := sanitiseSnapshotName(snapshotName)
 	if err != nil {
 		return err
@@ -3928,6 +4085,17 @@ func (m *Manager) snapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	vm.blockMutations = true
 	vm.mutex.Unlock()
 	defer vm.allowMutationsAndUnlock(false)
+	return vm.snapshot(snapshotName, snapshotSuffix, forceIfNotStopped,
+		snapshotRootOnly, quiesce, false)
+}
+
+// snapshot will snapshot the VM volumes. If quiesce is true and the VM is
+// running, the volumes are copied at a single point in time with the guest
+// file-systems briefly frozen. Mutations must be blocked and the VM lock must
+// not be held.
+func (vm *vmInfoType) snapshot(snapshotName, snapshotSuffix string,
+	forceIfNotStopped, snapshotRootOnly, quiesce, scheduled bool) error {
+	m := vm.manager
 	if vm.getActiveInitrdPath() != "" {
 		return errors.New("cannot snapshot root volume with separate initrd")
 	}
@@ -3939,6 +4107,11 @@ func (m *Manager) snapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
 			return errors.New("VM is not stopped")
 		}
 	}
+	if quiesce {
+		if err := checkQuiescableVolumes(vm.Volumes); err != nil {
+			return err
+		}
+	}
 	changed, err := vm.discardSnapshot(snapshotName, snapshotSuffix)
 	if err != nil {
 		if changed {
@@ -3972,27 +4145,52 @@ func (m *Manager) snapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
 			vm.writeAndSendInfo()
 		}
 	}()
+	var snapshotFilenames []string
+	var volumes []proto.LocalVolume
 	for index, volume := range vm.VolumeLocations {
-		snapshotFilename := volume.Filename + "." + snapshotSuffix
 		if index == 0 || !snapshotRootOnly {
-			err := fsutil.CopyFile(snapshotFilename, volume.Filename,
+			snapshotFilenames = append(snapshotFilenames,
+				volume.Filename+"."+snapshotSuffix)
+			volumes = append(volumes, volume)
+		}
+	}
+	createdOn := time.Now()
+	var quiesced bool
+	if quiesce && vm.State == proto.StateRunning {
+		quiesced, err = vm.copyVolumesQuiesced(volumes, snapshotFilenames)
+		if err != nil {
+			return err
+		}
+	} else {
+		for index, volume := range volumes {
+			err := fsutil.CopyFile(snapshotFilenames[index], volume.Filename,
 				fsutil.PrivateFilePerms)
 			if err != nil {
 				return err
 			}
-			fi, err := os.Stat(snapshotFilename)
-			if err != nil {
-				return fmt.Errorf("cannot stat: %s: %s", snapshotFilename, err)
-			}
-			vm.mutex.Lock()
-			if vm.Volumes[index].Snapshots == nil {
-				vm.Volumes[index].Snapshots = make(map[string]uint64)
-			}
-			vm.Volumes[index].Snapshots[snapshotName] = uint64(fi.Size())
-			vm.mutex.Unlock()
-			changed = true
 		}
 	}
+	for index, snapshotFilename := range snapshotFilenames {
+		fi, err := os.Stat(snapshotFilename)
+		if err != nil {
+			return fmt.Errorf("cannot stat: %s: %s", snapshotFilename, err)
+		}
+		vm.mutex.Lock()
+		if vm.Volumes[index].Snapshots == nil {
+			vm.Volumes[index].Snapshots = make(map[string]uint64)
+		}
+		vm.Volumes[index].Snapshots[snapshotName] = uint64(fi.Size())
+		vm.mutex.Unlock()
+		changed = true
+	}
+	vm.mutex.Lock()
+	vm.Snapshots = append(vm.Snapshots, proto.SnapshotInfo{
+		CreatedOn: createdOn,
+		Name:      snapshotName,
+		Quiesced:  quiesced,
+		Scheduled: scheduled,
+	})
+	vm.mutex.Unlock()
 	doCleanup = false
 	return nil
 }
@@ -4407,9 +4605,30 @@ func (vm *vmInfoType) discardSnapshot(snapshotName, snapshotSuff string) (
 		vm.mutex.Unlock()
 		changed = true
 	}
+	vm.mutex.Lock()
+	if vm.forgetSnapshot(snapshotName) {
+		changed = true
+	}
+	vm.mutex.Unlock()
 	return changed, nil
 }
 
+// forgetSnapshot will remove the information for the specified snapshot. The
+// VM lock must be held. It returns true if the information was removed.
+func (vm *vmInfoType) forgetSnapshot(snapshotName string) bool {
+	for index, snapshot := range vm.Snapshots {
+		if snapshot.Name == snapshotName {
+			vm.Snapshots = append(vm.Snapshots[:index],
+				vm.Snapshots[index+1:]...)
+			if len(vm.Snapshots) < 1 {
+				vm.Snapshots = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
 func (vm *vmInfoType) getActiveInitrdPath() string {
 	initrdPath := vm.getInitrdPath()
 	if _, err := os.Stat(initrdPath); err == nil {
@@ -4480,6 +4699,9 @@ func (vm *vmInfoType) monitor(monitorSock net.Conn,
 	go vm.processMonitorResponses(monitorSock, commandOutput)
 	cancelChannel := make(chan struct{}, 1)
 	go vm.probeHealthAgent(cancelChannel)
+	usageCancelChannel := make(chan struct{})
+	defer close(usageCancelChannel)
+	go vm.collectUsage(usageCancelChannel)
 	go vm.serialManager()
 	for command := range commandInput {
 		var err error
@@ -4487,6 +4709,8 @@ func (vm *vmInfoType) monitor(monitorSock net.Conn,
 			_, err = monitorSock.Write([]byte(rebootJson))
 		} else if command[0] == '\\' {
 			_, err = fmt.Fprintln(monitorSock, command[1:])
+		} else if command[0] == '#' { // Pass file descriptor with raw JSON.
+			err = sendMonitorFd(monitorSock, command[1:])
 		} else {
 			_, err = fmt.Fprintf(monitorSock, "{\"execute\":\"%s\"}\n",
 				command)
@@ -4495,6 +4719,9 @@ func (vm *vmInfoType) monitor(monitorSock net.Conn,
 			vm.logger.Println(err)
 		} else if command[0] == '\\' {
 			vm.logger.Debugf(0, "sent JSON: %s", command[1:])
+		} else if command[0] == '#' {
+			vm.logger.Debugf(0, "sent JSON with file descriptor: %s",
+				command[1:])
 		} else {
 			vm.logger.Debugf(0, "sent %s command", command)
 		}
@@ -4608,6 +4835,9 @@ func (vm *vmInfoType) setState(state proto.State) {
 		vm.ChangedStateOn = time.Now()
 		vm.State = state
 	}
+	if !stateHoldsNumaAllocation(state) {
+		vm.releaseNumaAllocation()
+	}
 	if !vm.doNotWriteOrSend {
 		vm.writeAndSendInfo()
 	}
@@ -4886,6 +5116,7 @@ func (vm *vmInfoType) startVm(enableNetboot, haveManagerLock bool) error {
 	if err != nil {
 		return err
 	}
+	vm.placeOnNumaNode(nCpus, haveManagerLock)
 	// Close all tap devices: either we have a failure, or QEMU will have picked
 	// them up and we no longer need to keep them open.
 	var tapDevicesToClose []*libnet.TapDevice
@@ -4906,6 +5137,15 @@ func (vm *vmInfoType) startVm(enableNetboot, haveManagerLock bool) error {
 			return fmt.Errorf("error creating tap device: %s", err)
 		}
 		tapDevicesToClose = append(tapDevicesToClose, tapDevice)
+		err = applyNetworkLimits(tapDevice.Name, vm.NetworkLimits)
+		if err != nil {
+			return err
+		}
+		err = vm.installIpv6SourceFilter(tapDevice.Name, haveManagerLock)
+		if err != nil {
+			// IPv6 metadata requests will be dropped, which is safe.
+			vm.logger.Println(err)
+		}
 		tapFiles = append(tapFiles, tapDevice.Files...)
 		tapNames = append(tapNames, tapDevice.Name)
 	}
@@ -4921,6 +5161,10 @@ func (vm *vmInfoType) startVm(enableNetboot, haveManagerLock bool) error {
 			return err
 		}
 	}
+	if err := vm.pinVirtualCPUs(); err != nil {
+		// Memory and threads are still bound to the NUMA node.
+		vm.logger.Println(err)
+	}
 	return nil
 }
 
@@ -0,0 +1,476 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"github.com/Cloud-Foundations/tricorder/go/tricorder"
+	"github.com/Cloud-Foundations/tricorder/go/tricorder/units"
+)
+
+const (
+	clockTicksPerSecond     = 100 // USER_HZ.
+	usageCollectionInterval = time.Second * 10
+	usageHistoryLength      = 60 // 10 minutes.
+	usageSummaryPeriod      = time.Minute
+)
+
+type ioCountersType struct {
+	bytes      uint64
+	operations uint64
+}
+
+type usageSampleType struct {
+	balloonBytes    uint64
+	blockRead       ioCountersType
+	blockWrite      ioCountersType
+	cpuTime         time.Duration
+	memoryBytes     uint64
+	networkReceive  ioCountersType // Received by the VM.
+	networkTransmit ioCountersType // Transmitted by the VM.
+	time            time.Time
+}
+
+type vmUsageType struct {
+	mutex   sync.Mutex        // Protect everything below.
+	samples []usageSampleType // Oldest first.
+}
+
+type qmpBalloonInfo struct {
+	Actual uint64 `json:"actual"`
+}
+
+type qmpBlockStatsInfo struct {
+	Stats struct {
+		ReadBytes       uint64 `json:"rd_bytes"`
+		ReadOperations  uint64 `json:"rd_operations"`
+		WriteBytes      uint64 `json:"wr_bytes"`
+		WriteOperations uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+func computeIoUsage(older, newer ioCountersType,
+	period time.Duration) proto.VmIoUsage {
+	return proto.VmIoUsage{
+		Bytes:          newer.bytes,
+		BytesPerSecond: computeRate(older.bytes, newer.bytes, period),
+		Operations:     newer.operations,
+		OperationsPerSecond: computeRate(older.operations, newer.operations,
+			period),
+	}
+}
+
+// computeRate returns the per-second rate of change of a counter. If the
+// counter was reset, zero is returned.
+func computeRate(older, newer uint64, period time.Duration) uint64 {
+	if newer < older || period <= 0 {
+		return 0
+	}
+	return uint64(float64(newer-older) * float64(time.Second) / float64(period))
+}
+
+func computeUsage(older, newer usageSampleType) proto.VmUsage {
+	period := newer.time.Sub(older.time)
+	usage := proto.VmUsage{
+		BalloonMemoryInMiB: newer.balloonBytes >> 20,
+		BlockRead: computeIoUsage(older.blockRead, newer.blockRead,
+			period),
+		BlockWrite: computeIoUsage(older.blockWrite, newer.blockWrite,
+			period),
+		CpuTime:     newer.cpuTime,
+		MemoryInMiB: newer.memoryBytes >> 20,
+		NetworkReceive: computeIoUsage(older.networkReceive,
+			newer.networkReceive, period),
+		NetworkTransmit: computeIoUsage(older.networkTransmit,
+			newer.networkTransmit, period),
+		Period:     period,
+		SampleTime: newer.time,
+	}
+	if newer.cpuTime >= older.cpuTime && period > 0 {
+		usage.MilliCPUs = uint64((newer.cpuTime - older.cpuTime) * 1000 /
+			period)
+	}
+	return usage
+}
+
+// findTapDevices returns the names of the tap devices opened by a process, in
+// file descriptor order.
+func findTapDevices(pid int) ([]string, error) {
+	dirname := fmt.Sprintf("/proc/%d/fdinfo", pid)
+	names, err := readDirnamesSortedByNumber(dirname)
+	if err != nil {
+		return nil, err
+	}
+	var tapNames []string
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dirname, name))
+		if err != nil {
+			continue // The file descriptor may have been closed.
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "iff:" {
+				tapNames = append(tapNames, fields[1])
+			}
+		}
+	}
+	// Multi-queue tap devices have a file descriptor per queue.
+	tapNames, _ = stringutil.DeduplicateList(tapNames, false)
+	return tapNames, nil
+}
+
+func readDirnamesSortedByNumber(dirname string) ([]string, error) {
+	file, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make(map[string]int, len(names))
+	for _, name := range names {
+		numbers[name], _ = strconv.Atoi(name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return numbers[names[i]] < numbers[names[j]]
+	})
+	return names, nil
+}
+
+func readNetworkCounter(tapName, counter string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", tapName,
+		"statistics", counter))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readProcessCpuTime returns the user and system CPU time used by a process.
+func readProcessCpuTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces, so skip past it.
+	index := bytes.LastIndexByte(data, ')')
+	if index < 0 {
+		return 0, errors.New("malformed stat file")
+	}
+	// Fields after the command name start with field 3 (state). Fields 14 and
+	// 15 are utime and stime.
+	fields := strings.Fields(string(data[index+1:]))
+	if len(fields) < 13 {
+		return 0, errors.New("short stat file")
+	}
+	var ticks uint64
+	for _, field := range fields[11:13] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += value
+	}
+	return time.Duration(ticks) * time.Second / clockTicksPerSecond, nil
+}
+
+// readProcessMemory returns the resident memory of a process.
+func readProcessMemory(pid int) (uint64, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmRSS:" && fields[2] == "kB" {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return value << 10, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("no VmRSS in status file")
+}
+
+func (m *Manager) getVmUsage(ipAddr net.IP) (*proto.VmUsage, error) {
+	vm, err := m.getVmAndLock(ipAddr, false)
+	if err != nil {
+		return nil, err
+	}
+	vm.mutex.RUnlock()
+	return vm.usage.getSummary(), nil
+}
+
+func (m *Manager) getVmUsageHistory(ipAddr net.IP) ([]proto.VmUsage, error) {
+	vm, err := m.getVmAndLock(ipAddr, false)
+	if err != nil {
+		return nil, err
+	}
+	vm.mutex.RUnlock()
+	return vm.usage.getHistory(), nil
+}
+
+// collectUsage will periodically collect the resources used by the VM until
+// the cancel channel is closed.
+func (vm *vmInfoType) collectUsage(cancel <-chan struct{}) {
+	vm.usage.clear()
+	defer vm.usage.clear()
+	if vm.ipAddress != "0.0.0.0" {
+		dir, err := vm.usage.registerMetrics("vms/" + vm.ipAddress)
+		if err != nil {
+			vm.logger.Printf("error registering usage metrics: %s\n", err)
+		} else {
+			defer dir.UnregisterDirectory()
+		}
+	}
+	var tapNames []string
+	haveBalloon := true
+	ticker := time.NewTicker(usageCollectionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cancel:
+			return
+		case <-ticker.C:
+		}
+		vm.mutex.RLock()
+		state := vm.State
+		vm.mutex.RUnlock()
+		if state != proto.StateRunning {
+			continue
+		}
+		sample, err := vm.sampleUsage(&tapNames, &haveBalloon)
+		if err != nil {
+			vm.logger.Debugf(1, "error collecting usage: %s\n", err)
+			continue
+		}
+		vm.usage.addSample(sample)
+	}
+}
+
+// sampleUsage will read the resources used by the VM. Block I/O and balloon
+// statistics are read using QMP, and are skipped if another QMP client is
+// active, in which case the previous values are used.
+func (vm *vmInfoType) sampleUsage(tapNames *[]string,
+	haveBalloon *bool) (usageSampleType, error) {
+	sample := vm.usage.getLatestSample()
+	sample.time = time.Now()
+	pid, err := vm.readPid()
+	if err != nil {
+		return usageSampleType{}, err
+	}
+	if sample.cpuTime, err = readProcessCpuTime(pid); err != nil {
+		return usageSampleType{}, err
+	}
+	if sample.memoryBytes, err = readProcessMemory(pid); err != nil {
+		return usageSampleType{}, err
+	}
+	if *tapNames == nil {
+		if *tapNames, err = findTapDevices(pid); err != nil {
+			return usageSampleType{}, err
+		}
+	}
+	sample.networkReceive = ioCountersType{}
+	sample.networkTransmit = ioCountersType{}
+	for _, tapName := range *tapNames {
+		// The directions are reversed: what the tap device transmits is
+		// received by the VM.
+		for _, counter := range []struct {
+			name  string
+			value *uint64
+		}{
+			{"rx_bytes", &sample.networkTransmit.bytes},
+			{"rx_packets", &sample.networkTransmit.operations},
+			{"tx_bytes", &sample.networkReceive.bytes},
+			{"tx_packets", &sample.networkReceive.operations},
+		} {
+			value, err := readNetworkCounter(tapName, counter.name)
+			if err != nil {
+				return usageSampleType{}, err
+			}
+			*counter.value += value
+		}
+	}
+	if err := vm.sampleQmpUsage(&sample, haveBalloon); err != nil {
+		return usageSampleType{}, err
+	}
+	return sample, nil
+}
+
+// sampleQmpUsage will read the block I/O and balloon statistics for the VM
+// into sample. If another QMP client (or a manager session) is active, sample
+// is left unchanged.
+func (vm *vmInfoType) sampleQmpUsage(sample *usageSampleType,
+	haveBalloon *bool) error {
+	qmp, err := vm.tryNewQmpClient()
+	if err != nil {
+		return err
+	}
+	if qmp == nil {
+		return nil
+	}
+	defer qmp.close()
+	var blockStats []qmpBlockStatsInfo
+	if err := qmp.execute("query-blockstats", nil, &blockStats); err != nil {
+		return err
+	}
+	sample.blockRead = ioCountersType{}
+	sample.blockWrite = ioCountersType{}
+	for _, stats := range blockStats {
+		sample.blockRead.bytes += stats.Stats.ReadBytes
+		sample.blockRead.operations += stats.Stats.ReadOperations
+		sample.blockWrite.bytes += stats.Stats.WriteBytes
+		sample.blockWrite.operations += stats.Stats.WriteOperations
+	}
+	if *haveBalloon {
+		var balloon qmpBalloonInfo
+		if err := qmp.execute("query-balloon", nil, &balloon); err != nil {
+			*haveBalloon = false // No balloon device: do not ask again.
+		} else {
+			sample.balloonBytes = balloon.Actual
+		}
+	}
+	return nil
+}
+
+func (u *vmUsageType) addSample(sample usageSampleType) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.samples = append(u.samples, sample)
+	if len(u.samples) > usageHistoryLength+1 {
+		u.samples = u.samples[len(u.samples)-usageHistoryLength-1:]
+	}
+}
+
+func (u *vmUsageType) clear() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.samples = nil
+}
+
+// getHistory returns the usage for each collection interval, oldest first.
+func (u *vmUsageType) getHistory() []proto.VmUsage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if len(u.samples) < 2 {
+		return nil
+	}
+	history := make([]proto.VmUsage, 0, len(u.samples)-1)
+	for index := 1; index < len(u.samples); index++ {
+		history = append(history,
+			computeUsage(u.samples[index-1], u.samples[index]))
+	}
+	return history
+}
+
+func (u *vmUsageType) getLatestSample() usageSampleType {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if len(u.samples) < 1 {
+		return usageSampleType{}
+	}
+	return u.samples[len(u.samples)-1]
+}
+
+// getSummary returns the latest usage with rates averaged over the summary
+// period, or nil if there are insufficient samples.
+func (u *vmUsageType) getSummary() *proto.VmUsage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if len(u.samples) < 2 {
+		return nil
+	}
+	newer := u.samples[len(u.samples)-1]
+	index := len(u.samples) - 2
+	for ; index > 0; index-- {
+		if newer.time.Sub(u.samples[index].time) >= usageSummaryPeriod {
+			break
+		}
+	}
+	usage := computeUsage(u.samples[index], newer)
+	return &usage
+}
+
+func (u *vmUsageType) registerMetrics(dirname string) (
+	*tricorder.DirectorySpec, error) {
+	dir, err := tricorder.RegisterDirectory(dirname)
+	if err != nil {
+		return nil, err
+	}
+	getUsage := func() proto.VmUsage {
+		if usage := u.getSummary(); usage != nil {
+			return *usage
+		}
+		return proto.VmUsage{}
+	}
+	metrics := []struct {
+		name        string
+		metric      interface{}
+		unit        units.Unit
+		description string
+	}{
+		{"cpu-time", func() time.Duration { return getUsage().CpuTime },
+			units.Second, "CPU time used by virtualiser"},
+		{"milli-cpus", func() uint64 { return getUsage().MilliCPUs },
+			units.None, "recent CPU usage in milliCPUs"},
+		{"memory", func() uint64 { return getUsage().MemoryInMiB << 20 },
+			units.Byte, "resident memory of virtualiser"},
+		{"balloon-memory",
+			func() uint64 { return getUsage().BalloonMemoryInMiB << 20 },
+			units.Byte, "memory reported by balloon device"},
+		{"block/read-bytes",
+			func() uint64 { return getUsage().BlockRead.Bytes },
+			units.Byte, "bytes read from volumes"},
+		{"block/read-operations",
+			func() uint64 { return getUsage().BlockRead.Operations },
+			units.None, "read requests for volumes"},
+		{"block/write-bytes",
+			func() uint64 { return getUsage().BlockWrite.Bytes },
+			units.Byte, "bytes written to volumes"},
+		{"block/write-operations",
+			func() uint64 { return getUsage().BlockWrite.Operations },
+			units.None, "write requests for volumes"},
+		{"network/receive-bytes",
+			func() uint64 { return getUsage().NetworkReceive.Bytes },
+			units.Byte, "bytes received by VM"},
+		{"network/receive-packets",
+			func() uint64 { return getUsage().NetworkReceive.Operations },
+			units.None, "packets received by VM"},
+		{"network/transmit-bytes",
+			func() uint64 { return getUsage().NetworkTransmit.Bytes },
+			units.Byte, "bytes transmitted by VM"},
+		{"network/transmit-packets",
+			func() uint64 { return getUsage().NetworkTransmit.Operations },
+			units.None, "packets transmitted by VM"},
+	}
+	for _, metric := range metrics {
+		err := dir.RegisterMetric(metric.name, metric.metric, metric.unit,
+			metric.description)
+		if err != nil {
+			dir.UnregisterDirectory()
+			return nil, err
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,226 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func newUsageFakeQemuVm(t *testing.T, haveBalloon bool) (
+	*vmInfoType, *fakeQemuType) {
+	return newFakeQemuVm(t,
+		func(command string, arguments json.RawMessage) (interface{}, error) {
+			switch command {
+			case "query-blockstats":
+				stats := make([]qmpBlockStatsInfo, 2)
+				stats[0].Stats.ReadBytes = 1000
+				stats[0].Stats.ReadOperations = 10
+				stats[0].Stats.WriteBytes = 2000
+				stats[0].Stats.WriteOperations = 20
+				stats[1].Stats.ReadBytes = 3000
+				stats[1].Stats.ReadOperations = 30
+				stats[1].Stats.WriteBytes = 4000
+				stats[1].Stats.WriteOperations = 40
+				return stats, nil
+			case "query-balloon":
+				if haveBalloon {
+					return qmpBalloonInfo{Actual: 512 << 20}, nil
+				}
+				return nil, errors.New("No balloon device has been activated")
+			}
+			return nil, errors.New("unsupported command")
+		})
+}
+
+// waitForManagerSessionClose will wait for a closed manager session to release
+// the QMP lock.
+func waitForManagerSessionClose(t *testing.T, vm *vmInfoType) {
+	for deadline := time.Now().Add(time.Second); ; {
+		if qmp, err := vm.tryNewQmpClient(); err != nil {
+			t.Fatal(err)
+		} else if qmp != nil {
+			qmp.close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("QMP lock not released after manager session closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestComputeRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		older  uint64
+		newer  uint64
+		period time.Duration
+		want   uint64
+	}{
+		{"steady", 1000, 3000, 2 * time.Second, 1000},
+		{"idle", 1000, 1000, time.Second, 0},
+		{"subsecond", 0, 500, 500 * time.Millisecond, 1000},
+		{"reset", 3000, 1000, time.Second, 0},
+		{"no period", 1000, 3000, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := computeRate(test.older, test.newer,
+				test.period); got != test.want {
+				t.Errorf("computeRate(%d, %d, %s) = %d, want %d",
+					test.older, test.newer, test.period, got, test.want)
+			}
+		})
+	}
+}
+
+func TestComputeUsage(t *testing.T) {
+	now := time.Now()
+	older := usageSampleType{
+		blockRead:      ioCountersType{bytes: 1000, operations: 10},
+		cpuTime:        time.Second,
+		networkReceive: ioCountersType{bytes: 5000, operations: 5},
+		time:           now,
+	}
+	newer := usageSampleType{
+		balloonBytes:   256 << 20,
+		blockRead:      ioCountersType{bytes: 21000, operations: 110},
+		cpuTime:        6 * time.Second,
+		memoryBytes:    1 << 30,
+		networkReceive: ioCountersType{bytes: 1000, operations: 1},
+		time:           now.Add(10 * time.Second),
+	}
+	want := proto.VmUsage{
+		BalloonMemoryInMiB: 256,
+		BlockRead: proto.VmIoUsage{
+			Bytes:               21000,
+			BytesPerSecond:      2000,
+			Operations:          110,
+			OperationsPerSecond: 10,
+		},
+		CpuTime:     6 * time.Second,
+		MemoryInMiB: 1024,
+		MilliCPUs:   500,
+		NetworkReceive: proto.VmIoUsage{ // Counters were reset.
+			Bytes:      1000,
+			Operations: 1,
+		},
+		Period:     10 * time.Second,
+		SampleTime: newer.time,
+	}
+	if got := computeUsage(older, newer); !reflect.DeepEqual(got, want) {
+		t.Errorf("computeUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSampleQmpUsage(t *testing.T) {
+	vm, fakeQemu := newUsageFakeQemuVm(t, true)
+	var sample usageSampleType
+	haveBalloon := true
+	if err := vm.sampleQmpUsage(&sample, &haveBalloon); err != nil {
+		t.Fatal(err)
+	}
+	want := usageSampleType{
+		balloonBytes: 512 << 20,
+		blockRead:    ioCountersType{bytes: 4000, operations: 40},
+		blockWrite:   ioCountersType{bytes: 6000, operations: 60},
+	}
+	if !reflect.DeepEqual(sample, want) {
+		t.Errorf("sample = %+v, want %+v", sample, want)
+	}
+	if !haveBalloon {
+		t.Error("balloon device forgotten")
+	}
+	wantCommands := []string{"query-blockstats", "query-balloon"}
+	if got := fakeQemu.getCommands(); !reflect.DeepEqual(got, wantCommands) {
+		t.Errorf("commands = %v, want %v", got, wantCommands)
+	}
+}
+
+func TestSampleQmpUsageNoBalloon(t *testing.T) {
+	vm, fakeQemu := newUsageFakeQemuVm(t, false)
+	var sample usageSampleType
+	haveBalloon := true
+	for count := 0; count < 2; count++ {
+		if err := vm.sampleQmpUsage(&sample, &haveBalloon); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if haveBalloon {
+		t.Error("missing balloon device not recorded")
+	}
+	if sample.balloonBytes != 0 {
+		t.Errorf("balloonBytes = %d, want 0", sample.balloonBytes)
+	}
+	wantCommands := []string{"query-blockstats", "query-balloon",
+		"query-blockstats"}
+	if got := fakeQemu.getCommands(); !reflect.DeepEqual(got, wantCommands) {
+		t.Errorf("commands = %v, want %v", got, wantCommands)
+	}
+}
+
+func TestSampleQmpUsageSkippedDuringManagerSession(t *testing.T) {
+	vm, fakeQemu := newUsageFakeQemuVm(t, true)
+	vm.State = proto.StateRunning
+	ipAddr := net.ParseIP("10.0.0.1")
+	m := &Manager{vms: map[string]*vmInfoType{ipAddr.String(): vm}}
+	input, _, err := m.connectToVmManager(ipAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := usageSampleType{blockRead: ioCountersType{bytes: 1}}
+	haveBalloon := true
+	if err := vm.sampleQmpUsage(&sample, &haveBalloon); err != nil {
+		t.Fatal(err)
+	}
+	if sample.blockRead.bytes != 1 {
+		t.Error("sample changed while manager session active")
+	}
+	if got := fakeQemu.getCommands(); len(got) > 0 {
+		t.Errorf("commands sent during manager session: %v", got)
+	}
+	close(input)
+	waitForManagerSessionClose(t, vm)
+}
+
+func TestConnectToVmManagerWaitsForQmpClient(t *testing.T) {
+	vm, _ := newUsageFakeQemuVm(t, true)
+	vm.State = proto.StateRunning
+	ipAddr := net.ParseIP("10.0.0.1")
+	m := &Manager{vms: map[string]*vmInfoType{ipAddr.String(): vm}}
+	qmp, err := vm.newQmpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan chan<- byte, 1)
+	go func() {
+		input, _, err := m.connectToVmManager(ipAddr)
+		if err != nil {
+			t.Error(err)
+		}
+		connected <- input
+	}()
+	select {
+	case <-connected:
+		t.Fatal("manager session connected while qmpClient in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The VM must not be locked while waiting.
+	vm.mutex.Lock()
+	vm.mutex.Unlock()
+	qmp.close()
+	select {
+	case input := <-connected:
+		if input != nil {
+			close(input)
+			waitForManagerSessionClose(t, vm)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("manager session not connected after qmpClient closed")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/Cloud-Foundations/Dominator/hypervisor/cloudinit"
 	"github.com/Cloud-Foundations/Dominator/hypervisor/manager"
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
@@ -48,12 +49,21 @@ func StartServer(hypervisorPortNum uint, bridges []net.Interface,
 		constants.MetadataUserData:            manager.UserDataFile,
 	}
 	s.infoHandlers = map[string]metadataWriter{
-		constants.MetadataEpochTime:   s.showTime,
-		constants.MetadataIdentityDoc: s.showVM,
+		constants.MetadataAwsInstanceId:        s.showInstanceId,
+		constants.MetadataAwsLocalHostname:     s.showLocalHostname,
+		constants.MetadataAwsLocalIpv4:         s.showLocalIpv4,
+		constants.MetadataAwsMac:               s.showMac,
+		constants.MetadataAwsPublicKey:         s.showPublicKey,
+		constants.MetadataEpochTime:            s.showTime,
+		constants.MetadataIdentityDoc:          s.showVM,
+		constants.MetadataNoCloudMetaData:      cloudinit.WriteMetaData,
+		constants.MetadataNoCloudNetworkConfig: s.showNetworkConfig,
+		constants.MetadataNoCloudVendorData:    s.showNothing,
 	}
 	s.rawHandlers = map[string]rawHandlerFunc{
 		constants.SmallStackDataSource:        s.showTrue,
 		constants.MetadataExternallyPatchable: s.showTrue,
+		constants.MetadataNoCloudUserData:     s.showUserData,
 	}
 	s.computePaths()
 	return s.startServer()
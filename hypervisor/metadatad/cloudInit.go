@@ -0,0 +1,64 @@
+package metadatad
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Cloud-Foundations/Dominator/hypervisor/cloudinit"
+	"github.com/Cloud-Foundations/Dominator/hypervisor/manager"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (s *server) showInstanceId(writer io.Writer, vmInfo proto.VmInfo) error {
+	_, err := fmt.Fprintln(writer, cloudinit.InstanceId(vmInfo))
+	return err
+}
+
+func (s *server) showLocalHostname(writer io.Writer,
+	vmInfo proto.VmInfo) error {
+	_, err := fmt.Fprintln(writer, cloudinit.LocalHostname(vmInfo))
+	return err
+}
+
+func (s *server) showLocalIpv4(writer io.Writer, vmInfo proto.VmInfo) error {
+	_, err := fmt.Fprintln(writer, vmInfo.Address.IpAddress)
+	return err
+}
+
+func (s *server) showMac(writer io.Writer, vmInfo proto.VmInfo) error {
+	_, err := fmt.Fprintln(writer, vmInfo.Address.MacAddress)
+	return err
+}
+
+func (s *server) showNetworkConfig(writer io.Writer,
+	vmInfo proto.VmInfo) error {
+	return cloudinit.WriteNetworkConfig(writer, vmInfo,
+		s.manager.ListSubnets(false))
+}
+
+func (s *server) showNothing(writer io.Writer, vmInfo proto.VmInfo) error {
+	return nil
+}
+
+func (s *server) showPublicKey(writer io.Writer, vmInfo proto.VmInfo) error {
+	for _, key := range vmInfo.SshPublicKeys {
+		if _, err := fmt.Fprintln(writer, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showUserData is the same as showFileData for the user data, except that an
+// empty response rather than an error is returned if there are no user data,
+// since cloud-init requires the user-data file for the NoCloud datasource.
+func (s *server) showUserData(w http.ResponseWriter, ipAddr net.IP) {
+	file, err := s.manager.GetVmFileData(ipAddr, manager.UserDataFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	io.Copy(w, file)
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
 	libnet "github.com/Cloud-Foundations/Dominator/lib/net"
@@ -51,6 +52,24 @@ func blockMetadataOnInterface(ifName string) error {
 		return fmt.Errorf("error running ebtables: %s: %s",
 			err, string(output))
 	}
+	// Every Hypervisor uses the same IPv6 link-local address for the metadata
+	// service, so Neighbour Discovery traffic for it must not leave the host
+	// either.
+	for _, args := range [][]string{
+		{"INPUT", "-i", ifName, "--ip6-src"},
+		{"FORWARD", "-i", ifName, "--ip6-src"},
+		{"FORWARD", "-o", ifName, "--ip6-src"},
+		{"FORWARD", "-o", ifName, "--ip6-dst"},
+		{"OUTPUT", "-o", ifName, "--ip6-dst"},
+	} {
+		cmd = exec.Command("ebtables", "-t", "filter", "-A", args[0],
+			args[1], args[2], "-p", "IPv6",
+			args[3], constants.LinklocalIpv6Address, "-j", "DROP")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error running ebtables: %s: %s",
+				err, string(output))
+		}
+	}
 	return nil
 }
 
@@ -81,6 +100,12 @@ func (s *server) startServer() error {
 			return err
 		}
 	}
+	// VMs are identified by the source address of IPv6 requests, so only
+	// accept requests with source addresses belonging to the VM. This replaces
+	// the chains for these filters, leaving other user-defined chains alone.
+	if err := s.manager.InstallIpv6SourceFilters(); err != nil {
+		return err
+	}
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	for _, bridge := range s.bridges {
@@ -174,12 +199,46 @@ func (s *server) createNamespace(startChannel <-chan struct{},
 		statusChannel <- statusType{err: err}
 		return
 	}
+	hypervisorListener6, metadataListener6, err := s.listenIpv6()
+	if err != nil {
+		logger.Printf("not serving metadata over IPv6: %s\n", err)
+	}
 	statusChannel <- statusType{namespaceFd: namespaceFd, threadId: threadId}
 	logger.Printf("starting metadata server in thread: %d\n", threadId)
 	go httpServe(hypervisorListener, nil, time.Second*5)
+	if metadataListener6 != nil {
+		go httpServe(hypervisorListener6, nil, time.Second*5)
+		go httpServe(metadataListener6, s, time.Second*5)
+	}
 	httpServe(metadataListener, s, time.Second*5)
 }
 
+// listenIpv6 will add the IPv6 link-local address for the metadata service to
+// the eth0 interface and will listen on it. Duplicate Address Detection is
+// disabled since every Hypervisor uses the same address. This must be called
+// from the namespace thread.
+func (s *server) listenIpv6() (net.Listener, net.Listener, error) {
+	cmd := exec.Command("ip", "-6", "addr", "add",
+		constants.LinklocalIpv6Address+"/64", "dev", "eth0", "nodad")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("error adding address: %s: %s",
+			err, string(output))
+	}
+	address := constants.LinklocalIpv6Address + "%eth0"
+	hypervisorListener, err := net.Listen("tcp6",
+		net.JoinHostPort(address, strconv.Itoa(int(s.hypervisorPortNum))))
+	if err != nil {
+		return nil, nil, err
+	}
+	metadataListener, err := net.Listen("tcp6",
+		net.JoinHostPort(address, "80"))
+	if err != nil {
+		hypervisorListener.Close()
+		return nil, nil, err
+	}
+	return hypervisorListener, metadataListener, nil
+}
+
 func createInterface(bridge net.Interface, threadId int,
 	logger log.DebugLogger) error {
 	localName := bridge.Name + "-ll"
@@ -33,7 +33,19 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprintln(w, err)
 		return
 	}
+	if index := strings.IndexByte(hostname, '%'); index >= 0 {
+		hostname = hostname[:index] // Strip the zone of link-local addresses.
+	}
 	ipAddr := net.ParseIP(hostname)
+	if ipAddr.To4() == nil {
+		// Request over IPv6: find the VM from the interface identifier.
+		ipAddr, err = s.manager.LookupVmByIpv6Address(ipAddr)
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
 	s.manager.NotifyVmMetadataRequest(ipAddr, req.URL.Path)
 	vmInfo, err := s.manager.GetVmInfo(ipAddr)
 	if err != nil {
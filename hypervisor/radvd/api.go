@@ -0,0 +1,44 @@
+package radvd
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"golang.org/x/net/ipv6"
+)
+
+type interfaceType struct {
+	iface      net.Interface
+	lastSentAt time.Time
+	subnets    map[string]proto.Subnet // Key: subnet ID.
+}
+
+// RouterAdvertiser sends IPv6 Router Advertisements on bridges, advertising
+// the IPv6 prefixes of the subnets attached to each bridge so that VMs may use
+// Stateless Address Autoconfiguration (SLAAC) and DHCPv6.
+type RouterAdvertiser struct {
+	conn              *ipv6.PacketConn
+	logger            log.DebugLogger
+	mutex             sync.Mutex                // Protect everything below.
+	interfaces        map[string]*interfaceType // Key: interface name.
+	subnetToInterface map[string]string         // Key: subnet ID.
+}
+
+func New(logger log.DebugLogger) (*RouterAdvertiser, error) {
+	return newRouterAdvertiser(logger)
+}
+
+// AddSubnet will start advertising the IPv6 prefix for the subnet on the
+// specified interface. Subnets without an IPv6 prefix are ignored.
+func (r *RouterAdvertiser) AddSubnet(subnet proto.Subnet,
+	interfaceName string) {
+	r.addSubnet(subnet, interfaceName)
+}
+
+// RemoveSubnet will stop advertising the IPv6 prefix for the subnet.
+func (r *RouterAdvertiser) RemoveSubnet(subnetId string) {
+	r.removeSubnet(subnetId)
+}
@@ -0,0 +1,243 @@
+package radvd
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	advertisementInterval = time.Second * 200
+	minimumDelay          = time.Second * 3 // Between solicited adverts.
+	preferredLifetime     = time.Hour * 4
+	validLifetime         = time.Hour * 24
+
+	optionSourceLinkLayerAddress = 1
+	optionPrefixInformation      = 3
+	optionMtu                    = 5
+	optionRecursiveDnsServer     = 25
+
+	prefixFlagAutonomous = 0x40
+	prefixFlagOnLink     = 0x80
+
+	routerFlagManaged = 0x80
+	routerFlagOther   = 0x40
+)
+
+func newRouterAdvertiser(logger log.DebugLogger) (*RouterAdvertiser, error) {
+	logger = prefixlogger.New("radvd: ", logger)
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, err
+	}
+	pktConn := conn.IPv6PacketConn()
+	if err := pktConn.SetMulticastHopLimit(255); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := pktConn.SetHopLimit(255); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := pktConn.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterSolicitation)
+	if err := pktConn.SetICMPFilter(&filter); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := &RouterAdvertiser{
+		conn:              pktConn,
+		logger:            logger,
+		interfaces:        make(map[string]*interfaceType),
+		subnetToInterface: make(map[string]string),
+	}
+	go r.advertiseLoop()
+	go r.solicitationLoop()
+	return r, nil
+}
+
+func appendOption(buffer []byte, optionType byte, data []byte) []byte {
+	// The length includes the type and length bytes, in units of 8 bytes.
+	buffer = append(buffer, optionType, byte((len(data)+2)/8))
+	return append(buffer, data...)
+}
+
+// makeAdvertisement will make a Router Advertisement message for the
+// interface. The router lifetime is zero, since the Hypervisor is not a router
+// for the subnets: only the prefixes (and DNS servers) are advertised. The
+// managed and other configuration flags are set so that VMs also request
+// addresses (from the address pool) and configuration using DHCPv6.
+// This must be called with the lock held.
+func makeAdvertisement(iface *interfaceType) ([]byte, error) {
+	body := make([]byte, 12)
+	body[0] = 64 // Current hop limit.
+	body[1] = routerFlagManaged | routerFlagOther
+	if len(iface.iface.HardwareAddr) == 6 {
+		body = appendOption(body, optionSourceLinkLayerAddress,
+			iface.iface.HardwareAddr)
+	}
+	if iface.iface.MTU > 0 {
+		data := make([]byte, 6)
+		binary.BigEndian.PutUint32(data[2:], uint32(iface.iface.MTU))
+		body = appendOption(body, optionMtu, data)
+	}
+	var dnsServers []net.IP
+	for _, subnet := range iface.subnets {
+		data := make([]byte, 30)
+		data[0] = 64 // Prefix length.
+		data[1] = prefixFlagOnLink | prefixFlagAutonomous
+		binary.BigEndian.PutUint32(data[2:],
+			uint32(validLifetime/time.Second))
+		binary.BigEndian.PutUint32(data[6:],
+			uint32(preferredLifetime/time.Second))
+		copy(data[14:], subnet.Ipv6Prefix.To16())
+		body = appendOption(body, optionPrefixInformation, data)
+		_, ipv6s := util.SplitIPs(subnet.DomainNameServers)
+		dnsServers = append(dnsServers, ipv6s...)
+	}
+	if len(dnsServers) > 0 {
+		data := make([]byte, 6, 6+len(dnsServers)*net.IPv6len)
+		binary.BigEndian.PutUint32(data[2:],
+			uint32(advertisementInterval*3/time.Second))
+		for _, dnsServer := range dnsServers {
+			data = append(data, dnsServer...)
+		}
+		body = appendOption(body, optionRecursiveDnsServer, data)
+	}
+	message := icmp.Message{
+		Type: ipv6.ICMPTypeRouterAdvertisement,
+		Body: &icmp.RawBody{Data: body},
+	}
+	// The kernel computes the checksum.
+	return message.Marshal(nil)
+}
+
+func (r *RouterAdvertiser) addSubnet(subnet proto.Subnet,
+	interfaceName string) {
+	if len(subnet.Ipv6Prefix) < 1 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	iface, ok := r.interfaces[interfaceName]
+	if !ok {
+		netIface, err := net.InterfaceByName(interfaceName)
+		if err != nil {
+			r.logger.Printf("cannot advertise subnet: %s: %s\n", subnet.Id, err)
+			return
+		}
+		err = r.conn.JoinGroup(netIface,
+			&net.IPAddr{IP: net.IPv6linklocalallrouters})
+		if err != nil {
+			r.logger.Printf("error joining all-routers group on: %s: %s\n",
+				interfaceName, err)
+		}
+		iface = &interfaceType{
+			iface:   *netIface,
+			subnets: make(map[string]proto.Subnet),
+		}
+		r.interfaces[interfaceName] = iface
+	}
+	iface.subnets[subnet.Id] = subnet
+	r.subnetToInterface[subnet.Id] = interfaceName
+	r.logger.Printf("advertising prefix: %s/64 for subnet: %s on: %s\n",
+		subnet.Ipv6Prefix, subnet.Id, interfaceName)
+	r.sendAdvertisement(iface)
+}
+
+func (r *RouterAdvertiser) advertiseLoop() {
+	for range time.Tick(advertisementInterval) {
+		r.mutex.Lock()
+		for _, iface := range r.interfaces {
+			r.sendAdvertisement(iface)
+		}
+		r.mutex.Unlock()
+	}
+}
+
+func (r *RouterAdvertiser) removeSubnet(subnetId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	interfaceName, ok := r.subnetToInterface[subnetId]
+	if !ok {
+		return
+	}
+	delete(r.subnetToInterface, subnetId)
+	iface := r.interfaces[interfaceName]
+	delete(iface.subnets, subnetId)
+	r.logger.Printf("stopped advertising subnet: %s on: %s\n",
+		subnetId, interfaceName)
+	if len(iface.subnets) < 1 {
+		err := r.conn.LeaveGroup(&iface.iface,
+			&net.IPAddr{IP: net.IPv6linklocalallrouters})
+		if err != nil {
+			r.logger.Printf("error leaving all-routers group on: %s: %s\n",
+				interfaceName, err)
+		}
+		delete(r.interfaces, interfaceName)
+	}
+}
+
+// sendAdvertisement will send a Router Advertisement to all nodes on the
+// interface.
+// This must be called with the lock held.
+func (r *RouterAdvertiser) sendAdvertisement(iface *interfaceType) {
+	if len(iface.subnets) < 1 {
+		return
+	}
+	message, err := makeAdvertisement(iface)
+	if err != nil {
+		r.logger.Println(err)
+		return
+	}
+	_, err = r.conn.WriteTo(message,
+		&ipv6.ControlMessage{HopLimit: 255, IfIndex: iface.iface.Index},
+		&net.IPAddr{IP: net.IPv6linklocalallnodes, Zone: iface.iface.Name})
+	if err != nil {
+		r.logger.Printf("error sending advertisement on: %s: %s\n",
+			iface.iface.Name, err)
+		return
+	}
+	iface.lastSentAt = time.Now()
+}
+
+// solicitationLoop will respond to Router Solicitations by sending a Router
+// Advertisement to all nodes on the interface the solicitation was received
+// on, rate limited to one advertisement every few seconds.
+func (r *RouterAdvertiser) solicitationLoop() {
+	buffer := make([]byte, 1500)
+	for {
+		_, cm, _, err := r.conn.ReadFrom(buffer)
+		if err != nil {
+			r.logger.Println(err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if cm == nil {
+			continue
+		}
+		r.mutex.Lock()
+		for _, iface := range r.interfaces {
+			if iface.iface.Index != cm.IfIndex {
+				continue
+			}
+			if time.Since(iface.lastSentAt) >= minimumDelay {
+				r.sendAdvertisement(iface)
+			}
+			break
+		}
+		r.mutex.Unlock()
+	}
+}
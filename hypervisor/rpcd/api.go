@@ -70,16 +70,20 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 	publicMethods := []string{
 		"AcknowledgeVm",
 		"AddVmVolumes",
+		"BackupVm",
 		"BecomePrimaryVmOwner",
 		"ChangeVmConsoleType",
 		"ChangeVmCpuPriority",
 		"ChangeVmDestroyProtection",
 		"ChangeVmHostname",
 		"ChangeVmMachineType",
+		"ChangeVmNetworkLimits",
 		"ChangeVmNumNetworkQueues",
 		"ChangeVmOwnerGroups",
 		"ChangeVmOwnerUsers",
+		"ChangeVmRestartPolicy",
 		"ChangeVmSize",
+		"ChangeVmSnapshotSchedule",
 		"ChangeVmSubnet",
 		"ChangeVmTags",
 		"ChangeVmVolumeInterfaces",
@@ -87,6 +91,7 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		"ChangeVmVolumeStorageIndex",
 		"CommitImportedVm",
 		"ConnectToVmConsole",
+		"ConnectToVmLiveMigration",
 		"ConnectToVmSerialPort",
 		"CopyVm",
 		"CreateVm",
@@ -130,6 +135,7 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		"RestoreVmUserData",
 		"ReorderVmVolumes",
 		"ScanVmRoot",
+		"ServeVmLiveMigration",
 		"SnapshotVm",
 		"StartVm",
 		"StopVm",
@@ -0,0 +1,21 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) BackupVm(conn *srpc.Conn,
+	request hypervisor.BackupVmRequest,
+	reply *hypervisor.BackupVmResponse) error {
+	response, err := t.manager.BackupVm(conn.GetAuthInformation(), request)
+	if err != nil {
+		*reply = hypervisor.BackupVmResponse{
+			Error: errors.ErrorToString(err),
+		}
+	} else {
+		*reply = *response
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) ChangeVmNetworkLimits(conn *srpc.Conn,
+	request hypervisor.ChangeVmNetworkLimitsRequest,
+	reply *hypervisor.ChangeVmNetworkLimitsResponse) error {
+	*reply = hypervisor.ChangeVmNetworkLimitsResponse{
+		errors.ErrorToString(
+			t.manager.ChangeVmNetworkLimits(request.IpAddress,
+				conn.GetAuthInformation(),
+				request.NetworkLimits))}
+	return nil
+}
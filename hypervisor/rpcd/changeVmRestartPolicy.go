@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) ChangeVmRestartPolicy(conn *srpc.Conn,
+	request hypervisor.ChangeVmRestartPolicyRequest,
+	reply *hypervisor.ChangeVmRestartPolicyResponse) error {
+	*reply = hypervisor.ChangeVmRestartPolicyResponse{
+		errors.ErrorToString(
+			t.manager.ChangeVmRestartPolicy(request.IpAddress,
+				conn.GetAuthInformation(),
+				request.RestartPolicy))}
+	return nil
+}
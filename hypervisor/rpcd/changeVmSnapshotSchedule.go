@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) ChangeVmSnapshotSchedule(conn *srpc.Conn,
+	request hypervisor.ChangeVmSnapshotScheduleRequest,
+	reply *hypervisor.ChangeVmSnapshotScheduleResponse) error {
+	*reply = hypervisor.ChangeVmSnapshotScheduleResponse{
+		errors.ErrorToString(
+			t.manager.ChangeVmSnapshotSchedule(request.IpAddress,
+				conn.GetAuthInformation(),
+				request.SnapshotSchedule))}
+	return nil
+}
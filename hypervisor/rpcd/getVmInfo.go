@@ -14,6 +14,9 @@ func (t *srpcType) GetVmInfo(conn *srpc.Conn,
 		VmInfo: info,
 		Error:  errors.ErrorToString(err),
 	}
+	if err == nil {
+		response.Usage, _ = t.manager.GetVmUsage(request.IpAddress)
+	}
 	*reply = response
 	return nil
 }
@@ -10,7 +10,8 @@ func (t *srpcType) SnapshotVm(conn *srpc.Conn,
 	request hypervisor.SnapshotVmRequest,
 	reply *hypervisor.SnapshotVmResponse) error {
 	err := t.manager.SnapshotVm(request.IpAddress, conn.GetAuthInformation(),
-		request.ForceIfNotStopped, request.RootOnly, request.Name)
+		request.ForceIfNotStopped, request.RootOnly, request.Quiesce,
+		request.Name)
 	*reply = hypervisor.SnapshotVmResponse{errors.ErrorToString(err)}
 	return nil
 }
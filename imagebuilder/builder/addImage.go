@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,7 +25,9 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/goroutine"
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/changelog"
 	"github.com/Cloud-Foundations/Dominator/lib/image/packageutil"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
@@ -110,6 +114,27 @@ func addImage(client srpc.ClientI, request proto.BuildImageRequest,
 	return name, nil
 }
 
+// addChangelog will compute the changelog from the previous image and will
+// upload it, returning an annotation for the release notes.
+func addChangelog(objClient *objectclient.ObjectClient,
+	oldImage, img *image.Image, params changelog.Params,
+	buildLog io.Writer) (*image.Annotation, error) {
+	changes := changelog.Compute(oldImage, img, params)
+	buffer := &bytes.Buffer{}
+	if err := changes.Encode(buffer); err != nil {
+		return nil, err
+	}
+	hashVal, _, err := objClient.AddObject(buffer, uint64(buffer.Len()), nil)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(buildLog,
+		"Changelog: %d packages added, %d removed, %d upgraded, %d files changed\n",
+		len(changes.PackagesAdded), len(changes.PackagesRemoved),
+		len(changes.PackagesUpgraded), len(changes.FileChanges))
+	return &image.Annotation{Object: &hashVal}, nil
+}
+
 func buildFileSystem(client srpc.ClientI, dirname string,
 	scanFilter *filter.Filter, cache *treeCache) (
 	*filesystem.FileSystem, error) {
@@ -189,7 +214,8 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 	cache *treeCache, computedFilesList []util.ComputedFile,
 	imageFilter *filter.Filter, owners OwnersType, rawTags tags.Tags,
 	trig *triggers.Triggers, copyMtimesFilter *filter.Filter,
-	buildLog buildLogger, logger log.Logger) (*image.Image, error) {
+	changelogParams *changelog.Params, buildLog buildLogger,
+	logger log.Logger) (*image.Image, error) {
 	if cache == nil {
 		cache = &treeCache{}
 	}
@@ -220,8 +246,8 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 		fs.NumRegularInodes-cache.numHits,
 		format.FormatBytes(fs.TotalDataBytes-cache.hitBytes),
 		format.Duration(duration), format.FormatBytes(speed))
-	_, oldImage, err := getLatestImage(client, request.StreamName, "", nil,
-		buildLog, logger)
+	oldImageName, oldImage, err := getLatestImage(client, request.StreamName,
+		"", nil, buildLog, logger)
 	if err != nil {
 		return nil, fmt.Errorf("error getting latest image: %s", err)
 	} else if oldImage != nil {
@@ -231,9 +257,11 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 			format.Duration(time.Since(patchStartTime)))
 	}
 	// Run tests, which has the side effect of mutating the namespace.
-	if err := runTests(ctx, g, dirname, buildLog); err != nil {
+	testResults, err := runTests(ctx, g, dirname, buildLog)
+	if err != nil {
 		return nil, err
 	}
+	recordTestResults(buildLog, testResults)
 	objClient := objectclient.AttachObjectClient(client)
 	// Make a copy of the build log because AddObject() drains the buffer.
 	logReader := bytes.NewBuffer(buildLog.Bytes())
@@ -242,9 +270,6 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 	if err != nil {
 		return nil, err
 	}
-	if err := objClient.Close(); err != nil {
-		return nil, err
-	}
 	tgs := rawTags.Copy()
 	for key, value := range tgs {
 		newValue := expand.Expression(value, func(name string) string {
@@ -265,6 +290,27 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 		Packages:    packages,
 		Tags:        tgs,
 	}
+	if testResults != nil {
+		img.TestResults, err = addTestResults(objClient, testResults)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if changelogParams != nil {
+		params := *changelogParams
+		params.PreviousImage = oldImageName
+		if oldImage != nil {
+			params.PreviousCommitId = oldImage.BuildCommitId
+		}
+		img.ReleaseNotes, err = addChangelog(objClient, oldImage, img, params,
+			buildLog)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := objClient.Close(); err != nil {
+		return nil, err
+	}
 	if err := img.Verify(); err != nil {
 		return nil, err
 	}
@@ -273,9 +319,11 @@ func packImage(ctx context.Context, g *goroutine.Goroutine, client srpc.ClientI,
 
 // runTests will run the tests in the "/tests" directory under rootDir. It
 // uses the specified goroutine with a prepared mount namespace. This namespace
-// will be modified.
+// will be modified. The results are returned, or nil if there are no tests.
+// Test failures are not treated as errors; an error is returned only if the
+// tests could not be run.
 func runTests(ctx context.Context, g *goroutine.Goroutine, rootDir string,
-	buildLog buildLogger) error {
+	buildLog buildLogger) (*testresults.Results, error) {
 	var testProgrammes []string
 	err := filepath.Walk(filepath.Join(rootDir, "tests"),
 		func(path string, fi os.FileInfo, err error) error {
@@ -286,10 +334,10 @@ func runTests(ctx context.Context, g *goroutine.Goroutine, rootDir string,
 			return nil
 		})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(testProgrammes) < 1 {
-		return nil
+		return nil, nil
 	}
 	fmt.Fprintf(buildLog, "Running %d tests\n", len(testProgrammes))
 	results := make(chan testResultType, 1)
@@ -298,24 +346,41 @@ func runTests(ctx context.Context, g *goroutine.Goroutine, rootDir string,
 			results <- runTest(ctx, g, rootDir, prog)
 		}(prog)
 	}
-	numFailures := 0
+	testResults := &testresults.Results{
+		Results: make([]testresults.Result, 0, len(testProgrammes)),
+	}
 	for range testProgrammes {
 		result := <-results
-		io.Copy(buildLog, &result)
-		if result.err != nil {
-			fmt.Fprintf(buildLog, "error running: %s: %s\n",
-				result.prog, result.err)
-			numFailures++
-		} else {
+		output := &bytes.Buffer{}
+		io.Copy(output, &result)
+		buildLog.Write(output.Bytes())
+		testResult := testresults.Result{
+			Duration: result.duration,
+			Name:     strings.TrimPrefix(result.prog, "/tests/"),
+			Output:   testresults.MakeExcerpt(output.Bytes()),
+			Status:   testresults.StatusPass,
+		}
+		var exitError *exec.ExitError
+		if result.err == nil {
 			fmt.Fprintf(buildLog, "%s passed in %s\n",
 				result.prog, format.Duration(result.duration))
+		} else if errors.As(result.err, &exitError) &&
+			exitError.ExitCode() == testresults.ExitCodeSkip {
+			fmt.Fprintf(buildLog, "%s skipped\n", result.prog)
+			testResult.Status = testresults.StatusSkip
+		} else {
+			fmt.Fprintf(buildLog, "error running: %s: %s\n",
+				result.prog, result.err)
+			testResult.Status = testresults.StatusFail
+			if result.err == errorTestTimedOut {
+				testResult.Output += "\n" + result.err.Error()
+			}
 		}
 		fmt.Fprintln(buildLog)
+		testResults.Results = append(testResults.Results, testResult)
 	}
-	if numFailures > 0 {
-		return fmt.Errorf("%d tests failed", numFailures)
-	}
-	return nil
+	testResults.Sort()
+	return testResults, nil
 }
 
 func runTest(ctx context.Context, g *goroutine.Goroutine,
@@ -335,6 +400,7 @@ func runTest(ctx context.Context, g *goroutine.Goroutine,
 	case result.err = <-errChannel:
 		result.duration = time.Since(startTime)
 	case <-timer.C:
+		result.duration = time.Since(startTime)
 		result.err = errorTestTimedOut
 	}
 	return result
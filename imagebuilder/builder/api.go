@@ -14,6 +14,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/slavedriver"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
@@ -40,10 +41,23 @@ type imageBuilder interface {
 		buildLog buildLogger) (*image.Image, error)
 }
 
+type testResultsRecorder interface {
+	recordTestResults(results *testresults.Results)
+}
+
 // Other private types.
 
 type argList []string
 
+type buildPriority uint
+
+const (
+	priorityAutoRebuild buildPriority = iota
+	priorityCascade
+	priorityRequest
+	priorityDependency
+)
+
 type bindMountType struct {
 	source   string
 	target   string
@@ -65,24 +79,67 @@ type bootstrapStream struct {
 	PackagerType     string
 }
 
+type buildCacheIndex struct {
+	filename string                          // Empty: do not save.
+	mutex    sync.Mutex                      // Protect everything below.
+	objects  map[hash.Hash]*buildCacheObject // Shared by all streams.
+	streams  map[string]map[string]hash.Hash // K: stream name, K: pathname.
+}
+
+// buildCacheIndexData is the saved form of the build cache index.
+type buildCacheIndexData struct {
+	Objects map[hash.Hash]uint64            // Value: size.
+	Streams map[string]map[string]hash.Hash // K: stream name, K: pathname.
+}
+
+type buildCacheObject struct {
+	refcount uint // Number of stream files with this content.
+	size     uint64
+}
+
+type buildCacheState struct {
+	cachedFiles  map[string]cachedFileType // Key: relative pathname.
+	dirname      string
+	fetchedBytes uint64
+	numFetched   uint
+	numLocal     uint
+	numMissing   uint
+}
+
+type buildQueue struct {
+	maxRunning          uint
+	maxRunningPerStream uint
+	maxRunningPerUser   uint
+	mutex               sync.Mutex // Protect everything below.
+	numRunning          uint
+	running             []*queueEntry
+	runningPerStream    map[string]uint // Key: stream name.
+	runningPerUser      map[string]uint // Key: username.
+	waiting             []*queueEntry   // Highest priority first.
+}
+
 type buildResultType struct {
-	imageName  string
-	startTime  time.Time
-	finishTime time.Time
-	buildLog   []byte
-	error      error
+	imageName   string
+	startTime   time.Time
+	finishTime  time.Time
+	buildLog    []byte
+	error       error
+	testResults *testresults.Results
 }
 
 type cacheConfigurationType struct {
 	BaseDirectory string // The image stream name is appended to this path.
 	MountPoint    string // Where in build environment to mount it.
+	Remote        bool   // If true, share the cache via the object server.
 	SizeLimit     types.Bytes
 }
 
 type currentBuildInfo struct {
-	buffer       *bytes.Buffer
-	slaveAddress string
-	startedAt    time.Time
+	buffer         *bytes.Buffer
+	imageUnchanged bool // True if the previous image was kept.
+	slaveAddress   string
+	startedAt      time.Time
+	testResults    *testresults.Results
 }
 
 type dependencyDataType struct {
@@ -100,12 +157,24 @@ type imageStreamConfigurationType struct {
 	BuilderUsers      []string
 	ManifestUrl       string
 	ManifestDirectory string
+	TestPolicy        testPolicyType `json:",omitempty"`
 	Variables         map[string]string
 }
 
 type imageStreamsConfigurationType struct {
-	StreamPatterns map[string]*imageStreamPatternType `json:",omitempty"`
-	Streams        map[string]*imageStreamType        `json:",omitempty"`
+	StreamMatrices     map[string]*imageStreamMatrixType  `json:",omitempty"`
+	StreamPatterns     map[string]*imageStreamPatternType `json:",omitempty"`
+	Streams            map[string]*imageStreamType        `json:",omitempty"`
+	autoRebuildStreams []string                           // From matrices.
+}
+
+// imageStreamMatrixType is a template which is expanded into a stream for each
+// combination of variable values.
+type imageStreamMatrixType struct {
+	AutoRebuild bool                `json:",omitempty"`
+	Exclude     []map[string]string `json:",omitempty"`
+	Values      map[string][]string // K: variable name, V: values.
+	imageStreamConfigurationType
 }
 
 type imageStreamPatternType struct {
@@ -152,7 +221,10 @@ type masterConfigurationType struct {
 	MtimesCopyFilterLines     []string                      `json:",omitempty"`
 	PackagerTypes             map[string]packagerType       `json:",omitempty"`
 	RelationshipsQuickLinks   []WebLink                     `json:",omitempty"`
+	SbomFormat                string                        `json:",omitempty"`
+	SkipUnchangedImages       bool                          `json:",omitempty"`
 	SshMetadataFetcher        sshutil.MetadataFetcherConfig `json:",omitempty"`
+	UnchangedImageFilterLines []string                      `json:",omitempty"`
 }
 
 // manifestLocationType contains the expanded location of a manifest. These
@@ -180,6 +252,15 @@ type packagerType struct {
 	Verbatim       []string
 }
 
+type rebuildCascadeType struct {
+	expiresIn time.Duration
+	trigger   chan struct{}
+	mutex     sync.Mutex          // Protect everything below.
+	building  map[string]struct{} // Key: stream name.
+	failed    map[string]error    // Key: stream name.
+	pending   map[string]struct{} // Key: stream name.
+}
+
 type sourceImageInfoType struct {
 	computedFiles []util.ComputedFile
 	filter        *filter.Filter
@@ -195,6 +276,21 @@ type testResultType struct {
 	prog     string
 }
 
+type queueEntry struct {
+	notify     chan struct{}
+	priority   buildPriority
+	queuedAt   time.Time
+	running    bool
+	startedAt  time.Time
+	streamName string
+	username   string
+}
+
+type testPolicyType struct {
+	IgnoreFailures  []string `json:",omitempty"` // Test names (i.e. flaky).
+	MaximumFailures uint     `json:",omitempty"`
+}
+
 type treeCache struct {
 	hitBytes    uint64
 	inodeTable  map[uint64]inodeData
@@ -202,11 +298,31 @@ type treeCache struct {
 	pathToInode map[string]uint64
 }
 
+// QueuePositionReporter may be implemented by the log writer passed to
+// BuildImage to receive the position of the build in the build queue while it
+// is waiting to start.
+type QueuePositionReporter interface {
+	ReportQueuePosition(position uint) error
+}
+
 type WebLink struct {
 	Name string
 	URL  string
 }
 
+// BuildCacheReporter may be implemented by the log writer passed to BuildImage
+// to receive the updated remote build cache when building on behalf of another
+// builder.
+type BuildCacheReporter interface {
+	ReportBuildCache(cache *proto.BuildCache) error
+}
+
+// TestResultsReporter may be implemented by the log writer passed to
+// Builder.BuildImage in order to receive the results of the image tests.
+type TestResultsReporter interface {
+	ReportTestResults(results []testresults.Result) error
+}
+
 type BuildErrorType struct {
 	error                     string
 	NeedSourceImage           bool
@@ -227,6 +343,8 @@ type Builder struct {
 	autoRebuildTrigger          chan<- chan<- struct{}
 	buildLogArchiver            logarchiver.BuildLogArchiver
 	bindMounts                  []string
+	buildCacheIndex             *buildCacheIndex
+	buildQueue                  *buildQueue
 	cache                       cacheConfigurationType
 	createSlaveTimeout          time.Duration
 	disableLock                 sync.RWMutex
@@ -246,14 +364,19 @@ type Builder struct {
 	maximumExpirationPrivileged time.Duration
 	minimumExpiration           time.Duration
 	mtimesCopyFilter            *filter.Filter
-	streamsLoadedChannel        <-chan struct{} // Closed when streams loaded.
+	rebuildCascade              *rebuildCascadeType // nil: disabled.
+	streamsLoadedChannel        <-chan struct{}     // Closed when streams loaded.
 	streamsLock                 sync.RWMutex
 	bootstrapStreams            map[string]*bootstrapStream
 	imageStreamPatterns         []*imageStreamPatternType
 	imageStreams                map[string]*imageStreamType
 	imageStreamsToAutoRebuild   []string
+	matrixStreamsToAutoRebuild  []string
 	relationshipsQuickLinks     []WebLink
+	sbomFormat                  string
+	skipUnchangedImages         bool
 	slaveDriver                 *slavedriver.SlaveDriver
+	unchangedImageFilter        *filter.Filter
 	buildResultsLock            sync.RWMutex
 	currentBuildInfos           map[string]*currentBuildInfo // Key: stream name.
 	lastBuildResults            map[string]buildResultType   // Key: stream name.
@@ -272,8 +395,12 @@ type BuilderOptions struct {
 	MaximumBuildDuration                time.Duration // Default/max: 24 hours.
 	MaximumExpirationDuration           time.Duration // Default: 1 day.
 	MaximumExpirationDurationPrivileged time.Duration // Default: 1 month.
+	MaximumRunningBuilds                uint          // Default: no limit.
+	MaximumRunningBuildsPerStream       uint          // Default: 1.
+	MaximumRunningBuildsPerUser         uint          // Default: no limit.
 	MinimumExpirationDuration           time.Duration // Def: 15 min. Min: 5 min
 	PresentationImageServerAddress      string
+	RebuildDependentStreams             bool // Rebuild when source is built.
 	StateDirectory                      string
 	VariablesFile                       string
 }
@@ -284,6 +411,13 @@ type BuilderParams struct {
 	SlaveDriver      *slavedriver.SlaveDriver
 }
 
+// LintMessage describes a problem found in a manifest by LintManifest.
+type LintMessage struct {
+	Component string // Name of the manifest component (i.e. "triggers").
+	IsError   bool   // If false, this is a warning.
+	Message   string
+}
+
 type OwnersType struct {
 	Groups []string
 	Users  []string
@@ -335,6 +469,10 @@ func (b *Builder) GetCurrentBuildLog(streamName string) ([]byte, error) {
 	return b.getCurrentBuildLog(streamName)
 }
 
+func (b *Builder) GetBuildQueue() []proto.BuildQueueEntry {
+	return b.getBuildQueue()
+}
+
 func (b *Builder) GetDirectedGraph(request proto.GetDirectedGraphRequest) (
 	proto.GetDirectedGraphResult, error) {
 	return b.getDirectedGraph(request)
@@ -365,6 +503,12 @@ func (b *Builder) ShowImageStreams(writer io.Writer) {
 	b.showImageStreams(writer)
 }
 
+// ShowLatestTestResults will write the test results from the latest build of
+// the specified stream as HTML.
+func (b *Builder) ShowLatestTestResults(writer io.Writer, streamName string) {
+	b.showLatestTestResults(writer, streamName)
+}
+
 func (b *Builder) StartAutoBuilds(request proto.StartAutoBuildsRequest) error {
 	return b.startAutoBuilds(request)
 }
@@ -422,6 +566,19 @@ func BuildTreeFromManifestWithOptions(client *srpc.Client,
 		stdlog.New(buildLog, "", 0))
 }
 
+// LintManifest will check the manifest directory specified in options for
+// problems, such as bad regular expressions, conflicting components and
+// scripts which cannot be run. If client is not nil, the source image is
+// fetched from the imageserver and the manifest is also checked against the
+// file-system of the source image (i.e. missing computed files and triggers
+// which match no files). The problems found are returned. A non-nil error is
+// returned only if the manifest could not be checked.
+func LintManifest(client srpc.ClientI, options BuildLocalOptions,
+	logger log.Logger) ([]LintMessage, error) {
+	return lintManifest(client, options.ManifestDirectory,
+		variablesGetter(options.Variables), logger)
+}
+
 func ProcessManifest(manifestDir, rootDir string, bindMounts []string,
 	buildLog io.Writer) error {
 	ctx, cancel := makeContext(0)
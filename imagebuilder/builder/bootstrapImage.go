@@ -20,6 +20,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/goroutine"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/changelog"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
 )
@@ -148,7 +149,7 @@ func (stream *bootstrapStream) build(b *Builder, client srpc.ClientI,
 		return packImage(ctx, g, client, request, rootDir,
 			stream.Filter, nil, nil, stream.imageFilter, stream.Owners,
 			stream.imageTags, stream.imageTriggers, b.mtimesCopyFilter,
-			buildLog, b.logger)
+			&changelog.Params{}, buildLog, b.logger)
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	"github.com/Cloud-Foundations/Dominator/lib/retry"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc/retryclient"
@@ -22,8 +23,10 @@ import (
 )
 
 type dualBuildLogger struct {
-	buffer *bytes.Buffer
-	writer io.Writer
+	buffer    *bytes.Buffer
+	buildInfo *currentBuildInfo
+	logWriter io.Writer
+	writer    io.Writer
 }
 
 func copyClientLogs(clientAddress string, keepSlave bool, buildError error,
@@ -96,9 +99,8 @@ func (b *Builder) checkToAutoExtend() bool {
 }
 
 func (b *Builder) build(client srpc.ClientI, request proto.BuildImageRequest,
-	authInfo *srpc.AuthInformation,
+	authInfo *srpc.AuthInformation, priority buildPriority,
 	logWriter io.Writer) (*image.Image, string, error) {
-	startTime := time.Now()
 	builder, err := b.getImageBuilderWithReload(request.StreamName)
 	if err != nil {
 		return nil, "", err
@@ -109,6 +111,14 @@ func (b *Builder) build(client srpc.ClientI, request proto.BuildImageRequest,
 	if err := b.checkPermission(builder, request, authInfo); err != nil {
 		return nil, "", err
 	}
+	var username string
+	if authInfo != nil {
+		username = authInfo.Username
+	}
+	queueEntry := b.buildQueue.add(request.StreamName, username, priority)
+	defer b.buildQueue.release(queueEntry)
+	b.waitInQueue(queueEntry, logWriter)
+	startTime := time.Now()
 	buildLogBuffer := &bytes.Buffer{}
 	buildInfo := &currentBuildInfo{
 		buffer:    buildLogBuffer,
@@ -117,27 +127,30 @@ func (b *Builder) build(client srpc.ClientI, request proto.BuildImageRequest,
 	b.buildResultsLock.Lock()
 	b.currentBuildInfos[request.StreamName] = buildInfo
 	b.buildResultsLock.Unlock()
-	var buildLog buildLogger
-	if logWriter == nil {
-		buildLog = buildLogBuffer
-	} else {
-		buildLog = &dualBuildLogger{
-			buffer: buildLogBuffer,
-			writer: io.MultiWriter(buildLogBuffer, logWriter),
-		}
+	buildLog := &dualBuildLogger{
+		buffer:    buildLogBuffer,
+		buildInfo: buildInfo,
+		logWriter: logWriter,
+		writer:    buildLogBuffer,
+	}
+	if logWriter != nil {
+		buildLog.writer = io.MultiWriter(buildLogBuffer, logWriter)
 	}
 	if authInfo != nil {
 		fmt.Fprintf(buildLog, "Building: %s for: %s\n",
 			request.StreamName, authInfo.Username)
 	}
 	img, name, err := b.buildWithLogger(builder, client, request, authInfo,
-		startTime, &buildInfo.slaveAddress, buildLog)
+		priority, startTime, buildInfo, buildLog)
+	b.cascadeRebuild(request.StreamName, priority, buildInfo.imageUnchanged,
+		err)
 	finishTime := time.Now()
 	b.buildResultsLock.Lock()
 	defer b.buildResultsLock.Unlock()
 	delete(b.currentBuildInfos, request.StreamName)
 	b.lastBuildResults[request.StreamName] = buildResultType{
-		name, startTime, finishTime, buildLog.Bytes(), err}
+		name, startTime, finishTime, buildLog.Bytes(), err,
+		buildInfo.testResults}
 	buildLogInfo := logarchiver.BuildInfo{
 		Duration: finishTime.Sub(startTime),
 		Error:    errors.ErrorToString(err),
@@ -184,7 +197,8 @@ func (b *Builder) buildImage(request proto.BuildImageRequest,
 		return nil, "", err
 	}
 	defer client.Close()
-	img, name, err := b.build(client, request, authInfo, logWriter)
+	img, name, err := b.build(client, request, authInfo, priorityRequest,
+		logWriter)
 	if request.ReturnImage {
 		return img, "", err
 	}
@@ -222,12 +236,14 @@ func (b *Builder) buildLocal(builder imageBuilder, client srpc.ClientI,
 	return img, nil
 }
 
-func (b *Builder) buildOnSlave(client srpc.ClientI,
+func (b *Builder) buildOnSlave(builder imageBuilder, client srpc.ClientI,
 	request proto.BuildImageRequest, authInfo *srpc.AuthInformation,
 	slaveAddress *string, buildLog buildLogger) (*image.Image, error) {
 	request.DisableRecursiveBuild = true
 	request.ReturnImage = true
 	request.StreamBuildLog = true
+	testPolicy := proto.TestPolicy(getTestPolicy(builder, request))
+	request.TestPolicy = &testPolicy
 	bVariables := b.getVariables()
 	if len(request.Variables) < 1 {
 		request.Variables = bVariables
@@ -242,6 +258,9 @@ func (b *Builder) buildOnSlave(client srpc.ClientI,
 		}
 		request.Variables = variables
 	}
+	if b.cache.Remote {
+		request.BuildCache = b.getBuildCache(request.StreamName)
+	}
 	slave, err := b.slaveDriver.GetSlaveWithTimeout(b.createSlaveTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("error getting slave: %s", err)
@@ -270,6 +289,10 @@ func (b *Builder) buildOnSlave(client srpc.ClientI,
 	var reply proto.BuildImageResponse
 	err = buildclient.BuildImage(slave.GetClient(), request, &reply, buildLog)
 	copyClientLogs(slave.GetClientAddress(), keepSlave, err, buildLog)
+	if len(reply.TestResults) > 0 {
+		recordTestResults(buildLog,
+			&testresults.Results{Results: reply.TestResults})
+	}
 	if err != nil {
 		if reply.NeedSourceImage {
 			keepSlave = true
@@ -283,6 +306,12 @@ func (b *Builder) buildOnSlave(client srpc.ClientI,
 		}
 		return nil, err
 	}
+	if b.cache.Remote && reply.BuildCache != nil {
+		err := b.buildCacheIndex.update(request.StreamName, reply.BuildCache)
+		if err != nil {
+			fmt.Fprintf(buildLog, "Error saving build cache index: %s\n", err)
+		}
+	}
 	return reply.Image, nil
 }
 
@@ -292,14 +321,16 @@ func (b *Builder) buildSomewhere(builder imageBuilder, client srpc.ClientI,
 	if b.slaveDriver == nil {
 		return b.buildLocal(builder, client, request, authInfo, buildLog)
 	} else {
-		return b.buildOnSlave(client, request, authInfo, slaveAddress, buildLog)
+		return b.buildOnSlave(builder, client, request, authInfo, slaveAddress,
+			buildLog)
 	}
 }
 
 func (b *Builder) buildWithLogger(builder imageBuilder, client srpc.ClientI,
 	request proto.BuildImageRequest, authInfo *srpc.AuthInformation,
-	startTime time.Time, slaveAddress *string,
+	priority buildPriority, startTime time.Time, buildInfo *currentBuildInfo,
 	buildLog buildLogger) (*image.Image, string, error) {
+	slaveAddress := &buildInfo.slaveAddress
 	img, err := b.buildSomewhere(builder, client, request, authInfo,
 		slaveAddress, buildLog)
 	if err != nil {
@@ -322,7 +353,9 @@ func (b *Builder) buildWithLogger(builder imageBuilder, client srpc.ClientI,
 				StreamName:   buildError.SourceImage,
 				Variables:    variables,
 			}
-			if _, _, e := b.build(client, sourceReq, nil, buildLog); e != nil {
+			_, _, e := b.build(client, sourceReq, nil, priorityDependency,
+				buildLog)
+			if e != nil {
 				return nil, "", e
 			}
 			img, err = b.buildSomewhere(builder, client, request, authInfo,
@@ -332,12 +365,32 @@ func (b *Builder) buildWithLogger(builder imageBuilder, client srpc.ClientI,
 	if err != nil {
 		return nil, "", err
 	}
+	// Images built on a slave have already been checked by the slave.
+	if b.slaveDriver == nil {
+		err := getTestPolicy(builder, request).check(buildInfo.testResults,
+			buildLog)
+		if err != nil {
+			fmt.Fprintln(buildLog, err)
+			return nil, "", err
+		}
+	}
 	if request.ReturnImage {
 		return img, "", nil
 	}
 	if authInfo != nil {
 		img.CreatedFor = authInfo.Username
 	}
+	if b.skipUnchangedImages &&
+		(priority == priorityAutoRebuild || priority == priorityCascade) {
+		if name := b.checkUnchanged(client, request, img, buildLog); name != "" {
+			buildInfo.imageUnchanged = true
+			return img, name, nil
+		}
+	}
+	if err := b.addSbom(client, request.StreamName, img, buildLog); err != nil {
+		fmt.Fprintln(buildLog, err)
+		return nil, "", err
+	}
 	uploadStartTime := time.Now()
 	if name, err := addImage(client, request, img); err != nil {
 		fmt.Fprintln(buildLog, err)
@@ -487,21 +540,21 @@ func (b *Builder) getLatestBuildLog(streamName string) ([]byte, error) {
 }
 
 func (b *Builder) rebuildImage(client srpc.ClientI, streamName string,
-	expiresIn time.Duration, extendOnly *bool) {
+	expiresIn time.Duration, priority buildPriority, extendOnly *bool) error {
 	if !*extendOnly {
 		*extendOnly = b.checkToAutoExtend()
 	}
 	if *extendOnly {
 		b.extendImage(client, streamName, expiresIn)
-		return
+		return nil
 	}
 	_, _, err := b.build(client, proto.BuildImageRequest{
 		StreamName: streamName,
 		ExpiresIn:  expiresIn,
 	},
-		nil, nil)
+		nil, priority, nil)
 	if err == nil {
-		return
+		return nil
 	}
 	// Image build failed, so extend expiration of latest image.
 	imageName, e := imgclient.FindLatestImage(client, streamName, false)
@@ -513,14 +566,15 @@ func (b *Builder) rebuildImage(client srpc.ClientI, streamName string,
 		if e == nil {
 			b.logger.Printf("Error building image: %s: %s, extended: %s\n",
 				streamName, err, imageName)
-			return
+			return err
 		}
 		b.logger.Printf(
 			"Error building image: %s: %s, failed to extend: %s: %s\n",
 			streamName, err, imageName, e)
-		return
+		return err
 	}
 	b.logger.Printf("Error building image: %s: %s\n", streamName, err)
+	return err
 }
 
 func (b *Builder) rebuildImages(rebuildInterval time.Duration,
@@ -571,7 +625,8 @@ func (b *Builder) rebuildImagesOnce(client srpc.ClientI,
 	b.logger.Println("Starting automatic image build cycle")
 	startTime := time.Now()
 	for _, streamName := range b.listStreamsToAutoRebuild() {
-		b.rebuildImage(client, streamName, expiresIn, &extendOnly)
+		b.rebuildImage(client, streamName, expiresIn, priorityAutoRebuild,
+			&extendOnly)
 	}
 	b.logger.Printf("Completed automatic image build cycle in %s\n",
 		format.Duration(time.Since(startTime)))
@@ -0,0 +1,424 @@
+package builder
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	imageclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+const buildCacheIndexFile = "build-cache-index.json"
+
+type cachedFileType struct {
+	entry   proto.BuildCacheEntry
+	modTime time.Time
+}
+
+func hashFile(pathname string) (hash.Hash, error) {
+	var hashVal hash.Hash
+	file, err := os.Open(pathname)
+	if err != nil {
+		return hashVal, err
+	}
+	defer file.Close()
+	hasher := sha512.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return hashVal, err
+	}
+	copy(hashVal[:], hasher.Sum(nil))
+	return hashVal, nil
+}
+
+func loadBuildCacheIndex(stateDir string) (*buildCacheIndex, error) {
+	index := &buildCacheIndex{
+		objects: make(map[hash.Hash]*buildCacheObject),
+		streams: make(map[string]map[string]hash.Hash),
+	}
+	if stateDir == "" {
+		return index, nil
+	}
+	index.filename = filepath.Join(stateDir, buildCacheIndexFile)
+	var data buildCacheIndexData
+	if err := json.ReadFromFile(index.filename, &data); err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	for streamName, files := range data.Streams {
+		index.streams[streamName] = files
+		for _, hashVal := range files {
+			object := index.objects[hashVal]
+			if object == nil {
+				object = &buildCacheObject{size: data.Objects[hashVal]}
+				index.objects[hashVal] = object
+			}
+			object.refcount++
+		}
+	}
+	return index, nil
+}
+
+// populateBuildCache will fetch the files listed in entries which are not
+// already present in dirname from the object server. Files which cannot be
+// fetched are skipped, since they will be re-created by the build.
+func populateBuildCache(client srpc.ClientI, dirname string,
+	entries []proto.BuildCacheEntry,
+	buildLog io.Writer) *buildCacheState {
+	state := &buildCacheState{
+		cachedFiles: make(map[string]cachedFileType, len(entries)),
+		dirname:     dirname,
+	}
+	startTime := time.Now()
+	var toFetch []proto.BuildCacheEntry
+	for _, entry := range entries {
+		pathname := state.makePathname(entry.Pathname)
+		if fi, err := os.Lstat(pathname); err == nil {
+			if fi.Mode().IsRegular() && uint64(fi.Size()) == entry.Size {
+				state.cachedFiles[entry.Pathname] = cachedFileType{
+					entry:   entry,
+					modTime: fi.ModTime(),
+				}
+				state.numLocal++
+				continue
+			}
+		}
+		toFetch = append(toFetch, entry)
+	}
+	if len(toFetch) < 1 {
+		if state.numLocal > 0 {
+			fmt.Fprintf(buildLog,
+				"Build cache: all %d files available locally\n",
+				state.numLocal)
+		}
+		return state
+	}
+	objClient := objectclient.AttachObjectClient(client)
+	defer objClient.Close()
+	if err := state.fetch(objClient, toFetch); err != nil {
+		fmt.Fprintf(buildLog, "Error fetching build cache: %s\n", err)
+	}
+	fmt.Fprintf(buildLog,
+		"Build cache: %d files available locally, fetched %d files (%s) in %s, %d missing\n",
+		state.numLocal, state.numFetched,
+		format.FormatBytes(state.fetchedBytes),
+		format.Duration(time.Since(startTime)), state.numMissing)
+	return state
+}
+
+// get returns the cache entries for the stream. If the stream has no entries,
+// the entries for the nearest ancestor stream (the stream for its source
+// image) with entries are returned, since a new stream is likely to use many
+// of the same files.
+func (index *buildCacheIndex) get(streamName string,
+	streamToSource map[string]string) *proto.BuildCache {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	files := index.streams[streamName]
+	for depth := 0; len(files) < 1 && depth < len(streamToSource); depth++ {
+		source, ok := streamToSource[streamName]
+		if !ok {
+			break
+		}
+		streamName = source
+		files = index.streams[streamName]
+	}
+	if len(files) < 1 {
+		return nil
+	}
+	cache := &proto.BuildCache{
+		Entries: make([]proto.BuildCacheEntry, 0, len(files)),
+	}
+	for pathname, hashVal := range files {
+		cache.Entries = append(cache.Entries, proto.BuildCacheEntry{
+			Hash:     hashVal,
+			Pathname: pathname,
+			Size:     index.objects[hashVal].size,
+		})
+	}
+	sort.Slice(cache.Entries, func(left, right int) bool {
+		return cache.Entries[left].Pathname < cache.Entries[right].Pathname
+	})
+	return cache
+}
+
+// update will replace the cache entries for the stream. Objects which are no
+// longer used by any stream are forgotten.
+func (index *buildCacheIndex) update(streamName string,
+	cache *proto.BuildCache) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	for _, hashVal := range index.streams[streamName] {
+		if object := index.objects[hashVal]; object.refcount > 1 {
+			object.refcount--
+		} else {
+			delete(index.objects, hashVal)
+		}
+	}
+	delete(index.streams, streamName)
+	if cache != nil && len(cache.Entries) > 0 {
+		files := make(map[string]hash.Hash, len(cache.Entries))
+		for _, entry := range cache.Entries {
+			files[entry.Pathname] = entry.Hash
+			object := index.objects[entry.Hash]
+			if object == nil {
+				object = &buildCacheObject{size: entry.Size}
+				index.objects[entry.Hash] = object
+			}
+			object.refcount++
+		}
+		index.streams[streamName] = files
+	}
+	if index.filename == "" {
+		return nil
+	}
+	data := buildCacheIndexData{
+		Objects: make(map[hash.Hash]uint64, len(index.objects)),
+		Streams: index.streams,
+	}
+	for hashVal, object := range index.objects {
+		data.Objects[hashVal] = object.size
+	}
+	return json.WriteToFile(index.filename, fsutil.PublicFilePerms, "    ",
+		data)
+}
+
+// collect will scan the cache directory and upload new files to the object
+// server. All the files are added to the build cache of the image server. The
+// entries for all the files are returned.
+func (state *buildCacheState) collect(client srpc.ClientI,
+	buildLog io.Writer) ([]proto.BuildCacheEntry, error) {
+	var entries, newEntries []proto.BuildCacheEntry
+	var numReused uint
+	err := filepath.WalkDir(state.dirname,
+		func(pathname string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if fi.Size() < 1 {
+				return nil
+			}
+			relativePathname, err := filepath.Rel(state.dirname, pathname)
+			if err != nil {
+				return err
+			}
+			cachedFile, ok := state.cachedFiles[relativePathname]
+			if ok && cachedFile.entry.Size == uint64(fi.Size()) &&
+				cachedFile.modTime.Equal(fi.ModTime()) {
+				entries = append(entries, cachedFile.entry)
+				numReused++
+				return nil
+			}
+			hashVal, err := hashFile(pathname)
+			if err != nil {
+				return err
+			}
+			newEntries = append(newEntries, proto.BuildCacheEntry{
+				Hash:     hashVal,
+				Pathname: relativePathname,
+				Size:     uint64(fi.Size()),
+			})
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	numFiles := numReused + uint(len(newEntries))
+	if numFiles < 1 {
+		return nil, nil
+	}
+	objClient := objectclient.AttachObjectClient(client)
+	defer objClient.Close()
+	numUploaded, uploadedBytes, err := state.upload(objClient, newEntries)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, newEntries...)
+	hashes := make([]hash.Hash, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+	// The objects are not used by any image, so keep them in the build cache
+	// of the image server so that they are not garbage collected.
+	if err := imageclient.AddBuildCacheObjects(client, hashes); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(left, right int) bool {
+		return entries[left].Pathname < entries[right].Pathname
+	})
+	fmt.Fprintf(buildLog,
+		"Build cache: %d of %d files reused (hit rate: %d%%), %d new files, uploaded %d (%s)\n",
+		numReused, numFiles, numReused*100/numFiles, len(newEntries),
+		numUploaded, format.FormatBytes(uploadedBytes))
+	return entries, nil
+}
+
+func (state *buildCacheState) fetch(objClient *objectclient.ObjectClient,
+	entries []proto.BuildCacheEntry) error {
+	hashes := make([]hash.Hash, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+	sizes, err := objClient.CheckObjects(hashes)
+	if err != nil {
+		state.numMissing = uint(len(entries))
+		return err
+	}
+	hashes = hashes[:0]
+	var available []proto.BuildCacheEntry
+	for index, entry := range entries {
+		if sizes[index] < 1 {
+			state.numMissing++
+		} else {
+			available = append(available, entry)
+			hashes = append(hashes, entry.Hash)
+		}
+	}
+	if len(available) < 1 {
+		return nil
+	}
+	objectsReader, err := objClient.GetObjects(hashes)
+	if err != nil {
+		state.numMissing += uint(len(available))
+		return err
+	}
+	defer objectsReader.Close()
+	for index, entry := range available {
+		size, reader, err := objectsReader.NextObject()
+		if err != nil {
+			state.numMissing += uint(len(available) - index)
+			return err
+		}
+		pathname := state.makePathname(entry.Pathname)
+		err = os.MkdirAll(filepath.Dir(pathname), fsutil.DirPerms)
+		if err == nil {
+			err = fsutil.CopyToFile(pathname, fsutil.PublicFilePerms, reader,
+				size)
+		}
+		reader.Close()
+		if err != nil {
+			state.numMissing += uint(len(available) - index)
+			return err
+		}
+		fi, err := os.Lstat(pathname)
+		if err != nil {
+			state.numMissing += uint(len(available) - index)
+			return err
+		}
+		state.cachedFiles[entry.Pathname] = cachedFileType{
+			entry:   entry,
+			modTime: fi.ModTime(),
+		}
+		state.fetchedBytes += size
+		state.numFetched++
+	}
+	return nil
+}
+
+// makePathname returns the full pathname for a cache entry, ensuring that it
+// is within the cache directory.
+func (state *buildCacheState) makePathname(relativePathname string) string {
+	return filepath.Join(state.dirname,
+		filepath.Clean(string(filepath.Separator)+relativePathname))
+}
+
+// upload will upload the files for the entries which are not already present
+// in the object server.
+func (state *buildCacheState) upload(objClient *objectclient.ObjectClient,
+	entries []proto.BuildCacheEntry) (uint, uint64, error) {
+	if len(entries) < 1 {
+		return 0, 0, nil
+	}
+	hashes := make([]hash.Hash, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+	sizes, err := objClient.CheckObjects(hashes)
+	if err != nil {
+		return 0, 0, err
+	}
+	var numUploaded uint
+	var uploadedBytes uint64
+	for index, entry := range entries {
+		if sizes[index] > 0 {
+			continue
+		}
+		file, err := os.Open(state.makePathname(entry.Pathname))
+		if err != nil {
+			return 0, 0, err
+		}
+		_, _, err = objClient.AddObject(file, entry.Size, &entry.Hash)
+		file.Close()
+		if err != nil {
+			return 0, 0, err
+		}
+		numUploaded++
+		uploadedBytes += entry.Size
+	}
+	return numUploaded, uploadedBytes, nil
+}
+
+// getBuildCache returns the remote build cache for the stream.
+func (b *Builder) getBuildCache(streamName string) *proto.BuildCache {
+	var streamToSource map[string]string
+	if dependencyData := b.getDependencyData(0); dependencyData != nil {
+		streamToSource = dependencyData.streamToSource
+	}
+	return b.buildCacheIndex.get(streamName, streamToSource)
+}
+
+// getBuildCacheEntries returns the remote build cache entries for the stream.
+// When building on behalf of another builder, the cache is provided in the
+// request.
+func (b *Builder) getBuildCacheEntries(
+	request proto.BuildImageRequest) []proto.BuildCacheEntry {
+	cache := request.BuildCache
+	if !request.ReturnImage {
+		cache = b.getBuildCache(request.StreamName)
+	}
+	if cache == nil {
+		return nil
+	}
+	return cache.Entries
+}
+
+// saveBuildCache will save the remote build cache for the stream. When
+// building on behalf of another builder, the cache is reported back to the
+// other builder.
+func (b *Builder) saveBuildCache(request proto.BuildImageRequest,
+	cache *proto.BuildCache, buildLog io.Writer) error {
+	if request.ReturnImage {
+		if reporter, ok := buildLog.(BuildCacheReporter); ok {
+			return reporter.ReportBuildCache(cache)
+		}
+		return nil
+	}
+	return b.buildCacheIndex.update(request.StreamName, cache)
+}
+
+func (bl *dualBuildLogger) ReportBuildCache(cache *proto.BuildCache) error {
+	if reporter, ok := bl.logWriter.(BuildCacheReporter); ok {
+		return reporter.ReportBuildCache(cache)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package builder
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+func TestBuildCacheIndex(t *testing.T) {
+	stateDir := t.TempDir()
+	index, err := loadBuildCacheIndex(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := proto.BuildCacheEntry{Hash: hash.Hash{1}, Pathname: "apt/a.deb",
+		Size: 10}
+	err = index.update("base", &proto.BuildCache{
+		Entries: []proto.BuildCacheEntry{shared,
+			{Hash: hash.Hash{2}, Pathname: "apt/b.deb", Size: 20}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = index.update("other", &proto.BuildCache{
+		Entries: []proto.BuildCacheEntry{shared},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.objects) != 2 || index.objects[shared.Hash].refcount != 2 {
+		t.Errorf("shared object not counted once per stream: %v",
+			index.objects)
+	}
+	index, err = loadBuildCacheIndex(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Builder{
+		buildCacheIndex: index,
+		dependencyData: &dependencyDataType{
+			streamToSource: map[string]string{"base/app": "base"},
+		},
+	}
+	request := proto.BuildImageRequest{StreamName: "base"}
+	if got := b.getBuildCacheEntries(request); len(got) != 2 ||
+		got[0] != shared || got[1].Size != 20 {
+		t.Errorf("unexpected entries after reload: %v", got)
+	}
+	// A new stream starts with the cache of its source image stream.
+	request.StreamName = "base/app"
+	if got := b.getBuildCacheEntries(request); len(got) != 2 {
+		t.Errorf("entries not inherited from source stream: %v", got)
+	}
+	request.ReturnImage = true
+	if got := b.getBuildCacheEntries(request); len(got) != 0 {
+		t.Errorf("entries from index for slave build: %v", got)
+	}
+	if err := index.update("base", nil); err != nil {
+		t.Fatal(err)
+	}
+	if object := index.objects[shared.Hash]; object == nil ||
+		object.refcount != 1 {
+		t.Errorf("shared object: %v, want refcount 1", object)
+	}
+	if _, ok := index.objects[hash.Hash{2}]; ok {
+		t.Error("unused object not forgotten")
+	}
+}
+
+func TestBuildCacheMakePathname(t *testing.T) {
+	state := &buildCacheState{dirname: "/cache/stream"}
+	if pathname := state.makePathname("../../etc/passwd"); pathname !=
+		filepath.Join("/cache/stream", "etc/passwd") {
+		t.Errorf("pathname escaped cache directory: %s", pathname)
+	}
+}
@@ -0,0 +1,260 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func newRebuildCascade(rebuildInterval time.Duration) *rebuildCascadeType {
+	expiresIn := time.Hour
+	if rebuildInterval > 0 {
+		expiresIn = 2 * rebuildInterval
+	}
+	return &rebuildCascadeType{
+		building:  make(map[string]struct{}),
+		expiresIn: expiresIn,
+		failed:    make(map[string]error),
+		pending:   make(map[string]struct{}),
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// hasAncestor returns true if any ancestor of streamName is in one of the
+// specified sets.
+func hasAncestor(streamToSource map[string]string, streamName string,
+	sets ...map[string]struct{}) bool {
+	var depth int
+	for source, ok := streamToSource[streamName]; ok; source, ok =
+		streamToSource[source] {
+		for _, set := range sets {
+			if _, ok := set[source]; ok {
+				return true
+			}
+		}
+		if depth++; depth > len(streamToSource) {
+			break // Break cycles.
+		}
+	}
+	return false
+}
+
+func (rc *rebuildCascadeType) wake() {
+	select {
+	case rc.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// cascadeRebuild is called after a build has completed. If successful and a
+// new image was uploaded, the streams which depend on streamName are queued for
+// rebuilding. Failures are recorded so that they are shown on the graph.
+func (b *Builder) cascadeRebuild(streamName string, priority buildPriority,
+	imageUnchanged bool, buildError error) {
+	rc := b.rebuildCascade
+	if rc == nil {
+		return
+	}
+	if buildError != nil {
+		rc.mutex.Lock()
+		rc.failed[streamName] = buildError
+		rc.mutex.Unlock()
+		return
+	}
+	if imageUnchanged {
+		rc.mutex.Lock()
+		delete(rc.failed, streamName)
+		rc.mutex.Unlock()
+		return
+	}
+	dependencyData := b.getDependencyData(0)
+	if dependencyData == nil {
+		return
+	}
+	var dependents []string
+	for name, source := range dependencyData.streamToSource {
+		if source == streamName {
+			dependents = append(dependents, name)
+		}
+	}
+	switch priority {
+	case priorityAutoRebuild:
+		// Streams which are automatically rebuilt will be built later in the
+		// same cycle, so only queue the others.
+		autoRebuild := make(map[string]struct{})
+		for _, name := range b.listStreamsToAutoRebuild() {
+			autoRebuild[name] = struct{}{}
+		}
+		dependents = filterStreams(dependents, func(name string) bool {
+			_, ok := autoRebuild[name]
+			return !ok
+		})
+	case priorityDependency:
+		// The stream which needed this source image is already building with
+		// it, so do not build it again.
+		b.buildResultsLock.RLock()
+		dependents = filterStreams(dependents, func(name string) bool {
+			_, ok := b.currentBuildInfos[name]
+			return !ok
+		})
+		b.buildResultsLock.RUnlock()
+	}
+	rc.mutex.Lock()
+	delete(rc.failed, streamName)
+	for _, name := range dependents {
+		rc.pending[name] = struct{}{}
+	}
+	rc.mutex.Unlock()
+	if len(dependents) > 0 {
+		b.logger.Debugf(0, "built: %s, queueing dependents: %v\n",
+			streamName, dependents)
+		rc.wake()
+	}
+}
+
+// filterStreams returns the stream names for which keep returns true.
+func filterStreams(streamNames []string, keep func(string) bool) []string {
+	filtered := streamNames[:0]
+	for _, streamName := range streamNames {
+		if keep(streamName) {
+			filtered = append(filtered, streamName)
+		}
+	}
+	return filtered
+}
+
+func (b *Builder) getRebuildCascadeFailures() map[string]error {
+	rc := b.rebuildCascade
+	if rc == nil {
+		return nil
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	failures := make(map[string]error, len(rc.failed))
+	for streamName, err := range rc.failed {
+		failures[streamName] = err
+	}
+	return failures
+}
+
+func (b *Builder) rebuildCascadeLoop() {
+	client, _ := dialServer(b.imageServerAddress, 0)
+	for range b.rebuildCascade.trigger {
+		b.startCascadeBuilds(client)
+	}
+}
+
+// startCascadeBuilds will start builds of the streams selected by
+// selectBuilds.
+func (b *Builder) startCascadeBuilds(client srpc.ClientI) {
+	rc := b.rebuildCascade
+	dependencyData := b.getDependencyData(0)
+	if dependencyData == nil {
+		return
+	}
+	for _, streamName := range rc.selectBuilds(dependencyData.streamToSource) {
+		b.logger.Printf("Rebuilding: %s after source was built\n", streamName)
+		go func(streamName string) {
+			var extendOnly bool
+			b.rebuildImage(client, streamName, rc.expiresIn, priorityCascade,
+				&extendOnly)
+			rc.mutex.Lock()
+			delete(rc.building, streamName)
+			rc.mutex.Unlock()
+			rc.wake()
+		}(streamName)
+	}
+}
+
+// selectBuilds will move the pending streams which do not have an ancestor
+// which is pending or building to the building set and returns them, sorted by
+// name. Streams with such an ancestor are left pending, so that they are built
+// once the ancestor has completed, since the selected streams are built
+// concurrently. Streams which are already building are also left pending, so
+// that they are built again once the current build has completed.
+func (rc *rebuildCascadeType) selectBuilds(
+	streamToSource map[string]string) []string {
+	var streamNames []string
+	rc.mutex.Lock()
+	for streamName := range rc.pending {
+		if _, ok := rc.building[streamName]; ok {
+			continue
+		}
+		if hasAncestor(streamToSource, streamName, rc.pending, rc.building) {
+			continue
+		}
+		streamNames = append(streamNames, streamName)
+	}
+	for _, streamName := range streamNames {
+		delete(rc.pending, streamName)
+		rc.building[streamName] = struct{}{}
+	}
+	rc.mutex.Unlock()
+	sort.Strings(streamNames)
+	return streamNames
+}
+
+func (b *Builder) writeRebuildCascadeHtml(writer io.Writer) {
+	rc := b.rebuildCascade
+	if rc == nil {
+		return
+	}
+	rc.mutex.Lock()
+	numPending := len(rc.pending)
+	numBuilding := len(rc.building)
+	numFailed := len(rc.failed)
+	rc.mutex.Unlock()
+	if numPending+numBuilding+numFailed < 1 {
+		return
+	}
+	fmt.Fprintf(writer,
+		"Cascading rebuilds: %d pending, %d building, %d failed<br>\n",
+		numPending, numBuilding, numFailed)
+}
+
+// writeRebuildCascadeFailures will mark streams which failed to rebuild in a
+// cascade in red and their dependents, which were not rebuilt, in orange.
+func writeRebuildCascadeFailures(writer io.Writer,
+	streamToSource map[string]string, failures map[string]error,
+	excludedStreams map[string]struct{}) {
+	if len(failures) < 1 {
+		return
+	}
+	streamToDependents := make(map[string][]string)
+	for stream, source := range streamToSource {
+		streamToDependents[source] = append(streamToDependents[source], stream)
+	}
+	blockedStreams := make(map[string]struct{})
+	for streamName := range failures {
+		walkDependents(streamToDependents, streamName, func(name string) {
+			if _, ok := failures[name]; !ok {
+				blockedStreams[name] = struct{}{}
+			}
+		})
+	}
+	streamNames := make([]string, 0, len(failures))
+	for streamName := range failures {
+		streamNames = append(streamNames, streamName)
+	}
+	sort.Strings(streamNames)
+	for _, streamName := range streamNames {
+		if _, ok := excludedStreams[streamName]; !ok {
+			fmt.Fprintf(writer, "  \"%s\" [color=red, tooltip=%s]\n",
+				streamName, strconv.Quote(failures[streamName].Error()))
+		}
+	}
+	streamNames = streamNames[:0]
+	for streamName := range blockedStreams {
+		streamNames = append(streamNames, streamName)
+	}
+	sort.Strings(streamNames)
+	for _, streamName := range streamNames {
+		if _, ok := excludedStreams[streamName]; !ok {
+			fmt.Fprintf(writer, "  \"%s\" [color=orange]\n", streamName)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package builder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+)
+
+func TestHasAncestor(t *testing.T) {
+	streamToSource := map[string]string{
+		"base/app":     "base",
+		"base/app/web": "base/app",
+		"loop/a":       "loop/b",
+		"loop/b":       "loop/a",
+	}
+	pending := map[string]struct{}{"base": {}}
+	if !hasAncestor(streamToSource, "base/app/web", pending) {
+		t.Error("base is not an ancestor of base/app/web")
+	}
+	if hasAncestor(streamToSource, "base", pending) {
+		t.Error("base is an ancestor of itself")
+	}
+	if hasAncestor(streamToSource, "loop/a", pending) {
+		t.Error("base is an ancestor of loop/a")
+	}
+}
+
+func TestCascadeRebuild(t *testing.T) {
+	b := &Builder{
+		currentBuildInfos: make(map[string]*currentBuildInfo),
+		dependencyData: &dependencyDataType{
+			streamToSource: map[string]string{
+				"base/app":     "base",
+				"base/app/web": "base/app",
+				"base/db":      "base",
+				"base/timer":   "base",
+			},
+		},
+		imageStreamsToAutoRebuild: []string{"base", "base/timer"},
+		logger:                    testlogger.New(t),
+		rebuildCascade:            newRebuildCascade(0),
+	}
+	rc := b.rebuildCascade
+	b.cascadeRebuild("base", priorityAutoRebuild, false, nil)
+	expectStreams(t, "auto-rebuild", rc.pending, "base/app", "base/db")
+	b.cascadeRebuild("base/app", priorityCascade, false, nil)
+	b.cascadeRebuild("base/app", priorityCascade, false, nil)
+	expectStreams(t, "coalesced", rc.pending,
+		"base/app", "base/app/web", "base/db")
+	selected := rc.selectBuilds(b.dependencyData.streamToSource)
+	if len(selected) != 2 ||
+		selected[0] != "base/app" || selected[1] != "base/db" {
+		t.Errorf("selected: %v != [base/app base/db]", selected)
+	}
+	expectStreams(t, "building", rc.building, "base/app", "base/db")
+	expectStreams(t, "pending after select", rc.pending, "base/app/web")
+	b.cascadeRebuild("base", priorityAutoRebuild, false, nil)
+	if selected := rc.selectBuilds(b.dependencyData.streamToSource); len(
+		selected) != 0 {
+		t.Errorf("selected: %v while ancestor building", selected)
+	}
+	expectStreams(t, "pending while building", rc.pending,
+		"base/app", "base/app/web", "base/db")
+	// Once base/app has been built, it is built again because it was queued
+	// while building, and only then is its dependent built.
+	delete(rc.building, "base/app")
+	selected = rc.selectBuilds(b.dependencyData.streamToSource)
+	if len(selected) != 1 || selected[0] != "base/app" {
+		t.Errorf("selected: %v != [base/app]", selected)
+	}
+	expectStreams(t, "pending while rebuilding", rc.pending,
+		"base/app/web", "base/db")
+	delete(rc.building, "base/app")
+	selected = rc.selectBuilds(b.dependencyData.streamToSource)
+	if len(selected) != 1 || selected[0] != "base/app/web" {
+		t.Errorf("selected: %v != [base/app/web]", selected)
+	}
+	expectStreams(t, "pending after ancestors built", rc.pending, "base/db")
+	b.cascadeRebuild("base/db", priorityCascade, false, errors.New("failed"))
+	if _, ok := rc.failed["base/db"]; !ok {
+		t.Error("base/db failure not recorded")
+	}
+	b.cascadeRebuild("base/db", priorityRequest, true, nil)
+	if _, ok := rc.failed["base/db"]; ok {
+		t.Error("base/db failure not cleared")
+	}
+}
+
+func expectStreams(t *testing.T, name string, set map[string]struct{},
+	streamNames ...string) {
+	if len(set) != len(streamNames) {
+		t.Errorf("%s: %v != %v", name, set, streamNames)
+		return
+	}
+	for _, streamName := range streamNames {
+		if _, ok := set[streamName]; !ok {
+			t.Errorf("%s: %v != %v", name, set, streamNames)
+			return
+		}
+	}
+}
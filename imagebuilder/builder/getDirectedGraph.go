@@ -394,11 +394,13 @@ func (b *Builder) getDirectedGraph(request proto.GetDirectedGraphRequest) (
 		}
 	}
 	// Mark streams which are auto rebuilt in bold.
-	for _, streamName := range b.imageStreamsToAutoRebuild {
+	for _, streamName := range b.listStreamsToAutoRebuild() {
 		if _, ok := excludedStreams[streamName]; !ok {
 			fmt.Fprintf(buffer, "  \"%s\" [style=bold]\n", streamName)
 		}
 	}
+	writeRebuildCascadeFailures(buffer, dependencyData.streamToSource,
+		b.getRebuildCascadeFailures(), excludedStreams)
 	fmt.Fprintln(buffer, "}")
 	return proto.GetDirectedGraphResult{
 		FetchLog:         dependencyData.lastAttemptFetchLog,
@@ -16,6 +16,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
 	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	libjson "github.com/Cloud-Foundations/Dominator/lib/json"
 	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
 )
@@ -31,6 +32,16 @@ func streamNameText(streamName string,
 	}
 }
 
+func testResultsText(streamName string,
+	testResults *testresults.Results) string {
+	if testResults == nil {
+		return ""
+	}
+	numPassed, numFailed, _ := testResults.Count()
+	return fmt.Sprintf("<a href=\"showLatestTestResults?%s\">%d/%d passed</a>",
+		streamName, numPassed, numPassed+numFailed)
+}
+
 func writeFilter(writer io.Writer, prefix string, filt *filter.Filter) {
 	if filt != nil && len(filt.FilterLines) > 0 {
 		fmt.Fprintln(writer, prefix, "Filter lines:<br>")
@@ -82,6 +93,24 @@ func (b *Builder) showImageStream(writer io.Writer, streamName string) {
 	stream.WriteHtml(writer)
 }
 
+func (b *Builder) showLatestTestResults(writer io.Writer, streamName string) {
+	b.buildResultsLock.RLock()
+	result, ok := b.lastBuildResults[streamName]
+	b.buildResultsLock.RUnlock()
+	if !ok {
+		fmt.Fprintf(writer, "<b>No build for stream: %s</b>\n", streamName)
+		return
+	}
+	if result.testResults == nil {
+		fmt.Fprintf(writer, "<b>No test results for stream: %s</b>\n",
+			streamName)
+		return
+	}
+	fmt.Fprintf(writer, "<h3>Latest test results for stream: %s</h3>\n",
+		streamName)
+	result.testResults.WriteHtml(writer)
+}
+
 func (b *Builder) showImageStreams(writer io.Writer) {
 	streamNames := b.listAllStreamNames()
 	sort.Strings(streamNames)
@@ -181,6 +210,8 @@ func (b *Builder) writeHtml(writer io.Writer) {
 		tw.Close()
 		fmt.Fprintln(writer, "<br>")
 	}
+	b.writeBuildQueueHtml(writer, autoRebuildStreams)
+	b.writeRebuildCascadeHtml(writer)
 	if len(failedBuilds) > 0 {
 		streamNames := make([]string, 0, len(failedBuilds))
 		for streamName := range failedBuilds {
@@ -192,7 +223,8 @@ func (b *Builder) writeHtml(writer io.Writer) {
 			format.Duration(time.Since(lastFailedBuild)))
 		fmt.Fprintln(writer, `<table border="1">`)
 		tw, _ := html.NewTableWriter(writer, true,
-			"Image Stream", "Error", "Build log", "Duration", "Last attempt")
+			"Image Stream", "Error", "Build log", "Tests", "Duration",
+			"Last attempt")
 		for _, streamName := range streamNames {
 			result := failedBuilds[streamName]
 			tw.WriteRow("", "",
@@ -200,6 +232,7 @@ func (b *Builder) writeHtml(writer io.Writer) {
 				result.error.Error(),
 				fmt.Sprintf("<a href=\"showLastBuildLog?%s\">log</a>",
 					streamName),
+				testResultsText(streamName, result.testResults),
 				format.Duration(result.finishTime.Sub(result.startTime)),
 				fmt.Sprintf("%s ago",
 					format.Duration(currentTime.Sub(result.finishTime))),
@@ -217,7 +250,7 @@ func (b *Builder) writeHtml(writer io.Writer) {
 		fmt.Fprintln(writer, "Successful image builds:<br>")
 		fmt.Fprintln(writer, `<table border="1">`)
 		tw, _ := html.NewTableWriter(writer, true, "Image Stream", "Name",
-			"Build log", "Duration", "Age")
+			"Build log", "Tests", "Duration", "Age")
 		for _, streamName := range streamNames {
 			result := goodBuilds[streamName]
 			tw.WriteRow("", "",
@@ -227,6 +260,7 @@ func (b *Builder) writeHtml(writer io.Writer) {
 					result.imageName),
 				fmt.Sprintf("<a href=\"showLastBuildLog?%s\">log</a>",
 					streamName),
+				testResultsText(streamName, result.testResults),
 				format.Duration(result.finishTime.Sub(result.startTime)),
 				fmt.Sprintf("%s ago",
 					format.Duration(currentTime.Sub(result.finishTime))),
@@ -250,6 +284,16 @@ func (stream *imageStreamType) WriteHtml(writer io.Writer) {
 		fmt.Fprintf(writer, "BuilderUsers: %s<br>\n",
 			strings.Join(stream.BuilderUsers, ", "))
 	}
+	if policy := stream.TestPolicy; policy.MaximumFailures > 0 ||
+		len(policy.IgnoreFailures) > 0 {
+		fmt.Fprintf(writer, "Test policy: maximum failures: %d",
+			policy.MaximumFailures)
+		if len(policy.IgnoreFailures) > 0 {
+			fmt.Fprintf(writer, ", ignored failures: %s",
+				strings.Join(policy.IgnoreFailures, ", "))
+		}
+		fmt.Fprintln(writer, "<br>")
+	}
 	manifestLocation := stream.getManifestLocation(nil, nil)
 	fmt.Fprintf(writer, "Manifest URL: <code>%s</code><br>\n",
 		stream.ManifestUrl)
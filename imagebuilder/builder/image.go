@@ -25,6 +25,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
 	"github.com/Cloud-Foundations/Dominator/lib/gitutil"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/changelog"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
@@ -53,12 +54,17 @@ func (stream *imageStreamType) build(b *Builder, client srpc.ClientI,
 		request.MaximumBuildDuration)
 	defer cancel()
 	bindMounts := convertBindMounts(b.bindMounts)
+	var remoteCache *buildCacheState
 	if b.cache.BaseDirectory != "" && b.cache.MountPoint != "" {
 		sourceDir := filepath.Join(b.cache.BaseDirectory,
 			filepath.Clean(request.StreamName))
 		if err := os.MkdirAll(sourceDir, fsutil.DirPerms); err != nil {
 			return nil, err
 		}
+		if b.cache.Remote {
+			remoteCache = populateBuildCache(client, sourceDir,
+				b.getBuildCacheEntries(request), buildLog)
+		}
 		bindMounts = append(bindMounts, bindMountType{
 			source:   sourceDir,
 			target:   b.cache.MountPoint,
@@ -78,6 +84,19 @@ func (stream *imageStreamType) build(b *Builder, client srpc.ClientI,
 			return nil, err
 		}
 	}
+	if remoteCache != nil {
+		// Failure to update the remote cache should not fail the build.
+		if entries, err := remoteCache.collect(client, buildLog); err != nil {
+			fmt.Fprintf(buildLog, "Error updating build cache: %s\n", err)
+		} else {
+			err := b.saveBuildCache(request,
+				&proto.BuildCache{Entries: entries}, buildLog)
+			if err != nil {
+				fmt.Fprintf(buildLog, "Error saving build cache index: %s\n",
+					err)
+			}
+		}
+	}
 	return img, nil
 }
 
@@ -383,9 +402,14 @@ func buildImageFromManifest(ctx context.Context, client srpc.ClientI,
 		return nil, err
 	}
 	defer g.Quit()
+	changelogParams, err := makeChangelogParams(manifestDir, gitInfo)
+	if err != nil {
+		return nil, err
+	}
 	img, err := packImage(ctx, g, client, request, rootDir, manifest.filter,
 		manifest.sourceImageInfo.treeCache, computedFilesList, imageFilter,
-		owners, tgs, imageTriggers, mtimesCopyFilter, buildLog, logger)
+		owners, tgs, imageTriggers, mtimesCopyFilter, changelogParams,
+		buildLog, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -405,6 +429,7 @@ func buildImageFromManifestAndUpload(ctx context.Context, client srpc.ClientI,
 		StreamName: streamName,
 		ExpiresIn:  expiresIn,
 	}
+	testResultsLog := &testResultsLogger{buildLogger: buildLog}
 	img, err := buildImageFromManifest(
 		ctx,
 		client,
@@ -419,11 +444,15 @@ func buildImageFromManifestAndUpload(ctx context.Context, client srpc.ClientI,
 		},
 		nil,
 		options.MtimesCopyFilter,
-		buildLog,
+		testResultsLog,
 		logger)
 	if err != nil {
 		return nil, "", err
 	}
+	err = testPolicyType{}.check(testResultsLog.testResults, buildLog)
+	if err != nil {
+		return nil, "", err
+	}
 	name, err := addImage(client, request, img)
 	if err != nil {
 		return nil, "", err
@@ -624,6 +653,35 @@ func loadTriggers(manifestDir string) (*triggers.Triggers, bool, error) {
 	}
 }
 
+// makeChangelogParams will list the files in the files tree of the manifest.
+func makeChangelogParams(manifestDir string, gitInfo *gitInfoType) (
+	*changelog.Params, error) {
+	params := &changelog.Params{}
+	if gitInfo != nil {
+		params.CommitId = gitInfo.commitId
+		params.GitUrl = gitInfo.gitUrl
+	}
+	filesDir := filepath.Join(manifestDir, "files")
+	err := filepath.Walk(filesDir,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == filesDir {
+					return nil
+				}
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			params.Files = append(params.Files, path[len(filesDir):])
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
 func unpackImage(client srpc.ClientI, streamName, buildCommitId string,
 	sourceImageTagsToMatch tags.MatchTags, maxSourceAge time.Duration,
 	rootDir string, buildLog io.Writer, logger log.Logger) (
@@ -0,0 +1,658 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/util"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/pathregexp"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	"github.com/Cloud-Foundations/Dominator/lib/verstr"
+)
+
+// knownManifestComponents lists the components documented in
+// user-guide/image-manifest.md.
+var knownManifestComponents = map[string]struct{}{
+	"computed-files":            {},
+	"computed-files.add":        {},
+	"computed-files.add.json":   {},
+	"computed-files.json":       {},
+	"files":                     {},
+	"files.append":              {},
+	"filter":                    {},
+	"filter.add":                {},
+	"manifest":                  {},
+	"owners.json":               {},
+	"package-list":              {},
+	"post-cleanup-scripts":      {},
+	"post-install-files":        {},
+	"post-install-files.append": {},
+	"post-scripts-files":        {},
+	"pre-install-scripts":       {},
+	"scripts":                   {},
+	"tags.json":                 {},
+	"tests":                     {},
+	"triggers":                  {},
+	"triggers.add":              {},
+}
+
+type manifestLinter struct {
+	manifestDir    string
+	envGetter      environmentGetter
+	imageFilter    *filter.Filter // From the filter or filter.add file.
+	manifestFilter *filter.Filter // From FilterLines in manifest file.
+	mayCreateFiles bool           // Packages or scripts are present.
+	messages       []LintMessage
+	paths          map[string]os.FileMode // Key: path in image.
+	sourceFS       *filesystem.FileSystem // May be nil.
+	sourcePaths    filesystem.FilenameToInodeTable
+}
+
+func exists(pathname string) bool {
+	_, err := os.Lstat(pathname)
+	return err == nil
+}
+
+func lintManifest(client srpc.ClientI, manifestDir string,
+	envGetter environmentGetter, logger log.Logger) ([]LintMessage, error) {
+	l := &manifestLinter{
+		envGetter:   envGetter,
+		manifestDir: manifestDir,
+		paths:       make(map[string]os.FileMode),
+	}
+	manifestConfig := l.lintManifestFile()
+	if client != nil && manifestConfig != nil &&
+		manifestConfig.SourceImage != "" {
+		err := l.loadSourceImage(client, *manifestConfig, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l.lintComponents()
+	return l.messages, nil
+}
+
+func (m LintMessage) String() string {
+	level := "warning"
+	if m.IsError {
+		level = "error"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, m.Component, m.Message)
+}
+
+func (l *manifestLinter) errorf(component, format string, v ...interface{}) {
+	l.messages = append(l.messages, LintMessage{
+		Component: component,
+		IsError:   true,
+		Message:   fmt.Sprintf(format, v...),
+	})
+}
+
+func (l *manifestLinter) warningf(component, format string,
+	v ...interface{}) {
+	l.messages = append(l.messages, LintMessage{
+		Component: component,
+		Message:   fmt.Sprintf(format, v...),
+	})
+}
+
+// checkPathInImage will check if the path will exist in the image, based on
+// the manifest file trees and the source image (if available). The file type
+// bits and true are returned if the path exists.
+func (l *manifestLinter) checkPathInImage(pathname string) (
+	os.FileMode, bool) {
+	if mode, ok := l.paths[pathname]; ok {
+		return mode, true
+	}
+	if l.sourceFS == nil {
+		return 0, false
+	}
+	inum, ok := l.sourcePaths[pathname]
+	if !ok {
+		return 0, false
+	}
+	return inodeFileMode(l.sourceFS.InodeTable[inum]), true
+}
+
+// inodeFileMode returns the file type bits for the specified inode. Computed
+// files are treated as regular files.
+func inodeFileMode(inode filesystem.GenericInode) os.FileMode {
+	switch inode.(type) {
+	case *filesystem.DirectoryInode:
+		return os.ModeDir
+	case *filesystem.SymlinkInode:
+		return os.ModeSymlink
+	case *filesystem.RegularInode, *filesystem.ComputedRegularInode:
+		return 0
+	}
+	return os.ModeDevice
+}
+
+func (l *manifestLinter) lintComponents() {
+	l.lintDirectoryEntries()
+	l.lintFileTree("files", false)
+	l.lintFileTree("files.append", true)
+	l.lintScripts("pre-install-scripts")
+	l.lintPackageList()
+	l.lintFileTree("post-install-files", false)
+	l.lintFileTree("post-install-files.append", true)
+	l.lintScripts("scripts")
+	l.lintFileTree("post-scripts-files", false)
+	l.lintScripts("post-cleanup-scripts")
+	l.lintFilter()
+	l.lintComputedFiles()
+	l.lintOwners()
+	l.lintTags()
+	l.lintTriggers()
+	l.lintTests()
+}
+
+func (l *manifestLinter) lintComputedFiles() {
+	computedFiles, component := l.loadComputedFiles("computed-files")
+	addComputedFiles, addComponent := l.loadComputedFiles(
+		"computed-files.add")
+	if component != "" && addComponent != "" {
+		l.errorf(addComponent, "must not be present with %s", component)
+	}
+	l.lintComputedFilesList(component, computedFiles)
+	l.lintComputedFilesList(addComponent, addComputedFiles)
+}
+
+func (l *manifestLinter) lintComputedFilesList(component string,
+	computedFiles []util.ComputedFile) {
+	filenames := make(map[string]struct{}, len(computedFiles))
+	for _, computedFile := range computedFiles {
+		filename := computedFile.Filename
+		if !filepath.IsAbs(filename) {
+			l.errorf(component, "%s: not an absolute path", filename)
+			continue
+		}
+		if filepath.Clean(filename) != filename {
+			l.errorf(component, "%s: not a clean path", filename)
+			continue
+		}
+		if computedFile.Source == "" {
+			l.errorf(component, "%s: no Source", filename)
+		}
+		if _, ok := filenames[filename]; ok {
+			l.warningf(component, "%s: duplicate entry", filename)
+		}
+		filenames[filename] = struct{}{}
+		if l.imageFilter != nil && l.imageFilter.Match(filename) {
+			l.warningf(component,
+				"%s: matches filter: will not be updated on machines",
+				filename)
+		}
+		if mode, ok := l.checkPathInImage(filename); ok {
+			if !mode.IsRegular() {
+				l.errorf(component, "%s: not a regular file in the image",
+					filename)
+			}
+		} else if l.sourceFS == nil {
+			continue
+		} else if l.mayCreateFiles {
+			l.warningf(component,
+				"%s: missing from manifest files and source image",
+				filename)
+		} else {
+			l.errorf(component,
+				"%s: missing from manifest files and source image",
+				filename)
+		}
+	}
+}
+
+// lintDirectoryEntries will check for unknown entries in the manifest
+// directory.
+func (l *manifestLinter) lintDirectoryEntries() {
+	names, err := listDirectory(l.manifestDir)
+	if err != nil {
+		l.errorf(".", "%s", err)
+		return
+	}
+	verstr.Sort(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, ok := knownManifestComponents[name]; !ok {
+			l.warningf(name, "unknown component: ignored")
+		}
+	}
+}
+
+// lintFileTree will check a directory tree which is copied or appended into
+// the image and will record the paths that it provides.
+func (l *manifestLinter) lintFileTree(component string, isAppend bool) {
+	topDir := filepath.Join(l.manifestDir, component)
+	if fi, err := os.Stat(topDir); err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf(component, "%s", err)
+		}
+		return
+	} else if !fi.IsDir() {
+		l.errorf(component, "not a directory")
+		return
+	}
+	err := filepath.Walk(topDir,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == topDir {
+				return nil
+			}
+			pathname := path[len(topDir):]
+			mode := fi.Mode() & os.ModeType
+			if isAppend {
+				if mode&os.ModeSymlink != 0 {
+					l.warningf(component,
+						"%s: symbolic links are not supported: ignored",
+						pathname)
+					return nil
+				}
+				if mode.IsDir() {
+					return nil
+				}
+			}
+			if !mode.IsDir() && !mode.IsRegular() &&
+				mode&os.ModeSymlink == 0 {
+				l.errorf(component, "%s: unsupported file type", pathname)
+				return nil
+			}
+			if l.manifestFilter != nil && l.manifestFilter.Match(pathname) {
+				l.warningf(component,
+					"%s: matches FilterLines: excluded from image", pathname)
+			}
+			l.lintPathAgainstSource(component, pathname, mode, isAppend)
+			if _, ok := l.paths[pathname]; !ok || !mode.IsDir() {
+				l.paths[pathname] = mode
+			}
+			return nil
+		})
+	if err != nil {
+		l.errorf(component, "%s", err)
+	}
+}
+
+func (l *manifestLinter) lintFilter() {
+	imageFilter := l.loadFilter("filter")
+	addFilter := l.loadFilter("filter.add")
+	if imageFilter != nil && addFilter != nil {
+		l.errorf("filter.add", "must not be present with filter")
+	} else if imageFilter != nil {
+		l.imageFilter = imageFilter
+	} else {
+		l.imageFilter = addFilter
+	}
+}
+
+func (l *manifestLinter) lintFilterLines(component, field string,
+	lines []string) *filter.Filter {
+	seen := make(map[string]struct{}, len(lines))
+	var numErrors uint
+	for _, line := range lines {
+		if line == "" || line == "!" {
+			continue
+		}
+		if _, ok := seen[line]; ok {
+			l.warningf(component, "%sduplicate expression: %q", field, line)
+		}
+		seen[line] = struct{}{}
+		if _, err := pathregexp.Compile(line); err != nil {
+			l.errorf(component, "%sbad expression: %q: %s", field, line, err)
+			numErrors++
+		}
+	}
+	if numErrors > 0 || len(lines) < 1 {
+		return nil
+	}
+	f, _ := filter.New(lines)
+	return f
+}
+
+// lintManifestFile will check the manifest file and will return the
+// configuration with variables expanded, or nil if it could not be read.
+func (l *manifestLinter) lintManifestFile() *manifestConfigType {
+	rawConfig, err := readManifestFile(l.manifestDir, nil)
+	if err != nil {
+		l.errorf("manifest", "%s", err)
+		return nil
+	}
+	if rawConfig.SourceImage == "" {
+		l.errorf("manifest", "no SourceImage")
+	}
+	if rawConfig.Filter != nil {
+		l.manifestFilter = l.lintFilterLines("manifest", "FilterLines: ",
+			rawConfig.FilterLines)
+	}
+	l.lintFilterLines("manifest", "MtimesCopyAddFilterLines: ",
+		rawConfig.MtimesCopyAddFilterLines)
+	l.lintFilterLines("manifest", "MtimesCopyFilterLines: ",
+		rawConfig.MtimesCopyFilterLines)
+	if len(rawConfig.MtimesCopyAddFilterLines) > 0 &&
+		len(rawConfig.MtimesCopyFilterLines) > 0 {
+		l.warningf("manifest",
+			"MtimesCopyAddFilterLines ignored since MtimesCopyFilterLines present")
+	}
+	manifestConfig, err := readManifestFile(l.manifestDir, l.envGetter)
+	if err != nil {
+		l.errorf("manifest", "%s", err)
+		return nil
+	}
+	if rawConfig.SourceImage != "" && manifestConfig.SourceImage == "" {
+		l.errorf("manifest", "SourceImage: %q expands to an empty string",
+			rawConfig.SourceImage)
+	}
+	return &manifestConfig
+}
+
+func (l *manifestLinter) lintOwners() {
+	var owners OwnersType
+	err := json.ReadFromFile(filepath.Join(l.manifestDir, "owners.json"),
+		&owners)
+	if err != nil && !os.IsNotExist(err) {
+		l.errorf("owners.json", "%s", err)
+	}
+}
+
+func (l *manifestLinter) lintPackageList() {
+	packageList, err := fsutil.LoadLines(filepath.Join(l.manifestDir,
+		"package-list"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf("package-list", "%s", err)
+		}
+		return
+	}
+	if len(packageList) > 0 {
+		l.mayCreateFiles = true
+	}
+	seen := make(map[string]struct{}, len(packageList))
+	for _, name := range packageList {
+		if strings.ContainsAny(name, " \t") {
+			l.errorf("package-list", "%q: contains whitespace", name)
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			l.warningf("package-list", "%s: duplicate entry", name)
+		}
+		seen[name] = struct{}{}
+	}
+}
+
+// lintPathAgainstSource will check that a path provided by a manifest file
+// tree is compatible with the corresponding path in the source image.
+func (l *manifestLinter) lintPathAgainstSource(component, pathname string,
+	mode os.FileMode, isAppend bool) {
+	if l.sourceFS == nil {
+		return
+	}
+	inum, ok := l.sourcePaths[pathname]
+	if !ok {
+		return
+	}
+	sourceMode := inodeFileMode(l.sourceFS.InodeTable[inum])
+	if isAppend {
+		if !sourceMode.IsRegular() {
+			l.errorf(component,
+				"%s: cannot append to non-regular file in source image",
+				pathname)
+		}
+	} else if mode.IsDir() && !sourceMode.IsDir() {
+		if sourceMode&os.ModeSymlink == 0 {
+			l.errorf(component,
+				"%s: directory replaces non-directory in source image",
+				pathname)
+		}
+	} else if !mode.IsDir() && sourceMode.IsDir() {
+		l.errorf(component, "%s: replaces directory in source image",
+			pathname)
+	}
+}
+
+// lintScripts will check the scripts in a scripts directory.
+func (l *manifestLinter) lintScripts(component string) {
+	scriptsDir := filepath.Join(l.manifestDir, component)
+	if fi, err := os.Stat(scriptsDir); err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf(component, "%s", err)
+		}
+		return
+	} else if !fi.IsDir() {
+		l.errorf(component, "not a directory")
+		return
+	}
+	names, err := listDirectory(scriptsDir)
+	if err != nil {
+		l.errorf(component, "%s", err)
+		return
+	}
+	verstr.Sort(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue // Skipped by runScripts.
+		}
+		l.mayCreateFiles = true
+		pathname := filepath.Join(scriptsDir, name)
+		fi, err := os.Stat(pathname)
+		if err != nil {
+			l.errorf(component, "%s: %s", name, err)
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			l.errorf(component, "%s: not a regular file", name)
+			continue
+		}
+		if fi.Mode()&0111 == 0 {
+			l.warningf(component, "%s: not executable", name)
+		}
+		l.lintInterpreter(component, name, pathname)
+	}
+}
+
+// lintInterpreter will check that a script can be executed directly.
+func (l *manifestLinter) lintInterpreter(component, name, pathname string) {
+	file, err := os.Open(pathname)
+	if err != nil {
+		l.errorf(component, "%s: %s", name, err)
+		return
+	}
+	defer file.Close()
+	header := make([]byte, 4)
+	nRead, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		l.errorf(component, "%s: %s", name, err)
+		return
+	}
+	header = header[:nRead]
+	if nRead < 1 {
+		l.warningf(component, "%s: empty file", name)
+	} else if !bytes.HasPrefix(header, []byte("#!")) &&
+		!bytes.Equal(header, []byte("\x7fELF")) {
+		l.errorf(component, "%s: missing interpreter line (#!)", name)
+	}
+}
+
+func (l *manifestLinter) lintTags() {
+	var tgs tags.Tags
+	err := json.ReadFromFile(filepath.Join(l.manifestDir, "tags.json"), &tgs)
+	if err != nil && !os.IsNotExist(err) {
+		l.errorf("tags.json", "%s", err)
+	}
+}
+
+// lintTests will check the tests directory. Tests which are not executable are
+// skipped when running tests.
+func (l *manifestLinter) lintTests() {
+	testsDir := filepath.Join(l.manifestDir, "tests")
+	if fi, err := os.Stat(testsDir); err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf("tests", "%s", err)
+		}
+		return
+	} else if !fi.IsDir() {
+		l.errorf("tests", "not a directory")
+		return
+	}
+	err := filepath.Walk(testsDir,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			name := path[len(testsDir)+1:]
+			if fi.Mode()&0100 == 0 {
+				l.warningf("tests", "%s: not executable: will not be run",
+					name)
+				return nil
+			}
+			l.lintInterpreter("tests", name, path)
+			return nil
+		})
+	if err != nil {
+		l.errorf("tests", "%s", err)
+	}
+}
+
+func (l *manifestLinter) lintTriggers() {
+	imageTriggers := l.loadTriggers("triggers")
+	addTriggers := l.loadTriggers("triggers.add")
+	if imageTriggers != nil && addTriggers != nil {
+		l.errorf("triggers.add", "must not be present with triggers")
+	}
+	l.lintTriggersList("triggers", imageTriggers)
+	l.lintTriggersList("triggers.add", addTriggers)
+}
+
+func (l *manifestLinter) lintTriggersList(component string,
+	imageTriggers *triggers.Triggers) {
+	if imageTriggers == nil {
+		return
+	}
+	services := make(map[string]struct{}, len(imageTriggers.Triggers))
+	for index, trigger := range imageTriggers.Triggers {
+		name := trigger.Service
+		if name == "" {
+			l.errorf(component, "trigger %d: no Service", index)
+			name = fmt.Sprintf("trigger %d", index)
+		} else if _, ok := services[name]; ok {
+			l.warningf(component, "%s: duplicate Service", name)
+		}
+		services[name] = struct{}{}
+		if len(trigger.MatchLines) < 1 {
+			l.warningf(component, "%s: no MatchLines", name)
+		}
+		for _, line := range trigger.MatchLines {
+			regex, err := pathregexp.Compile(line)
+			if err != nil {
+				l.errorf(component, "%s: bad MatchLines expression: %q: %s",
+					name, line, err)
+				continue
+			}
+			if l.sourceFS != nil && !l.matchAnyPath(regex) {
+				l.warningf(component,
+					"%s: %q matches no path in manifest files or source image",
+					name, line)
+			}
+		}
+	}
+}
+
+func (l *manifestLinter) loadComputedFiles(component string) (
+	[]util.ComputedFile, string) {
+	jsonComponent := component + ".json"
+	haveJson := exists(filepath.Join(l.manifestDir, jsonComponent))
+	havePlain := exists(filepath.Join(l.manifestDir, component))
+	if haveJson && havePlain {
+		l.warningf(component, "ignored since %s present", jsonComponent)
+	}
+	if haveJson {
+		component = jsonComponent
+	} else if !havePlain {
+		return nil, ""
+	}
+	computedFiles, err := util.LoadComputedFiles(
+		filepath.Join(l.manifestDir, component))
+	if err != nil {
+		l.errorf(component, "%s", err)
+	}
+	return computedFiles, component
+}
+
+func (l *manifestLinter) loadFilter(component string) *filter.Filter {
+	lines, err := fsutil.LoadLines(filepath.Join(l.manifestDir, component))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf(component, "%s", err)
+		}
+		return nil
+	}
+	if f := l.lintFilterLines(component, "", lines); f != nil {
+		return f
+	}
+	return &filter.Filter{}
+}
+
+func (l *manifestLinter) loadSourceImage(client srpc.ClientI,
+	manifestConfig manifestConfigType, logger log.Logger) error {
+	imageName, img, err := getLatestImage(client, manifestConfig.SourceImage,
+		manifestConfig.SourceImageGitCommitId,
+		manifestConfig.SourceImageTagsToMatch, io.Discard, logger)
+	if err != nil {
+		return err
+	}
+	if img == nil {
+		l.warningf("manifest", "SourceImage: %s: no image available",
+			manifestConfig.SourceImage)
+		return nil
+	}
+	if err := img.FileSystem.RebuildInodePointers(); err != nil {
+		return err
+	}
+	logger.Printf("Checking against source image: %s\n", imageName)
+	l.sourceFS = img.FileSystem
+	l.sourcePaths = img.FileSystem.FilenameToInodeTable()
+	return nil
+}
+
+func (l *manifestLinter) loadTriggers(component string) *triggers.Triggers {
+	imageTriggers, err := triggers.Load(filepath.Join(l.manifestDir,
+		component))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.errorf(component, "%s", err)
+		}
+		return nil
+	}
+	return imageTriggers
+}
+
+// matchAnyPath returns true if the regular expression matches a path in the
+// manifest file trees or the source image.
+func (l *manifestLinter) matchAnyPath(regex pathregexp.Regexp) bool {
+	for pathname := range l.paths {
+		if regex.MatchString(pathname) {
+			return true
+		}
+	}
+	for pathname := range l.sourcePaths {
+		if regex.MatchString(pathname) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image/testimage"
+)
+
+func writeLintFile(t *testing.T, manifestDir, filename, data string,
+	perm os.FileMode) {
+	pathname := filepath.Join(manifestDir, filename)
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pathname, []byte(data), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLintManifest(t *testing.T) {
+	manifestDir := t.TempDir()
+	writeLintFile(t, manifestDir, "manifest",
+		`{"SourceImage": "base", "FilterLines": ["/tmp/(.*"]}`, 0644)
+	writeLintFile(t, manifestDir, "filter", "/etc/[\n/var/log/.*\n", 0644)
+	writeLintFile(t, manifestDir, "triggers",
+		`[{"MatchLines": ["/etc/ssh/.*"], "Service": "sshd"},
+		  {"MatchLines": ["/opt/none/.*"], "Service": "none"}]`, 0644)
+	writeLintFile(t, manifestDir, "computed-files",
+		"/etc/computed host:1\n/etc/ssh host:1\n", 0644)
+	writeLintFile(t, manifestDir, "files/etc/computed", "data", 0644)
+	writeLintFile(t, manifestDir, "files/etc/ssh", "data", 0644)
+	writeLintFile(t, manifestDir, "scripts/10-noexec", "#!/bin/sh\n", 0644)
+	writeLintFile(t, manifestDir, "scripts/20-nointerp", "true\n", 0755)
+	writeLintFile(t, manifestDir, "unknown", "", 0644)
+	l := &manifestLinter{
+		manifestDir: manifestDir,
+		paths:       make(map[string]os.FileMode),
+	}
+	if l.lintManifestFile() == nil {
+		t.Fatal("manifest file not read")
+	}
+	l.sourceFS = testimage.New(
+		testimage.File{Name: "/etc/ssh/sshd_config"}).FileSystem
+	l.sourcePaths = l.sourceFS.FilenameToInodeTable()
+	l.lintComponents()
+	expected := []string{
+		"error: manifest: FilterLines: bad expression: \"/tmp/(.*\"",
+		"warning: unknown: unknown component: ignored",
+		"error: files: /etc/ssh: replaces directory in source image",
+		"warning: scripts: 10-noexec: not executable",
+		"error: scripts: 20-nointerp: missing interpreter line (#!)",
+		"error: filter: bad expression: \"/etc/[\"",
+		"warning: triggers: none: \"/opt/none/.*\" matches no path",
+	}
+	var messages []string
+	for _, message := range l.messages {
+		messages = append(messages, message.String())
+	}
+	for _, prefix := range expected {
+		found := false
+		for _, message := range messages {
+			if strings.HasPrefix(message, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing: %s", prefix)
+		}
+	}
+	for _, message := range messages {
+		if strings.Contains(message, "sshd") ||
+			strings.Contains(message, "/etc/computed") {
+			t.Errorf("unexpected: %s", message)
+		}
+	}
+	if t.Failed() {
+		t.Log(strings.Join(messages, "\n"))
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/image/sbom"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
@@ -91,6 +92,9 @@ func imageStreamsRealDecoder(reader io.Reader) (
 		newStreams[name] = stream
 	}
 	config.Streams = newStreams
+	if err := config.expandStreamMatrices(); err != nil {
+		return nil, err
+	}
 	for _, stream := range config.Streams {
 		stream.builderUsers = stringutil.ConvertListToMap(stream.BuilderUsers,
 			false)
@@ -117,6 +121,9 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 		options.MaximumExpirationDurationPrivileged =
 			options.MaximumExpirationDuration
 	}
+	if options.MaximumRunningBuildsPerStream < 1 {
+		options.MaximumRunningBuildsPerStream = 1
+	}
 	if options.MinimumExpirationDuration <= 0 {
 		options.MinimumExpirationDuration = 15 * time.Minute
 	} else if options.MinimumExpirationDuration < 15*time.Second {
@@ -160,6 +167,17 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 			return nil, err
 		}
 	}
+	if err := sbom.CheckFormat(masterConfiguration.SbomFormat); err != nil {
+		return nil, err
+	}
+	var unchangedImageFilter *filter.Filter
+	if len(masterConfiguration.UnchangedImageFilterLines) > 0 {
+		unchangedImageFilter, err = filter.New(
+			masterConfiguration.UnchangedImageFilterLines)
+		if err != nil {
+			return nil, err
+		}
+	}
 	autoRebuildTrigger := make(chan chan<- struct{}) // Unbuffered: busy block.
 	generateDependencyTrigger := make(chan chan<- struct{}, 1)
 	streamsLoadedChannel := make(chan struct{})
@@ -174,10 +192,18 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 				masterConfiguration.Cache.BaseDirectory)
 		}
 	}
+	buildCacheIndex, err := loadBuildCacheIndex(options.StateDirectory)
+	if err != nil {
+		return nil, err
+	}
 	b := &Builder{
-		autoRebuildTrigger:          autoRebuildTrigger,
-		buildLogArchiver:            params.BuildLogArchiver,
-		bindMounts:                  masterConfiguration.BindMounts,
+		autoRebuildTrigger: autoRebuildTrigger,
+		buildLogArchiver:   params.BuildLogArchiver,
+		bindMounts:         masterConfiguration.BindMounts,
+		buildCacheIndex:    buildCacheIndex,
+		buildQueue: newBuildQueue(options.MaximumRunningBuilds,
+			options.MaximumRunningBuildsPerStream,
+			options.MaximumRunningBuildsPerUser),
 		cache:                       masterConfiguration.Cache,
 		mtimesCopyFilter:            mtimesCopyFilter,
 		createSlaveTimeout:          options.CreateSlaveTimeout,
@@ -196,7 +222,10 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 		streamsLoadedChannel:        streamsLoadedChannel,
 		bootstrapStreams:            masterConfiguration.BootstrapStreams,
 		imageStreamsToAutoRebuild:   masterConfiguration.ImageStreamsToAutoRebuild,
+		sbomFormat:                  masterConfiguration.SbomFormat,
+		skipUnchangedImages:         masterConfiguration.SkipUnchangedImages,
 		slaveDriver:                 params.SlaveDriver,
+		unchangedImageFilter:        unchangedImageFilter,
 		currentBuildInfos:           make(map[string]*currentBuildInfo),
 		lastBuildResults:            make(map[string]buildResultType),
 		packagerTypes:               masterConfiguration.PackagerTypes,
@@ -224,9 +253,15 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 	if err != nil {
 		return nil, err
 	}
+	if options.RebuildDependentStreams {
+		b.rebuildCascade = newRebuildCascade(options.ImageRebuildInterval)
+	}
 	go b.dependencyGeneratorLoop(generateDependencyTrigger)
 	go b.watchConfigLoop(imageStreamsConfigChannel, streamsLoadedChannel)
 	go b.rebuildImages(options.ImageRebuildInterval, autoRebuildTrigger)
+	if b.rebuildCascade != nil {
+		go b.rebuildCascadeLoop()
+	}
 	return b, nil
 }
 
@@ -413,6 +448,7 @@ func (b *Builder) updateImageStreams(
 	b.streamsLock.Lock()
 	b.imageStreamPatterns = streamPatterns
 	b.imageStreams = imageStreamsConfiguration.Streams
+	b.matrixStreamsToAutoRebuild = imageStreamsConfiguration.autoRebuildStreams
 	b.streamsLock.Unlock()
 	b.triggerDependencyDataGeneration()
 	return b.makeRequiredDirectories()
@@ -0,0 +1,157 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Cloud-Foundations/Dominator/lib/expand"
+)
+
+// expandStreamMatrices will expand each stream matrix into a stream for each
+// combination of variable values and will add the streams to the table of
+// streams. The names of the expanded streams which should be automatically
+// rebuilt are recorded.
+func (config *imageStreamsConfigurationType) expandStreamMatrices() error {
+	templates := make([]string, 0, len(config.StreamMatrices))
+	for template := range config.StreamMatrices {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	if config.Streams == nil && len(templates) > 0 {
+		config.Streams = make(map[string]*imageStreamType)
+	}
+	for _, template := range templates {
+		matrix := config.StreamMatrices[template]
+		streams, err := matrix.expand(template)
+		if err != nil {
+			return fmt.Errorf("stream matrix: %s: %s", template, err)
+		}
+		for _, stream := range streams {
+			if _, ok := config.Streams[stream.name]; ok {
+				return fmt.Errorf("stream matrix: %s: duplicate stream: %s",
+					template, stream.name)
+			}
+			config.Streams[stream.name] = stream
+			if matrix.AutoRebuild {
+				config.autoRebuildStreams = append(config.autoRebuildStreams,
+					stream.name)
+			}
+		}
+	}
+	return nil
+}
+
+// expand will return a stream for each combination of variable values which
+// is not excluded. The stream name is generated by expanding the template with
+// the variable values.
+func (matrix *imageStreamMatrixType) expand(template string) (
+	[]*imageStreamType, error) {
+	if len(matrix.Values) < 1 {
+		return nil, fmt.Errorf("no Values")
+	}
+	names := make([]string, 0, len(matrix.Values))
+	for name, values := range matrix.Values {
+		if len(values) < 1 {
+			return nil, fmt.Errorf("no values for variable: %s", name)
+		}
+		if _, ok := matrix.Variables[name]; ok {
+			return nil, fmt.Errorf("variable: %s also present in Variables",
+				name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, exclude := range matrix.Exclude {
+		for name := range exclude {
+			if _, ok := matrix.Values[name]; !ok {
+				return nil, fmt.Errorf("unknown variable in Exclude: %s", name)
+			}
+		}
+	}
+	var err error
+	var streams []*imageStreamType
+	streamNames := make(map[string]struct{})
+	matrix.forEachCombination(names, make(map[string]string, len(names)),
+		func(combination map[string]string) {
+			if err != nil || matrix.isExcluded(combination) {
+				return
+			}
+			stream := matrix.makeStream(template, combination)
+			if stream.name == "" {
+				err = fmt.Errorf("empty stream name for: %v", combination)
+				return
+			}
+			if _, ok := streamNames[stream.name]; ok {
+				err = fmt.Errorf("duplicate stream: %s (template must use all variables)",
+					stream.name)
+				return
+			}
+			streamNames[stream.name] = struct{}{}
+			streams = append(streams, stream)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) < 1 {
+		return nil, fmt.Errorf("all combinations excluded")
+	}
+	return streams, nil
+}
+
+// forEachCombination will call fn for each combination of values for the
+// specified variable names. The combination map is re-used between calls.
+func (matrix *imageStreamMatrixType) forEachCombination(names []string,
+	combination map[string]string, fn func(map[string]string)) {
+	if len(names) < 1 {
+		fn(combination)
+		return
+	}
+	for _, value := range matrix.Values[names[0]] {
+		combination[names[0]] = value
+		matrix.forEachCombination(names[1:], combination, fn)
+	}
+}
+
+func (matrix *imageStreamMatrixType) isExcluded(
+	combination map[string]string) bool {
+	for _, exclude := range matrix.Exclude {
+		matched := true
+		for name, value := range exclude {
+			if combination[name] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// makeStream will make a stream for a combination of variable values. The
+// values are added to the stream variables and may be referenced in the values
+// of other stream variables.
+func (matrix *imageStreamMatrixType) makeStream(template string,
+	combination map[string]string) *imageStreamType {
+	mappingFunc := func(name string) string {
+		if value, ok := combination[name]; ok {
+			return value
+		}
+		return archMapper(name)
+	}
+	variables := make(map[string]string,
+		len(matrix.Variables)+len(combination))
+	for name, value := range matrix.Variables {
+		variables[name] = expand.Opportunistic(value, mappingFunc)
+	}
+	for name, value := range combination {
+		variables[name] = value
+	}
+	stream := &imageStreamType{
+		name:                         expand.Expression(template, mappingFunc),
+		imageStreamConfigurationType: matrix.imageStreamConfigurationType,
+	}
+	stream.Variables = variables
+	return stream
+}
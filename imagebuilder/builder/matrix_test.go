@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamMatrix(t *testing.T) {
+	config, err := imageStreamsRealDecoder(strings.NewReader(`{
+  "StreamMatrices": {
+    "base/${RELEASE}/${TEAM}": {
+      "AutoRebuild": true,
+      "Exclude": [{"RELEASE": "Debian-10", "TEAM": "web"}],
+      "ManifestDirectory": "$IMAGE_STREAM_DIRECTORY_NAME",
+      "ManifestUrl": "dir:///manifests",
+      "Values": {
+        "RELEASE": ["Debian-10", "Debian-11"],
+        "TEAM": ["db", "web"]
+      },
+      "Variables": {"SOURCE": "bootstrap/${RELEASE}"}
+    }
+  },
+  "Streams": {
+    "other": {"ManifestUrl": "dir:///manifests"}
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Streams) != 4 {
+		t.Fatalf("number of streams: %d != 4", len(config.Streams))
+	}
+	if _, ok := config.Streams["base/Debian-10/web"]; ok {
+		t.Error("excluded stream present")
+	}
+	stream := config.Streams["base/Debian-11/db"]
+	if stream == nil {
+		t.Fatal("base/Debian-11/db stream missing")
+	}
+	if stream.Variables["RELEASE"] != "Debian-11" ||
+		stream.Variables["SOURCE"] != "bootstrap/Debian-11" {
+		t.Errorf("bad variables: %v", stream.Variables)
+	}
+	if len(config.autoRebuildStreams) != 3 {
+		t.Errorf("auto rebuild streams: %v", config.autoRebuildStreams)
+	}
+	_, err = imageStreamsRealDecoder(strings.NewReader(`{
+  "StreamMatrices": {
+    "base/${RELEASE}": {
+      "Values": {"RELEASE": ["Debian-11"], "TEAM": ["db", "web"]}
+    }
+  }
+}`))
+	if err == nil {
+		t.Error("duplicate stream names not detected")
+	}
+}
@@ -0,0 +1,258 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+func decrementCount(counts map[string]uint, key string) {
+	if count := counts[key]; count > 1 {
+		counts[key] = count - 1
+	} else {
+		delete(counts, key)
+	}
+}
+
+func newBuildQueue(maxRunning, maxRunningPerStream,
+	maxRunningPerUser uint) *buildQueue {
+	return &buildQueue{
+		maxRunning:          maxRunning,
+		maxRunningPerStream: maxRunningPerStream,
+		maxRunningPerUser:   maxRunningPerUser,
+		runningPerStream:    make(map[string]uint),
+		runningPerUser:      make(map[string]uint),
+	}
+}
+
+func (priority buildPriority) String() string {
+	switch priority {
+	case priorityAutoRebuild:
+		return "auto-rebuild"
+	case priorityCascade:
+		return "cascade"
+	case priorityRequest:
+		return "request"
+	case priorityDependency:
+		return "dependency"
+	default:
+		return fmt.Sprintf("unknown(%d)", priority)
+	}
+}
+
+// add will add an entry to the queue and will start it if possible.
+func (q *buildQueue) add(streamName, username string,
+	priority buildPriority) *queueEntry {
+	entry := &queueEntry{
+		notify:     make(chan struct{}, 1),
+		priority:   priority,
+		queuedAt:   time.Now(),
+		streamName: streamName,
+		username:   username,
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	index := len(q.waiting)
+	for i, waitingEntry := range q.waiting {
+		if entry.priority > waitingEntry.priority {
+			index = i
+			break
+		}
+	}
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[index+1:], q.waiting[index:])
+	q.waiting[index] = entry
+	q.dispatch()
+	return entry
+}
+
+// canStart returns true if the entry can be started without exceeding the
+// concurrency limits. Builds of source images needed by running builds are
+// exempt from the global limit, since the running builds are waiting for them.
+// This must be called with the lock held.
+func (q *buildQueue) canStart(entry *queueEntry) bool {
+	if q.maxRunning > 0 && q.numRunning >= q.maxRunning &&
+		entry.priority < priorityDependency {
+		return false
+	}
+	if q.maxRunningPerStream > 0 &&
+		q.runningPerStream[entry.streamName] >= q.maxRunningPerStream {
+		return false
+	}
+	if q.maxRunningPerUser > 0 && entry.username != "" &&
+		q.runningPerUser[entry.username] >= q.maxRunningPerUser {
+		return false
+	}
+	return true
+}
+
+// dispatch will start all the waiting entries which may be started and will
+// notify the remaining entries that their position may have changed.
+// This must be called with the lock held.
+func (q *buildQueue) dispatch() {
+	waiting := q.waiting[:0]
+	for _, entry := range q.waiting {
+		if !q.canStart(entry) {
+			waiting = append(waiting, entry)
+			continue
+		}
+		entry.running = true
+		entry.startedAt = time.Now()
+		q.numRunning++
+		q.runningPerStream[entry.streamName]++
+		if entry.username != "" {
+			q.runningPerUser[entry.username]++
+		}
+		q.running = append(q.running, entry)
+		entry.wake()
+	}
+	for index := len(waiting); index < len(q.waiting); index++ {
+		q.waiting[index] = nil
+	}
+	q.waiting = waiting
+	for _, entry := range q.waiting {
+		entry.wake()
+	}
+}
+
+// getPosition returns the position of the entry in the queue, starting from 1.
+// Zero is returned if the entry is running.
+func (q *buildQueue) getPosition(entry *queueEntry) uint {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if entry.running {
+		return 0
+	}
+	for index, waitingEntry := range q.waiting {
+		if waitingEntry == entry {
+			return uint(index) + 1
+		}
+	}
+	return 0
+}
+
+func (q *buildQueue) list() []proto.BuildQueueEntry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	entries := make([]proto.BuildQueueEntry, 0,
+		len(q.running)+len(q.waiting))
+	for _, entry := range q.running {
+		entries = append(entries, entry.makeProto())
+	}
+	for _, entry := range q.waiting {
+		entries = append(entries, entry.makeProto())
+	}
+	return entries
+}
+
+// release will remove the entry from the queue, whether it is waiting or
+// running, and will start waiting entries if possible.
+func (q *buildQueue) release(entry *queueEntry) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if entry.running {
+		for index, runningEntry := range q.running {
+			if runningEntry == entry {
+				q.running = append(q.running[:index], q.running[index+1:]...)
+				break
+			}
+		}
+		entry.running = false
+		q.numRunning--
+		decrementCount(q.runningPerStream, entry.streamName)
+		if entry.username != "" {
+			decrementCount(q.runningPerUser, entry.username)
+		}
+	} else {
+		for index, waitingEntry := range q.waiting {
+			if waitingEntry == entry {
+				q.waiting = append(q.waiting[:index], q.waiting[index+1:]...)
+				break
+			}
+		}
+	}
+	q.dispatch()
+}
+
+func (entry *queueEntry) makeProto() proto.BuildQueueEntry {
+	return proto.BuildQueueEntry{
+		Priority:   entry.priority.String(),
+		QueuedAt:   entry.queuedAt,
+		Running:    entry.running,
+		StartedAt:  entry.startedAt,
+		StreamName: entry.streamName,
+		Username:   entry.username,
+	}
+}
+
+func (entry *queueEntry) wake() {
+	select {
+	case entry.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Builder) getBuildQueue() []proto.BuildQueueEntry {
+	return b.buildQueue.list()
+}
+
+// waitInQueue will wait until the entry is started, reporting changes in the
+// queue position to logWriter.
+func (b *Builder) waitInQueue(entry *queueEntry, logWriter io.Writer) {
+	reporter, _ := logWriter.(QueuePositionReporter)
+	var lastPosition uint
+	for {
+		position := b.buildQueue.getPosition(entry)
+		if position < 1 {
+			break
+		}
+		if position != lastPosition {
+			lastPosition = position
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "Position in build queue: %d\n",
+					position)
+			}
+			if reporter != nil {
+				reporter.ReportQueuePosition(position)
+			}
+		}
+		<-entry.notify
+	}
+	if lastPosition > 0 && logWriter != nil {
+		fmt.Fprintf(logWriter, "Waited %s in build queue\n",
+			format.Duration(time.Since(entry.queuedAt)))
+	}
+}
+
+func (b *Builder) writeBuildQueueHtml(writer io.Writer,
+	autoRebuildStreams map[string]struct{}) {
+	var waiting []proto.BuildQueueEntry
+	for _, entry := range b.buildQueue.list() {
+		if !entry.Running {
+			waiting = append(waiting, entry)
+		}
+	}
+	if len(waiting) < 1 {
+		return
+	}
+	fmt.Fprintln(writer, "Build queue:<br>")
+	fmt.Fprintln(writer, `<table border="1">`)
+	tw, _ := html.NewTableWriter(writer, true, "Position", "Image Stream",
+		"Priority", "Requested by", "Waiting")
+	for index, entry := range waiting {
+		tw.WriteRow("", "",
+			strconv.Itoa(index+1),
+			streamNameText(entry.StreamName, autoRebuildStreams),
+			entry.Priority,
+			entry.Username,
+			format.Duration(time.Since(entry.QueuedAt)),
+		)
+	}
+	tw.Close()
+	fmt.Fprintln(writer, "<br>")
+}
@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"testing"
+)
+
+func TestBuildQueuePriorities(t *testing.T) {
+	q := newBuildQueue(1, 1, 0)
+	first := q.add("stream0", "", priorityAutoRebuild)
+	if q.getPosition(first) != 0 {
+		t.Fatal("first build not started")
+	}
+	auto := q.add("stream1", "", priorityAutoRebuild)
+	request := q.add("stream2", "user", priorityRequest)
+	if pos := q.getPosition(request); pos != 1 {
+		t.Errorf("request position: %d != 1", pos)
+	}
+	if pos := q.getPosition(auto); pos != 2 {
+		t.Errorf("auto-rebuild position: %d != 2", pos)
+	}
+	dependency := q.add("stream3", "", priorityDependency)
+	if q.getPosition(dependency) != 0 {
+		t.Error("dependency build not started despite global limit")
+	}
+	sameStream := q.add("stream0", "user", priorityRequest)
+	if q.getPosition(sameStream) == 0 {
+		t.Error("second build of stream0 started")
+	}
+	q.release(dependency)
+	if q.getPosition(request) == 0 {
+		t.Error("request started while over global limit")
+	}
+	q.release(first)
+	if q.getPosition(request) != 0 {
+		t.Error("request not started after release")
+	}
+	if q.getPosition(auto) == 0 {
+		t.Error("auto-rebuild started before request")
+	}
+	q.release(request)
+	if q.getPosition(sameStream) != 0 {
+		t.Error("second build of stream0 not started")
+	}
+	q.release(sameStream)
+	if q.getPosition(auto) != 0 {
+		t.Error("auto-rebuild not started")
+	}
+	q.release(auto)
+	if len(q.list()) != 0 || q.numRunning != 0 {
+		t.Error("queue not empty")
+	}
+}
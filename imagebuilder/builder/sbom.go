@@ -0,0 +1,40 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/sbom"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+// addSbom will generate a Software Bill of Materials for the image, upload it
+// to the image server and attach it to the image as an annotation.
+func (b *Builder) addSbom(client srpc.ClientI, streamName string,
+	img *image.Image, buildLog io.Writer) error {
+	buffer := &bytes.Buffer{}
+	err := sbom.Write(buffer, img, sbom.Params{
+		Format: b.sbomFormat,
+		Name:   streamName,
+	})
+	if err != nil {
+		return fmt.Errorf("error generating SBOM: %s", err)
+	}
+	objClient := objectclient.AttachObjectClient(client)
+	defer objClient.Close()
+	hashVal, _, err := objClient.AddObject(buffer, uint64(buffer.Len()), nil)
+	if err != nil {
+		return fmt.Errorf("error uploading SBOM: %s", err)
+	}
+	img.SBOM = &image.Annotation{Object: &hashVal}
+	format := b.sbomFormat
+	if format == "" {
+		format = sbom.FormatSPDX
+	}
+	fmt.Fprintf(buildLog, "Generated %s SBOM: %d packages\n",
+		format, len(img.Packages))
+	return nil
+}
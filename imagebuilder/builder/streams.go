@@ -2,6 +2,8 @@ package builder
 
 import (
 	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
 )
 
 func (b *Builder) getBootstrapStream(name string) *bootstrapStream {
@@ -96,7 +98,12 @@ func (b *Builder) listNormalStreamNames() []string {
 func (b *Builder) listStreamsToAutoRebuild() []string {
 	b.streamsLock.RLock()
 	defer b.streamsLock.RUnlock()
-	imageStreamNames := make([]string, len(b.imageStreamsToAutoRebuild))
-	copy(imageStreamNames, b.imageStreamsToAutoRebuild)
+	imageStreamNames := make([]string, 0,
+		len(b.imageStreamsToAutoRebuild)+len(b.matrixStreamsToAutoRebuild))
+	imageStreamNames = append(imageStreamNames,
+		b.imageStreamsToAutoRebuild...)
+	imageStreamNames = append(imageStreamNames,
+		b.matrixStreamsToAutoRebuild...)
+	imageStreamNames, _ = stringutil.DeduplicateList(imageStreamNames, false)
 	return imageStreamNames
 }
@@ -0,0 +1,107 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+// testResultsLogger records test results for builds which do not have a
+// dualBuildLogger.
+type testResultsLogger struct {
+	buildLogger
+	testResults *testresults.Results
+}
+
+// addTestResults will upload the test results to the image server and will
+// return an annotation for them.
+func addTestResults(objClient *objectclient.ObjectClient,
+	results *testresults.Results) (*image.Annotation, error) {
+	buffer := &bytes.Buffer{}
+	if err := results.Encode(buffer); err != nil {
+		return nil, err
+	}
+	hashVal, _, err := objClient.AddObject(buffer, uint64(buffer.Len()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading test results: %s", err)
+	}
+	return &image.Annotation{Object: &hashVal}, nil
+}
+
+// recordTestResults will record the test results with the build logger, if it
+// supports recording.
+func recordTestResults(buildLog io.Writer, results *testresults.Results) {
+	if results == nil {
+		return
+	}
+	if recorder, ok := buildLog.(testResultsRecorder); ok {
+		recorder.recordTestResults(results)
+	}
+}
+
+// getTestPolicy returns the test policy for the build. When building on behalf
+// of another builder, the policy is provided in the request.
+func getTestPolicy(builder imageBuilder,
+	request proto.BuildImageRequest) testPolicyType {
+	if request.TestPolicy != nil {
+		return testPolicyType(*request.TestPolicy)
+	}
+	if builder, ok := builder.(*imageStreamType); ok {
+		return builder.TestPolicy
+	}
+	return testPolicyType{}
+}
+
+// check will return an error if the test results fail the policy. A summary
+// is written to buildLog.
+func (policy testPolicyType) check(results *testresults.Results,
+	buildLog io.Writer) error {
+	if results == nil {
+		return nil
+	}
+	ignoreFailures := stringutil.ConvertListToMap(policy.IgnoreFailures,
+		false)
+	var numFailures, numIgnored uint
+	for _, result := range results.Results {
+		if result.Status != testresults.StatusFail {
+			continue
+		}
+		if _, ok := ignoreFailures[result.Name]; ok {
+			numIgnored++
+		} else {
+			numFailures++
+		}
+	}
+	numPassed, _, numSkipped := results.Count()
+	fmt.Fprintf(buildLog,
+		"Tests: %d passed, %d failed, %d failures ignored, %d skipped\n",
+		numPassed, numFailures, numIgnored, numSkipped)
+	if numFailures <= policy.MaximumFailures {
+		return nil
+	}
+	if policy.MaximumFailures < 1 {
+		return fmt.Errorf("%d tests failed", numFailures)
+	}
+	return fmt.Errorf("%d tests failed, maximum permitted: %d",
+		numFailures, policy.MaximumFailures)
+}
+
+func (bl *dualBuildLogger) recordTestResults(results *testresults.Results) {
+	bl.buildInfo.testResults = results
+	if reporter, ok := bl.logWriter.(TestResultsReporter); ok {
+		reporter.ReportTestResults(results.Results)
+	}
+}
+
+func (l *testResultsLogger) recordTestResults(results *testresults.Results) {
+	l.testResults = results
+	if reporter, ok := l.buildLogger.(TestResultsReporter); ok {
+		reporter.ReportTestResults(results.Results)
+	}
+}
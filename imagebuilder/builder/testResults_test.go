@@ -0,0 +1,60 @@
+package builder
+
+import (
+	"io"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+func TestTestPolicyCheck(t *testing.T) {
+	results := &testresults.Results{
+		Results: []testresults.Result{
+			{Name: "flaky", Status: testresults.StatusFail},
+			{Name: "good", Status: testresults.StatusPass},
+			{Name: "optional", Status: testresults.StatusSkip},
+			{Name: "other", Status: testresults.StatusFail},
+		},
+	}
+	tests := []struct {
+		name    string
+		policy  testPolicyType
+		wantErr bool
+	}{
+		{"strict", testPolicyType{}, true},
+		{"ignoreOne", testPolicyType{IgnoreFailures: []string{"flaky"}}, true},
+		{"ignoreAll",
+			testPolicyType{IgnoreFailures: []string{"flaky", "other"}}, false},
+		{"maximumOne", testPolicyType{MaximumFailures: 1}, true},
+		{"maximumTwo", testPolicyType{MaximumFailures: 2}, false},
+		{"ignoreAndMaximum", testPolicyType{
+			IgnoreFailures:  []string{"flaky"},
+			MaximumFailures: 1,
+		}, false},
+	}
+	for _, test := range tests {
+		err := test.policy.check(results, io.Discard)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+	}
+	if err := (testPolicyType{}).check(nil, io.Discard); err != nil {
+		t.Errorf("no results: unexpected error: %s", err)
+	}
+}
+
+func TestGetTestPolicy(t *testing.T) {
+	stream := &imageStreamType{}
+	stream.TestPolicy.MaximumFailures = 1
+	request := proto.BuildImageRequest{}
+	if policy := getTestPolicy(stream, request); policy.MaximumFailures != 1 {
+		t.Errorf("stream policy not used: %v", policy)
+	}
+	request.TestPolicy = &proto.TestPolicy{MaximumFailures: 2}
+	if policy := getTestPolicy(stream, request); policy.MaximumFailures != 2 {
+		t.Errorf("request policy not used: %v", policy)
+	}
+}
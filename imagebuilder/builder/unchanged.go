@@ -0,0 +1,201 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	imageclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+// compareDirectoriesIgnoringMtimes will compare two directories, ignoring
+// modification times and entries matching ignoreFilter. The first difference
+// found is written to logWriter.
+func compareDirectoriesIgnoringMtimes(left, right *filesystem.DirectoryInode,
+	dirname string, ignoreFilter *filter.Filter, logWriter io.Writer) bool {
+	if left.Mode != right.Mode || left.Uid != right.Uid ||
+		left.Gid != right.Gid {
+		fmt.Fprintf(logWriter, "Directory metadata changed: %s\n", dirname)
+		return false
+	}
+	leftEntries := filterEntries(left.EntryList, dirname, ignoreFilter)
+	rightEntries := filterEntries(right.EntryList, dirname, ignoreFilter)
+	if len(leftEntries) != len(rightEntries) {
+		fmt.Fprintf(logWriter, "Number of entries changed: %s: %d to %d\n",
+			dirname, len(leftEntries), len(rightEntries))
+		return false
+	}
+	for index, leftEntry := range leftEntries {
+		rightEntry := rightEntries[index]
+		filename := path.Join(dirname, leftEntry.Name)
+		if leftEntry.Name != rightEntry.Name {
+			fmt.Fprintf(logWriter, "Entry changed: %s to %s\n",
+				filename, path.Join(dirname, rightEntry.Name))
+			return false
+		}
+		if !compareInodesIgnoringMtimes(leftEntry.Inode(), rightEntry.Inode(),
+			filename, ignoreFilter, logWriter) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareInodesIgnoringMtimes will compare two inodes, ignoring modification
+// times. The first difference found is written to logWriter.
+func compareInodesIgnoringMtimes(left, right filesystem.GenericInode,
+	filename string, ignoreFilter *filter.Filter, logWriter io.Writer) bool {
+	var same bool
+	switch left := left.(type) {
+	case *filesystem.DirectoryInode:
+		if right, ok := right.(*filesystem.DirectoryInode); ok {
+			return compareDirectoriesIgnoringMtimes(left, right, filename,
+				ignoreFilter, logWriter)
+		}
+	case *filesystem.RegularInode:
+		if right, ok := right.(*filesystem.RegularInode); ok {
+			same = left.Mode == right.Mode && left.Uid == right.Uid &&
+				left.Gid == right.Gid && left.Size == right.Size &&
+				(left.Size < 1 || left.Hash == right.Hash)
+		}
+	case *filesystem.ComputedRegularInode:
+		if right, ok := right.(*filesystem.ComputedRegularInode); ok {
+			same = *left == *right
+		}
+	case *filesystem.SymlinkInode:
+		if right, ok := right.(*filesystem.SymlinkInode); ok {
+			same = *left == *right
+		}
+	case *filesystem.SpecialInode:
+		if right, ok := right.(*filesystem.SpecialInode); ok {
+			same = left.Mode == right.Mode && left.Uid == right.Uid &&
+				left.Gid == right.Gid && left.Rdev == right.Rdev
+		}
+	}
+	if !same {
+		fmt.Fprintf(logWriter, "File changed: %s\n", filename)
+	}
+	return same
+}
+
+// compareImagesIgnoringMtimes returns true if the file-systems of the images
+// are the same (ignoring modification times and files matching ignoreFilter)
+// and the filters, triggers and tags are the same.
+func compareImagesIgnoringMtimes(left, right *image.Image,
+	ignoreFilter *filter.Filter, logWriter io.Writer) bool {
+	if !left.Filter.Equal(right.Filter) {
+		fmt.Fprintln(logWriter, "Image filter changed")
+		return false
+	}
+	if !compareTriggers(left.Triggers, right.Triggers) {
+		fmt.Fprintln(logWriter, "Image triggers changed")
+		return false
+	}
+	if !left.Tags.Equal(right.Tags) {
+		fmt.Fprintln(logWriter, "Image tags changed")
+		return false
+	}
+	if left.FileSystem == nil || right.FileSystem == nil {
+		return false
+	}
+	return compareDirectoriesIgnoringMtimes(&left.FileSystem.DirectoryInode,
+		&right.FileSystem.DirectoryInode, "/", ignoreFilter, logWriter)
+}
+
+func compareTriggers(left, right *triggers.Triggers) bool {
+	var leftTriggers, rightTriggers []*triggers.Trigger
+	if left != nil {
+		leftTriggers = left.Triggers
+	}
+	if right != nil {
+		rightTriggers = right.Triggers
+	}
+	if len(leftTriggers) != len(rightTriggers) {
+		return false
+	}
+	if len(leftTriggers) < 1 {
+		return true
+	}
+	leftData, err := json.Marshal(leftTriggers)
+	if err != nil {
+		return false
+	}
+	rightData, err := json.Marshal(rightTriggers)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(leftData, rightData)
+}
+
+func filterEntries(entries []*filesystem.DirectoryEntry, dirname string,
+	ignoreFilter *filter.Filter) []*filesystem.DirectoryEntry {
+	if ignoreFilter == nil {
+		return entries
+	}
+	filteredEntries := make([]*filesystem.DirectoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !ignoreFilter.Match(path.Join(dirname, entry.Name)) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+// checkUnchanged will compare the newly built image with the latest image in
+// the stream. If they are the same, the expiration time of the latest image is
+// extended and its name is returned, otherwise the empty string is returned.
+func (b *Builder) checkUnchanged(client srpc.ClientI,
+	request proto.BuildImageRequest, img *image.Image,
+	buildLog io.Writer) string {
+	imageName, err := imageclient.FindLatestImage(client, request.StreamName,
+		false)
+	if err != nil {
+		fmt.Fprintf(buildLog, "Error finding latest image: %s\n", err)
+		return ""
+	}
+	if imageName == "" {
+		return ""
+	}
+	previousImage, err := imageclient.GetImage(client, imageName)
+	if err != nil {
+		fmt.Fprintf(buildLog, "Error getting image: %s: %s\n", imageName, err)
+		return ""
+	}
+	if previousImage == nil || previousImage.FileSystem == nil {
+		return ""
+	}
+	if err := previousImage.FileSystem.RebuildInodePointers(); err != nil {
+		fmt.Fprintf(buildLog, "Error reading image: %s: %s\n", imageName, err)
+		return ""
+	}
+	fmt.Fprintf(buildLog, "Comparing with previous image: %s\n", imageName)
+	if !compareImagesIgnoringMtimes(previousImage, img,
+		b.unchangedImageFilter, buildLog) {
+		return ""
+	}
+	if request.ExpiresIn > 0 && !previousImage.ExpiresAt.IsZero() {
+		expiresAt := time.Now().Add(request.ExpiresIn)
+		if expiresAt.After(previousImage.ExpiresAt) {
+			err := imageclient.ChangeImageExpiration(client, imageName,
+				expiresAt)
+			if err != nil {
+				fmt.Fprintf(buildLog,
+					"Error extending expiration for image: %s: %s\n",
+					imageName, err)
+				return ""
+			}
+		}
+	}
+	fmt.Fprintf(buildLog, "No change from: %s, extended expiration\n",
+		imageName)
+	return imageName
+}
@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testimage"
+)
+
+func makeTestImage(mtime int64, logData byte) *image.Image {
+	return testimage.New(
+		testimage.File{
+			Name:         "/build.log",
+			Hash:         hash.Hash{logData},
+			MtimeSeconds: mtime,
+			Size:         1,
+		},
+		testimage.File{Name: "/etc/passwd", MtimeSeconds: mtime, Size: 1},
+	)
+}
+
+func TestCompareImagesIgnoringMtimes(t *testing.T) {
+	logWriter := &bytes.Buffer{}
+	if !compareImagesIgnoringMtimes(makeTestImage(1, 0), makeTestImage(2, 0),
+		nil, logWriter) {
+		t.Errorf("images with different mtimes differ: %s", logWriter)
+	}
+	if compareImagesIgnoringMtimes(makeTestImage(1, 0), makeTestImage(1, 1),
+		nil, logWriter) {
+		t.Error("images with different data are the same")
+	}
+	ignoreFilter, err := filter.New([]string{"/build[.]log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compareImagesIgnoringMtimes(makeTestImage(1, 0), makeTestImage(1, 1),
+		ignoreFilter, logWriter) {
+		t.Errorf("filtered images differ: %s", logWriter)
+	}
+}
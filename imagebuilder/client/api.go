@@ -23,6 +23,10 @@ func DisableBuildRequests(client *srpc.Client, disableFor time.Duration) (
 	return disableBuildRequests(client, disableFor)
 }
 
+func GetBuildQueue(client *srpc.Client) ([]proto.BuildQueueEntry, error) {
+	return getBuildQueue(client)
+}
+
 func GetDependencies(client *srpc.Client,
 	request proto.GetDependenciesRequest) (
 	proto.GetDependenciesResult, error) {
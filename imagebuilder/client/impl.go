@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
 )
@@ -30,6 +31,8 @@ func buildImage(client *srpc.Client, request proto.BuildImageRequest,
 	if str != "\n" {
 		return errors.New(str[:len(str)-1])
 	}
+	var buildCache *proto.BuildCache
+	var testResults []testresults.Result
 	for {
 		var reply proto.BuildImageResponse
 		if err := conn.Decode(&reply); err != nil {
@@ -37,6 +40,16 @@ func buildImage(client *srpc.Client, request proto.BuildImageRequest,
 		}
 		logWriter.Write(reply.BuildLog)
 		reply.BuildLog = nil
+		if reply.BuildCache != nil {
+			buildCache = reply.BuildCache
+		} else {
+			reply.BuildCache = buildCache
+		}
+		if reply.TestResults != nil {
+			testResults = reply.TestResults
+		} else {
+			reply.TestResults = testResults
+		}
 		if err := errors.New(reply.ErrorString); err != nil {
 			*response = reply
 			return err
@@ -82,6 +95,19 @@ func disableBuildRequests(client *srpc.Client, disableFor time.Duration) (
 	return reply.DisabledUntil, nil
 }
 
+func getBuildQueue(client *srpc.Client) ([]proto.BuildQueueEntry, error) {
+	var reply proto.GetBuildQueueResponse
+	err := client.RequestReply("Imaginator.GetBuildQueue",
+		proto.GetBuildQueueRequest{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Entries, nil
+}
+
 func getDependencies(client *srpc.Client,
 	request proto.GetDependenciesRequest) (
 	proto.GetDependenciesResult, error) {
@@ -55,6 +55,8 @@ func StartServerWithOptionsAndParams(options Options, params Params) error {
 	html.HandleFunc("/showImageStream", myState.showImageStreamHandler)
 	html.HandleFunc("/showImageStreams", myState.showImageStreamsHandler)
 	html.HandleFunc("/showLastBuildLog", myState.showLastBuildLogHandler)
+	html.HandleFunc("/showLatestTestResults",
+		myState.showLatestTestResultsHandler)
 	if myState.buildLogReporter != nil {
 		html.HandleFunc("/showAllBuilds", myState.showAllBuildsHandler)
 		html.HandleFunc("/showBuildLog", myState.showBuildLogHandler)
@@ -0,0 +1,19 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+)
+
+func (s state) showLatestTestResultsHandler(w http.ResponseWriter,
+	req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	streamName := req.URL.RawQuery
+	fmt.Fprintf(writer, "<title>test results for stream %s</title>\n",
+		streamName)
+	fmt.Fprintln(writer, "<body>")
+	s.builder.ShowLatestTestResults(writer, streamName)
+	fmt.Fprintln(writer, "</body>")
+}
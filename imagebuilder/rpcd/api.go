@@ -40,6 +40,7 @@ func Setup(builder *builder.Builder, logger log.Logger) (*htmlWriter, error) {
 		srpc.ReceiverOptions{
 			PublicMethods: []string{
 				"BuildImage",
+				"GetBuildQueue",
 				"GetDependencies",
 				"GetDirectedGraph",
 			}})
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/imagebuilder/builder"
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
 )
@@ -105,3 +106,34 @@ func (w *logWriterType) Write(p []byte) (int, error) {
 	}
 	return len(p), nil
 }
+
+func (w *logWriterType) ReportBuildCache(cache *proto.BuildCache) error {
+	w.lockAndScheduleFlush()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	reply := proto.BuildImageResponse{BuildCache: cache}
+	return w.conn.Encode(reply)
+}
+
+func (w *logWriterType) ReportQueuePosition(position uint) error {
+	w.lockAndScheduleFlush()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	reply := proto.BuildImageResponse{QueuePosition: position}
+	return w.conn.Encode(reply)
+}
+
+func (w *logWriterType) ReportTestResults(
+	results []testresults.Result) error {
+	w.lockAndScheduleFlush()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	reply := proto.BuildImageResponse{TestResults: results}
+	return w.conn.Encode(reply)
+}
@@ -0,0 +1,13 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
+)
+
+func (t *srpcType) GetBuildQueue(conn *srpc.Conn,
+	request proto.GetBuildQueueRequest,
+	reply *proto.GetBuildQueueResponse) error {
+	reply.Entries = t.builder.GetBuildQueue()
+	return nil
+}
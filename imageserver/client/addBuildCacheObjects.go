@@ -0,0 +1,19 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func addBuildCacheObjects(client srpc.ClientI, hashes []hash.Hash) error {
+	request := proto.AddBuildCacheObjectsRequest{Hashes: hashes}
+	var reply proto.AddBuildCacheObjectsResponse
+	err := client.RequestReply("ImageServer.AddBuildCacheObjects", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
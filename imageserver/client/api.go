@@ -7,9 +7,17 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
 )
 
+// AddBuildCacheObjects will add objects to the build cache of the image server,
+// which keeps them until they have not been added again for the build cache
+// lifetime.
+func AddBuildCacheObjects(client srpc.ClientI, hashes []hash.Hash) error {
+	return addBuildCacheObjects(client, hashes)
+}
+
 func AddImage(client srpc.ClientI, name string, img *image.Image) error {
 	return addImage(client, name, img)
 }
@@ -48,6 +56,23 @@ func DeleteUnreferencedObjects(client srpc.ClientI, percentage uint8,
 	return deleteUnreferencedObjects(client, percentage, bytes)
 }
 
+func FindImagesWithObject(client srpc.ClientI, hashVal hash.Hash) (
+	[]string, error) {
+	return findImagesWithObject(client, hashVal)
+}
+
+// FindImagesWithPackage will find images containing the specified package. If
+// version is empty, all versions are matched.
+func FindImagesWithPackage(client srpc.ClientI, name, version string) (
+	[]proto.ImagePackage, error) {
+	return findImagesWithPackage(client, name, version)
+}
+
+func FindImagesWithPath(client srpc.ClientI, pathname string) (
+	[]string, error) {
+	return findImagesWithPath(client, pathname)
+}
+
 func FindLatestImage(client srpc.ClientI, dirname string,
 	ignoreExpiring bool) (string, error) {
 	return findLatestImage(client, proto.FindLatestImageRequest{
@@ -61,6 +86,11 @@ func FindLatestImageReq(client srpc.ClientI,
 	return findLatestImage(client, request)
 }
 
+func GetDirectoryUsage(client srpc.ClientI, dirname string) (
+	proto.DirectoryUsage, error) {
+	return getDirectoryUsage(client, dirname)
+}
+
 func GetImage(client srpc.ClientI, name string) (*image.Image, error) {
 	return getImage(client, name, 0)
 }
@@ -90,6 +120,14 @@ func GetImageUsageEstimate(client srpc.ClientI, name string) (
 	return getImageUsageEstimate(client, name)
 }
 
+// GetImageVulnerabilities will get the vulnerability findings for the packages
+// in the specified image, matched against the vulnerability feed loaded by the
+// imageserver.
+func GetImageVulnerabilities(client srpc.ClientI, name string) (
+	[]vulnerability.Finding, error) {
+	return getImageVulnerabilities(client, name)
+}
+
 func GetImageWithTimeout(client srpc.ClientI, name string,
 	timeout time.Duration) (*image.Image, error) {
 	return getImage(client, name, timeout)
@@ -105,6 +143,10 @@ func GetReplicationMaster(client srpc.ClientI) (string, error) {
 	return getReplicationMaster(client)
 }
 
+func GetReplicationPeers(client srpc.ClientI) ([]string, error) {
+	return getReplicationPeers(client)
+}
+
 func ImportTree(client srpc.ClientI, request proto.ImportTreeRequest) (
 	proto.ImportTreeResponse, error) {
 	return importTree(client, request)
@@ -141,3 +183,8 @@ func RestoreImageFromArchive(client srpc.ClientI,
 	proto.RestoreImageFromArchiveResponse, error) {
 	return restoreImageFromArchive(client, request)
 }
+
+func SetDirectoryQuota(client srpc.ClientI, dirname string,
+	quotaBytes uint64) error {
+	return setDirectoryQuota(client, dirname, quotaBytes)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func findImagesWithObject(client srpc.ClientI, hashVal hash.Hash) (
+	[]string, error) {
+	request := proto.FindImagesWithObjectRequest{Hash: hashVal}
+	var reply proto.FindImagesWithObjectResponse
+	err := client.RequestReply("ImageServer.FindImagesWithObject", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.ImageNames, nil
+}
+
+func findImagesWithPackage(client srpc.ClientI, name, version string) (
+	[]proto.ImagePackage, error) {
+	request := proto.FindImagesWithPackageRequest{
+		PackageName: name,
+		Version:     version,
+	}
+	var reply proto.FindImagesWithPackageResponse
+	err := client.RequestReply("ImageServer.FindImagesWithPackage", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Images, nil
+}
+
+func findImagesWithPath(client srpc.ClientI, pathname string) (
+	[]string, error) {
+	request := proto.FindImagesWithPathRequest{Pathname: pathname}
+	var reply proto.FindImagesWithPathResponse
+	err := client.RequestReply("ImageServer.FindImagesWithPath", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.ImageNames, nil
+}
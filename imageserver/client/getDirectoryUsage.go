@@ -0,0 +1,21 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func getDirectoryUsage(client srpc.ClientI, dirname string) (
+	proto.DirectoryUsage, error) {
+	request := proto.GetDirectoryUsageRequest{DirectoryName: dirname}
+	var reply proto.GetDirectoryUsageResponse
+	err := client.RequestReply("ImageServer.GetDirectoryUsage", request, &reply)
+	if err != nil {
+		return proto.DirectoryUsage{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return proto.DirectoryUsage{}, err
+	}
+	return reply.Usage, nil
+}
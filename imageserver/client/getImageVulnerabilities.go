@@ -0,0 +1,23 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func getImageVulnerabilities(client srpc.ClientI, name string) (
+	[]vulnerability.Finding, error) {
+	request := imageserver.GetImageVulnerabilitiesRequest{ImageName: name}
+	var reply imageserver.GetImageVulnerabilitiesResponse
+	err := client.RequestReply("ImageServer.GetImageVulnerabilities",
+		request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Findings, nil
+}
@@ -19,3 +19,17 @@ func getReplicationMaster(client srpc.ClientI) (string, error) {
 	}
 	return reply.ReplicationMaster, nil
 }
+
+func getReplicationPeers(client srpc.ClientI) ([]string, error) {
+	request := imageserver.GetReplicationMasterRequest{}
+	var reply imageserver.GetReplicationMasterResponse
+	err := client.RequestReply("ImageServer.GetReplicationMaster", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.ReplicationPeers, nil
+}
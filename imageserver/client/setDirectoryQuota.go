@@ -0,0 +1,21 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func setDirectoryQuota(client srpc.ClientI, dirname string,
+	quotaBytes uint64) error {
+	request := proto.SetDirectoryQuotaRequest{
+		DirectoryName: dirname,
+		QuotaBytes:    quotaBytes,
+	}
+	var reply proto.SetDirectoryQuotaResponse
+	err := client.RequestReply("ImageServer.SetDirectoryQuota", request, &reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
@@ -63,15 +63,21 @@ func StartServer(config Config, params Params) error {
 	if config.AllowUnauthenticatedReads {
 		html.HandleFunc("/getObject", myState.getObjectHandler)
 	}
+	html.HandleFunc("/findImages", myState.findImagesHandler)
 	html.HandleFunc("/listBuildLog", myState.listBuildLogHandler)
 	html.HandleFunc("/listComputedInodes", myState.listComputedInodesHandler)
 	html.HandleFunc("/listDirectories", myState.listDirectoriesHandler)
+	html.HandleFunc("/listDirectoryUsage", myState.listDirectoryUsageHandler)
 	html.HandleFunc("/listFilter", myState.listFilterHandler)
 	html.HandleFunc("/listImage", myState.listImageHandler)
 	html.HandleFunc("/listImages", myState.listImagesHandler)
 	html.HandleFunc("/listPackages", myState.listPackagesHandler)
 	html.HandleFunc("/listReleaseNotes", myState.listReleaseNotesHandler)
+	html.HandleFunc("/listSBOM", myState.listSBOMHandler)
+	html.HandleFunc("/listTestResults", myState.listTestResultsHandler)
 	html.HandleFunc("/listTriggers", myState.listTriggersHandler)
+	html.HandleFunc("/listVulnerabilities",
+		myState.listVulnerabilitiesHandler)
 	html.HandleFunc("/showImage", myState.showImageHandler)
 	if params.DaemonMode {
 		go http.Serve(listener, nil)
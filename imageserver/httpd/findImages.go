@@ -0,0 +1,125 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/verstr"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func writeFindImagesForm(writer io.Writer, searchType, value string) {
+	fmt.Fprintln(writer, `<form action="findImages" method="get">`)
+	fmt.Fprintln(writer, "Find images with")
+	fmt.Fprintln(writer, `<select name="type">`)
+	for _, option := range []string{"package", "path", "object"} {
+		if option == searchType {
+			fmt.Fprintf(writer, "<option selected>%s</option>\n", option)
+		} else {
+			fmt.Fprintf(writer, "<option>%s</option>\n", option)
+		}
+	}
+	fmt.Fprintln(writer, "</select>")
+	fmt.Fprintf(writer,
+		"<input type=\"text\" name=\"value\" size=\"64\" value=\"%s\" placeholder=\"name[=version], /path or object hash\">\n",
+		template.HTMLEscapeString(value))
+	fmt.Fprintln(writer, `<input type="submit" value="Search">`)
+	fmt.Fprintln(writer, "</form>")
+}
+
+func (s state) findImagesHandler(w http.ResponseWriter, req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	query := req.URL.Query()
+	searchType := query.Get("type")
+	value := strings.TrimSpace(query.Get("value"))
+	var images []proto.ImagePackage
+	var err error
+	switch searchType {
+	case "object":
+		var hashVal hash.Hash
+		if err = hashVal.UnmarshalText([]byte(value)); err == nil {
+			images = makeImageList(
+				s.imageDataBase.FindImagesWithObject(hashVal))
+		}
+	case "package":
+		name, version, _ := strings.Cut(value, "=")
+		images = s.imageDataBase.FindImagesWithPackage(name, version)
+	case "path":
+		if !filepath.IsAbs(value) {
+			err = fmt.Errorf("pathname must be absolute: %s", value)
+		} else {
+			images = makeImageList(
+				s.imageDataBase.FindImagesWithPath(filepath.Clean(value)))
+		}
+	default:
+		err = fmt.Errorf("unknown search type: %s", searchType)
+	}
+	sort.Slice(images, func(left, right int) bool {
+		return verstr.Less(images[left].ImageName, images[right].ImageName)
+	})
+	if query.Get("output") == "text" {
+		if err != nil {
+			fmt.Fprintln(writer, err)
+			return
+		}
+		for _, image := range images {
+			fmt.Fprintln(writer, image.ImageName, image.Version)
+		}
+		return
+	}
+	fmt.Fprintln(writer, "<title>imageserver find images</title>")
+	fmt.Fprintln(writer, `<style>
+                          table, th, td {
+                          border-collapse: collapse;
+                          }
+                          </style>`)
+	fmt.Fprintln(writer, "<body>")
+	writeFindImagesForm(writer, searchType, value)
+	fmt.Fprintln(writer, "<h3>")
+	if err != nil {
+		fmt.Fprintf(writer, "<font color=\"red\">%s</font>\n",
+			template.HTMLEscapeString(err.Error()))
+		fmt.Fprintln(writer, "</h3>")
+		fmt.Fprintln(writer, "</body>")
+		return
+	}
+	fmt.Fprintf(writer, "Found %d images<br>\n", len(images))
+	fmt.Fprintln(writer, `<table border="1">`)
+	columns := []string{"Name"}
+	if searchType == "package" {
+		columns = append(columns, "Version")
+	}
+	tw, _ := html.NewTableWriter(writer, true, columns...)
+	for _, image := range images {
+		nameLink := fmt.Sprintf("<a href=\"showImage?%s\">%s</a>",
+			url.PathEscape(image.ImageName),
+			template.HTMLEscapeString(image.ImageName))
+		if searchType == "package" {
+			tw.WriteRow("", "", nameLink,
+				template.HTMLEscapeString(image.Version))
+		} else {
+			tw.WriteRow("", "", nameLink)
+		}
+	}
+	tw.Close()
+	fmt.Fprintln(writer, "</h3>")
+	fmt.Fprintln(writer, "</body>")
+}
+
+func makeImageList(imageNames []string) []proto.ImagePackage {
+	images := make([]proto.ImagePackage, 0, len(imageNames))
+	for _, name := range imageNames {
+		images = append(images, proto.ImagePackage{ImageName: name})
+	}
+	return images
+}
@@ -0,0 +1,82 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"text/template"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+// listDirectoryUsageHandler shows usage for top-level directories and for
+// directories which have a quota.
+func (s state) listDirectoryUsageHandler(w http.ResponseWriter,
+	req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	directories := s.imageDataBase.ListDirectories()
+	image.SortDirectories(directories)
+	fmt.Fprintln(writer, "<title>imageserver directory usage</title>")
+	fmt.Fprintln(writer, `<style>
+                          table, th, td {
+                          border-collapse: collapse;
+                          }
+                          </style>`)
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<h3>")
+	fmt.Fprintln(writer, `<table border="1" style="width:100%">`)
+	tw, _ := html.NewTableWriter(writer, true, "Name", "Owner Group",
+		"Images", "Objects", "Unique", "Shared", "Quota", "Quota Used")
+	for _, directory := range directories {
+		if directory.Name == "." {
+			continue
+		}
+		if directory.Metadata.QuotaBytes < 1 &&
+			filepath.Dir(directory.Name) != "." {
+			continue
+		}
+		usage, err := s.imageDataBase.GetDirectoryUsage(directory.Name)
+		if err != nil {
+			continue
+		}
+		writeDirectoryUsage(tw, directory, usage)
+	}
+	tw.Close()
+	fmt.Fprintln(writer, "</body>")
+}
+
+func writeDirectoryUsage(tw *html.TableWriter, directory image.Directory,
+	usage proto.DirectoryUsage) {
+	var background, quota, quotaUsed string
+	if usage.QuotaBytes > 0 {
+		usedBytes := usage.SharedBytes + usage.UniqueBytes
+		percentUsed := usedBytes * 100 / usage.QuotaBytes
+		quota = format.FormatBytes(usage.QuotaBytes)
+		quotaUsed = fmt.Sprintf("%d%%", percentUsed)
+		if percentUsed >= 100 {
+			background = "#ffb0b0"
+		} else if percentUsed >= 90 {
+			background = "#ffffb0"
+		}
+	}
+	tw.WriteRow("", background,
+		fmt.Sprintf(
+			"<a href=\"listImages?directoryName=%s\">%s</a>",
+			url.QueryEscape(directory.Name),
+			template.HTMLEscapeString(directory.Name),
+		),
+		template.HTMLEscapeString(directory.Metadata.OwnerGroup),
+		fmt.Sprintf("%d", usage.NumImages),
+		fmt.Sprintf("%d", usage.NumObjects),
+		format.FormatBytes(usage.UniqueBytes),
+		format.FormatBytes(usage.SharedBytes),
+		quota,
+		quotaUsed,
+	)
+}
@@ -4,6 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"net/http"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image/changelog"
 )
 
 func (s state) listReleaseNotesHandler(w http.ResponseWriter,
@@ -29,6 +32,25 @@ func (s state) listReleaseNotesHandler(w http.ResponseWriter,
 	}
 	fmt.Fprintf(writer, "Release notes for image: %s<br>\n", imageName)
 	fmt.Fprintln(writer, "</h3>")
-	listObject(writer, s.objectServer, image.ReleaseNotes.Object)
+	if changes := s.getChangelog(image.ReleaseNotes.Object); changes != nil {
+		changes.WriteHtml(writer)
+	} else {
+		listObject(writer, s.objectServer, image.ReleaseNotes.Object)
+	}
 	fmt.Fprintln(writer, "</body>")
 }
+
+// getChangelog returns the changelog stored in the object, or nil if the
+// object does not contain a changelog.
+func (s state) getChangelog(hashVal *hash.Hash) *changelog.Changelog {
+	_, reader, err := s.objectServer.GetObject(*hashVal)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	changes, err := changelog.Decode(reader)
+	if err != nil {
+		return nil
+	}
+	return changes
+}
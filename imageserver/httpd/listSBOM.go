@@ -0,0 +1,36 @@
+package httpd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+func (s state) listSBOMHandler(w http.ResponseWriter, req *http.Request) {
+	imageName := req.URL.RawQuery
+	image := s.imageDataBase.GetImage(imageName)
+	if image == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Image: %s UNKNOWN!\n", imageName)
+		return
+	}
+	if image.SBOM == nil || image.SBOM.Object == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "No SBOM for image: %s\n", imageName)
+		return
+	}
+	size, readCloser, err := s.objectServer.GetObject(*image.SBOM.Object)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		return
+	}
+	defer readCloser.Close()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.FormatUint(size, 10))
+	io.Copy(w, readCloser)
+}
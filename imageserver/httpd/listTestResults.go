@@ -0,0 +1,43 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
+)
+
+func (s state) listTestResultsHandler(w http.ResponseWriter,
+	req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	imageName := req.URL.RawQuery
+	fmt.Fprintf(writer, "<title>image %s</title>\n", imageName)
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<h3>")
+	image := s.imageDataBase.GetImage(imageName)
+	if image == nil {
+		fmt.Fprintf(writer, "Image: %s UNKNOWN!\n", imageName)
+		return
+	}
+	if image.TestResults == nil || image.TestResults.Object == nil {
+		fmt.Fprintf(writer, "No test results for image: %s\n", imageName)
+		return
+	}
+	fmt.Fprintf(writer, "Test results for image: %s<br>\n", imageName)
+	fmt.Fprintln(writer, "</h3>")
+	_, reader, err := s.objectServer.GetObject(*image.TestResults.Object)
+	if err != nil {
+		fmt.Fprintf(writer, "Error reading test results: %s\n", err)
+		return
+	}
+	defer reader.Close()
+	results, err := testresults.Decode(reader)
+	if err != nil {
+		fmt.Fprintf(writer, "Error decoding test results: %s\n", err)
+		return
+	}
+	results.WriteHtml(writer)
+	fmt.Fprintln(writer, "</body>")
+}
@@ -0,0 +1,89 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/url"
+)
+
+func (s state) listVulnerabilitiesHandler(w http.ResponseWriter,
+	req *http.Request) {
+	parsedQuery := url.ParseQuery(req.URL)
+	if len(parsedQuery.Flags) != 1 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var imageName string
+	for name := range parsedQuery.Flags {
+		imageName = name
+	}
+	findings, loadedAt, err := s.imageDataBase.GetImageVulnerabilities(
+		imageName)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, err)
+		return
+	}
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	switch parsedQuery.OutputType() {
+	case url.OutputTypeText:
+		for _, finding := range findings {
+			fmt.Fprintln(writer, finding.PackageName, finding.PackageVersion,
+				finding.AdvisoryId, finding.FixedVersion)
+		}
+		return
+	case url.OutputTypeJson:
+		err := json.WriteWithIndent(writer, "    ", findings)
+		if err != nil {
+			fmt.Fprintln(writer, err)
+		}
+		return
+	case url.OutputTypeHtml:
+		break
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(writer, "<title>image %s vulnerabilities</title>\n", imageName)
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<h3>")
+	fmt.Fprintf(writer, "Vulnerabilities in image: %s", imageName)
+	fmt.Fprintf(writer,
+		" <a href=\"listVulnerabilities?%s&output=text\">text</a>", imageName)
+	fmt.Fprintf(writer,
+		" <a href=\"listVulnerabilities?%s&output=json\">json</a>", imageName)
+	fmt.Fprintln(writer, "</h3>")
+	fmt.Fprintf(writer, "Vulnerability feed loaded at: %s<br>\n",
+		loadedAt.Format(timeFormat))
+	if len(findings) < 1 {
+		fmt.Fprintln(writer, "No vulnerabilities found<br>")
+		fmt.Fprintln(writer, "</body>")
+		return
+	}
+	fmt.Fprintln(writer, `<table border="1" style="width:100%">`)
+	tw, _ := html.NewTableWriter(writer, true, "Package", "Version",
+		"Advisory", "Aliases", "Severity", "Fixed Version", "Summary")
+	for _, finding := range findings {
+		tw.WriteRow("", "",
+			template.HTMLEscapeString(finding.PackageName),
+			template.HTMLEscapeString(finding.PackageVersion),
+			template.HTMLEscapeString(finding.AdvisoryId),
+			template.HTMLEscapeString(strings.Join(finding.Aliases, ", ")),
+			template.HTMLEscapeString(finding.Severity),
+			template.HTMLEscapeString(finding.FixedVersion),
+			template.HTMLEscapeString(finding.Summary),
+		)
+	}
+	tw.Close()
+	fmt.Fprintln(writer, "</body>")
+}
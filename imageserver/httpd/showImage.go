@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -24,6 +25,11 @@ func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
 	writer := bufio.NewWriter(w)
 	defer writer.Flush()
 	imageName := req.URL.RawQuery
+	if strings.Contains(imageName, "%") { // Escaped by url.QueryEscape.
+		if name, err := url.QueryUnescape(imageName); err == nil {
+			imageName = name
+		}
+	}
 	fmt.Fprintf(writer, "<title>image %s</title>\n", imageName)
 	fmt.Fprintln(writer, "<body>")
 	fmt.Fprintln(writer, "<h3>")
@@ -64,6 +70,12 @@ func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
 			"Number of triggers: <a href=\"listTriggers?%s\">%d</a><br>\n",
 			imageName, len(img.Triggers.Triggers))
 	}
+	findings, _, err := s.imageDataBase.GetImageVulnerabilities(imageName)
+	if err == nil {
+		fmt.Fprintf(writer,
+			"Number of vulnerabilities: <a href=\"listVulnerabilities?%s\">%d</a><br>\n",
+			imageName, len(findings))
+	}
 	if !img.ExpiresAt.IsZero() {
 		fmt.Fprintf(writer, "Expires at: %s (in %s)<br>\n",
 			img.ExpiresAt.In(time.Local).Format(timeFormat),
@@ -73,6 +85,9 @@ func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
 		"listReleaseNotes")
 	showAnnotation(writer, img.BuildLog, imageName, "Build log",
 		"listBuildLog")
+	showAnnotation(writer, img.SBOM, imageName, "SBOM", "listSBOM")
+	showAnnotation(writer, img.TestResults, imageName, "Test results",
+		"listTestResults")
 	if img.CreatedBy != "" {
 		fmt.Fprintf(writer, "Created by: %s\n<br>", img.CreatedBy)
 	}
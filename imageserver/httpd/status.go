@@ -27,6 +27,7 @@ func statusHandler(w http.ResponseWriter, req *http.Request) {
 	}
 	fmt.Fprintln(writer, "</center>")
 	html.WriteHeaderWithRequestNoGC(writer, req)
+	writeFindImagesForm(writer, "package", "")
 	fmt.Fprintln(writer, "<h3>")
 	for _, htmlWriter := range htmlWriters {
 		htmlWriter.WriteHtml(writer)
@@ -0,0 +1,17 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) AddBuildCacheObjects(conn *srpc.Conn,
+	request imageserver.AddBuildCacheObjectsRequest,
+	reply *imageserver.AddBuildCacheObjectsResponse) error {
+	t.logger.Debugf(0, "AddBuildCacheObjects(%d objects) by %s\n",
+		len(request.Hashes), conn.Username())
+	reply.Error = errors.ErrorToString(
+		t.imageDataBase.AddBuildCacheObjects(request.Hashes))
+	return nil
+}
@@ -7,13 +7,17 @@ import (
 	"io"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/Cloud-Foundations/Dominator/imageserver/scanner"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
 	"github.com/Cloud-Foundations/Dominator/lib/goroutine"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
 )
 
 var (
@@ -25,12 +29,22 @@ var (
 		"Filename containing filter to exclude images from replication (default do not exclude any)")
 	replicationIncludeFilter = flag.String("replicationIncludeFilter", "",
 		"Filename containing filter to include images for replication (default include all)")
+	replicationDirectories flagutil.StringList
+	replicationTagsToMatch tags.MatchTags
 )
 
+func init() {
+	flag.Var(&replicationDirectories, "replicationDirectories",
+		"Comma separated list of directories to replicate (trailing /: directory only, default all)")
+	flag.Var(&replicationTagsToMatch, "replicationTagsToMatch",
+		"Tags to match when selecting images to replicate from master (default all)")
+}
+
 type Config struct {
 	AllowUnauthenticatedReads   bool
 	InformationDatabaseTemplate string
 	ReplicationMaster           string
+	ReplicationPeers            []string // Multi-master mode.
 }
 
 type Params struct {
@@ -47,6 +61,9 @@ type srpcType struct {
 	includeFilter               *filter.Filter
 	informationDatabaseTemplate *template.Template
 	replicationMaster           string
+	replicationDirectories      []directorySelector
+	replicationPeers            []*peerType
+	replicationTagMatcher       *tagmatcher.TagMatcher
 	imageserverResource         *srpc.ClientResource
 	objSrv                      objectserver.FullObjectServer
 	archiveMode                 bool
@@ -57,6 +74,15 @@ type srpcType struct {
 	imagesBeingInjected         map[string]struct{}
 }
 
+type peerType struct {
+	address       string
+	resource      *srpc.ClientResource
+	mutex         sync.Mutex // Protect everything below.
+	connected     bool
+	lastError     string
+	lastErrorTime time.Time
+}
+
 type htmlWriter srpcType
 
 func (hw *htmlWriter) WriteHtml(writer io.Writer) {
@@ -70,6 +96,10 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 	if *archiveMode && config.ReplicationMaster == "" {
 		return nil, errors.New("replication master required in archive mode")
 	}
+	if config.ReplicationMaster != "" && len(config.ReplicationPeers) > 0 {
+		return nil, errors.New(
+			"cannot have both a replication master and replication peers")
+	}
 	analysisGoroutine, err := makeAnalysisGoroutine()
 	if err != nil {
 		return nil, err
@@ -86,6 +116,9 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		logger:              params.Logger,
 		archiveMode:         *archiveMode,
 		imagesBeingInjected: make(map[string]struct{}),
+		replicationDirectories: newDirectorySelectors(
+			replicationDirectories),
+		replicationTagMatcher: tagmatcher.New(replicationTagsToMatch, false),
 	}
 	if config.InformationDatabaseTemplate != "" {
 		tmpl, err := template.New("").Parse(config.InformationDatabaseTemplate)
@@ -95,6 +128,10 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		}
 		srpcObj.informationDatabaseTemplate = tmpl
 	}
+	for _, address := range config.ReplicationPeers {
+		srpcObj.replicationPeers = append(srpcObj.replicationPeers,
+			newPeer(address))
+	}
 	if *replicationExcludeFilter != "" {
 		srpcObj.excludeFilter, err = filter.Load(*replicationExcludeFilter)
 		if err != nil {
@@ -113,7 +150,11 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		"CheckImage",
 		"ChownDirectory",
 		"DeleteImage",
+		"FindImagesWithObject",
+		"FindImagesWithPackage",
+		"FindImagesWithPath",
 		"FindLatestImage",
+		"GetDirectoryUsage",
 		"GetFilteredImageUpdates",
 		"GetImage",
 		"GetImageArchive",
@@ -122,6 +163,7 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		"GetImageInodes",
 		"GetImageUpdates",
 		"GetImageUsageEstimate",
+		"GetImageVulnerabilities",
 		"GetObjectStatisticsForImages",
 		"GetReplicationMaster",
 		"ListDirectories",
@@ -134,7 +176,11 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		unauthenticatedMethods = []string{
 			"CheckDirectory",
 			"CheckImage",
+			"FindImagesWithObject",
+			"FindImagesWithPackage",
+			"FindImagesWithPath",
 			"FindLatestImage",
+			"GetDirectoryUsage",
 			"GetFilteredImageUpdates",
 			"GetImage",
 			"GetImageArchive",
@@ -143,6 +189,7 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 			"GetImageInodes",
 			"GetImageUpdates",
 			"GetImageUsageEstimate",
+			"GetImageVulnerabilities",
 			"GetObjectStatisticsForImages",
 			"GetReplicationMaster",
 			"ListDirectories",
@@ -159,6 +206,9 @@ func Setup(config Config, params Params) (*htmlWriter, error) {
 		go srpcObj.replicator(finishedReplication)
 	} else {
 		close(finishedReplication)
+		for _, peer := range srpcObj.replicationPeers {
+			go srpcObj.peerReplicator(peer)
+		}
 	}
 	return (*htmlWriter)(srpcObj), nil
 }
@@ -0,0 +1,13 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) FindImagesWithObject(conn *srpc.Conn,
+	request imageserver.FindImagesWithObjectRequest,
+	reply *imageserver.FindImagesWithObjectResponse) error {
+	reply.ImageNames = t.imageDataBase.FindImagesWithObject(request.Hash)
+	return nil
+}
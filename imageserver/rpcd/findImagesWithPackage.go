@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) FindImagesWithPackage(conn *srpc.Conn,
+	request imageserver.FindImagesWithPackageRequest,
+	reply *imageserver.FindImagesWithPackageResponse) error {
+	if request.PackageName == "" {
+		reply.Error = "no package name specified"
+		return nil
+	}
+	reply.Images = t.imageDataBase.FindImagesWithPackage(request.PackageName,
+		request.Version)
+	return nil
+}
@@ -0,0 +1,20 @@
+package rpcd
+
+import (
+	"path/filepath"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) FindImagesWithPath(conn *srpc.Conn,
+	request imageserver.FindImagesWithPathRequest,
+	reply *imageserver.FindImagesWithPathResponse) error {
+	if !filepath.IsAbs(request.Pathname) {
+		reply.Error = "pathname must be absolute: " + request.Pathname
+		return nil
+	}
+	reply.ImageNames = t.imageDataBase.FindImagesWithPath(
+		filepath.Clean(request.Pathname))
+	return nil
+}
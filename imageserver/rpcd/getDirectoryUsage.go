@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) GetDirectoryUsage(conn *srpc.Conn,
+	request imageserver.GetDirectoryUsageRequest,
+	reply *imageserver.GetDirectoryUsageResponse) error {
+	usage, err := t.imageDataBase.GetDirectoryUsage(request.DirectoryName)
+	*reply = imageserver.GetDirectoryUsageResponse{
+		Error: errors.ErrorToString(err),
+		Usage: usage,
+	}
+	return nil
+}
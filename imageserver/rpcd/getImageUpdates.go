@@ -69,6 +69,20 @@ func (t *srpcType) getImageUpdates(conn *srpc.Conn,
 			return err
 		}
 	}
+	if request.IncludeDeletions {
+		deletedImages := t.imageDataBase.ListDeletedImages()
+		for imageName, deletedOn := range deletedImages {
+			imageUpdate := imageserver.ImageUpdate{
+				DeletedOn: deletedOn,
+				Name:      imageName,
+				Operation: imageserver.OperationDeleteImage,
+			}
+			if err := conn.Encode(imageUpdate); err != nil {
+				t.logger.Println(err)
+				return err
+			}
+		}
+	}
 	// Signal end of initial image list.
 	if err := conn.Encode(imageserver.ImageUpdate{}); err != nil {
 		t.logger.Println(err)
@@ -94,8 +108,13 @@ func (t *srpcType) getImageUpdates(conn *srpc.Conn,
 				return err
 			}
 		case imageName := <-deleteChannel:
-			if err := sendUpdate(conn, imageName,
-				imageserver.OperationDeleteImage); err != nil {
+			deletedOn, _ := t.imageDataBase.GetImageDeletionTime(imageName)
+			imageUpdate := imageserver.ImageUpdate{
+				DeletedOn: deletedOn,
+				Name:      imageName,
+				Operation: imageserver.OperationDeleteImage,
+			}
+			if err := conn.Encode(imageUpdate); err != nil {
 				t.logger.Println(err)
 				return err
 			}
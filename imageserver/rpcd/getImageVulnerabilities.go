@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) GetImageVulnerabilities(conn *srpc.Conn,
+	request imageserver.GetImageVulnerabilitiesRequest,
+	reply *imageserver.GetImageVulnerabilitiesResponse) error {
+	findings, loadedAt, err := t.imageDataBase.GetImageVulnerabilities(
+		request.ImageName)
+	reply.Error = errors.ErrorToString(err)
+	reply.FeedLoadedAt = loadedAt
+	reply.Findings = findings
+	return nil
+}
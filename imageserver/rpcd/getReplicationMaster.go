@@ -9,5 +9,6 @@ func (t *srpcType) GetReplicationMaster(conn *srpc.Conn,
 	request imageserver.GetReplicationMasterRequest,
 	reply *imageserver.GetReplicationMasterResponse) error {
 	reply.ReplicationMaster = t.replicationMaster
+	reply.ReplicationPeers = t.getReplicationPeers()
 	return nil
 }
@@ -10,8 +10,16 @@ func (hw *htmlWriter) writeHtml(writer io.Writer) {
 		fmt.Fprintln(writer,
 			`<font color="purple">Running in archive mode</font><br>`)
 	}
+	(*srpcType)(hw).writeReplicationSelectionHtml(writer)
 	fmt.Fprintf(writer, "Replication clients: %d<br>\n",
 		hw.getNumReplicationClients())
+	if len(hw.replicationPeers) > 0 {
+		fmt.Fprint(writer, "Replication peers:")
+		for _, peer := range hw.replicationPeers {
+			peer.writeHtml(writer)
+		}
+		fmt.Fprintln(writer, "<br>")
+	}
 }
 
 func (hw *htmlWriter) getNumReplicationClients() uint {
@@ -200,7 +200,7 @@ func (g *combinedGetter) getDataReader(hashVal hash.Hash, isTree bool) (
 	}
 	rc.Close()
 	if computedHash != hashVal {
-		return nil, 0, fmt.Errorf("claimed hash: %x != computed hash: %",
+		return nil, 0, fmt.Errorf("claimed hash: %x != computed hash: %x",
 			hashVal, computedHash)
 	}
 	if added {
@@ -250,7 +250,7 @@ func (g *combinedGetter) importObject(hashVal hash.Hash) error {
 		return err
 	}
 	if computedHash != hashVal {
-		return fmt.Errorf("claimed hash: %x != computed hash: %",
+		return fmt.Errorf("claimed hash: %x != computed hash: %x",
 			hashVal, computedHash)
 	}
 	if added {
@@ -0,0 +1,340 @@
+package rpcd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func newPeer(address string) *peerType {
+	return &peerType{
+		address:  address,
+		resource: srpc.NewClientResource("tcp", address),
+	}
+}
+
+// directoryWins returns true if the peer directory metadata should replace the
+// local directory metadata. The most recently modified metadata wins, with
+// ties broken by comparing the contents, so that all peers converge.
+func directoryWins(local, peer image.DirectoryMetadata) bool {
+	if !peer.ModifiedOn.Equal(local.ModifiedOn) {
+		return peer.ModifiedOn.After(local.ModifiedOn)
+	}
+	if peer.OwnerGroup != local.OwnerGroup {
+		return peer.OwnerGroup > local.OwnerGroup
+	}
+	return peer.QuotaBytes > local.QuotaBytes
+}
+
+// peerImageWins returns true if the peer image should replace the local image
+// with the same name. The image which was created first wins, with ties broken
+// by the creator username, so that all peers converge on the same image.
+func peerImageWins(local, peer *image.Image) bool {
+	if !peer.CreatedOn.Equal(local.CreatedOn) {
+		return peer.CreatedOn.Before(local.CreatedOn)
+	}
+	return peer.CreatedBy < local.CreatedBy
+}
+
+// sameImage returns true if the images are replicas of the same image.
+func sameImage(left, right *image.Image) bool {
+	return left.CreatedOn.Equal(right.CreatedOn) &&
+		left.CreatedBy == right.CreatedBy
+}
+
+func (peer *peerType) setState(connected bool, err error) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	peer.connected = connected
+	if err != nil {
+		peer.lastError = err.Error()
+		peer.lastErrorTime = time.Now()
+	}
+}
+
+func (peer *peerType) writeHtml(writer io.Writer) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	fmt.Fprintf(writer, " <a href=\"http://%s/\">%s</a>",
+		peer.address, peer.address)
+	if peer.connected {
+		fmt.Fprint(writer, " (connected)")
+	} else if peer.lastError != "" {
+		fmt.Fprintf(writer, " (<font color=\"red\">%s %s ago</font>)",
+			peer.lastError,
+			format.Duration(time.Since(peer.lastErrorTime)))
+	} else {
+		fmt.Fprint(writer, " (disconnected)")
+	}
+}
+
+// peerReplicator will receive image updates from a peer imageserver in
+// multi-master mode. Unlike the replicator for a replication master, images
+// and directories which are not present on the peer are not deleted.
+func (t *srpcType) peerReplicator(peer *peerType) {
+	initialTimeout := time.Second * 15
+	timeout := initialTimeout
+	var nextSleepStopTime time.Time
+	logger := prefixlogger.New(fmt.Sprintf("Peer(%s): ", peer.address),
+		t.logger)
+	for {
+		nextSleepStopTime = time.Now().Add(timeout)
+		if client, err := srpc.DialHTTP("tcp", peer.address,
+			timeout); err != nil {
+			logger.Printf("error dialing: %s\n", err)
+			peer.setState(false, err)
+		} else {
+			if conn, err := callGetPeerUpdates(client); err != nil {
+				logger.Println(err)
+				peer.setState(false, err)
+			} else {
+				peer.setState(true, nil)
+				err := t.getPeerUpdates(conn, peer, logger)
+				if err == io.EOF {
+					logger.Println("connection closed")
+					if nextSleepStopTime.Sub(time.Now()) < 1 {
+						timeout = initialTimeout
+					}
+					peer.setState(false, nil)
+				} else {
+					logger.Println(err)
+					peer.setState(false, err)
+				}
+				conn.Close()
+			}
+			client.Close()
+			peer.resource.ScheduleClose()
+		}
+		time.Sleep(nextSleepStopTime.Sub(time.Now()))
+		if timeout < time.Minute {
+			timeout *= 2
+		}
+	}
+}
+
+func (t *srpcType) getPeerUpdates(conn *srpc.Conn, peer *peerType,
+	logger log.DebugLogger) error {
+	logger.Println("connected")
+	replicationStartTime := time.Now()
+	for {
+		var imageUpdate imageserver.ImageUpdate
+		if err := conn.Decode(&imageUpdate); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return errors.New("decode err: " + err.Error())
+		}
+		switch imageUpdate.Operation {
+		case imageserver.OperationAddImage:
+			if imageUpdate.Name == "" { // Initial list has been sent.
+				logger.Printf("synchronised with peer in %s\n",
+					format.Duration(time.Since(replicationStartTime)))
+				continue
+			}
+			if !t.checkReplicateImage(imageUpdate.Name) {
+				continue
+			}
+			if err := t.addPeerImage(peer, imageUpdate.Name); err != nil {
+				logger.Printf("error adding image: %s: %s\n",
+					imageUpdate.Name, err)
+			}
+		case imageserver.OperationDeleteDirectory:
+			if !t.imageDataBase.CheckDirectory(imageUpdate.Name) {
+				continue
+			}
+			logger.Printf("delete directory: %s\n", imageUpdate.Name)
+			err := t.imageDataBase.DeleteDirectory(imageUpdate.Name,
+				&srpc.AuthInformation{HaveMethodAccess: true})
+			if err != nil {
+				logger.Println(err)
+			}
+		case imageserver.OperationDeleteImage:
+			if !t.checkReplicateImage(imageUpdate.Name) {
+				continue
+			}
+			deletedOn := imageUpdate.DeletedOn
+			if deletedOn.IsZero() { // Peer does not record deletion times.
+				deletedOn = time.Now()
+			}
+			deleted, err := t.imageDataBase.DeleteReplicatedImage(
+				imageUpdate.Name, deletedOn)
+			if err != nil {
+				logger.Printf("error deleting image: %s: %s\n",
+					imageUpdate.Name, err)
+			} else if deleted {
+				logger.Printf("delete image: %s\n", imageUpdate.Name)
+			}
+		case imageserver.OperationMakeDirectory:
+			directory := imageUpdate.Directory
+			if directory == nil {
+				return errors.New("nil imageUpdate.Directory")
+			}
+			if err := t.mergePeerDirectory(*directory); err != nil {
+				return err
+			}
+		default:
+			logger.Printf("unknown operation: %d\n", imageUpdate.Operation)
+		}
+	}
+}
+
+// addPeerImage will add an image from a peer, resolving any conflict with a
+// different local image of the same name.
+func (t *srpcType) addPeerImage(peer *peerType, name string) error {
+	timeout := time.Second * 60
+	if t.checkImageBeingInjected(name) {
+		return nil
+	}
+	logger := prefixlogger.New(fmt.Sprintf("Peer(%s): %s: ", peer.address,
+		name), t.logger)
+	localImage := t.imageDataBase.GetImage(name)
+	client, err := peer.resource.GetHTTP(nil, timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Put()
+	if localImage != nil {
+		peerImage, err := getPeerImage(client, name, true, timeout)
+		if err != nil {
+			client.Close()
+			return err
+		}
+		if sameImage(localImage, peerImage) {
+			return t.mergePeerImageExpiration(name, localImage, peerImage,
+				logger)
+		}
+		if !peerImageWins(localImage, peerImage) {
+			logger.Debugln(0, "conflict: keeping local image")
+			return nil
+		}
+		logger.Println("conflict: replacing with peer image")
+	} else if deletedOn, ok := t.imageDataBase.GetImageDeletionTime(
+		name); ok {
+		peerImage, err := getPeerImage(client, name, true, timeout)
+		if err != nil {
+			client.Close()
+			return err
+		}
+		if !peerImage.CreatedOn.After(deletedOn) {
+			// The peer will delete its image when it gets the deletion.
+			logger.Debugln(0, "deleted locally, not adding")
+			return nil
+		}
+		logger.Println("add image again after deletion")
+	} else {
+		logger.Println("add image")
+	}
+	img, err := getPeerImage(client, name, false, timeout)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	img.FileSystem.RebuildInodePointers()
+	err = t.imageDataBase.DoWithPendingImage(img, func() error {
+		if err := t.getMissingObjects(img, client, logger); err != nil {
+			client.Close()
+			return err
+		}
+		if localImage != nil {
+			return t.imageDataBase.ReplaceImage(img, name)
+		}
+		return t.imageDataBase.AddReplicatedImage(img, name)
+	})
+	if err != nil {
+		return err
+	}
+	logger.Println("added image")
+	return nil
+}
+
+// callGetPeerUpdates will request image updates from a peer, including
+// deleted images, so that deletions made while disconnected are propagated.
+func callGetPeerUpdates(client *srpc.Client) (*srpc.Conn, error) {
+	conn, err := client.Call("ImageServer.GetFilteredImageUpdates")
+	if err != nil {
+		return nil, err
+	}
+	request := imageserver.GetFilteredImageUpdatesRequest{
+		IncludeDeletions: true,
+	}
+	if err := conn.Encode(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func getPeerImage(client *srpc.Client, name string, ignoreFilesystem bool,
+	timeout time.Duration) (*image.Image, error) {
+	request := imageserver.GetImageRequest{
+		ImageName:        name,
+		IgnoreFilesystem: ignoreFilesystem,
+		Timeout:          timeout,
+	}
+	var reply imageserver.GetImageResponse
+	err := client.RequestReply("ImageServer.GetImage", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Image == nil {
+		return nil, errors.New(name + ": not found")
+	}
+	return reply.Image, nil
+}
+
+// mergePeerDirectory will create or update a directory from a peer, if the
+// peer metadata are newer.
+func (t *srpcType) mergePeerDirectory(directory image.Directory) error {
+	for _, localDirectory := range t.imageDataBase.ListDirectories() {
+		if localDirectory.Name != directory.Name {
+			continue
+		}
+		if !directoryWins(localDirectory.Metadata, directory.Metadata) {
+			return nil
+		}
+		break
+	}
+	return t.imageDataBase.UpdateDirectory(directory)
+}
+
+// mergePeerImageExpiration will extend the expiration time of the local image
+// if the peer has a later expiration time.
+func (t *srpcType) mergePeerImageExpiration(name string,
+	localImage, peerImage *image.Image, logger log.Logger) error {
+	if localImage.ExpiresAt.IsZero() {
+		return nil
+	}
+	if !peerImage.ExpiresAt.IsZero() &&
+		!peerImage.ExpiresAt.After(localImage.ExpiresAt) {
+		return nil
+	}
+	changed, err := t.imageDataBase.ChangeImageExpiration(name,
+		peerImage.ExpiresAt, &srpc.AuthInformation{HaveMethodAccess: true})
+	if err != nil {
+		return err
+	}
+	if changed {
+		logger.Println("extended expiration time")
+	}
+	return nil
+}
+
+func (t *srpcType) getReplicationPeers() []string {
+	addresses := make([]string, 0, len(t.replicationPeers))
+	for _, peer := range t.replicationPeers {
+		addresses = append(addresses, peer.address)
+	}
+	return addresses
+}
@@ -0,0 +1,85 @@
+package rpcd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+func TestDirectoryWins(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Minute)
+	var tests = []struct {
+		name        string
+		local, peer image.DirectoryMetadata
+		want        bool
+	}{
+		{"identical", image.DirectoryMetadata{ModifiedOn: older},
+			image.DirectoryMetadata{ModifiedOn: older}, false},
+		{"peer newer", image.DirectoryMetadata{ModifiedOn: older},
+			image.DirectoryMetadata{ModifiedOn: newer}, true},
+		{"peer older",
+			image.DirectoryMetadata{ModifiedOn: newer, OwnerGroup: "a"},
+			image.DirectoryMetadata{ModifiedOn: older, OwnerGroup: "b"},
+			false},
+		{"tie, peer group greater",
+			image.DirectoryMetadata{ModifiedOn: older, OwnerGroup: "a"},
+			image.DirectoryMetadata{ModifiedOn: older, OwnerGroup: "b"},
+			true},
+		{"tie, peer group lesser",
+			image.DirectoryMetadata{ModifiedOn: older, OwnerGroup: "b"},
+			image.DirectoryMetadata{ModifiedOn: older, OwnerGroup: "a"},
+			false},
+		{"tie, peer quota greater",
+			image.DirectoryMetadata{ModifiedOn: older, QuotaBytes: 1},
+			image.DirectoryMetadata{ModifiedOn: older, QuotaBytes: 2},
+			true},
+		{"tie, peer quota lesser",
+			image.DirectoryMetadata{ModifiedOn: older, QuotaBytes: 2},
+			image.DirectoryMetadata{ModifiedOn: older, QuotaBytes: 1},
+			false},
+	}
+	for _, test := range tests {
+		if got := directoryWins(test.local, test.peer); got != test.want {
+			t.Errorf("%s: directoryWins() = %v", test.name, got)
+		}
+		// Peers must converge: at most one side may win.
+		if directoryWins(test.local, test.peer) &&
+			directoryWins(test.peer, test.local) {
+			t.Errorf("%s: both sides win", test.name)
+		}
+	}
+}
+
+func TestPeerImageWins(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Minute)
+	var tests = []struct {
+		name        string
+		local, peer image.Image
+		want        bool
+	}{
+		{"identical", image.Image{CreatedBy: "a", CreatedOn: older},
+			image.Image{CreatedBy: "a", CreatedOn: older}, false},
+		{"peer created first", image.Image{CreatedBy: "a", CreatedOn: newer},
+			image.Image{CreatedBy: "b", CreatedOn: older}, true},
+		{"peer created later", image.Image{CreatedBy: "b", CreatedOn: older},
+			image.Image{CreatedBy: "a", CreatedOn: newer}, false},
+		{"tie, peer creator lesser",
+			image.Image{CreatedBy: "b", CreatedOn: older},
+			image.Image{CreatedBy: "a", CreatedOn: older}, true},
+		{"tie, peer creator greater",
+			image.Image{CreatedBy: "a", CreatedOn: older},
+			image.Image{CreatedBy: "b", CreatedOn: older}, false},
+	}
+	for _, test := range tests {
+		if got := peerImageWins(&test.local, &test.peer); got != test.want {
+			t.Errorf("%s: peerImageWins() = %v", test.name, got)
+		}
+		if peerImageWins(&test.local, &test.peer) &&
+			peerImageWins(&test.peer, &test.local) {
+			t.Errorf("%s: both sides win", test.name)
+		}
+	}
+}
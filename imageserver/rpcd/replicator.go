@@ -113,16 +113,7 @@ func (t *srpcType) getUpdates(conn *srpc.Conn,
 					format.Duration(time.Since(replicationStartTime)))
 				continue
 			}
-			if t.excludeFilter != nil &&
-				t.excludeFilter.Match(imageUpdate.Name) {
-				t.logger.Debugf(0, "Excluding %s from replication\n",
-					imageUpdate.Name)
-				continue
-			}
-			if t.includeFilter != nil &&
-				!t.includeFilter.Match(imageUpdate.Name) {
-				t.logger.Debugf(0, "Not including %s in replication\n",
-					imageUpdate.Name)
+			if !t.checkReplicateImage(imageUpdate.Name) {
 				continue
 			}
 			if initialImages != nil {
@@ -137,6 +128,9 @@ func (t *srpcType) getUpdates(conn *srpc.Conn,
 			if t.archiveMode {
 				continue
 			}
+			if !t.checkReplicateDirectory(imageUpdate.Name) {
+				continue
+			}
 			t.logger.Printf("Replicator(%s): delete directory\n",
 				imageUpdate.Name)
 			err := t.imageDataBase.DeleteDirectory(imageUpdate.Name,
@@ -148,6 +142,9 @@ func (t *srpcType) getUpdates(conn *srpc.Conn,
 			if t.archiveMode {
 				continue
 			}
+			if !t.imageDataBase.CheckImage(imageUpdate.Name) {
+				continue // Not replicated: filtered or not selected.
+			}
 			t.logger.Printf("Replicator(%s): delete image\n", imageUpdate.Name)
 			err := t.imageDataBase.DeleteImage(imageUpdate.Name,
 				&srpc.AuthInformation{HaveMethodAccess: true})
@@ -159,6 +156,9 @@ func (t *srpcType) getUpdates(conn *srpc.Conn,
 			if directory == nil {
 				return errors.New("nil imageUpdate.Directory")
 			}
+			if !t.checkReplicateDirectory(directory.Name) {
+				continue
+			}
 			if initialDirectories != nil {
 				initialDirectories[directory.Name] = struct{}{}
 			}
@@ -249,6 +249,15 @@ func (t *srpcType) addImage(name string) error {
 		return err
 	}
 	defer client.Put()
+	match, err := t.checkReplicateImageTags(client, name, timeout)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	if !match {
+		logger.Debugln(0, "tags do not match, not replicating")
+		return nil
+	}
 	request := imageserver.GetImageRequest{
 		ImageName: name,
 		Timeout:   timeout,
@@ -277,8 +286,7 @@ func (t *srpcType) addImage(name string) error {
 			client.Close()
 			return err
 		}
-		err := t.imageDataBase.AddImage(img, name,
-			&srpc.AuthInformation{HaveMethodAccess: true})
+		err := t.imageDataBase.AddReplicatedImage(img, name)
 		if err != nil {
 			return err
 		}
@@ -291,6 +299,24 @@ func (t *srpcType) addImage(name string) error {
 	return nil
 }
 
+// checkReplicateImage returns true if the image passes the replication
+// filters.
+func (t *srpcType) checkReplicateImage(name string) bool {
+	if !t.checkReplicateImageDirectory(name) {
+		t.logger.Debugf(0, "%s not in replication directories\n", name)
+		return false
+	}
+	if t.excludeFilter != nil && t.excludeFilter.Match(name) {
+		t.logger.Debugf(0, "Excluding %s from replication\n", name)
+		return false
+	}
+	if t.includeFilter != nil && !t.includeFilter.Match(name) {
+		t.logger.Debugf(0, "Not including %s in replication\n", name)
+		return false
+	}
+	return true
+}
+
 func (t *srpcType) checkImageBeingInjected(name string) bool {
 	t.imagesBeingInjectedLock.Lock()
 	defer t.imagesBeingInjectedLock.Unlock()
@@ -0,0 +1,117 @@
+package rpcd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+type directorySelector struct {
+	name    string
+	subtree bool // If false, only images directly in the directory.
+}
+
+// newDirectorySelectors returns selectors for the specified directories. The
+// directory names follow the conventions of the DirectoryName field in
+// ListSelectedImagesRequest.
+func newDirectorySelectors(directories []string) []directorySelector {
+	selectors := make([]directorySelector, 0, len(directories))
+	for _, directory := range directories {
+		if strings.HasSuffix(directory, "/") {
+			selectors = append(selectors, directorySelector{
+				name: filepath.Clean(directory),
+			})
+		} else {
+			selectors = append(selectors, directorySelector{
+				name:    filepath.Clean(directory),
+				subtree: true,
+			})
+		}
+	}
+	return selectors
+}
+
+// checkReplicateDirectory returns true if the directory should be replicated.
+// Parents of the selected directories are replicated so that the selected
+// directories may be created.
+func (t *srpcType) checkReplicateDirectory(name string) bool {
+	if len(t.replicationDirectories) < 1 {
+		return true
+	}
+	for _, selector := range t.replicationDirectories {
+		if name == selector.name ||
+			strings.HasPrefix(selector.name, name+"/") {
+			return true
+		}
+		if selector.subtree && strings.HasPrefix(name, selector.name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplicateImageDirectory returns true if the image is in one of the
+// selected directories.
+func (t *srpcType) checkReplicateImageDirectory(name string) bool {
+	if len(t.replicationDirectories) < 1 {
+		return true
+	}
+	dirname := filepath.Dir(name)
+	for _, selector := range t.replicationDirectories {
+		if selector.name == "." && selector.subtree {
+			return true
+		}
+		if dirname == selector.name {
+			return true
+		}
+		if selector.subtree &&
+			strings.HasPrefix(dirname, selector.name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplicateImageTags returns true if the tags of the image on the
+// replication master match the replication tags. Only the image metadata are
+// fetched, so that the file-system for unwanted images is not transferred.
+func (t *srpcType) checkReplicateImageTags(client *srpc.Client, name string,
+	timeout time.Duration) (bool, error) {
+	if t.replicationTagMatcher == nil {
+		return true, nil
+	}
+	request := imageserver.GetImageRequest{
+		ImageName:        name,
+		IgnoreFilesystem: true,
+		Timeout:          timeout,
+	}
+	var reply imageserver.GetImageResponse
+	err := client.RequestReply("ImageServer.GetImage", request, &reply)
+	if err != nil {
+		return false, err
+	}
+	if reply.Image == nil {
+		return false, fmt.Errorf("%s: not found", name)
+	}
+	return t.replicationTagMatcher.MatchEach(reply.Image.Tags), nil
+}
+
+func (t *srpcType) writeReplicationSelectionHtml(writer io.Writer) {
+	if len(t.replicationDirectories) < 1 && t.replicationTagMatcher == nil {
+		return
+	}
+	fmt.Fprint(writer, "Selective replication:")
+	if len(replicationDirectories) > 0 {
+		fmt.Fprintf(writer, " directories: %s",
+			strings.Join(replicationDirectories, ","))
+	}
+	if t.replicationTagMatcher != nil {
+		fmt.Fprintf(writer, " tags: %s", replicationTagsToMatch.String())
+	}
+	fmt.Fprintln(writer, "<br>")
+}
@@ -0,0 +1,165 @@
+package rpcd
+
+import (
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
+)
+
+func TestCheckReplicateDirectory(t *testing.T) {
+	var tests = []struct {
+		name        string
+		directories []string
+		want        map[string]bool
+	}{
+		{"no selection", nil, map[string]bool{"a": true, "a/b/c": true}},
+		{"subtree", []string{"a/b"},
+			map[string]bool{
+				"a":     true, // Parent is needed to create the directory.
+				"a/b":   true,
+				"a/b/c": true,
+				"a/bc":  false,
+				"b":     false,
+			}},
+		{"directory only", []string{"a/b/"},
+			map[string]bool{
+				"a":     true,
+				"a/b":   true,
+				"a/b/c": false,
+				"x":     false,
+			}},
+		{"multiple", []string{"a/", "x/y"},
+			map[string]bool{
+				"a":     true,
+				"a/b":   false,
+				"x":     true,
+				"x/y/z": true,
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srpcObj := &srpcType{
+				replicationDirectories: newDirectorySelectors(
+					test.directories),
+			}
+			for name, want := range test.want {
+				if got := srpcObj.checkReplicateDirectory(name); got != want {
+					t.Errorf("checkReplicateDirectory(%s) = %t, want %t",
+						name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReplicateImage(t *testing.T) {
+	mustLoadFilter := func(lines ...string) *filter.Filter {
+		if len(lines) < 1 {
+			return nil
+		}
+		f, err := filter.New(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	var tests = []struct {
+		name        string
+		directories []string
+		exclude     []string
+		include     []string
+		want        map[string]bool
+	}{
+		{"no selection", nil, nil, nil,
+			map[string]bool{"a/image": true, "image": true}},
+		{"subtree", []string{"a"}, nil, nil,
+			map[string]bool{
+				"a/image":   true,
+				"a/b/image": true,
+				"ab/image":  false,
+				"image":     false,
+			}},
+		{"directory only", []string{"a/"}, nil, nil,
+			map[string]bool{
+				"a/image":   true,
+				"a/b/image": false,
+			}},
+		{"top-level subtree", []string{"."}, nil, nil,
+			map[string]bool{"a/b/image": true, "image": true}},
+		{"top-level only", []string{"./"}, nil, nil,
+			map[string]bool{"a/image": false, "image": true}},
+		{"exclude", []string{"a"}, []string{"a/test/.*"}, nil,
+			map[string]bool{
+				"a/image":      true,
+				"a/test/image": false,
+			}},
+		{"include", nil, nil, []string{"a/.*"},
+			map[string]bool{
+				"a/image": true,
+				"b/image": false,
+			}},
+		{"exclude wins over include", nil, []string{"a/test/.*"},
+			[]string{"a/.*"},
+			map[string]bool{
+				"a/image":      true,
+				"a/test/image": false,
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srpcObj := &srpcType{
+				excludeFilter: mustLoadFilter(test.exclude...),
+				includeFilter: mustLoadFilter(test.include...),
+				logger:        testlogger.New(t),
+				replicationDirectories: newDirectorySelectors(
+					test.directories),
+			}
+			for name, want := range test.want {
+				if got := srpcObj.checkReplicateImage(name); got != want {
+					t.Errorf("checkReplicateImage(%s) = %t, want %t",
+						name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicationTagMatcher(t *testing.T) {
+	srpcObj := &srpcType{replicationTagMatcher: tagmatcher.New(nil, false)}
+	// Without tags to match, the image is not fetched from the master.
+	match, err := srpcObj.checkReplicateImageTags(nil, "image", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("image not replicated without tags to match")
+	}
+	srpcObj.replicationTagMatcher = tagmatcher.New(tags.MatchTags{
+		"Environment": {"production", "staging"},
+		"Team":        {"infra"},
+	}, false)
+	var tests = []struct {
+		name string
+		tags tags.Tags
+		want bool
+	}{
+		{"all match", tags.Tags{"Environment": "staging", "Team": "infra"},
+			true},
+		{"extra tags", tags.Tags{"Environment": "production",
+			"Team": "infra", "Owner": "someone"}, true},
+		{"wrong value", tags.Tags{"Environment": "test", "Team": "infra"},
+			false},
+		{"missing key", tags.Tags{"Environment": "production"}, false},
+		{"no tags", nil, false},
+	}
+	for _, test := range tests {
+		got := srpcObj.replicationTagMatcher.MatchEach(test.tags)
+		if got != test.want {
+			t.Errorf("%s: MatchEach(%v) = %t, want %t",
+				test.name, test.tags, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) SetDirectoryQuota(conn *srpc.Conn,
+	request imageserver.SetDirectoryQuotaRequest,
+	reply *imageserver.SetDirectoryQuotaResponse) error {
+	if err := t.checkMutability(); err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	t.logger.Printf("SetDirectoryQuota(%s) to: %s by %s\n",
+		request.DirectoryName, format.FormatBytes(request.QuotaBytes),
+		conn.Username())
+	reply.Error = errors.ErrorToString(
+		t.imageDataBase.SetDirectoryQuota(request.DirectoryName,
+			request.QuotaBytes, conn.GetAuthInformation()))
+	return nil
+}
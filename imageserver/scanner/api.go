@@ -12,6 +12,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
 )
 
@@ -22,6 +23,7 @@ const metadataFile = ".metadata"
 
 type Config struct {
 	BaseDirectory                       string
+	BuildCacheLifetime                  time.Duration // Default: 2 weeks.
 	LockCheckInterval                   time.Duration
 	LockLogTimeout                      time.Duration
 	MaximumExpirationDuration           time.Duration // Default: 1 day.
@@ -41,8 +43,15 @@ type ImageDataBase struct {
 	secret      []byte
 	sync.RWMutex
 	// Protected by main lock.
+	buildCache      map[hash.Hash]time.Time // Value: last used.
 	directoryMap    map[string]image.DirectoryMetadata
-	imageMap        map[string]*imageType // nil: write in progress.
+	directoryUsages map[string]*directoryUsageType // Directories with quotas.
+	imageMap        map[string]*imageType          // nil: write in progress.
+	objectIndex     imageIndex[hash.Hash]
+	packageIndex    packageIndex
+	pathIndex       imageIndex[string]
+	reservedImages  map[string]*image.Image // Counted against quotas.
+	tombstones      map[string]time.Time    // Deleted images.
 	addNotifiers    notifiers
 	deleteNotifiers notifiers
 	mkdirNotifiers  makeDirectoryNotifiers
@@ -52,6 +61,13 @@ type ImageDataBase struct {
 	objectFetchLock  sync.Mutex
 }
 
+// directoryUsageType tracks the objects used by the images in a directory tree
+// which has a quota.
+type directoryUsageType struct {
+	objects   map[hash.Hash]objectUsageType
+	usedBytes uint64
+}
+
 type imageType struct {
 	computedFiles []filesystem.ComputedFile
 	fileChecksum  []byte
@@ -63,9 +79,15 @@ type imageType struct {
 	usageEstimate uint64
 }
 
+type objectUsageType struct {
+	numImages uint64
+	size      uint64
+}
+
 type Params struct {
-	Logger       log.DebugLogger
-	ObjectServer objectserver.FullObjectServer
+	Logger            log.DebugLogger
+	ObjectServer      objectserver.FullObjectServer
+	VulnerabilityFeed *vulnerability.Feed // Optional.
 }
 
 func Load(config Config, params Params) (*ImageDataBase, error) {
@@ -85,9 +107,25 @@ func LoadImageDataBase(baseDir string, objSrv objectserver.FullObjectServer,
 		})
 }
 
+// AddBuildCacheObjects will add objects to the build cache, which keeps them
+// from being garbage collected until they have not been added again for the
+// build cache lifetime.
+func (imdb *ImageDataBase) AddBuildCacheObjects(hashes []hash.Hash) error {
+	return imdb.addBuildCacheObjects(hashes)
+}
+
 func (imdb *ImageDataBase) AddImage(img *image.Image, name string,
 	authInfo *srpc.AuthInformation) error {
-	return imdb.addImage(img, name, authInfo)
+	return imdb.addImage(img, name, authInfo, false)
+}
+
+// AddReplicatedImage will add an image which was received from a replication
+// master or peer. Quotas are not enforced, since they were enforced when the
+// image was first added.
+func (imdb *ImageDataBase) AddReplicatedImage(img *image.Image,
+	name string) error {
+	return imdb.addImage(img, name,
+		&srpc.AuthInformation{HaveMethodAccess: true}, true)
 }
 
 func (imdb *ImageDataBase) ChangeImageExpiration(name string,
@@ -95,6 +133,12 @@ func (imdb *ImageDataBase) ChangeImageExpiration(name string,
 	return imdb.changeImageExpiration(name, expiresAt, authInfo)
 }
 
+// GetBuildCacheStatistics returns the number of objects in the build cache and
+// their total size.
+func (imdb *ImageDataBase) GetBuildCacheStatistics() (uint, uint64) {
+	return imdb.getBuildCacheStatistics()
+}
+
 func (imdb *ImageDataBase) CheckDirectory(name string) bool {
 	return imdb.checkDirectory(name)
 }
@@ -126,6 +170,14 @@ func (imdb *ImageDataBase) DeleteImage(name string,
 	return imdb.deleteImage(name, authInfo)
 }
 
+// DeleteReplicatedImage will apply an image deletion received from a
+// replication peer. It returns true if the image was deleted or the deletion
+// was recorded.
+func (imdb *ImageDataBase) DeleteReplicatedImage(name string,
+	deletedOn time.Time) (bool, error) {
+	return imdb.deleteReplicatedImage(name, deletedOn)
+}
+
 // DeleteUnreferencedObjects will delete some or all unreferenced objects.
 // Objects are randomly selected for deletion, until both the percentage and
 // bytes thresholds are satisfied.
@@ -147,6 +199,32 @@ func (imdb *ImageDataBase) FindLatestImage(
 	return imdb.findLatestImage(request)
 }
 
+// GetDirectoryUsage will return the object usage for the images in the
+// specified directory tree.
+func (imdb *ImageDataBase) GetDirectoryUsage(dirname string) (
+	proto.DirectoryUsage, error) {
+	return imdb.getDirectoryUsage(dirname)
+}
+
+// FindImagesWithObject will return the names of images which contain the
+// specified object.
+func (imdb *ImageDataBase) FindImagesWithObject(hashVal hash.Hash) []string {
+	return imdb.findImagesWithObject(hashVal)
+}
+
+// FindImagesWithPackage will return the images which contain the specified
+// package. If version is empty, all versions are matched.
+func (imdb *ImageDataBase) FindImagesWithPackage(name,
+	version string) []proto.ImagePackage {
+	return imdb.findImagesWithPackage(name, version)
+}
+
+// FindImagesWithPath will return the names of images which contain the
+// specified pathname.
+func (imdb *ImageDataBase) FindImagesWithPath(pathname string) []string {
+	return imdb.findImagesWithPath(pathname)
+}
+
 func (imdb *ImageDataBase) GetImage(name string) *image.Image {
 	return imdb.getImage(name)
 }
@@ -163,6 +241,12 @@ func (imdb *ImageDataBase) GetImageArchive(name string) ([]byte, error) {
 	return imdb.getImageArchive(name)
 }
 
+// GetImageDeletionTime returns the time the image was deleted, if it was.
+func (imdb *ImageDataBase) GetImageDeletionTime(name string) (
+	time.Time, bool) {
+	return imdb.getImageDeletionTime(name)
+}
+
 func (imdb *ImageDataBase) GetImageFileChecksum(name string) []byte {
 	return imdb.getImageFileChecksum(name)
 }
@@ -181,6 +265,14 @@ func (imdb *ImageDataBase) GetImageInodes(imageName string,
 	return imdb.getImageInodes(imageName, filenames)
 }
 
+// GetImageVulnerabilities will match the packages in the specified image
+// against the vulnerability feed and will return the findings and the time the
+// feed was loaded.
+func (imdb *ImageDataBase) GetImageVulnerabilities(name string) (
+	[]vulnerability.Finding, time.Time, error) {
+	return imdb.getImageVulnerabilities(name)
+}
+
 // GetImageUsageEstimate will return the usage estimate for the specified image
 // and true if found, else it will return 0, false.
 func (imdb *ImageDataBase) GetImageUsageEstimate(name string) (uint64, bool) {
@@ -195,6 +287,11 @@ func (imdb *ImageDataBase) ListDirectories() []image.Directory {
 	return imdb.listDirectories()
 }
 
+// ListDeletedImages returns the deleted images and their deletion times.
+func (imdb *ImageDataBase) ListDeletedImages() map[string]time.Time {
+	return imdb.listDeletedImages()
+}
+
 func (imdb *ImageDataBase) ListImages() []string {
 	return imdb.listImages(proto.ListSelectedImagesRequest{})
 }
@@ -243,12 +340,26 @@ func (imdb *ImageDataBase) RegisterMakeDirectoryNotifier() <-chan image.Director
 	return imdb.registerMakeDirectoryNotifier()
 }
 
+// ReplaceImage will replace an existing image with a different image of the
+// same name. This is used to resolve conflicts between replication peers and
+// bypasses permission checks.
+func (imdb *ImageDataBase) ReplaceImage(img *image.Image, name string) error {
+	return imdb.replaceImage(img, name)
+}
+
 func (imdb *ImageDataBase) RestoreImageFromArchive(
 	request proto.RestoreImageFromArchiveRequest,
 	authInfo *srpc.AuthInformation) error {
 	return imdb.restoreImageFromArchive(request, authInfo)
 }
 
+// SetDirectoryQuota will set the quota for the specified directory tree. A zero
+// value removes the quota.
+func (imdb *ImageDataBase) SetDirectoryQuota(dirname string, quotaBytes uint64,
+	authInfo *srpc.AuthInformation) error {
+	return imdb.setDirectoryQuota(dirname, quotaBytes, authInfo)
+}
+
 func (imdb *ImageDataBase) UnregisterAddNotifier(channel <-chan string) {
 	imdb.unregisterAddNotifier(channel)
 }
@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+)
+
+const buildCacheFile = ".buildCache"
+
+// buildCacheObjects is the set of objects in the build cache. The objects are
+// referenced (their refcounts are incremented) while they are in the build
+// cache, so that they are not garbage collected even though no image uses
+// them.
+type buildCacheObjects map[hash.Hash]struct{}
+
+func (objects buildCacheObjects) ForEachObject(
+	objectFunc func(hash.Hash) error) error {
+	for hashVal := range objects {
+		if err := objectFunc(hashVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBuildCacheObjects will add the objects to the build cache or refresh their
+// last used times. Objects which have not been used for the build cache
+// lifetime are removed from the build cache.
+func (imdb *ImageDataBase) addBuildCacheObjects(hashes []hash.Hash) error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	newObjects := make(buildCacheObjects)
+	for _, hashVal := range hashes {
+		if _, ok := imdb.buildCache[hashVal]; !ok {
+			newObjects[hashVal] = struct{}{}
+		}
+	}
+	if len(newObjects) > 0 {
+		err := imdb.Params.ObjectServer.AdjustRefcounts(true, newObjects)
+		if err != nil {
+			return err
+		}
+	}
+	usedOn := time.Now().UTC()
+	for _, hashVal := range hashes {
+		imdb.buildCache[hashVal] = usedOn
+	}
+	imdb.expireBuildCacheWithLock(usedOn)
+	return imdb.writeBuildCacheWithLock()
+}
+
+// expireBuildCacheWithLock will remove the objects which were not used since
+// the build cache lifetime before now. This must be called with the main lock
+// held.
+func (imdb *ImageDataBase) expireBuildCacheWithLock(now time.Time) {
+	expiredObjects := make(buildCacheObjects)
+	for hashVal, usedOn := range imdb.buildCache {
+		if now.Sub(usedOn) > imdb.BuildCacheLifetime {
+			expiredObjects[hashVal] = struct{}{}
+			delete(imdb.buildCache, hashVal)
+		}
+	}
+	if len(expiredObjects) < 1 {
+		return
+	}
+	err := imdb.Params.ObjectServer.AdjustRefcounts(false, expiredObjects)
+	if err != nil {
+		imdb.Logger.Printf("Error releasing expired build cache objects: %s\n",
+			err)
+	}
+}
+
+func (imdb *ImageDataBase) getBuildCacheStatistics() (uint, uint64) {
+	imdb.RLock()
+	hashes := make([]hash.Hash, 0, len(imdb.buildCache))
+	for hashVal := range imdb.buildCache {
+		hashes = append(hashes, hashVal)
+	}
+	imdb.RUnlock()
+	sizes, err := imdb.Params.ObjectServer.CheckObjects(hashes)
+	if err != nil {
+		return uint(len(hashes)), 0
+	}
+	var numBytes uint64
+	for _, size := range sizes {
+		numBytes += size
+	}
+	return uint(len(hashes)), numBytes
+}
+
+// loadBuildCache will load the build cache and reference the objects which are
+// still available and have not expired.
+func (imdb *ImageDataBase) loadBuildCache() error {
+	buildCache := make(map[hash.Hash]time.Time)
+	err := json.ReadFromFile(path.Join(imdb.BaseDirectory, buildCacheFile),
+		&buildCache)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	hashes := make([]hash.Hash, 0, len(buildCache))
+	for hashVal := range buildCache {
+		hashes = append(hashes, hashVal)
+	}
+	sizes, err := imdb.Params.ObjectServer.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	objects := make(buildCacheObjects, len(hashes))
+	for index, hashVal := range hashes {
+		if sizes[index] > 0 {
+			objects[hashVal] = struct{}{}
+		} else {
+			delete(buildCache, hashVal)
+		}
+	}
+	err = imdb.Params.ObjectServer.AdjustRefcounts(true, objects)
+	if err != nil {
+		return err
+	}
+	imdb.Lock()
+	defer imdb.Unlock()
+	imdb.buildCache = buildCache
+	imdb.expireBuildCacheWithLock(time.Now())
+	return nil
+}
+
+// writeBuildCacheWithLock will save the build cache. This must be called with
+// the main lock held.
+func (imdb *ImageDataBase) writeBuildCacheWithLock() error {
+	return json.WriteToFile(path.Join(imdb.BaseDirectory, buildCacheFile),
+		fsutil.PublicFilePerms, "    ", imdb.buildCache)
+}
@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	objectserver "github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+)
+
+func TestBuildCacheObjects(t *testing.T) {
+	imdb, objSrv := newTestImageDataBase(t)
+	objects := addTestObjects(t, objSrv, 10, 1, 2)
+	err := imdb.AddBuildCacheObjects([]hash.Hash{objects[1], objects[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.AddBuildCacheObjects([]hash.Hash{{3}}); err == nil {
+		t.Error("missing object added to build cache")
+	}
+	if _, _, err := objSrv.DeleteUnreferenced(100, 0); err != nil {
+		t.Fatal(err)
+	}
+	sizes, err := objSrv.CheckObjects([]hash.Hash{objects[1], objects[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes[0] != 10 {
+		t.Error("build cache object garbage collected")
+	}
+	if sizes[1] != 0 {
+		t.Error("unreferenced object not garbage collected")
+	}
+	numObjects, numBytes := imdb.GetBuildCacheStatistics()
+	if numObjects != 1 || numBytes != 10 {
+		t.Errorf("statistics: %d objects, %d bytes, want 1, 10",
+			numObjects, numBytes)
+	}
+	// The build cache is remembered across restarts.
+	logger := testlogger.New(t)
+	reloadedObjSrv, err := objectserver.NewObjectServer(
+		objSrv.BaseDirectory, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadImageDataBase(imdb.BaseDirectory, reloadedObjSrv, "",
+		logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refcounts := reloadedObjSrv.GetRefcounts([]hash.Hash{objects[1]})
+	if refcounts[0] != 1 {
+		t.Errorf("refcount after restart: %d, want 1", refcounts[0])
+	}
+	// Objects which are not used for the lifetime are released.
+	reloaded.BuildCacheLifetime = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	newObjects := addTestObjects(t, reloadedObjSrv, 20, 2)
+	err = reloaded.AddBuildCacheObjects([]hash.Hash{newObjects[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refcounts = reloadedObjSrv.GetRefcounts(
+		[]hash.Hash{objects[1], newObjects[2]})
+	if refcounts[0] != 0 || refcounts[1] != 1 {
+		t.Errorf("refcounts after expiry: %v, want [0 1]", refcounts)
+	}
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+// imageIndex maps a key (such as an object hash or a pathname) to the names of
+// the images containing it.
+type imageIndex[K comparable] map[K]map[string]struct{}
+
+// packageIndex maps package name to version to image names.
+type packageIndex map[string]map[string]map[string]struct{}
+
+func (index imageIndex[K]) add(key K, imageName string) {
+	imageNames := index[key]
+	if imageNames == nil {
+		imageNames = make(map[string]struct{})
+		index[key] = imageNames
+	}
+	imageNames[imageName] = struct{}{}
+}
+
+func (index imageIndex[K]) list(key K) []string {
+	imageNames := make([]string, 0, len(index[key]))
+	for imageName := range index[key] {
+		imageNames = append(imageNames, imageName)
+	}
+	return imageNames
+}
+
+func (index imageIndex[K]) remove(key K, imageName string) {
+	imageNames := index[key]
+	if imageNames == nil {
+		return
+	}
+	delete(imageNames, imageName)
+	if len(imageNames) < 1 {
+		delete(index, key)
+	}
+}
+
+func (index packageIndex) add(imageName string, img *image.Image) {
+	for _, pkg := range img.Packages {
+		versions := index[pkg.Name]
+		if versions == nil {
+			versions = make(map[string]map[string]struct{})
+			index[pkg.Name] = versions
+		}
+		imageNames := versions[pkg.Version]
+		if imageNames == nil {
+			imageNames = make(map[string]struct{})
+			versions[pkg.Version] = imageNames
+		}
+		imageNames[imageName] = struct{}{}
+	}
+}
+
+func (index packageIndex) remove(imageName string, img *image.Image) {
+	for _, pkg := range img.Packages {
+		versions := index[pkg.Name]
+		if versions == nil {
+			continue
+		}
+		imageNames := versions[pkg.Version]
+		if imageNames == nil {
+			continue
+		}
+		delete(imageNames, imageName)
+		if len(imageNames) < 1 {
+			delete(versions, pkg.Version)
+		}
+		if len(versions) < 1 {
+			delete(index, pkg.Name)
+		}
+	}
+}
+
+// addImageToIndicesWithLock will add the objects, packages and pathnames of
+// an image to the indices. This must be called with the main lock held.
+func (imdb *ImageDataBase) addImageToIndicesWithLock(imageName string,
+	img *image.Image) {
+	img.ForEachObject(func(hashVal hash.Hash) error {
+		imdb.objectIndex.add(hashVal, imageName)
+		return nil
+	})
+	imdb.packageIndex.add(imageName, img)
+	if img.FileSystem == nil {
+		return
+	}
+	img.FileSystem.ForEachFile(
+		func(name string, _ uint64, _ filesystem.GenericInode) error {
+			imdb.pathIndex.add(name, imageName)
+			return nil
+		})
+}
+
+func (imdb *ImageDataBase) findImagesWithObject(hashVal hash.Hash) []string {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	return imdb.objectIndex.list(hashVal)
+}
+
+func (imdb *ImageDataBase) findImagesWithPackage(name,
+	version string) []proto.ImagePackage {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	var matches []proto.ImagePackage
+	for packageVersion, imageNames := range imdb.packageIndex[name] {
+		if version != "" && packageVersion != version {
+			continue
+		}
+		for imageName := range imageNames {
+			matches = append(matches, proto.ImagePackage{
+				ImageName: imageName,
+				Version:   packageVersion,
+			})
+		}
+	}
+	return matches
+}
+
+func (imdb *ImageDataBase) findImagesWithPath(pathname string) []string {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	return imdb.pathIndex.list(pathname)
+}
+
+// removeImageFromIndicesWithLock will remove the objects, packages and
+// pathnames of an image from the indices. This must be called with the main
+// lock held.
+func (imdb *ImageDataBase) removeImageFromIndicesWithLock(imageName string,
+	img *image.Image) {
+	img.ForEachObject(func(hashVal hash.Hash) error {
+		imdb.objectIndex.remove(hashVal, imageName)
+		return nil
+	})
+	imdb.packageIndex.remove(imageName, img)
+	if img.FileSystem == nil {
+		return
+	}
+	img.FileSystem.ForEachFile(
+		func(name string, _ uint64, _ filesystem.GenericInode) error {
+			imdb.pathIndex.remove(name, imageName)
+			return nil
+		})
+}
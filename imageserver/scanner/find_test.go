@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+// makeTestTreeImage will make an image with a regular file for each pathname,
+// using the object for the fill byte. Pathnames are of the form: "/dir/file".
+func makeTestTreeImage(objects testObjectsType,
+	files map[string]byte) *image.Image {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	directories := make(map[string]*filesystem.DirectoryInode)
+	addEntry := func(directory *filesystem.DirectoryInode, name string,
+		inode filesystem.GenericInode) {
+		inodeNumber := uint64(len(fs.InodeTable) + 1)
+		fs.InodeTable[inodeNumber] = inode
+		dirent := &filesystem.DirectoryEntry{
+			Name:        name,
+			InodeNumber: inodeNumber,
+		}
+		dirent.SetInode(inode)
+		directory.EntryList = append(directory.EntryList, dirent)
+	}
+	for pathname, fill := range files {
+		fields := strings.Split(pathname, "/")
+		directory := directories[fields[1]]
+		if directory == nil {
+			directory = &filesystem.DirectoryInode{}
+			directories[fields[1]] = directory
+			addEntry(&fs.DirectoryInode, fields[1], directory)
+		}
+		addEntry(directory, fields[2],
+			&filesystem.RegularInode{Hash: objects[fill], Size: 1})
+	}
+	return &image.Image{FileSystem: fs}
+}
+
+func TestFindImages(t *testing.T) {
+	imdb, objSrv := newTestImageDataBase(t)
+	objects := addTestObjects(t, objSrv, 10, 1, 2, 3)
+	images := map[string]map[string]byte{
+		"a": {"/bin/sh": 1, "/etc/passwd": 2},
+		"b": {"/etc/passwd": 2, "/usr/lib": 3},
+	}
+	for name, files := range images {
+		err := imdb.AddImage(makeTestTreeImage(objects, files), name,
+			testAuthInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(stage string, wantObjects map[hash.Hash][]string,
+		wantPaths map[string][]string) {
+		for hashVal, want := range wantObjects {
+			got := imdb.FindImagesWithObject(hashVal)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: FindImagesWithObject(%x) = %v, want %v",
+					stage, hashVal, got, want)
+			}
+		}
+		for pathname, want := range wantPaths {
+			got := imdb.FindImagesWithPath(pathname)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: FindImagesWithPath(%s) = %v, want %v",
+					stage, pathname, got, want)
+			}
+		}
+	}
+	check("added",
+		map[hash.Hash][]string{
+			objects[1]: {"a"},
+			objects[2]: {"a", "b"},
+			objects[3]: {"b"},
+			{4}:        {},
+		},
+		map[string][]string{
+			"/":           {"a", "b"},
+			"/bin":        {"a"},
+			"/etc/passwd": {"a", "b"},
+			"/usr/lib":    {"b"},
+			"/usr/bin":    {},
+		})
+	if err := imdb.DeleteImage("a", testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	check("deleted",
+		map[hash.Hash][]string{
+			objects[1]: {},
+			objects[2]: {"b"},
+		},
+		map[string][]string{
+			"/bin":        {},
+			"/etc/passwd": {"b"},
+		})
+	if len(imdb.objectIndex) != 2 || len(imdb.pathIndex) != 5 {
+		t.Errorf("stale index entries: objects: %d, paths: %d",
+			len(imdb.objectIndex), len(imdb.pathIndex))
+	}
+}
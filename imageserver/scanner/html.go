@@ -3,6 +3,8 @@ package scanner
 import (
 	"fmt"
 	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
 )
 
 func (imdb *ImageDataBase) writeHtml(writer io.Writer) {
@@ -15,6 +17,12 @@ func (imdb *ImageDataBase) writeHtml(writer io.Writer) {
 		"Number of  <a href=\"listDirectories?output=text\">directories</a>: "+
 			"<a href=\"listDirectories\">%d</a><br>\n",
 		imdb.CountDirectories())
+	fmt.Fprintln(writer,
+		"Directory <a href=\"listDirectoryUsage\">usage</a><br>")
+	if numObjects, numBytes := imdb.GetBuildCacheStatistics(); numObjects > 0 {
+		fmt.Fprintf(writer, "Build cache: %d objects (%s)<br>\n",
+			numObjects, format.FormatBytes(numBytes))
+	}
 	if imdb.ReplicationMaster != "" {
 		fmt.Fprintf(writer,
 			"Replication master: <a href=\"http://%s/\">%s</a><br>\n",
@@ -78,7 +78,7 @@ func writeImage(filename string, img *image.Image, exclusive bool) (
 }
 
 func (imdb *ImageDataBase) addImage(img *image.Image, name string,
-	authInfo *srpc.AuthInformation) error {
+	authInfo *srpc.AuthInformation, replicated bool) error {
 	if err := img.Verify(); err != nil {
 		return err
 	}
@@ -94,13 +94,25 @@ func (imdb *ImageDataBase) addImage(img *image.Image, name string,
 		if doCleanup {
 			imdb.Lock()
 			delete(imdb.imageMap, name)
+			imdb.releaseQuotasWithLock(name)
 			imdb.Unlock()
 		}
 	}()
 	if err := imdb.checkPermissions(name, nil, authInfo); err != nil {
 		return err
 	}
+	if err := imdb.reserveQuotas(name, img, !replicated); err != nil {
+		return err
+	}
 	exclusive := imdb.ReplicationMaster == ""
+	if deletedOn, ok := imdb.getImageDeletionTime(name); ok && replicated {
+		// A peer may add an image again after it was deleted.
+		if !img.CreatedOn.After(deletedOn) {
+			return errors.New("image: " + name +
+				" was deleted after it was created")
+		}
+		exclusive = false
+	}
 	if err := imdb.writeImage(name, img, exclusive); err != nil {
 		if os.IsExist(err) {
 			return errors.New("cannot add previously deleted image: " + name)
@@ -289,6 +301,7 @@ func (imdb *ImageDataBase) chownDirectory(dirname, ownerGroup string,
 	if err := imdb.checkChown(dirname, ownerGroup, authInfo); err != nil {
 		return err
 	}
+	directoryMetadata.ModifiedOn = time.Now().UTC()
 	directoryMetadata.OwnerGroup = ownerGroup
 	return imdb.updateDirectoryMetadata(
 		image.Directory{Name: dirname, Metadata: directoryMetadata})
@@ -405,6 +418,7 @@ func (imdb *ImageDataBase) deleteDirectory(name string,
 			return err
 		}
 		delete(imdb.directoryMap, name)
+		delete(imdb.directoryUsages, name)
 		imdb.rmdirNotifiers.sendPlain(name, "rmdir", imdb.Logger)
 		return nil
 	}
@@ -423,8 +437,8 @@ func (imdb *ImageDataBase) deleteImage(name string,
 		if err := imdb.checkPermissions(name, imgType, authInfo); err != nil {
 			return err
 		}
-		filename := filepath.Join(imdb.BaseDirectory, name)
-		if err := os.Truncate(filename, 0); err != nil {
+		err := imdb.writeTombstoneWithLock(name, time.Now().UTC())
+		if err != nil {
 			return err
 		}
 		imdb.deleteImageAndUpdateUnreferencedObjectsList(name)
@@ -441,9 +455,31 @@ func (imdb *ImageDataBase) deleteImageAndUpdateUnreferencedObjectsList(
 		return
 	}
 	delete(imdb.imageMap, name)
+	imdb.removeImageFromIndicesWithLock(name, img)
+	imdb.removeImageUsageWithLock(name, img)
 	imdb.Params.ObjectServer.AdjustRefcounts(false, img)
 }
 
+// insertImageWithLock will add an image entry. The object references must
+// already have been counted. This must be called with the main lock held.
+func (imdb *ImageDataBase) insertImageWithLock(name string, img *imageType) {
+	imdb.imageMap[name] = img
+	imdb.addImageToIndicesWithLock(name, img.image)
+}
+
+// undeleteImageWithLock will restore an image entry which was removed with
+// deleteImageAndUpdateUnreferencedObjectsList. This must be called with the
+// main lock held.
+func (imdb *ImageDataBase) undeleteImageWithLock(name string,
+	img *imageType) error {
+	err := imdb.Params.ObjectServer.AdjustRefcounts(true, img.image)
+	if err != nil {
+		return err
+	}
+	imdb.insertImageWithLock(name, img)
+	return imdb.addImageUsageWithLock(name, img.image, false)
+}
+
 func (imdb *ImageDataBase) doWithPendingImage(img *image.Image,
 	doFunc func() error) error {
 	imdb.pendingImageLock.Lock()
@@ -779,6 +815,47 @@ func (imdb *ImageDataBase) registerMakeDirectoryNotifier() <-chan image.Director
 	return channel
 }
 
+// replaceImage will replace an existing image, bypassing permission checks.
+func (imdb *ImageDataBase) replaceImage(img *image.Image, name string) error {
+	if err := img.Verify(); err != nil {
+		return err
+	}
+	imdb.Lock()
+	oldImgType, _ := imdb.getImageTypeWithLock(name)
+	if oldImgType == nil || oldImgType.image == nil {
+		imdb.Unlock()
+		return errors.New("image: " + name + " does not exist")
+	}
+	if oldImgType.modifying {
+		imdb.Unlock()
+		return errors.New("image: " + name + " being modified")
+	}
+	imdb.deleteImageAndUpdateUnreferencedObjectsList(name)
+	imdb.imageMap[name] = nil // Write in progress.
+	// The replacement is not subject to quotas but is counted against them.
+	err := imdb.addImageUsageWithLock(name, img, false)
+	if err == nil {
+		imdb.reservedImages[name] = img
+	}
+	imdb.Unlock()
+	writeErr := err
+	if writeErr == nil {
+		writeErr = imdb.writeImage(name, img, false)
+		if writeErr == nil {
+			return nil
+		}
+	}
+	// Restore the old image.
+	imdb.Lock()
+	defer imdb.Unlock()
+	imdb.releaseQuotasWithLock(name)
+	if err := imdb.undeleteImageWithLock(name, oldImgType); err != nil {
+		delete(imdb.imageMap, name)
+		return err
+	}
+	return writeErr
+}
+
 func (imdb *ImageDataBase) restoreImageFromArchive(
 	req proto.RestoreImageFromArchiveRequest,
 	authInfo *srpc.AuthInformation) error {
@@ -818,9 +895,14 @@ func (imdb *ImageDataBase) restoreImageFromArchive(
 		if doCleanup {
 			imdb.Lock()
 			delete(imdb.imageMap, imageArchive.ImageName)
+			imdb.releaseQuotasWithLock(imageArchive.ImageName)
 			imdb.Unlock()
 		}
 	}()
+	err = imdb.reserveQuotas(imageArchive.ImageName, img, true)
+	if err != nil {
+		return err
+	}
 	providedMac, err := io.ReadAll(archive)
 	if err != nil {
 		return err
@@ -895,14 +977,16 @@ func (imdb *ImageDataBase) writeImage(name string, img *image.Image,
 	}
 	imdb.scheduleExpiration(img, name)
 	imdb.Lock()
-	imdb.imageMap[name] = &imageType{
+	delete(imdb.reservedImages, name) // Now counted as a written image.
+	delete(imdb.tombstones, name)
+	imdb.insertImageWithLock(name, &imageType{
 		computedFiles: computedFiles,
 		fileChecksum:  fileChecksum,
 		image:         img,
 		ownerGroups:   ownerGroups,
 		ownerUsers:    ownerUsers,
 		usageEstimate: usageEstimate,
-	}
+	})
 	imdb.addNotifiers.sendPlain(name, "add", imdb.Logger)
 	imdb.Unlock()
 	return nil
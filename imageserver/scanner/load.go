@@ -12,6 +12,7 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/concurrent"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/lockwatcher"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
@@ -22,6 +23,9 @@ import (
 )
 
 func loadImageDataBase(config Config, params Params) (*ImageDataBase, error) {
+	if config.BuildCacheLifetime < 1 {
+		config.BuildCacheLifetime = 14 * 24 * time.Hour
+	}
 	if config.MaximumExpirationDuration < 1 {
 		config.MaximumExpirationDuration = 24 * time.Hour
 	}
@@ -44,8 +48,15 @@ func loadImageDataBase(config Config, params Params) (*ImageDataBase, error) {
 	imdb := &ImageDataBase{
 		Config:          config,
 		Params:          params,
+		buildCache:      make(map[hash.Hash]time.Time),
 		directoryMap:    make(map[string]image.DirectoryMetadata),
+		directoryUsages: make(map[string]*directoryUsageType),
 		imageMap:        make(map[string]*imageType),
+		objectIndex:     make(imageIndex[hash.Hash]),
+		packageIndex:    make(packageIndex),
+		pathIndex:       make(imageIndex[string]),
+		reservedImages:  make(map[string]*image.Image),
+		tombstones:      make(map[string]time.Time),
 		addNotifiers:    make(notifiers),
 		deleteNotifiers: make(notifiers),
 		mkdirNotifiers:  make(makeDirectoryNotifiers),
@@ -67,6 +78,12 @@ func loadImageDataBase(config Config, params Params) (*ImageDataBase, error) {
 	if err := state.Reap(); err != nil {
 		return nil, err
 	}
+	if err := imdb.loadDirectoryUsages(); err != nil {
+		return nil, err
+	}
+	if err := imdb.loadBuildCache(); err != nil {
+		return nil, err
+	}
 	if params.Logger != nil {
 		plural := ""
 		if imdb.CountImages() != 1 {
@@ -119,6 +136,13 @@ func (imdb *ImageDataBase) scanDirectory(dirname string,
 			err = state.GoRun(func() error {
 				return imdb.loadFile(filename)
 			})
+		} else if stat.Mode&syscall.S_IFMT == syscall.S_IFREG &&
+			name[len(name)-1] != '~' {
+			// Deleted image: the modification time is the deletion time.
+			imdb.Lock()
+			imdb.tombstones[filename] = time.Unix(stat.Mtim.Sec,
+				stat.Mtim.Nsec).UTC()
+			imdb.Unlock()
 		}
 		if err != nil {
 			if err == syscall.ENOENT {
@@ -200,7 +224,7 @@ func (imdb *ImageDataBase) loadFile(filename string) error {
 	}
 	imdb.Lock()
 	defer imdb.Unlock()
-	imdb.imageMap[filename] = imageEntry
+	imdb.insertImageWithLock(filename, imageEntry)
 	return nil
 }
 
@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+)
+
+// deleteReplicatedImage will apply an image deletion received from a peer. A
+// local image which was created after the deletion was added again and is
+// kept. If there is no local image, the deletion is recorded so that it is
+// propagated to other peers. It returns true if the image was deleted or the
+// deletion was recorded.
+func (imdb *ImageDataBase) deleteReplicatedImage(name string,
+	deletedOn time.Time) (bool, error) {
+	imdb.Lock()
+	defer imdb.Unlock()
+	if img, ok := imdb.getImageWithLock(name); ok {
+		if img == nil {
+			return false, nil // Being written: the writer decides.
+		}
+		if img.CreatedOn.After(deletedOn) {
+			return false, nil
+		}
+		if err := imdb.writeTombstoneWithLock(name, deletedOn); err != nil {
+			return false, err
+		}
+		imdb.deleteImageAndUpdateUnreferencedObjectsList(name)
+		imdb.deleteNotifiers.sendPlain(name, "delete", imdb.Logger)
+		return true, nil
+	}
+	if oldDeletedOn, ok := imdb.tombstones[name]; ok &&
+		!deletedOn.After(oldDeletedOn) {
+		return false, nil
+	}
+	if _, ok := imdb.directoryMap[filepath.Dir(name)]; !ok {
+		return false, nil
+	}
+	if err := imdb.writeTombstoneWithLock(name, deletedOn); err != nil {
+		return false, err
+	}
+	imdb.deleteNotifiers.sendPlain(name, "delete", imdb.Logger)
+	return true, nil
+}
+
+func (imdb *ImageDataBase) getImageDeletionTime(name string) (
+	time.Time, bool) {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	deletedOn, ok := imdb.tombstones[name]
+	return deletedOn, ok
+}
+
+func (imdb *ImageDataBase) listDeletedImages() map[string]time.Time {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	deletedImages := make(map[string]time.Time, len(imdb.tombstones))
+	for name, deletedOn := range imdb.tombstones {
+		deletedImages[name] = deletedOn
+	}
+	return deletedImages
+}
+
+// writeTombstoneWithLock will truncate or create the file for an image and
+// record the deletion time as the modification time, so that the deletion is
+// remembered across restarts. This must be called with the main lock held.
+func (imdb *ImageDataBase) writeTombstoneWithLock(name string,
+	deletedOn time.Time) error {
+	filename := filepath.Join(imdb.BaseDirectory, name)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(filename, deletedOn, deletedOn); err != nil {
+		return err
+	}
+	imdb.tombstones[name] = deletedOn
+	return nil
+}
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+)
+
+func makeTestImageCreatedOn(objects testObjectsType,
+	createdOn time.Time) *image.Image {
+	img := makeTestImage(objects, 1)
+	img.CreatedOn = createdOn
+	return img
+}
+
+func TestDeletionPropagation(t *testing.T) {
+	peerA, objSrvA := newTestImageDataBase(t)
+	peerB, objSrvB := newTestImageDataBase(t)
+	objectsA := addTestObjects(t, objSrvA, 10, 1)
+	objectsB := addTestObjects(t, objSrvB, 10, 1)
+	createdOn := time.Now().Add(-time.Hour).UTC()
+	for _, name := range []string{"old", "readded"} {
+		err := peerA.AddImage(makeTestImageCreatedOn(objectsA, createdOn),
+			name, testAuthInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Peer B only received one of the images before it was disconnected.
+	err := peerB.AddReplicatedImage(
+		makeTestImageCreatedOn(objectsB, createdOn), "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Delete on peer A while peer B is disconnected.
+	for _, name := range []string{"old", "readded", "missing"} {
+		if err := peerA.DeleteImage(name, testAuthInfo); err != nil &&
+			name != "missing" {
+			t.Fatal(err)
+		}
+	}
+	deletedImages := peerA.ListDeletedImages()
+	if len(deletedImages) != 2 {
+		t.Fatalf("deleted images: %v", deletedImages)
+	}
+	// The image is added again on peer B after it was deleted on peer A.
+	readdedImage := makeTestImageCreatedOn(objectsB, time.Now().UTC())
+	err = peerB.AddImage(readdedImage, "readded", testAuthInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Peer B reconnects and receives the deletions from peer A.
+	for name, deletedOn := range deletedImages {
+		deleted, err := peerB.DeleteReplicatedImage(name, deletedOn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := name == "old"; deleted != want {
+			t.Errorf("%s: deleted = %t, want %t", name, deleted, want)
+		}
+	}
+	if peerB.CheckImage("old") {
+		t.Error("deleted image not deleted on peer")
+	}
+	if !peerB.CheckImage("readded") {
+		t.Error("image added again after deletion was deleted")
+	}
+	if deleted, err := peerB.DeleteReplicatedImage("old",
+		deletedImages["old"]); err != nil {
+		t.Fatal(err)
+	} else if deleted {
+		t.Error("deletion applied twice")
+	}
+	// Peer A receives the images from peer B: only the image added again
+	// after the deletion is accepted.
+	err = peerA.AddReplicatedImage(
+		makeTestImageCreatedOn(objectsA, createdOn), "old")
+	if err == nil {
+		t.Error("deleted image added again by peer")
+	}
+	err = peerA.AddImage(makeTestImageCreatedOn(objectsA, time.Now().UTC()),
+		"old", testAuthInfo)
+	if err == nil {
+		t.Error("previously deleted image added by user")
+	}
+	err = peerA.AddReplicatedImage(
+		makeTestImageCreatedOn(objectsA, readdedImage.CreatedOn), "readded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := peerA.GetImageDeletionTime("readded"); ok {
+		t.Error("deletion still recorded after image added again")
+	}
+	// Deletions are remembered across restarts.
+	reloaded, err := LoadImageDataBase(peerA.BaseDirectory,
+		peerA.Params.ObjectServer, "", testlogger.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deletedOn, ok := reloaded.GetImageDeletionTime("old"); !ok {
+		t.Error("deletion forgotten after restart")
+	} else if !deletedOn.Equal(deletedImages["old"]) {
+		t.Errorf("deletion time: %s, want %s",
+			deletedOn, deletedImages["old"])
+	}
+	if !reloaded.CheckImage("readded") {
+		t.Error("image added again not loaded after restart")
+	}
+}
@@ -0,0 +1,319 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+// reserveQuotas will count the specified image against the quota for the image
+// directory and its parent directories. If enforce is true, it will first check
+// if this would exceed any of the quotas. The check and the reservation are
+// made with the lock held, so concurrent adds cannot exceed a quota. The
+// reservation must be released with releaseQuotasWithLock if the image is not
+// written.
+func (imdb *ImageDataBase) reserveQuotas(name string, img *image.Image,
+	enforce bool) error {
+	if imdb.ReplicationMaster != "" {
+		enforce = false // The master is responsible for enforcement.
+	}
+	imdb.Lock()
+	defer imdb.Unlock()
+	if err := imdb.addImageUsageWithLock(name, img, enforce); err != nil {
+		return err
+	}
+	imdb.reservedImages[name] = img
+	return nil
+}
+
+// releaseQuotasWithLock will release a reservation made by reserveQuotas.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) releaseQuotasWithLock(name string) {
+	if img, ok := imdb.reservedImages[name]; ok {
+		delete(imdb.reservedImages, name)
+		imdb.removeImageUsageWithLock(name, img)
+	}
+}
+
+// addImageUsageWithLock will count the objects for the specified image against
+// the quotas for its directory and parent directories. If enforce is true and a
+// quota would be exceeded, nothing is counted and an error is returned.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) addImageUsageWithLock(name string,
+	img *image.Image, enforce bool) error {
+	dirnames, usages := imdb.getDirectoryUsagesWithLock(name)
+	if len(usages) < 1 {
+		return nil
+	}
+	hashes := getImageObjects(img)
+	sizes, err := imdb.Params.ObjectServer.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	if enforce {
+		for index, usage := range usages {
+			quotaBytes := imdb.directoryMap[dirnames[index]].QuotaBytes
+			usedBytes := usage.getUsedBytesWith(hashes, sizes)
+			if usedBytes > quotaBytes {
+				return fmt.Errorf("quota for: %s exceeded: %s > %s",
+					dirnames[index], format.FormatBytes(usedBytes),
+					format.FormatBytes(quotaBytes))
+			}
+		}
+	}
+	for _, usage := range usages {
+		usage.add(hashes, sizes)
+	}
+	return nil
+}
+
+// removeImageUsageWithLock will stop counting the objects for the specified
+// image against the quotas for its directory and parent directories.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) removeImageUsageWithLock(name string,
+	img *image.Image) {
+	_, usages := imdb.getDirectoryUsagesWithLock(name)
+	if len(usages) < 1 {
+		return
+	}
+	hashes := getImageObjects(img)
+	for _, usage := range usages {
+		usage.remove(hashes)
+	}
+}
+
+// getDirectoryUsagesWithLock returns the names and usage trackers for the
+// directories containing the specified image which have quotas.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) getDirectoryUsagesWithLock(name string) (
+	[]string, []*directoryUsageType) {
+	var dirnames []string
+	var usages []*directoryUsageType
+	dirname := filepath.Dir(name)
+	for {
+		if usage := imdb.directoryUsages[dirname]; usage != nil {
+			dirnames = append(dirnames, dirname)
+			usages = append(usages, usage)
+		}
+		if dirname == "." {
+			return dirnames, usages
+		}
+		dirname = filepath.Dir(dirname)
+	}
+}
+
+// loadDirectoryUsages will create the usage trackers for the directories which
+// have quotas.
+func (imdb *ImageDataBase) loadDirectoryUsages() error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	for dirname, directoryMetadata := range imdb.directoryMap {
+		if directoryMetadata.QuotaBytes < 1 {
+			continue
+		}
+		if err := imdb.makeDirectoryUsageWithLock(dirname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeDirectoryUsageWithLock will create the usage tracker for a directory by
+// scanning the written and reserved images in the directory tree.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) makeDirectoryUsageWithLock(dirname string) error {
+	usage := &directoryUsageType{objects: make(map[hash.Hash]objectUsageType)}
+	directoryMatcher := newDirectoryMatcher(dirname)
+	addImage := func(img *image.Image) error {
+		hashes := getImageObjects(img)
+		sizes, err := imdb.Params.ObjectServer.CheckObjects(hashes)
+		if err != nil {
+			return err
+		}
+		usage.add(hashes, sizes)
+		return nil
+	}
+	for name, img := range imdb.imageMap {
+		if img == nil || img.image == nil || !directoryMatcher(name) {
+			continue
+		}
+		if err := addImage(img.image); err != nil {
+			return err
+		}
+	}
+	for name, img := range imdb.reservedImages {
+		if !directoryMatcher(name) {
+			continue
+		}
+		if err := addImage(img); err != nil {
+			return err
+		}
+	}
+	imdb.directoryUsages[dirname] = usage
+	return nil
+}
+
+// getImageObjects returns the distinct objects used by an image.
+func getImageObjects(img *image.Image) []hash.Hash {
+	objects := make(map[hash.Hash]struct{})
+	img.ForEachObject(func(hashVal hash.Hash) error {
+		objects[hashVal] = struct{}{}
+		return nil
+	})
+	hashes := make([]hash.Hash, 0, len(objects))
+	for hashVal := range objects {
+		hashes = append(hashes, hashVal)
+	}
+	return hashes
+}
+
+func (usage *directoryUsageType) add(hashes []hash.Hash, sizes []uint64) {
+	for index, hashVal := range hashes {
+		object, ok := usage.objects[hashVal]
+		if !ok {
+			object.size = sizes[index]
+			usage.usedBytes += object.size
+		}
+		object.numImages++
+		usage.objects[hashVal] = object
+	}
+}
+
+// getUsedBytesWith returns the number of bytes which would be used if the
+// specified objects were added.
+func (usage *directoryUsageType) getUsedBytesWith(hashes []hash.Hash,
+	sizes []uint64) uint64 {
+	usedBytes := usage.usedBytes
+	for index, hashVal := range hashes {
+		if _, ok := usage.objects[hashVal]; !ok {
+			usedBytes += sizes[index]
+		}
+	}
+	return usedBytes
+}
+
+func (usage *directoryUsageType) remove(hashes []hash.Hash) {
+	for _, hashVal := range hashes {
+		object, ok := usage.objects[hashVal]
+		if !ok {
+			continue
+		}
+		if object.numImages > 1 {
+			object.numImages--
+			usage.objects[hashVal] = object
+			continue
+		}
+		delete(usage.objects, hashVal)
+		usage.usedBytes -= object.size
+	}
+}
+
+// computeUsage will fill in the byte and object counts in usage. The number
+// of references to each object from the directory tree is given by objectRefs.
+// Objects with no references from outside the tree are counted as unique.
+func (imdb *ImageDataBase) computeUsage(objectRefs map[hash.Hash]uint64,
+	usage *proto.DirectoryUsage) error {
+	hashes := make([]hash.Hash, 0, len(objectRefs))
+	for hashVal := range objectRefs {
+		hashes = append(hashes, hashVal)
+	}
+	sizes, err := imdb.Params.ObjectServer.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	refcounts := imdb.Params.ObjectServer.GetRefcounts(hashes)
+	for index, hashVal := range hashes {
+		if refcounts[index] > objectRefs[hashVal] {
+			usage.SharedBytes += sizes[index]
+		} else {
+			usage.UniqueBytes += sizes[index]
+		}
+	}
+	usage.NumObjects = uint64(len(hashes))
+	return nil
+}
+
+// countObjectReferencesWithLock returns the number of references to each object
+// from the images in the directory tree and the number of images.
+// This must be called with the lock held.
+func (imdb *ImageDataBase) countObjectReferencesWithLock(dirname string) (
+	map[hash.Hash]uint64, uint) {
+	directoryMatcher := newDirectoryMatcher(dirname)
+	objectRefs := make(map[hash.Hash]uint64)
+	var numImages uint
+	for name, img := range imdb.imageMap {
+		if img == nil || img.image == nil {
+			continue
+		}
+		if !directoryMatcher(name) {
+			continue
+		}
+		img.image.ForEachObject(func(hashVal hash.Hash) error {
+			objectRefs[hashVal]++
+			return nil
+		})
+		numImages++
+	}
+	return objectRefs, numImages
+}
+
+func (imdb *ImageDataBase) getDirectoryUsage(dirname string) (
+	proto.DirectoryUsage, error) {
+	dirname = filepath.Clean(dirname)
+	imdb.RLock()
+	directoryMetadata, ok := imdb.directoryMap[dirname]
+	if !ok {
+		imdb.RUnlock()
+		return proto.DirectoryUsage{},
+			fmt.Errorf("no metadata for: \"%s\"", dirname)
+	}
+	objectRefs, numImages := imdb.countObjectReferencesWithLock(dirname)
+	imdb.RUnlock()
+	usage := proto.DirectoryUsage{
+		NumImages:  numImages,
+		QuotaBytes: directoryMetadata.QuotaBytes,
+	}
+	if err := imdb.computeUsage(objectRefs, &usage); err != nil {
+		return proto.DirectoryUsage{}, err
+	}
+	return usage, nil
+}
+
+func (imdb *ImageDataBase) setDirectoryQuota(dirname string, quotaBytes uint64,
+	authInfo *srpc.AuthInformation) error {
+	if authInfo == nil {
+		return errNoAuthInfo
+	}
+	if !authInfo.HaveMethodAccess {
+		return errors.New("no permission to set quotas")
+	}
+	dirname = filepath.Clean(dirname)
+	imdb.Lock()
+	defer imdb.Unlock()
+	directoryMetadata, ok := imdb.directoryMap[dirname]
+	if !ok {
+		return fmt.Errorf("no metadata for: \"%s\"", dirname)
+	}
+	directoryMetadata.ModifiedOn = time.Now().UTC()
+	directoryMetadata.QuotaBytes = quotaBytes
+	err := imdb.updateDirectoryMetadata(
+		image.Directory{Name: dirname, Metadata: directoryMetadata})
+	if err != nil {
+		return err
+	}
+	if quotaBytes < 1 {
+		delete(imdb.directoryUsages, dirname)
+		return nil
+	}
+	if _, ok := imdb.directoryUsages[dirname]; ok {
+		return nil
+	}
+	return imdb.makeDirectoryUsageWithLock(dirname)
+}
@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	objectserver "github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+var testAuthInfo = &srpc.AuthInformation{HaveMethodAccess: true}
+
+type testObjectsType map[byte]hash.Hash
+
+// addTestObjects will add an object of the specified size for each fill byte
+// and returns the hashes, indexed by fill byte.
+func addTestObjects(t *testing.T, objSrv *objectserver.ObjectServer,
+	size int, fills ...byte) testObjectsType {
+	objects := make(testObjectsType, len(fills))
+	for _, fill := range fills {
+		hashVal, _, err := objSrv.AddObject(
+			bytes.NewReader(bytes.Repeat([]byte{fill}, size)), uint64(size),
+			nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects[fill] = hashVal
+	}
+	return objects
+}
+
+// makeTestImage will make an image which references the specified objects.
+func makeTestImage(objects testObjectsType, fills ...byte) *image.Image {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	for index, fill := range fills {
+		fs.InodeTable[uint64(index+1)] = &filesystem.RegularInode{
+			Hash: objects[fill],
+			Size: 1,
+		}
+	}
+	return &image.Image{FileSystem: fs}
+}
+
+func newTestImageDataBase(t *testing.T) (*ImageDataBase,
+	*objectserver.ObjectServer) {
+	logger := testlogger.New(t)
+	objSrv, err := objectserver.NewObjectServer(t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imdb, err := LoadImageDataBase(t.TempDir(), objSrv, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imdb, objSrv
+}
+
+func TestDirectoryUsageTracking(t *testing.T) {
+	objects := testObjectsType{1: {1}, 2: {2}, 3: {3}}
+	sizes := map[hash.Hash]uint64{{1}: 100, {2}: 200, {3}: 400}
+	usage := &directoryUsageType{objects: make(map[hash.Hash]objectUsageType)}
+	add := func(fills ...byte) []hash.Hash {
+		hashes := getImageObjects(makeTestImage(objects, fills...))
+		hashSizes := make([]uint64, 0, len(hashes))
+		for _, hashVal := range hashes {
+			hashSizes = append(hashSizes, sizes[hashVal])
+		}
+		if got, want := usage.getUsedBytesWith(hashes, hashSizes),
+			usage.usedBytes; got < want {
+			t.Errorf("getUsedBytesWith() = %d < usedBytes = %d", got, want)
+		}
+		usage.add(hashes, hashSizes)
+		return hashes
+	}
+	first := add(1, 2, 2) // Duplicate objects within an image count once.
+	if usage.usedBytes != 300 {
+		t.Errorf("usedBytes = %d, want 300", usage.usedBytes)
+	}
+	second := add(2, 3)
+	if usage.usedBytes != 700 {
+		t.Errorf("usedBytes = %d, want 700", usage.usedBytes)
+	}
+	usage.remove(first)
+	if usage.usedBytes != 600 { // Object 2 is still used by the second image.
+		t.Errorf("usedBytes = %d, want 600", usage.usedBytes)
+	}
+	usage.remove(second)
+	if usage.usedBytes != 0 || len(usage.objects) != 0 {
+		t.Errorf("usedBytes = %d, objects = %d, want 0, 0",
+			usage.usedBytes, len(usage.objects))
+	}
+}
+
+func TestQuotaRejection(t *testing.T) {
+	imdb, objSrv := newTestImageDataBase(t)
+	objects := addTestObjects(t, objSrv, 1000, 1, 2, 3)
+	if err := imdb.MakeDirectory("dir", testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.MakeDirectory("dir/sub", testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.SetDirectoryQuota("dir", 2500, testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	err := imdb.AddImage(makeTestImage(objects, 1, 2), "dir/sub/a",
+		testAuthInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shared objects are only counted once, so this fits.
+	err = imdb.AddImage(makeTestImage(objects, 1, 2), "dir/b", testAuthInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imdb.AddImage(makeTestImage(objects, 2, 3), "dir/sub/c",
+		testAuthInfo)
+	if err == nil {
+		t.Fatal("image exceeding quota added")
+	}
+	if imdb.CheckImage("dir/sub/c") {
+		t.Error("rejected image present")
+	}
+	// Outside of the directory tree the quota does not apply.
+	err = imdb.AddImage(makeTestImage(objects, 2, 3), "c", testAuthInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rejected image must not have been counted.
+	if err := imdb.DeleteImage("dir/b", testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	err = imdb.AddImage(makeTestImage(objects, 1, 2), "dir/sub/d",
+		testAuthInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := imdb.GetDirectoryUsage("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := proto.DirectoryUsage{
+		NumImages:   2,
+		NumObjects:  2,
+		QuotaBytes:  2500,
+		SharedBytes: 1000, // Object 2 is also used by image "c".
+		UniqueBytes: 1000,
+	}
+	if usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+	// Lowering the quota below the usage rejects even images which add no
+	// new objects.
+	if err := imdb.SetDirectoryQuota("dir", 1500, testAuthInfo); err != nil {
+		t.Fatal(err)
+	}
+	err = imdb.AddImage(makeTestImage(objects, 1), "dir/e", testAuthInfo)
+	if err == nil {
+		t.Error("image added to directory over quota")
+	}
+}
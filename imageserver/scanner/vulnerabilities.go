@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
+)
+
+func (imdb *ImageDataBase) getImageVulnerabilities(name string) (
+	[]vulnerability.Finding, time.Time, error) {
+	if imdb.VulnerabilityFeed == nil {
+		return nil, time.Time{}, errors.New("no vulnerability feed configured")
+	}
+	db, err := imdb.VulnerabilityFeed.GetDatabase()
+	if db == nil {
+		if err == nil {
+			err = errors.New("vulnerability feed not loaded")
+		}
+		return nil, time.Time{}, err
+	}
+	img := imdb.getImage(name)
+	if img == nil {
+		return nil, time.Time{}, fmt.Errorf("image: %s does not exist", name)
+	}
+	return db.Match(img.Packages), db.LoadedAt(), nil
+}
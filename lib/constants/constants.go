@@ -27,8 +27,9 @@ const (
 	PatchedImageNameFile = "/var/lib/patched-image"
 
 	// Metadata service.
-	LinklocalAddress = "169.254.169.254"
-	MetadataUrl      = "http://" + LinklocalAddress
+	LinklocalAddress     = "169.254.169.254"
+	LinklocalIpv6Address = "fe80::a9fe:a9fe"
+	MetadataUrl          = "http://" + LinklocalAddress
 
 	// Common endpoints.
 	MetadataUserData = "/latest/user-data"
@@ -54,7 +55,19 @@ const (
 	MetadataIdentityRsaX509Key  = "/latest/dynamic/instance-identity/RSA-X.509-key"
 
 	// AWS endpoints.
-	MetadataAwsInstanceType = "/latest/meta-data/instance-type"
+	MetadataAwsInstanceId    = "/latest/meta-data/instance-id"
+	MetadataAwsInstanceType  = "/latest/meta-data/instance-type"
+	MetadataAwsLocalHostname = "/latest/meta-data/local-hostname"
+	MetadataAwsLocalIpv4     = "/latest/meta-data/local-ipv4"
+	MetadataAwsMac           = "/latest/meta-data/mac"
+	MetadataAwsPublicKey     = "/latest/meta-data/public-keys/0/openssh-key"
+
+	// cloud-init NoCloud datasource endpoints.
+	MetadataNoCloudPrefix        = "/nocloud/"
+	MetadataNoCloudMetaData      = MetadataNoCloudPrefix + "meta-data"
+	MetadataNoCloudNetworkConfig = MetadataNoCloudPrefix + "network-config"
+	MetadataNoCloudUserData      = MetadataNoCloudPrefix + "user-data"
+	MetadataNoCloudVendorData    = MetadataNoCloudPrefix + "vendor-data"
 )
 
 var RequiredPaths = map[string]rune{
@@ -18,7 +18,9 @@ type Annotation struct {
 }
 
 type DirectoryMetadata struct {
+	ModifiedOn time.Time // UTC. Used to resolve multi-master conflicts.
 	OwnerGroup string
+	QuotaBytes uint64 // Applies to the directory tree. Zero: no quota.
 }
 
 type Directory struct {
@@ -37,6 +39,8 @@ type Image struct {
 	Triggers      *triggers.Triggers
 	ReleaseNotes  *Annotation
 	BuildLog      *Annotation
+	SBOM          *Annotation // Software Bill of Materials.
+	TestResults   *Annotation
 	CreatedOn     time.Time
 	ExpiresAt     time.Time
 	OwnerGroups   []string
@@ -0,0 +1,76 @@
+package changelog
+
+import (
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+const (
+	FileAdded   = "added"
+	FileChanged = "changed"
+	FileRemoved = "removed"
+)
+
+type Changelog struct {
+	PreviousImage      string          `json:",omitempty"`
+	PackagesAdded      []image.Package `json:",omitempty"`
+	PackagesRemoved    []image.Package `json:",omitempty"`
+	PackagesUpgraded   []PackageChange `json:",omitempty"`
+	FileChanges        []FileChange    `json:",omitempty"`
+	FilterLinesAdded   []string        `json:",omitempty"`
+	FilterLinesRemoved []string        `json:",omitempty"`
+	TriggersChanged    []string        `json:",omitempty"` // Service names.
+	GitUrl             string          `json:",omitempty"`
+	PreviousCommitId   string          `json:",omitempty"`
+	CommitId           string          `json:",omitempty"`
+}
+
+type FileChange struct {
+	Name   string
+	Change string // One of FileAdded, FileChanged, FileRemoved.
+}
+
+type PackageChange struct {
+	Name            string
+	PreviousVersion string
+	Version         string
+}
+
+type Params struct {
+	Files            []string // Pathnames of files from the manifest.
+	GitUrl           string
+	CommitId         string
+	PreviousImage    string
+	PreviousCommitId string
+}
+
+// Compute will compute the changelog between the previous image and the new
+// image. If the previous image is nil, only the Git information is recorded.
+// The file-systems of both images must have their inode pointers built.
+func Compute(previous, img *image.Image, params Params) *Changelog {
+	return compute(previous, img, params)
+}
+
+// Decode will decode a changelog written by Encode. An error is returned if
+// the data are not a changelog, such as JSON release notes with some other
+// structure.
+func Decode(reader io.Reader) (*Changelog, error) {
+	return decode(reader)
+}
+
+// Empty returns true if the changelog contains no changes.
+func (c *Changelog) Empty() bool {
+	return c.empty()
+}
+
+// Encode will write the changelog in a form suitable for storing as the
+// release notes for an image.
+func (c *Changelog) Encode(writer io.Writer) error {
+	return c.encode(writer)
+}
+
+// WriteHtml will write the changelog as HTML tables.
+func (c *Changelog) WriteHtml(writer io.Writer) {
+	c.writeHtml(writer)
+}
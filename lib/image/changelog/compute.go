@@ -0,0 +1,185 @@
+package changelog
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	libjson "github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+)
+
+func compute(previous, img *image.Image, params Params) *Changelog {
+	changelog := &Changelog{
+		GitUrl:        params.GitUrl,
+		CommitId:      params.CommitId,
+		PreviousImage: params.PreviousImage,
+	}
+	if params.PreviousCommitId != params.CommitId {
+		changelog.PreviousCommitId = params.PreviousCommitId
+	}
+	if previous == nil {
+		return changelog
+	}
+	changelog.comparePackages(previous.Packages, img.Packages)
+	changelog.compareFiles(previous.FileSystem, img.FileSystem, params.Files)
+	changelog.compareFilters(previous.Filter, img.Filter)
+	changelog.compareTriggers(previous.Triggers, img.Triggers)
+	return changelog
+}
+
+func decode(reader io.Reader) (*Changelog, error) {
+	var changelog Changelog
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields() // Reject release notes in other formats.
+	if err := decoder.Decode(&changelog); err != nil {
+		return nil, err
+	}
+	return &changelog, nil
+}
+
+func getInode(fs *filesystem.FileSystem,
+	table filesystem.FilenameToInodeTable,
+	filename string) filesystem.GenericInode {
+	if inum, ok := table[filename]; ok {
+		return fs.InodeTable[inum]
+	}
+	return nil
+}
+
+func makeTriggerMap(trig *triggers.Triggers) map[string]string {
+	triggerMap := make(map[string]string)
+	if trig == nil {
+		return triggerMap
+	}
+	for _, trigger := range trig.Triggers {
+		if data, err := json.Marshal(trigger); err == nil {
+			triggerMap[trigger.Service] += string(data)
+		}
+	}
+	return triggerMap
+}
+
+func (c *Changelog) compareFiles(previous, fs *filesystem.FileSystem,
+	filenames []string) {
+	if previous == nil || fs == nil || len(filenames) < 1 {
+		return
+	}
+	previousTable := previous.FilenameToInodeTable()
+	table := fs.FilenameToInodeTable()
+	for _, filename := range filenames {
+		previousInode := getInode(previous, previousTable, filename)
+		inode := getInode(fs, table, filename)
+		var change string
+		if inode == nil {
+			if previousInode != nil {
+				change = FileRemoved
+			}
+		} else if previousInode == nil {
+			change = FileAdded
+		} else {
+			sameType, sameMetadata, sameData := filesystem.CompareInodes(
+				previousInode, inode, nil)
+			if !sameType || !sameMetadata || !sameData {
+				change = FileChanged
+			}
+		}
+		if change != "" {
+			c.FileChanges = append(c.FileChanges,
+				FileChange{Name: filename, Change: change})
+		}
+	}
+	sort.Slice(c.FileChanges, func(left, right int) bool {
+		return c.FileChanges[left].Name < c.FileChanges[right].Name
+	})
+}
+
+func (c *Changelog) compareFilters(previous, current *filter.Filter) {
+	previousLines := make(map[string]struct{})
+	if previous != nil {
+		for _, line := range previous.FilterLines {
+			previousLines[line] = struct{}{}
+		}
+	}
+	if current != nil {
+		for _, line := range current.FilterLines {
+			if _, ok := previousLines[line]; ok {
+				delete(previousLines, line)
+			} else {
+				c.FilterLinesAdded = append(c.FilterLinesAdded, line)
+			}
+		}
+	}
+	for line := range previousLines {
+		c.FilterLinesRemoved = append(c.FilterLinesRemoved, line)
+	}
+	sort.Strings(c.FilterLinesAdded)
+	sort.Strings(c.FilterLinesRemoved)
+}
+
+func (c *Changelog) comparePackages(previous, current []image.Package) {
+	previousPackages := make(map[string]image.Package, len(previous))
+	for _, pkg := range previous {
+		previousPackages[pkg.Name] = pkg
+	}
+	for _, pkg := range current {
+		if previousPackage, ok := previousPackages[pkg.Name]; !ok {
+			c.PackagesAdded = append(c.PackagesAdded, pkg)
+		} else {
+			delete(previousPackages, pkg.Name)
+			if previousPackage.Version != pkg.Version {
+				c.PackagesUpgraded = append(c.PackagesUpgraded,
+					PackageChange{
+						Name:            pkg.Name,
+						PreviousVersion: previousPackage.Version,
+						Version:         pkg.Version,
+					})
+			}
+		}
+	}
+	for _, pkg := range previousPackages {
+		c.PackagesRemoved = append(c.PackagesRemoved, pkg)
+	}
+	sort.Slice(c.PackagesAdded, func(left, right int) bool {
+		return c.PackagesAdded[left].Name < c.PackagesAdded[right].Name
+	})
+	sort.Slice(c.PackagesRemoved, func(left, right int) bool {
+		return c.PackagesRemoved[left].Name < c.PackagesRemoved[right].Name
+	})
+	sort.Slice(c.PackagesUpgraded, func(left, right int) bool {
+		return c.PackagesUpgraded[left].Name < c.PackagesUpgraded[right].Name
+	})
+}
+
+func (c *Changelog) compareTriggers(previous, current *triggers.Triggers) {
+	previousTriggers := makeTriggerMap(previous)
+	for service, data := range makeTriggerMap(current) {
+		if previousData, ok := previousTriggers[service]; !ok ||
+			previousData != data {
+			c.TriggersChanged = append(c.TriggersChanged, service)
+		}
+		delete(previousTriggers, service)
+	}
+	for service := range previousTriggers {
+		c.TriggersChanged = append(c.TriggersChanged, service)
+	}
+	sort.Strings(c.TriggersChanged)
+}
+
+func (c *Changelog) empty() bool {
+	return len(c.PackagesAdded) < 1 &&
+		len(c.PackagesRemoved) < 1 &&
+		len(c.PackagesUpgraded) < 1 &&
+		len(c.FileChanges) < 1 &&
+		len(c.FilterLinesAdded) < 1 &&
+		len(c.FilterLinesRemoved) < 1 &&
+		len(c.TriggersChanged) < 1 &&
+		c.PreviousCommitId == ""
+}
+
+func (c *Changelog) encode(writer io.Writer) error {
+	return libjson.WriteWithIndent(writer, "    ", c)
+}
@@ -0,0 +1,88 @@
+package changelog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+)
+
+func TestCompute(t *testing.T) {
+	previous := &image.Image{
+		Filter: &filter.Filter{FilterLines: []string{"/tmp/.*", "/var/log"}},
+		Packages: []image.Package{
+			{Name: "bash", Version: "5.0"},
+			{Name: "curl", Version: "7.0"},
+			{Name: "vim", Version: "8.0"},
+		},
+		Triggers: &triggers.Triggers{Triggers: []*triggers.Trigger{
+			{MatchLines: []string{"/etc/ssh/.*"}, Service: "sshd"},
+		}},
+	}
+	img := &image.Image{
+		Filter: &filter.Filter{FilterLines: []string{"/tmp/.*", "/var/cache"}},
+		Packages: []image.Package{
+			{Name: "bash", Version: "5.1"},
+			{Name: "curl", Version: "7.0"},
+			{Name: "git", Version: "2.0"},
+		},
+		Triggers: &triggers.Triggers{Triggers: []*triggers.Trigger{
+			{MatchLines: []string{"/etc/ssh/.*"}, Service: "sshd",
+				DoReboot: true},
+		}},
+	}
+	changes := Compute(previous, img, Params{
+		CommitId:         "def",
+		PreviousCommitId: "abc",
+		PreviousImage:    "stream/previous",
+	})
+	if len(changes.PackagesAdded) != 1 ||
+		changes.PackagesAdded[0].Name != "git" {
+		t.Errorf("packages added: %v", changes.PackagesAdded)
+	}
+	if len(changes.PackagesRemoved) != 1 ||
+		changes.PackagesRemoved[0].Name != "vim" {
+		t.Errorf("packages removed: %v", changes.PackagesRemoved)
+	}
+	if len(changes.PackagesUpgraded) != 1 ||
+		changes.PackagesUpgraded[0].PreviousVersion != "5.0" {
+		t.Errorf("packages upgraded: %v", changes.PackagesUpgraded)
+	}
+	if len(changes.FilterLinesAdded) != 1 ||
+		len(changes.FilterLinesRemoved) != 1 {
+		t.Errorf("filter lines added: %v, removed: %v",
+			changes.FilterLinesAdded, changes.FilterLinesRemoved)
+	}
+	if len(changes.TriggersChanged) != 1 {
+		t.Errorf("triggers changed: %v", changes.TriggersChanged)
+	}
+	buffer := &bytes.Buffer{}
+	if err := changes.Encode(buffer); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PreviousCommitId != "abc" || decoded.Empty() {
+		t.Error("decoded changelog differs")
+	}
+	if !Compute(img, img, Params{}).Empty() {
+		t.Error("changelog for same image is not empty")
+	}
+}
+
+func TestDecodeOtherFormats(t *testing.T) {
+	for _, data := range []string{
+		`{"Notes": "Fixed the widget"}`,
+		`["Fixed the widget"]`,
+		"Fixed the widget\n",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("no error decoding: %s", data)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package changelog
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+)
+
+func writeList(writer io.Writer, title string, lines []string) {
+	if len(lines) < 1 {
+		return
+	}
+	fmt.Fprintf(writer, "%s:<br>\n", title)
+	fmt.Fprintln(writer, "<ul>")
+	for _, line := range lines {
+		fmt.Fprintf(writer, "  <li><code>%s</code></li>\n",
+			template.HTMLEscapeString(line))
+	}
+	fmt.Fprintln(writer, "</ul>")
+}
+
+func (c *Changelog) writeHtml(writer io.Writer) {
+	if c.PreviousImage == "" {
+		fmt.Fprintln(writer, "No previous image<br>")
+	} else {
+		fmt.Fprintf(writer,
+			"Changes since: <a href=\"showImage?%s\">%s</a><br>\n",
+			url.QueryEscape(c.PreviousImage),
+			template.HTMLEscapeString(c.PreviousImage))
+	}
+	if c.CommitId != "" {
+		if c.PreviousCommitId != "" {
+			fmt.Fprintf(writer, "Manifest commits: %s..%s",
+				template.HTMLEscapeString(c.PreviousCommitId),
+				template.HTMLEscapeString(c.CommitId))
+		} else {
+			fmt.Fprintf(writer, "Manifest commit: %s",
+				template.HTMLEscapeString(c.CommitId))
+		}
+		if c.GitUrl != "" {
+			fmt.Fprintf(writer, " in: %s", template.HTMLEscapeString(c.GitUrl))
+		}
+		fmt.Fprintln(writer, "<br>")
+	}
+	if c.Empty() {
+		fmt.Fprintln(writer, "No changes<br>")
+		return
+	}
+	fmt.Fprintln(writer, "<p>")
+	if len(c.PackagesAdded)+len(c.PackagesRemoved)+
+		len(c.PackagesUpgraded) > 0 {
+		fmt.Fprintln(writer, "Package changes:<br>")
+		fmt.Fprintln(writer, `<table border="1">`)
+		tw, _ := html.NewTableWriter(writer, true, "Name", "Change",
+			"Previous Version", "Version")
+		for _, pkg := range c.PackagesAdded {
+			tw.WriteRow("", "", template.HTMLEscapeString(pkg.Name), "added",
+				"", template.HTMLEscapeString(pkg.Version))
+		}
+		for _, pkg := range c.PackagesRemoved {
+			tw.WriteRow("", "", template.HTMLEscapeString(pkg.Name), "removed",
+				template.HTMLEscapeString(pkg.Version), "")
+		}
+		for _, pkg := range c.PackagesUpgraded {
+			tw.WriteRow("", "", template.HTMLEscapeString(pkg.Name), "upgraded",
+				template.HTMLEscapeString(pkg.PreviousVersion),
+				template.HTMLEscapeString(pkg.Version))
+		}
+		tw.Close()
+		fmt.Fprintln(writer, "<p>")
+	}
+	if len(c.FileChanges) > 0 {
+		fmt.Fprintln(writer, "Manifest file changes:<br>")
+		fmt.Fprintln(writer, `<table border="1">`)
+		tw, _ := html.NewTableWriter(writer, true, "Name", "Change")
+		for _, fileChange := range c.FileChanges {
+			tw.WriteRow("", "", template.HTMLEscapeString(fileChange.Name),
+				template.HTMLEscapeString(fileChange.Change))
+		}
+		tw.Close()
+		fmt.Fprintln(writer, "<p>")
+	}
+	writeList(writer, "Filter lines added", c.FilterLinesAdded)
+	writeList(writer, "Filter lines removed", c.FilterLinesRemoved)
+	writeList(writer, "Triggers changed for services", c.TriggersChanged)
+}
@@ -0,0 +1,34 @@
+package changelog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+func TestWriteHtmlEscapes(t *testing.T) {
+	const markup = "<script>x</script>"
+	changes := &Changelog{
+		PreviousImage:      "dir/image&" + markup,
+		PackagesAdded:      []image.Package{{Name: markup, Version: markup}},
+		FileChanges:        []FileChange{{Name: markup, Change: FileAdded}},
+		FilterLinesAdded:   []string{markup},
+		TriggersChanged:    []string{markup},
+		GitUrl:             markup,
+		PreviousCommitId:   markup,
+		CommitId:           markup,
+		FilterLinesRemoved: []string{markup},
+	}
+	buffer := &bytes.Buffer{}
+	changes.WriteHtml(buffer)
+	output := buffer.String()
+	if strings.Contains(output, "<script>") {
+		t.Errorf("unescaped markup in: %s", output)
+	}
+	if !strings.Contains(output,
+		`href="showImage?dir%2Fimage%26%3Cscript%3Ex%3C%2Fscript%3E"`) {
+		t.Errorf("previous image link not query escaped: %s", output)
+	}
+}
@@ -25,5 +25,15 @@ func (image *Image) forEachObject(objectFunc func(hash.Hash) error) error {
 			return err
 		}
 	}
+	if image.SBOM != nil && image.SBOM.Object != nil {
+		if err := objectFunc(*image.SBOM.Object); err != nil {
+			return err
+		}
+	}
+	if image.TestResults != nil && image.TestResults.Object != nil {
+		if err := objectFunc(*image.TestResults.Object); err != nil {
+			return err
+		}
+	}
 	return nil
 }
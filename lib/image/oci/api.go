@@ -0,0 +1,55 @@
+package oci
+
+import (
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+type ExportParams struct {
+	Architecture string // Default: the architecture of the running program.
+	Compress     bool   // If true, the layer is compressed with gzip.
+	Reference    string // Optional reference name (tag) for the image.
+}
+
+type Hasher interface {
+	Hash(reader io.Reader, length uint64) (hash.Hash, error)
+}
+
+// Export will write the image as an OCI image layout in the directory dirname,
+// which is created if needed. The image file-system is written as a single
+// layer, with data for regular files read from objectsGetter. Image tags are
+// written as labels in the image configuration.
+func Export(dirname string, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter, params ExportParams) error {
+	return export(dirname, img, objectsGetter, params)
+}
+
+// ExportArchive will write the image as a tar archive of an OCI image layout
+// to writer. A temporary directory is used to stage the image layout.
+func ExportArchive(writer io.Writer, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter, params ExportParams) error {
+	return exportArchive(writer, img, objectsGetter, params)
+}
+
+// Import will read the OCI image layout in the directory dirname and will
+// return the file-system obtained by applying each layer in order, including
+// whiteouts. The data for regular files are passed to hasher. Files matching
+// filter are skipped. If the image index contains multiple images, the image
+// for the architecture of the running program is selected.
+func Import(dirname string, hasher Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	return importLayout(dirname, hasher, filter)
+}
+
+// ImportArchive will read a tar archive of an OCI image layout from reader.
+// The archive is extracted into a temporary directory, which is then read with
+// Import.
+func ImportArchive(reader io.Reader, hasher Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	return importArchive(reader, hasher, filter)
+}
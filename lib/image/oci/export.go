@@ -0,0 +1,249 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	dtar "github.com/Cloud-Foundations/Dominator/lib/filesystem/tar"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+type countingWriter struct {
+	count  int64
+	writer io.Writer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	nWritten, err := w.writer.Write(p)
+	w.count += int64(nWritten)
+	return nWritten, err
+}
+
+func export(dirname string, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter, params ExportParams) error {
+	if params.Architecture == "" {
+		params.Architecture = runtime.GOARCH
+	}
+	blobsDir := filepath.Join(dirname, "blobs", "sha256")
+	if err := os.MkdirAll(blobsDir, fsutil.DirPerms); err != nil {
+		return err
+	}
+	layer, diffID, err := writeLayer(blobsDir, img, objectsGetter,
+		params.Compress)
+	if err != nil {
+		return err
+	}
+	config := imageConfig{
+		Architecture: params.Architecture,
+		OS:           "linux",
+		RootFS: rootFS{
+			Type:    "layers",
+			DiffIDs: []string{diffID},
+		},
+	}
+	if !img.CreatedOn.IsZero() {
+		createdOn := img.CreatedOn.UTC()
+		config.Created = &createdOn
+	}
+	if len(img.Tags) > 0 {
+		config.Config.Labels = img.Tags
+	}
+	configDescriptor, err := writeJsonBlob(blobsDir, mediaTypeConfig, config)
+	if err != nil {
+		return err
+	}
+	manifest := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		Config:        configDescriptor,
+		Layers:        []descriptor{layer},
+	}
+	if config.Created != nil {
+		manifest.Annotations = map[string]string{
+			annotationCreated: config.Created.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+	manifestDescriptor, err := writeJsonBlob(blobsDir, mediaTypeManifest,
+		manifest)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor.Platform = &platform{
+		Architecture: params.Architecture,
+		OS:           "linux",
+	}
+	if params.Reference != "" {
+		manifestDescriptor.Annotations = map[string]string{
+			annotationRefName: params.Reference,
+		}
+	}
+	index := imageIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeIndex,
+		Manifests:     []descriptor{manifestDescriptor},
+	}
+	err = writeJsonFile(filepath.Join(dirname, "oci-layout"),
+		imageLayout{ImageLayoutVersion: layoutVersion})
+	if err != nil {
+		return err
+	}
+	return writeJsonFile(filepath.Join(dirname, "index.json"), index)
+}
+
+func exportArchive(writer io.Writer, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter, params ExportParams) error {
+	dirname, err := os.MkdirTemp("", "oci-export.")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dirname)
+	if err := export(dirname, img, objectsGetter, params); err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(writer)
+	if err := writeDirectoryToTar(tarWriter, dirname); err != nil {
+		tarWriter.Close()
+		return err
+	}
+	return tarWriter.Close()
+}
+
+// renameBlob will rename the temporary file to the name of its digest.
+func renameBlob(blobsDir, tmpFilename string, digest []byte) (string, error) {
+	hexDigest := hex.EncodeToString(digest)
+	err := os.Rename(tmpFilename, filepath.Join(blobsDir, hexDigest))
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hexDigest, nil
+}
+
+func writeDirectoryToTar(tarWriter *tar.Writer, dirname string) error {
+	return filepath.Walk(dirname,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dirname {
+				return nil
+			}
+			name, err := filepath.Rel(dirname, path)
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(name)
+			if fi.IsDir() {
+				header.Name += "/"
+			}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(tarWriter, file)
+			return err
+		})
+}
+
+func writeJsonBlob(blobsDir, mediaType string,
+	value interface{}) (descriptor, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return descriptor{}, err
+	}
+	digest := sha256.Sum256(data)
+	hexDigest := hex.EncodeToString(digest[:])
+	err = os.WriteFile(filepath.Join(blobsDir, hexDigest), data,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return descriptor{}, err
+	}
+	return descriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hexDigest,
+		Size:      int64(len(data)),
+	}, nil
+}
+
+func writeJsonFile(filename string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, fsutil.PublicFilePerms)
+}
+
+// writeLayer will write the image file-system as a layer blob. The layer
+// descriptor and the digest of the uncompressed layer (the DiffID) are
+// returned.
+func writeLayer(blobsDir string, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter,
+	compress bool) (descriptor, string, error) {
+	file, err := os.CreateTemp(blobsDir, ".layer.")
+	if err != nil {
+		return descriptor{}, "", err
+	}
+	tmpFilename := file.Name()
+	defer os.Remove(tmpFilename)
+	defer file.Close()
+	bufferedWriter := bufio.NewWriter(file)
+	layerHasher := sha256.New()
+	layerWriter := &countingWriter{
+		writer: io.MultiWriter(bufferedWriter, layerHasher),
+	}
+	diffIDHasher := sha256.New()
+	var gzipWriter *gzip.Writer
+	mediaType := mediaTypeLayer
+	var tarOutput io.Writer = layerWriter
+	if compress {
+		gzipWriter = gzip.NewWriter(layerWriter)
+		mediaType = mediaTypeLayerGzip
+		tarOutput = gzipWriter
+	}
+	err = dtar.Write(io.MultiWriter(tarOutput, diffIDHasher), img.FileSystem,
+		objectsGetter)
+	if err != nil {
+		return descriptor{}, "", err
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return descriptor{}, "", err
+		}
+	}
+	if err := bufferedWriter.Flush(); err != nil {
+		return descriptor{}, "", err
+	}
+	if err := file.Close(); err != nil {
+		return descriptor{}, "", err
+	}
+	digest, err := renameBlob(blobsDir, tmpFilename, layerHasher.Sum(nil))
+	if err != nil {
+		return descriptor{}, "", err
+	}
+	layer := descriptor{
+		MediaType: mediaType,
+		Digest:    digest,
+		Size:      layerWriter.count,
+	}
+	return layer, "sha256:" + hex.EncodeToString(diffIDHasher.Sum(nil)), nil
+}
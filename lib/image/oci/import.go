@@ -0,0 +1,456 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+)
+
+type mergedEntry struct {
+	header *tar.Header
+	hash   hash.Hash
+}
+
+// mergedTree is the file-system resulting from applying layers in order.
+type mergedTree struct {
+	entries map[string]*mergedEntry // Key: normalised pathname.
+}
+
+type treeBuilder struct {
+	directories     map[string]*filesystem.DirectoryInode
+	fileSystem      *filesystem.FileSystem
+	inodeNumbers    map[string]uint64
+	nextInodeNumber uint64
+}
+
+func importArchive(reader io.Reader, hasher Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	dirname, err := os.MkdirTemp("", "oci-import.")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dirname)
+	if err := extractArchive(tar.NewReader(reader), dirname); err != nil {
+		return nil, err
+	}
+	return importLayout(dirname, hasher, filter)
+}
+
+func importLayout(dirname string, hasher Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	manifest, err := readManifest(dirname)
+	if err != nil {
+		return nil, err
+	}
+	tree := &mergedTree{entries: make(map[string]*mergedEntry)}
+	for _, layer := range manifest.Layers {
+		if err := tree.applyLayer(dirname, layer, hasher, filter); err != nil {
+			return nil, fmt.Errorf("error applying layer: %s: %s",
+				layer.Digest, err)
+		}
+	}
+	return tree.build()
+}
+
+// blobPath returns the pathname of the blob with the specified digest.
+func blobPath(dirname, digest string) (string, error) {
+	splitDigest := strings.SplitN(digest, ":", 2)
+	if len(splitDigest) != 2 || splitDigest[0] == "" || splitDigest[1] == "" ||
+		strings.ContainsAny(digest, "/\\") {
+		return "", fmt.Errorf("malformed digest: \"%s\"", digest)
+	}
+	return filepath.Join(dirname, "blobs", splitDigest[0], splitDigest[1]), nil
+}
+
+func extractArchive(tarReader *tar.Reader, dirname string) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+		filename := filepath.Join(dirname, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(filename, fsutil.DirPerms); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			err := os.MkdirAll(filepath.Dir(filename), fsutil.DirPerms)
+			if err != nil {
+				return err
+			}
+			err = fsutil.CopyToFile(filename, fsutil.PublicFilePerms,
+				tarReader, uint64(header.Size))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readJson(filename string, value interface{}) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewDecoder(bufio.NewReader(file)).Decode(value)
+}
+
+// readManifest will read the image index and return the manifest for the
+// selected image, following nested indices.
+func readManifest(dirname string) (*imageManifest, error) {
+	var index imageIndex
+	if err := readJson(filepath.Join(dirname, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	for {
+		manifestDescriptor, err := selectManifest(index.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		filename, err := blobPath(dirname, manifestDescriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		switch manifestDescriptor.MediaType {
+		case mediaTypeIndex, mediaTypeDockerManifestList:
+			index = imageIndex{}
+			if err := readJson(filename, &index); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var manifest imageManifest
+		if err := readJson(filename, &manifest); err != nil {
+			return nil, err
+		}
+		return &manifest, nil
+	}
+}
+
+// selectManifest returns the only manifest or the manifest for the
+// architecture of the running program.
+func selectManifest(manifests []descriptor) (descriptor, error) {
+	if len(manifests) < 1 {
+		return descriptor{}, errors.New("no manifests in image index")
+	}
+	if len(manifests) == 1 {
+		return manifests[0], nil
+	}
+	for _, manifest := range manifests {
+		if manifest.Platform != nil && manifest.Platform.OS == "linux" &&
+			manifest.Platform.Architecture == runtime.GOARCH {
+			return manifest, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no manifest for linux/%s in image index",
+		runtime.GOARCH)
+}
+
+func normaliseFilename(filename string) string {
+	return path.Clean("/" + filename)
+}
+
+func (tree *mergedTree) applyLayer(dirname string, layer descriptor,
+	hasher Hasher, filter *filter.Filter) error {
+	if strings.HasSuffix(layer.MediaType, "+zstd") {
+		return fmt.Errorf("unsupported media type: %s", layer.MediaType)
+	}
+	filename, err := blobPath(dirname, layer.Digest)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var layerReader io.Reader = reader
+	// Some producers use the wrong media type, so check for gzip magic.
+	if magic, err := reader.Peek(2); err == nil &&
+		magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		layerReader = gzipReader
+	}
+	tarReader := tar.NewReader(layerReader)
+	var layerEntries []*mergedEntry
+	var opaqueDirectories, whiteouts []string
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		header.Name = normaliseFilename(header.Name)
+		dirname, leafName := path.Split(header.Name)
+		dirname = path.Clean(dirname)
+		if leafName == whiteoutOpaque {
+			opaqueDirectories = append(opaqueDirectories, dirname)
+			continue
+		}
+		if strings.HasPrefix(leafName, whiteoutPrefix) {
+			whiteouts = append(whiteouts,
+				path.Join(dirname, leafName[len(whiteoutPrefix):]))
+			continue
+		}
+		if filter != nil && filter.Match(header.Name) {
+			continue
+		}
+		entry := &mergedEntry{header: header}
+		if header.Typeflag == tar.TypeReg && header.Size > 0 {
+			entry.hash, err = hasher.Hash(tarReader, uint64(header.Size))
+			if err != nil {
+				return err
+			}
+		}
+		layerEntries = append(layerEntries, entry)
+	}
+	// Whiteouts only apply to lower layers, so apply them first.
+	for _, dirname := range opaqueDirectories {
+		tree.deleteChildren(dirname)
+	}
+	for _, name := range whiteouts {
+		tree.delete(name)
+	}
+	for _, entry := range layerEntries {
+		name := entry.header.Name
+		if oldEntry, ok := tree.entries[name]; ok &&
+			oldEntry.header.Typeflag == tar.TypeDir &&
+			entry.header.Typeflag != tar.TypeDir {
+			tree.deleteChildren(name)
+		}
+		tree.entries[name] = entry
+	}
+	return nil
+}
+
+func (tree *mergedTree) build() (*filesystem.FileSystem, error) {
+	fileSystem := &filesystem.FileSystem{
+		DirectoryInode: filesystem.DirectoryInode{
+			Mode: syscall.S_IFDIR | fsutil.DirPerms,
+		},
+		InodeTable: make(filesystem.InodeTable),
+	}
+	builder := &treeBuilder{
+		directories: map[string]*filesystem.DirectoryInode{
+			"/": &fileSystem.DirectoryInode,
+		},
+		fileSystem:      fileSystem,
+		inodeNumbers:    make(map[string]uint64),
+		nextInodeNumber: 1,
+	}
+	names := make([]string, 0, len(tree.entries))
+	for name := range tree.entries {
+		names = append(names, name)
+	}
+	// Parents sort before their children.
+	sort.Strings(names)
+	var hardlinks []string
+	for _, name := range names {
+		header := tree.entries[name].header
+		if name == "/" {
+			if header.Typeflag == tar.TypeDir {
+				builder.setDirectory(&fileSystem.DirectoryInode, header)
+			}
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			hardlinks = append(hardlinks, name)
+			continue
+		}
+		if err := builder.add(name, tree.entries[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range hardlinks {
+		target, err := tree.resolveHardlink(name)
+		if err != nil {
+			return nil, err
+		}
+		inodeNumber, ok := builder.inodeNumbers[target]
+		if !ok {
+			return nil, fmt.Errorf("missing hardlink target: %s", target)
+		}
+		parent, err := builder.getDirectory(path.Dir(name))
+		if err != nil {
+			return nil, err
+		}
+		entry := &filesystem.DirectoryEntry{
+			Name:        path.Base(name),
+			InodeNumber: inodeNumber,
+		}
+		entry.SetInode(fileSystem.InodeTable[inodeNumber])
+		parent.EntryList = append(parent.EntryList, entry)
+	}
+	for _, directory := range builder.directories {
+		sort.Slice(directory.EntryList, func(left, right int) bool {
+			return directory.EntryList[left].Name <
+				directory.EntryList[right].Name
+		})
+	}
+	fileSystem.DirectoryCount = uint64(len(builder.directories))
+	fileSystem.ComputeTotalDataBytes()
+	return fileSystem, nil
+}
+
+// delete will delete the entry and any children.
+func (tree *mergedTree) delete(name string) {
+	delete(tree.entries, name)
+	tree.deleteChildren(name)
+}
+
+func (tree *mergedTree) deleteChildren(dirname string) {
+	prefix := dirname + "/"
+	if dirname == "/" {
+		prefix = "/"
+	}
+	for name := range tree.entries {
+		if name != "/" && strings.HasPrefix(name, prefix) {
+			delete(tree.entries, name)
+		}
+	}
+}
+
+// resolveHardlink returns the name of the entry which the hardlink ultimately
+// refers to.
+func (tree *mergedTree) resolveHardlink(name string) (string, error) {
+	for count := 0; count < len(tree.entries); count++ {
+		entry, ok := tree.entries[name]
+		if !ok {
+			return "", fmt.Errorf("missing hardlink target: %s", name)
+		}
+		if entry.header.Typeflag != tar.TypeLink {
+			return name, nil
+		}
+		name = normaliseFilename(entry.header.Linkname)
+	}
+	return "", fmt.Errorf("hardlink loop: %s", name)
+}
+
+func (builder *treeBuilder) add(name string, entry *mergedEntry) error {
+	parent, err := builder.getDirectory(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	header := entry.header
+	var inode filesystem.GenericInode
+	switch header.Typeflag {
+	case tar.TypeDir:
+		directory := &filesystem.DirectoryInode{}
+		builder.setDirectory(directory, header)
+		builder.directories[name] = directory
+		inode = directory
+	case tar.TypeReg:
+		inode = &filesystem.RegularInode{
+			Mode: filesystem.FileMode((header.Mode & ^syscall.S_IFMT) |
+				syscall.S_IFREG),
+			Uid:              uint32(header.Uid),
+			Gid:              uint32(header.Gid),
+			MtimeNanoSeconds: int32(header.ModTime.Nanosecond()),
+			MtimeSeconds:     header.ModTime.Unix(),
+			Size:             uint64(header.Size),
+			Hash:             entry.hash,
+		}
+	case tar.TypeSymlink:
+		inode = &filesystem.SymlinkInode{
+			Uid:     uint32(header.Uid),
+			Gid:     uint32(header.Gid),
+			Symlink: header.Linkname,
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		var fileType int64 = syscall.S_IFIFO
+		if header.Typeflag == tar.TypeChar {
+			fileType = syscall.S_IFCHR
+		} else if header.Typeflag == tar.TypeBlock {
+			fileType = syscall.S_IFBLK
+		}
+		if header.Devminor > 255 {
+			return fmt.Errorf("minor device number: %d too large",
+				header.Devminor)
+		}
+		inode = &filesystem.SpecialInode{
+			Mode: filesystem.FileMode((header.Mode & ^syscall.S_IFMT) |
+				fileType),
+			Uid:              uint32(header.Uid),
+			Gid:              uint32(header.Gid),
+			MtimeNanoSeconds: int32(header.ModTime.Nanosecond()),
+			MtimeSeconds:     header.ModTime.Unix(),
+			Rdev:             uint64(header.Devmajor<<8 | header.Devminor),
+		}
+	default:
+		return fmt.Errorf("%s: unsupported file type: %v", name,
+			header.Typeflag)
+	}
+	inodeNumber := builder.nextInodeNumber
+	builder.nextInodeNumber++
+	builder.fileSystem.InodeTable[inodeNumber] = inode
+	builder.inodeNumbers[name] = inodeNumber
+	dirent := &filesystem.DirectoryEntry{
+		Name:        path.Base(name),
+		InodeNumber: inodeNumber,
+	}
+	dirent.SetInode(inode)
+	parent.EntryList = append(parent.EntryList, dirent)
+	return nil
+}
+
+// getDirectory returns the directory inode for dirname, creating it and any
+// missing parents if the layers did not contain them.
+func (builder *treeBuilder) getDirectory(dirname string) (
+	*filesystem.DirectoryInode, error) {
+	if directory, ok := builder.directories[dirname]; ok {
+		return directory, nil
+	}
+	if _, ok := builder.inodeNumbers[dirname]; ok {
+		return nil, fmt.Errorf("%s: not a directory", dirname)
+	}
+	err := builder.add(dirname, &mergedEntry{
+		header: &tar.Header{
+			Mode:     fsutil.DirPerms,
+			Typeflag: tar.TypeDir,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return builder.directories[dirname], nil
+}
+
+func (builder *treeBuilder) setDirectory(directory *filesystem.DirectoryInode,
+	header *tar.Header) {
+	directory.Mode = filesystem.FileMode((header.Mode & ^syscall.S_IFMT) |
+		syscall.S_IFDIR)
+	directory.Uid = uint32(header.Uid)
+	directory.Gid = uint32(header.Gid)
+}
@@ -0,0 +1,156 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+)
+
+type testFile struct {
+	name     string
+	typeflag byte
+	data     string
+	linkname string
+}
+
+type testHasher struct{}
+
+func (testHasher) Hash(reader io.Reader, length uint64) (hash.Hash, error) {
+	hasher := sha512.New()
+	if _, err := io.CopyN(hasher, reader, int64(length)); err != nil {
+		return hash.Hash{}, err
+	}
+	var hashVal hash.Hash
+	copy(hashVal[:], hasher.Sum(nil))
+	return hashVal, nil
+}
+
+func makeLayer(t *testing.T, files []testFile) []byte {
+	buffer := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buffer)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:     file.name,
+			Mode:     0644,
+			Size:     int64(len(file.data)),
+			Typeflag: file.typeflag,
+			Linkname: file.linkname,
+		}
+		if file.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(file.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func makeLayout(t *testing.T, layers ...[]byte) string {
+	dirname := t.TempDir()
+	blobsDir := filepath.Join(dirname, "blobs", "sha256")
+	if err := os.MkdirAll(blobsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := imageManifest{SchemaVersion: 2, MediaType: mediaTypeManifest}
+	for _, layer := range layers {
+		digest := sha256.Sum256(layer)
+		hexDigest := hex.EncodeToString(digest[:])
+		err := os.WriteFile(filepath.Join(blobsDir, hexDigest), layer, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Layers = append(manifest.Layers, descriptor{
+			MediaType: mediaTypeLayer,
+			Digest:    "sha256:" + hexDigest,
+			Size:      int64(len(layer)),
+		})
+	}
+	manifestDescriptor, err := writeJsonBlob(blobsDir, mediaTypeManifest,
+		manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeJsonFile(filepath.Join(dirname, "index.json"),
+		imageIndex{SchemaVersion: 2, Manifests: []descriptor{
+			manifestDescriptor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dirname
+}
+
+func lookup(fs *filesystem.FileSystem,
+	names ...string) *filesystem.DirectoryEntry {
+	directory := &fs.DirectoryInode
+	var found *filesystem.DirectoryEntry
+	for _, name := range names {
+		found = nil
+		for _, dirent := range directory.EntryList {
+			if dirent.Name == name {
+				found = dirent
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		directory, _ = found.Inode().(*filesystem.DirectoryInode)
+	}
+	return found
+}
+
+func TestImportWhiteouts(t *testing.T) {
+	layer0 := makeLayer(t, []testFile{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/a", typeflag: tar.TypeReg, data: "a"},
+		{name: "etc/b", typeflag: tar.TypeReg, data: "b"},
+		{name: "opt/x/", typeflag: tar.TypeDir},
+		{name: "opt/x/y", typeflag: tar.TypeReg, data: "y"},
+	})
+	layer1 := makeLayer(t, []testFile{
+		{name: "etc/.wh.a", typeflag: tar.TypeReg},
+		{name: "etc/c", typeflag: tar.TypeLink, linkname: "etc/b"},
+		{name: "opt/x/z", typeflag: tar.TypeReg, data: "z"},
+		{name: "opt/x/.wh..wh..opq", typeflag: tar.TypeReg},
+	})
+	fs, err := Import(makeLayout(t, layer0, layer1), testHasher{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup(fs, "etc", "a") != nil {
+		t.Error("whiteout did not delete /etc/a")
+	}
+	if lookup(fs, "opt", "x", "y") != nil {
+		t.Error("opaque whiteout did not delete /opt/x/y")
+	}
+	if lookup(fs, "opt", "x", "z") == nil {
+		t.Error("/opt/x/z missing: opaque whiteout applied to own layer")
+	}
+	b := lookup(fs, "etc", "b")
+	c := lookup(fs, "etc", "c")
+	if b == nil || c == nil {
+		t.Fatal("/etc/b or /etc/c missing")
+	}
+	if b.InodeNumber != c.InodeNumber {
+		t.Error("/etc/c is not a hardlink to /etc/b")
+	}
+	if lookup(fs, "opt") == nil {
+		t.Error("implicit parent directory /opt missing")
+	}
+}
@@ -19,6 +19,8 @@ func (image *Image) registerStrings(registerFunc func(string)) {
 	image.Triggers.RegisterStrings(registerFunc)
 	image.ReleaseNotes.registerStrings(registerFunc)
 	image.BuildLog.registerStrings(registerFunc)
+	image.SBOM.registerStrings(registerFunc)
+	image.TestResults.registerStrings(registerFunc)
 	for index := range image.Packages {
 		pkg := &image.Packages[index]
 		pkg.registerStrings(registerFunc)
@@ -36,6 +38,8 @@ func (image *Image) replaceStrings(replaceFunc func(string) string) {
 	image.Triggers.ReplaceStrings(replaceFunc)
 	image.ReleaseNotes.replaceStrings(replaceFunc)
 	image.BuildLog.replaceStrings(replaceFunc)
+	image.SBOM.replaceStrings(replaceFunc)
+	image.TestResults.replaceStrings(replaceFunc)
 	for index := range image.Packages {
 		pkg := &image.Packages[index]
 		pkg.replaceStrings(replaceFunc)
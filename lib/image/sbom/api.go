@@ -0,0 +1,33 @@
+package sbom
+
+import (
+	"io"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+type Params struct {
+	CreatedOn time.Time // Default: image creation time or the current time.
+	Format    string    // FormatSPDX (default) or FormatCycloneDX.
+	Name      string    // Name of the image or image stream.
+}
+
+// CheckFormat returns an error if format is not a supported SBOM format. The
+// empty string is accepted and selects the default format.
+func CheckFormat(format string) error {
+	return checkFormat(format)
+}
+
+// Write will write a software bill of materials for the image to writer in
+// JSON format. The packages in the image are listed, with the package type
+// (deb or rpm) detected from the image file-system. The hashes of all regular
+// files in the image are also listed.
+func Write(writer io.Writer, img *image.Image, params Params) error {
+	return write(writer, img, params)
+}
@@ -0,0 +1,228 @@
+package sbom
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+)
+
+const (
+	creatorTool          = "Dominator"
+	documentNamespaceUrl = "https://github.com/Cloud-Foundations/Dominator/sbom/"
+	spdxDocumentId       = "SPDXRef-DOCUMENT"
+	spdxImageId          = "SPDXRef-Image"
+)
+
+type fileEntry struct {
+	hash string
+	name string
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case "", FormatCycloneDX, FormatSPDX:
+		return nil
+	}
+	return fmt.Errorf("unsupported SBOM format: \"%s\"", format)
+}
+
+// detectPackageType returns the package URL type for the packages in the image
+// file-system.
+func detectPackageType(fs *filesystem.FileSystem) string {
+	if fs == nil {
+		return ""
+	}
+	filenameToInodeTable := fs.FilenameToInodeTable()
+	if _, ok := filenameToInodeTable["/var/lib/dpkg/status"]; ok {
+		return "deb"
+	}
+	if _, ok := filenameToInodeTable["/var/lib/rpm"]; ok {
+		return "rpm"
+	}
+	return ""
+}
+
+// listFiles returns the names and SHA-512 hashes of the regular files in the
+// file-system, sorted by name.
+func listFiles(fs *filesystem.FileSystem) ([]fileEntry, error) {
+	if fs == nil {
+		return nil, nil
+	}
+	var files []fileEntry
+	err := fs.ForEachFile(
+		func(name string, inodeNumber uint64,
+			inode filesystem.GenericInode) error {
+			if inode, ok := inode.(*filesystem.RegularInode); ok {
+				files = append(files, fileEntry{
+					hash: hex.EncodeToString(inode.Hash[:]),
+					name: name,
+				})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(left, right int) bool {
+		return files[left].name < files[right].name
+	})
+	return files, nil
+}
+
+func makePurl(packageType string, pkg image.Package) string {
+	if packageType == "" {
+		return ""
+	}
+	purl := "pkg:" + packageType + "/" + url.PathEscape(pkg.Name)
+	if pkg.Version != "" {
+		purl += "@" + url.PathEscape(pkg.Version)
+	}
+	return purl
+}
+
+func write(writer io.Writer, img *image.Image, params Params) error {
+	if err := checkFormat(params.Format); err != nil {
+		return err
+	}
+	if img.FileSystem != nil {
+		if err := img.FileSystem.RebuildInodePointers(); err != nil {
+			return err
+		}
+	}
+	if params.CreatedOn.IsZero() {
+		if img.CreatedOn.IsZero() {
+			params.CreatedOn = time.Now()
+		} else {
+			params.CreatedOn = img.CreatedOn
+		}
+	}
+	files, err := listFiles(img.FileSystem)
+	if err != nil {
+		return err
+	}
+	packageType := detectPackageType(img.FileSystem)
+	var document interface{}
+	if params.Format == FormatCycloneDX {
+		document = makeCycloneDx(img, params, packageType, files)
+	} else {
+		document = makeSpdx(img, params, packageType, files)
+	}
+	return json.WriteWithIndent(writer, "  ", document)
+}
+
+func makeCycloneDx(img *image.Image, params Params, packageType string,
+	files []fileEntry) *cycloneDxBom {
+	bom := &cycloneDxBom{
+		BomFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDxMetadata{
+			Timestamp: params.CreatedOn.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDxTool{{Name: creatorTool}},
+			Component: cycloneDxComponent{
+				Type: "operating-system",
+				Name: params.Name,
+			},
+		},
+		Components: make([]cycloneDxComponent, 0,
+			len(img.Packages)+len(files)),
+	}
+	for index, pkg := range img.Packages {
+		purl := makePurl(packageType, pkg)
+		bomRef := purl
+		if bomRef == "" {
+			bomRef = fmt.Sprintf("package-%d", index)
+		}
+		bom.Components = append(bom.Components, cycloneDxComponent{
+			BomRef:  bomRef,
+			Type:    "library",
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Purl:    purl,
+		})
+	}
+	for _, file := range files {
+		bom.Components = append(bom.Components, cycloneDxComponent{
+			Type:   "file",
+			Name:   file.name,
+			Hashes: []cycloneDxHash{{Algorithm: "SHA-512", Content: file.hash}},
+		})
+	}
+	return bom
+}
+
+func makeSpdx(img *image.Image, params Params, packageType string,
+	files []fileEntry) *spdxDocument {
+	document := &spdxDocument{
+		SpdxVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SpdxId:      spdxDocumentId,
+		Name:        params.Name,
+		DocumentNamespace: documentNamespaceUrl + url.PathEscape(params.Name) +
+			"/" + strconv.FormatInt(params.CreatedOn.Unix(), 10),
+		CreationInfo: spdxCreationInfo{
+			Created:  params.CreatedOn.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + creatorTool},
+		},
+		Packages: make([]spdxPackage, 0, len(img.Packages)+1),
+		Files:    make([]spdxFile, 0, len(files)),
+		Relationships: []spdxRelationship{{
+			SpdxElementId:      spdxDocumentId,
+			RelationshipType:   "DESCRIBES",
+			RelatedSpdxElement: spdxImageId,
+		}},
+	}
+	document.Packages = append(document.Packages, spdxPackage{
+		Name:             params.Name,
+		SpdxId:           spdxImageId,
+		DownloadLocation: "NOASSERTION",
+	})
+	for index, pkg := range img.Packages {
+		spdxPkg := spdxPackage{
+			Name:             pkg.Name,
+			SpdxId:           fmt.Sprintf("SPDXRef-Package-%d", index),
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+		}
+		if purl := makePurl(packageType, pkg); purl != "" {
+			spdxPkg.ExternalRefs = []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl,
+			}}
+		}
+		document.Packages = append(document.Packages, spdxPkg)
+		document.Relationships = append(document.Relationships,
+			spdxRelationship{
+				SpdxElementId:      spdxImageId,
+				RelationshipType:   "CONTAINS",
+				RelatedSpdxElement: spdxPkg.SpdxId,
+			})
+	}
+	for index, file := range files {
+		spdxFile := spdxFile{
+			FileName: "." + file.name,
+			SpdxId:   fmt.Sprintf("SPDXRef-File-%d", index),
+			Checksums: []spdxChecksum{{
+				Algorithm:     "SHA512",
+				ChecksumValue: file.hash,
+			}},
+		}
+		document.Files = append(document.Files, spdxFile)
+		document.Relationships = append(document.Relationships,
+			spdxRelationship{
+				SpdxElementId:      spdxImageId,
+				RelationshipType:   "CONTAINS",
+				RelatedSpdxElement: spdxFile.SpdxId,
+			})
+	}
+	return document
+}
@@ -0,0 +1,95 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testimage"
+)
+
+func makeTestImage() *image.Image {
+	img := testimage.New(
+		testimage.File{Name: "/bin", Hash: hash.Hash{0xab}, Size: 4},
+		testimage.File{Name: "/var/lib/rpm", IsDirectory: true},
+	)
+	img.CreatedOn = time.Unix(1700000000, 0)
+	img.Packages = []image.Package{{Name: "bash", Version: "5.1"}}
+	return img
+}
+
+func TestWriteCycloneDx(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	err := Write(buffer, makeTestImage(),
+		Params{Format: FormatCycloneDX, Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cycloneDxBom
+	if err := json.Unmarshal(buffer.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("expected 2 components, got: %d", len(bom.Components))
+	}
+	if purl := bom.Components[0].Purl; purl != "pkg:rpm/bash@5.1" {
+		t.Errorf("unexpected purl: %s", purl)
+	}
+	if hashes := bom.Components[1].Hashes; len(hashes) != 1 ||
+		hashes[0].Content[:4] != "ab00" {
+		t.Errorf("unexpected hashes: %v", hashes)
+	}
+}
+
+func TestWriteCycloneDxUnknownPackageType(t *testing.T) {
+	img := makeTestImage()
+	img.FileSystem = nil
+	buffer := &bytes.Buffer{}
+	err := Write(buffer, img, Params{Format: FormatCycloneDX, Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cycloneDxBom
+	if err := json.Unmarshal(buffer.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if len(bom.Components) != 1 {
+		t.Fatalf("expected 1 component, got: %d", len(bom.Components))
+	}
+	if component := bom.Components[0]; component.BomRef == "" ||
+		component.Purl != "" {
+		t.Errorf("unexpected bom-ref: \"%s\" or purl: \"%s\"",
+			component.BomRef, component.Purl)
+	}
+}
+
+func TestWriteSpdx(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	if err := Write(buffer, makeTestImage(), Params{Name: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	var document spdxDocument
+	if err := json.Unmarshal(buffer.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Packages) != 2 {
+		t.Fatalf("expected 2 packages, got: %d", len(document.Packages))
+	}
+	if len(document.Files) != 1 || document.Files[0].FileName != "./bin" {
+		t.Errorf("unexpected files: %v", document.Files)
+	}
+	if len(document.Relationships) != 3 {
+		t.Errorf("expected 3 relationships, got: %d",
+			len(document.Relationships))
+	}
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, &image.Image{},
+		Params{Format: "bogus"}); err == nil {
+		t.Error("unsupported format did not fail")
+	}
+}
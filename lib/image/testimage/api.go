@@ -0,0 +1,22 @@
+package testimage
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+// File describes a file to add to a test image. Parent directories are created
+// automatically.
+type File struct {
+	Name         string // Absolute pathname.
+	IsDirectory  bool
+	Hash         hash.Hash
+	MtimeSeconds int64
+	Size         uint64
+}
+
+// New will create an image for tests containing the specified files. Both the
+// inode table and the inode pointers are populated.
+func New(files ...File) *image.Image {
+	return newImage(files)
+}
@@ -0,0 +1,71 @@
+package testimage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+type builder struct {
+	directories map[string]*filesystem.DirectoryInode
+	fs          *filesystem.FileSystem
+}
+
+func newImage(files []File) *image.Image {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	fs.DirectoryInode.Mode = filesystem.FileMode(0755)
+	b := &builder{
+		directories: map[string]*filesystem.DirectoryInode{
+			"/": &fs.DirectoryInode,
+		},
+		fs: fs,
+	}
+	for _, file := range files {
+		if file.IsDirectory {
+			b.makeDirectory(file.Name)
+			continue
+		}
+		inode := &filesystem.RegularInode{
+			Mode:         filesystem.FileMode(0644),
+			MtimeSeconds: file.MtimeSeconds,
+			Size:         file.Size,
+			Hash:         file.Hash,
+		}
+		b.addEntry(file.Name, inode)
+	}
+	for _, directory := range b.directories {
+		sort.Slice(directory.EntryList, func(left, right int) bool {
+			return directory.EntryList[left].Name <
+				directory.EntryList[right].Name
+		})
+	}
+	return &image.Image{FileSystem: fs}
+}
+
+func (b *builder) addEntry(name string, inode filesystem.GenericInode) {
+	index := strings.LastIndex(name, "/")
+	parent := b.makeDirectory(name[:index])
+	inodeNumber := uint64(len(b.fs.InodeTable) + 1)
+	b.fs.InodeTable[inodeNumber] = inode
+	dirent := &filesystem.DirectoryEntry{
+		Name:        name[index+1:],
+		InodeNumber: inodeNumber,
+	}
+	dirent.SetInode(inode)
+	parent.EntryList = append(parent.EntryList, dirent)
+}
+
+func (b *builder) makeDirectory(name string) *filesystem.DirectoryInode {
+	if name == "" {
+		name = "/"
+	}
+	if directory, ok := b.directories[name]; ok {
+		return directory
+	}
+	directory := &filesystem.DirectoryInode{Mode: filesystem.FileMode(0755)}
+	b.directories[name] = directory
+	b.addEntry(name, directory)
+	return directory
+}
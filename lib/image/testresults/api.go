@@ -0,0 +1,61 @@
+package testresults
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	StatusFail = "fail"
+	StatusPass = "pass"
+	StatusSkip = "skip"
+
+	// ExitCodeSkip is the exit code a test uses to indicate it was skipped.
+	ExitCodeSkip = 77
+
+	// MaximumOutputLength is the maximum length of an output excerpt.
+	MaximumOutputLength = 4096
+)
+
+type Result struct {
+	Duration time.Duration
+	Name     string // Pathname relative to the /tests directory.
+	Output   string `json:",omitempty"` // Excerpt (the end) of the output.
+	Status   string // One of StatusFail, StatusPass, StatusSkip.
+}
+
+type Results struct {
+	Results []Result // Sorted by Name.
+}
+
+// Decode will decode test results written by Encode.
+func Decode(reader io.Reader) (*Results, error) {
+	return decode(reader)
+}
+
+// MakeExcerpt will return the end of the output, limited to
+// MaximumOutputLength bytes.
+func MakeExcerpt(output []byte) string {
+	return makeExcerpt(output)
+}
+
+// Count will return the number of tests with each status.
+func (r *Results) Count() (numPassed, numFailed, numSkipped uint) {
+	return r.count()
+}
+
+// Encode will write the test results in a form suitable for storing as an
+// image annotation.
+func (r *Results) Encode(writer io.Writer) error {
+	return r.encode(writer)
+}
+
+// Sort will sort the test results by name.
+func (r *Results) Sort() {
+	r.sort()
+}
+
+// WriteHtml will write the test results as a HTML table.
+func (r *Results) WriteHtml(writer io.Writer) {
+	r.writeHtml(writer)
+}
@@ -0,0 +1,41 @@
+package testresults
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+)
+
+func (r *Results) writeHtml(writer io.Writer) {
+	numPassed, numFailed, numSkipped := r.count()
+	fmt.Fprintf(writer, "Passed: %d, failed: %d, skipped: %d<br>\n",
+		numPassed, numFailed, numSkipped)
+	if len(r.Results) < 1 {
+		return
+	}
+	fmt.Fprintln(writer, `<table border="1">`)
+	tw, _ := html.NewTableWriter(writer, true, "Name", "Status", "Duration",
+		"Output")
+	for _, result := range r.Results {
+		var background string
+		switch result.Status {
+		case StatusFail:
+			background = "#ffb0b0"
+		case StatusSkip:
+			background = "#e0e0e0"
+		}
+		output := result.Output
+		if output != "" {
+			output = "<pre>" + template.HTMLEscapeString(output) + "</pre>"
+		}
+		tw.WriteRow("", background,
+			template.HTMLEscapeString(result.Name),
+			result.Status,
+			format.Duration(result.Duration),
+			output)
+	}
+	tw.Close()
+}
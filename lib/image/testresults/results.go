@@ -0,0 +1,54 @@
+package testresults
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	libjson "github.com/Cloud-Foundations/Dominator/lib/json"
+)
+
+func decode(reader io.Reader) (*Results, error) {
+	var results Results
+	if err := json.NewDecoder(reader).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+func makeExcerpt(output []byte) string {
+	if len(output) <= MaximumOutputLength {
+		return string(output)
+	}
+	output = output[len(output)-MaximumOutputLength:]
+	// Do not start in the middle of a multi-byte character.
+	for len(output) > 0 && !utf8.RuneStart(output[0]) {
+		output = output[1:]
+	}
+	return "..." + string(output)
+}
+
+func (r *Results) count() (numPassed, numFailed, numSkipped uint) {
+	for _, result := range r.Results {
+		switch result.Status {
+		case StatusPass:
+			numPassed++
+		case StatusSkip:
+			numSkipped++
+		default:
+			numFailed++
+		}
+	}
+	return
+}
+
+func (r *Results) encode(writer io.Writer) error {
+	return libjson.WriteWithIndent(writer, "    ", r)
+}
+
+func (r *Results) sort() {
+	sort.SliceStable(r.Results, func(left, right int) bool {
+		return r.Results[left].Name < r.Results[right].Name
+	})
+}
@@ -0,0 +1,48 @@
+package testresults
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	results := &Results{Results: []Result{
+		{Name: "web/check", Status: StatusSkip},
+		{Duration: time.Second, Name: "base/check", Status: StatusPass},
+		{Name: "base/fail", Output: "oops\n", Status: StatusFail},
+	}}
+	results.Sort()
+	if results.Results[0].Name != "base/check" {
+		t.Errorf("not sorted: %v", results.Results)
+	}
+	buffer := &bytes.Buffer{}
+	if err := results.Encode(buffer); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numPassed, numFailed, numSkipped := decoded.Count()
+	if numPassed != 1 || numFailed != 1 || numSkipped != 1 {
+		t.Errorf("passed: %d, failed: %d, skipped: %d",
+			numPassed, numFailed, numSkipped)
+	}
+	if decoded.Results[1].Output != "oops\n" {
+		t.Errorf("output: %q", decoded.Results[1].Output)
+	}
+}
+
+func TestMakeExcerpt(t *testing.T) {
+	if excerpt := MakeExcerpt([]byte("short")); excerpt != "short" {
+		t.Errorf("excerpt: %q", excerpt)
+	}
+	output := strings.Repeat("x", MaximumOutputLength) + "end"
+	excerpt := MakeExcerpt([]byte(output))
+	if !strings.HasPrefix(excerpt, "...") || !strings.HasSuffix(excerpt, "end") ||
+		len(excerpt) != MaximumOutputLength+3 {
+		t.Errorf("bad excerpt length: %d", len(excerpt))
+	}
+}
@@ -48,6 +48,14 @@ func CopyIP(ip net.IP) net.IP {
 func DecrementIP(ip net.IP) {
 	decrementIP(ip)
 }
+
+// GetEui64HardwareAddr returns the 48 bit MAC address from which the interface
+// identifier of the IPv6 address ip was derived (using modified EUI-64). If
+// the interface identifier was not derived from a MAC address nil is returned.
+func GetEui64HardwareAddr(ip net.IP) net.HardwareAddr {
+	return getEui64HardwareAddr(ip)
+}
+
 func GetDefaultRoute() (*DefaultRouteInfo, error) {
 	return getDefaultRoute()
 }
@@ -72,6 +80,13 @@ func InvertIP(input net.IP) {
 	invertIP(input)
 }
 
+// MakeEui64Address returns the IPv6 address formed from the /64 prefix and the
+// modified EUI-64 interface identifier for the 48 bit MAC address hwAddr, as
+// used for IPv6 Stateless Address Autoconfiguration (SLAAC).
+func MakeEui64Address(prefix net.IP, hwAddr net.HardwareAddr) (net.IP, error) {
+	return makeEui64Address(prefix, hwAddr)
+}
+
 func ShrinkIP(netIP net.IP) net.IP {
 	return shrinkIP(netIP)
 }
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"fmt"
+	"net"
+)
+
+func getEui64HardwareAddr(ip net.IP) net.HardwareAddr {
+	if ip.To4() != nil {
+		return nil
+	}
+	if ip = ip.To16(); ip == nil {
+		return nil
+	}
+	if ip[11] != 0xff || ip[12] != 0xfe {
+		return nil
+	}
+	return net.HardwareAddr{ip[8] ^ 0x02, ip[9], ip[10], ip[13], ip[14], ip[15]}
+}
+
+func makeEui64Address(prefix net.IP, hwAddr net.HardwareAddr) (net.IP, error) {
+	if len(hwAddr) != 6 {
+		return nil, fmt.Errorf("not a 48 bit MAC address: %s", hwAddr)
+	}
+	prefix16 := prefix.To16()
+	if prefix16 == nil || prefix.To4() != nil {
+		return nil, fmt.Errorf("not an IPv6 prefix: %s", prefix)
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix16[:8])
+	ip[8] = hwAddr[0] ^ 0x02 // Flip the universal/local bit.
+	ip[9] = hwAddr[1]
+	ip[10] = hwAddr[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = hwAddr[3]
+	ip[14] = hwAddr[4]
+	ip[15] = hwAddr[5]
+	return ip, nil
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMakeEui64Address(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		hwAddr  string
+		want    string
+		wantErr bool
+	}{
+		{"global", "2001:db8:1:2::", "52:54:0a:01:02:03",
+			"2001:db8:1:2:5054:aff:fe01:203", false},
+		{"link-local", "fe80::", "52:54:0a:01:02:03",
+			"fe80::5054:aff:fe01:203", false},
+		{"universal bit set", "2001:db8::", "00:16:3e:aa:bb:cc",
+			"2001:db8::216:3eff:feaa:bbcc", false},
+		{"host bits ignored", "2001:db8::ffff", "52:54:0a:01:02:03",
+			"2001:db8::5054:aff:fe01:203", false},
+		{"IPv4 prefix", "10.0.0.0", "52:54:0a:01:02:03", "", true},
+		{"EUI-64 MAC", "2001:db8::", "52:54:0a:ff:fe:01:02:03", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hwAddr, err := net.ParseMAC(test.hwAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := makeEui64Address(net.ParseIP(test.prefix), hwAddr)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("makeEui64Address() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(net.ParseIP(test.want)) {
+				t.Errorf("makeEui64Address() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetEui64HardwareAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{"global", "2001:db8:1:2:5054:aff:fe01:203", "52:54:0a:01:02:03"},
+		{"link-local", "fe80::5054:aff:fe01:203", "52:54:0a:01:02:03"},
+		{"universal bit set", "2001:db8::216:3eff:feaa:bbcc",
+			"00:16:3e:aa:bb:cc"},
+		{"not EUI-64", "2001:db8::1", ""},
+		{"IPv4", "10.0.0.1", ""},
+		{"IPv4 mapped", "::ffff:10.0.0.1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := getEui64HardwareAddr(net.ParseIP(test.ip))
+			if test.want == "" {
+				if got != nil {
+					t.Errorf("getEui64HardwareAddr() = %s, want nil", got)
+				}
+				return
+			}
+			if got.String() != test.want {
+				t.Errorf("getEui64HardwareAddr() = %s, want %s",
+					got, test.want)
+			}
+		})
+	}
+}
+
+func TestEui64RoundTrip(t *testing.T) {
+	hwAddr, err := net.ParseMAC("52:54:0a:01:02:03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := makeEui64Address(net.ParseIP("2001:db8::"), hwAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getEui64HardwareAddr(ip); got.String() != hwAddr.String() {
+		t.Errorf("round trip: %s, want %s", got, hwAddr)
+	}
+}
@@ -53,6 +53,7 @@ type ObjectsIterator interface {
 type ObjectsRefcounter interface {
 	AdjustRefcounts(bool, ObjectsIterator) error
 	DeleteUnreferenced(percentage uint8, bytes uint64) (uint64, uint64, error)
+	GetRefcounts(hashes []hash.Hash) []uint64
 	ListUnreferenced() map[hash.Hash]uint64
 }
 
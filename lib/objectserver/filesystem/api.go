@@ -132,6 +132,12 @@ func (objSrv *ObjectServer) DeleteUnreferenced(percentage uint8,
 	return objSrv.deleteUnreferenced(percentage, bytes)
 }
 
+// GetRefcounts will return the reference counts for the specified objects. A
+// zero refcount is returned for unknown objects.
+func (objSrv *ObjectServer) GetRefcounts(hashes []hash.Hash) []uint64 {
+	return objSrv.getRefcounts(hashes)
+}
+
 func (objSrv *ObjectServer) ListUnreferenced() map[hash.Hash]uint64 {
 	return objSrv.listUnreferenced()
 }
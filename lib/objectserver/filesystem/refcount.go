@@ -159,6 +159,18 @@ func (objSrv *ObjectServer) incrementRefcount(object *objectType) error {
 	return nil
 }
 
+func (objSrv *ObjectServer) getRefcounts(hashes []hash.Hash) []uint64 {
+	objSrv.rwLock.RLock()
+	defer objSrv.rwLock.RUnlock()
+	refcounts := make([]uint64, len(hashes))
+	for index, hashVal := range hashes {
+		if object := objSrv.objects[hashVal]; object != nil {
+			refcounts[index] = object.refcount
+		}
+	}
+	return refcounts
+}
+
 func (objSrv *ObjectServer) listUnreferenced() map[hash.Hash]uint64 {
 	objSrv.rwLock.RLock()
 	defer objSrv.rwLock.RUnlock()
@@ -0,0 +1,89 @@
+/*
+Package vulnerability matches package lists against an offline vulnerability
+feed.
+
+The feed is a file containing either a single advisory or a JSON array of
+advisories in the OSV (https://ossf.github.io/osv-schema/) format. Advisories
+are matched against packages by name and affected versions. Version strings
+are compared using the verstr package, after discarding any epoch prefix, so
+matching is approximate for some versioning schemes.
+*/
+package vulnerability
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+type Database struct {
+	advisories    map[string][]*affectedPackage // Key: package name.
+	loadedAt      time.Time
+	numAdvisories uint
+}
+
+// Feed is a vulnerability database which is reloaded when the feed file
+// changes.
+type Feed struct {
+	ecosystems []string
+	logger     log.DebugLogger
+	pathname   string
+	mutex      sync.RWMutex // Protect everything below.
+	database   *Database
+	lastError  error
+}
+
+type Finding struct {
+	AdvisoryId     string
+	Aliases        []string `json:",omitempty"`
+	FixedVersion   string   `json:",omitempty"`
+	PackageName    string
+	PackageVersion string
+	Severity       string `json:",omitempty"`
+	Summary        string `json:",omitempty"`
+}
+
+// Decode will decode an OSV vulnerability feed from reader. If ecosystems is
+// not empty, only advisories for packages in the specified ecosystems are
+// loaded. Ecosystems are matched by prefix, so "Debian" will match
+// "Debian:12".
+func Decode(reader io.Reader, ecosystems []string) (*Database, error) {
+	return decode(reader, ecosystems)
+}
+
+// Load will load an OSV vulnerability feed from the specified file.
+func Load(pathname string, ecosystems []string) (*Database, error) {
+	return load(pathname, ecosystems)
+}
+
+// LoadedAt returns the time the database was loaded.
+func (db *Database) LoadedAt() time.Time {
+	return db.loadedAt
+}
+
+// Match returns the findings for the specified packages, sorted by package
+// name and advisory ID.
+func (db *Database) Match(packages []image.Package) []Finding {
+	return db.match(packages)
+}
+
+// NumAdvisories returns the number of advisories in the database.
+func (db *Database) NumAdvisories() uint {
+	return db.numAdvisories
+}
+
+// WatchFeed will load the feed file at pathname and will reload it whenever it
+// changes. Errors are logged.
+func WatchFeed(pathname string, ecosystems []string,
+	logger log.DebugLogger) *Feed {
+	return watchFeed(pathname, ecosystems, logger)
+}
+
+// GetDatabase returns the most recently loaded database (nil if the feed has
+// not been loaded) and the error from the last load attempt, if any.
+func (f *Feed) GetDatabase() (*Database, error) {
+	return f.getDatabase()
+}
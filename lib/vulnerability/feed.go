@@ -0,0 +1,51 @@
+package vulnerability
+
+import (
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func watchFeed(pathname string, ecosystems []string,
+	logger log.DebugLogger) *Feed {
+	feed := &Feed{
+		ecosystems: ecosystems,
+		logger:     logger,
+		pathname:   pathname,
+	}
+	go feed.watch(fsutil.WatchFile(pathname, logger))
+	return feed
+}
+
+func (f *Feed) getDatabase() (*Database, error) {
+	if f == nil {
+		return nil, nil
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.database, f.lastError
+}
+
+func (f *Feed) load(reader io.ReadCloser) {
+	defer reader.Close()
+	database, err := decode(reader, f.ecosystems)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err != nil {
+		f.lastError = err
+		f.logger.Printf("Error loading vulnerability feed: %s: %s\n",
+			f.pathname, err)
+		return
+	}
+	f.database = database
+	f.lastError = nil
+	f.logger.Printf("Loaded %d advisories from vulnerability feed: %s\n",
+		database.numAdvisories, f.pathname)
+}
+
+func (f *Feed) watch(readCloserChannel <-chan io.ReadCloser) {
+	for reader := range readCloserChannel {
+		f.load(reader)
+	}
+}
@@ -0,0 +1,101 @@
+package vulnerability
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/verstr"
+)
+
+// isAffected returns true if version is affected. If the version is affected
+// and there is a version which fixes it, that is also returned.
+func (pkg *affectedPackage) isAffected(version string) (bool, string) {
+	if _, ok := pkg.versions[version]; ok {
+		return true, ""
+	}
+	for _, osvRange := range pkg.ranges {
+		if osvRange.Type == "GIT" {
+			continue
+		}
+		if affected, fixedVersion := rangeAffects(osvRange,
+			version); affected {
+			return true, fixedVersion
+		}
+	}
+	return false, ""
+}
+
+func (db *Database) match(packages []image.Package) []Finding {
+	if db == nil {
+		return nil
+	}
+	var findings []Finding
+	for _, pkg := range packages {
+		version := stripEpoch(pkg.Version)
+		for _, affectedPkg := range db.advisories[pkg.Name] {
+			affected, fixedVersion := affectedPkg.isAffected(version)
+			if !affected {
+				continue
+			}
+			advisory := affectedPkg.advisory
+			findings = append(findings, Finding{
+				AdvisoryId:     advisory.Id,
+				Aliases:        advisory.Aliases,
+				FixedVersion:   fixedVersion,
+				PackageName:    pkg.Name,
+				PackageVersion: pkg.Version,
+				Severity:       advisory.severity(),
+				Summary:        advisory.Summary,
+			})
+		}
+	}
+	sort.SliceStable(findings, func(left, right int) bool {
+		if findings[left].PackageName != findings[right].PackageName {
+			return findings[left].PackageName < findings[right].PackageName
+		}
+		return findings[left].AdvisoryId < findings[right].AdvisoryId
+	})
+	return findings
+}
+
+// rangeAffects returns true if version is within an affected interval of the
+// range. The events are expected to be sorted by version, as required by the
+// OSV schema.
+func rangeAffects(osvRange osvRange, version string) (bool, string) {
+	var affected bool
+	for _, event := range osvRange.Events {
+		if introduced, ok := event[eventIntroduced]; ok {
+			introduced = stripEpoch(introduced)
+			if introduced == "0" || !verstr.Less(version, introduced) {
+				affected = true
+			}
+		}
+		if fixed, ok := event[eventFixed]; ok && affected {
+			if verstr.Less(version, stripEpoch(fixed)) {
+				return true, fixed
+			}
+			affected = false
+		}
+		if lastAffected, ok := event[eventLastAffected]; ok && affected {
+			if !verstr.Less(stripEpoch(lastAffected), version) {
+				return true, ""
+			}
+			affected = false
+		}
+	}
+	return affected, ""
+}
+
+// stripEpoch removes a leading "epoch:" from a version string.
+func stripEpoch(version string) string {
+	if index := strings.IndexByte(version, ':'); index > 0 {
+		for _, char := range version[:index] {
+			if char < '0' || char > '9' {
+				return version
+			}
+		}
+		return version[index+1:]
+	}
+	return version
+}
@@ -0,0 +1,79 @@
+package vulnerability
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+)
+
+const testFeed = `[
+  {
+    "id": "OSV-1",
+    "summary": "Overflow in bash",
+    "aliases": ["CVE-2000-0001"],
+    "affected": [{
+      "package": {"ecosystem": "Debian:12", "name": "bash"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [
+        {"introduced": "0"}, {"fixed": "5.2.10"}
+      ]}]
+    }],
+    "database_specific": {"severity": "high"}
+  },
+  {
+    "id": "OSV-2",
+    "affected": [{
+      "package": {"ecosystem": "Debian:12", "name": "curl"},
+      "versions": ["7.88.1"]
+    }]
+  },
+  {
+    "id": "OSV-3",
+    "affected": [{
+      "package": {"ecosystem": "PyPI", "name": "curl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}]}]
+    }]
+  },
+  {
+    "id": "OSV-4",
+    "affected": [{
+      "package": {"ecosystem": "Debian:12", "name": "vim"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [
+        {"introduced": "9.0"}, {"last_affected": "9.0.5"}
+      ]}]
+    }]
+  }
+]`
+
+func TestMatch(t *testing.T) {
+	db, err := Decode(strings.NewReader(testFeed), []string{"Debian"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.NumAdvisories() != 3 {
+		t.Fatalf("expected 3 advisories, got: %d", db.NumAdvisories())
+	}
+	findings := db.Match([]image.Package{
+		{Name: "bash", Version: "1:5.2.9"},
+		{Name: "curl", Version: "7.88.1"},
+		{Name: "vim", Version: "9.0.10"},
+	})
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got: %v", findings)
+	}
+	if findings[0].AdvisoryId != "OSV-1" ||
+		findings[0].FixedVersion != "5.2.10" ||
+		findings[0].Severity != "high" {
+		t.Errorf("unexpected finding: %v", findings[0])
+	}
+	if findings[1].AdvisoryId != "OSV-2" {
+		t.Errorf("unexpected finding: %v", findings[1])
+	}
+	findings = db.Match([]image.Package{
+		{Name: "bash", Version: "5.2.10"},
+		{Name: "vim", Version: "9.0.5"},
+	})
+	if len(findings) != 1 || findings[0].AdvisoryId != "OSV-4" {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
@@ -0,0 +1,153 @@
+package vulnerability
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	eventFixed        = "fixed"
+	eventIntroduced   = "introduced"
+	eventLastAffected = "last_affected"
+)
+
+type affectedPackage struct {
+	advisory *osvAdvisory
+	ranges   []osvRange
+	versions map[string]struct{}
+}
+
+type osvAdvisory struct {
+	Id               string
+	Aliases          []string
+	Summary          string
+	Severity         []osvSeverity
+	Affected         []osvAffected
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+type osvAffected struct {
+	Package  osvPackage
+	Ranges   []osvRange
+	Versions []string
+}
+
+type osvPackage struct {
+	Ecosystem string
+	Name      string
+}
+
+type osvRange struct {
+	Type   string
+	Events []map[string]string
+}
+
+type osvSeverity struct {
+	Type  string
+	Score string
+}
+
+func decode(reader io.Reader, ecosystems []string) (*Database, error) {
+	bufReader := bufio.NewReader(reader)
+	var advisories []*osvAdvisory
+	firstByte, err := peekNonSpace(bufReader)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bufReader)
+	if firstByte == '[' {
+		if err := decoder.Decode(&advisories); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var advisory osvAdvisory
+			if err := decoder.Decode(&advisory); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+			advisories = append(advisories, &advisory)
+		}
+	}
+	db := &Database{
+		advisories: make(map[string][]*affectedPackage),
+		loadedAt:   time.Now(),
+	}
+	for _, advisory := range advisories {
+		if advisory == nil || advisory.Id == "" {
+			continue
+		}
+		var added bool
+		for _, affected := range advisory.Affected {
+			if !matchEcosystem(affected.Package.Ecosystem, ecosystems) {
+				continue
+			}
+			pkg := &affectedPackage{
+				advisory: advisory,
+				ranges:   affected.Ranges,
+				versions: make(map[string]struct{}, len(affected.Versions)),
+			}
+			for _, version := range affected.Versions {
+				pkg.versions[stripEpoch(version)] = struct{}{}
+			}
+			name := affected.Package.Name
+			db.advisories[name] = append(db.advisories[name], pkg)
+			added = true
+		}
+		if added {
+			db.numAdvisories++
+		}
+	}
+	return db, nil
+}
+
+func load(pathname string, ecosystems []string) (*Database, error) {
+	file, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decode(file, ecosystems)
+}
+
+func matchEcosystem(ecosystem string, ecosystems []string) bool {
+	if len(ecosystems) < 1 {
+		return true
+	}
+	for _, prefix := range ecosystems {
+		if strings.HasPrefix(ecosystem, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch char {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return char, reader.UnreadByte()
+	}
+}
+
+func (advisory *osvAdvisory) severity() string {
+	if severity, ok := advisory.DatabaseSpecific["severity"].(string); ok {
+		return severity
+	}
+	if len(advisory.Severity) > 0 {
+		return advisory.Severity[0].Type + ":" + advisory.Severity[0].Score
+	}
+	return ""
+}
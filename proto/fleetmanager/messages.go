@@ -26,6 +26,28 @@ type ChangeMachineTagsResponse struct {
 	Error string
 }
 
+// The EvacuateHypervisor() RPC is streamed.
+// The client sends a single EvacuateHypervisorRequest message.
+// The server sends a stream of EvacuateHypervisorResponse messages until a
+// message with Final=true or Error set is sent. Messages which relate to a VM
+// have VmIpAddress set. If VmError is set, migrating that VM failed.
+type EvacuateHypervisorRequest struct {
+	HypervisorHostname          string
+	HypervisorTagsToMatch       tags.MatchTags // Empty: match all tags.
+	LiveMigration               bool
+	Location                    string // Empty: any location.
+	MaximumConcurrentMigrations uint   // Zero: use the default.
+}
+
+type EvacuateHypervisorResponse struct {
+	DestinationHypervisor string `json:",omitempty"`
+	Error                 string `json:",omitempty"`
+	Final                 bool   `json:",omitempty"`
+	ProgressMessage       string `json:",omitempty"`
+	VmError               string `json:",omitempty"`
+	VmIpAddress           net.IP `json:",omitempty"`
+}
+
 type GetHypervisorForVMRequest struct {
 	IpAddress net.IP
 }
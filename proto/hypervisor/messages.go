@@ -6,6 +6,7 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
 	"github.com/Cloud-Foundations/Dominator/lib/types"
 )
@@ -16,6 +17,8 @@ const (
 	ArchitectureTypeArm64 = 2
 	// ArchitectureTypeRuntime is defined in architecture-specific files.
 
+	BackupManifestFilename = "manifest.json" // In the backup image.
+
 	ConsoleNone  = 0
 	ConsoleDummy = 1
 	ConsoleVNC   = 2
@@ -29,6 +32,14 @@ const (
 	MachineTypeGenericPC = 2
 	MachineTypeVirt      = 3
 
+	RestartPolicyNever   = 0
+	RestartPolicyOnCrash = 1
+	RestartPolicyAlways  = 2
+
+	SeedVolumeNone        = 0
+	SeedVolumeNoCloud     = 1
+	SeedVolumeConfigDrive = 2
+
 	StateStarting      = 0
 	StateRunning       = 1
 	StateFailedToStart = 2
@@ -70,8 +81,9 @@ type AcknowledgeVmResponse struct {
 }
 
 type Address struct {
-	IpAddress  net.IP `json:",omitempty"`
-	MacAddress string
+	IpAddress   net.IP `json:",omitempty"`
+	Ipv6Address net.IP `json:",omitempty"` // Assigned using DHCPv6.
+	MacAddress  string
 }
 
 type AddressList []Address
@@ -87,6 +99,59 @@ type AddVmVolumesResponse struct {
 
 type ArchitectureType uint
 
+// BackupInfo describes a backup of a VM. The backup manifest (a JSON-encoded
+// BackupManifest) is stored in the image server with the ManifestHash. The
+// manifest and the chunks are referenced by the image ImageName, so that they
+// are not garbage collected until the image is deleted.
+type BackupInfo struct {
+	CreatedOn    time.Time
+	ExpiresAt    time.Time `json:",omitempty"` // Zero: until image deleted.
+	ImageName    string
+	ImageServer  string `json:",omitempty"` // Empty: Hypervisor image server.
+	ManifestHash hash.Hash
+	Name         string `json:",omitempty"`
+	Quiesced     bool   `json:",omitempty"` // Guest file-systems were frozen.
+}
+
+// BackupManifest records the state of a VM at a point in time. The volume data
+// are split into chunks which are stored in an object server, so chunks which
+// are unchanged between backups (or shared between VMs) are only stored once.
+type BackupManifest struct {
+	ChunkSize uint64
+	CreatedOn time.Time
+	Name      string        `json:",omitempty"`
+	Quiesced  bool          `json:",omitempty"`
+	UserData  *BackupVolume `json:",omitempty"`
+	VmInfo    VmInfo
+	Volumes   []BackupVolume
+}
+
+// BackupVolume lists the chunks containing the data for a volume. All chunks
+// except the last are ChunkSize bytes long.
+type BackupVolume struct {
+	Chunks []hash.Hash
+	Size   uint64
+}
+
+type BackupVmRequest struct {
+	ChunkSize         uint64        `json:",omitempty"` // Default: 4 MiB.
+	ExpiresIn         time.Duration `json:",omitempty"` // Zero: never.
+	ForceIfNotStopped bool          `json:",omitempty"`
+	ImageName         string        // Image which references the backup.
+	ImageServer       string        `json:",omitempty"` // Empty: image server.
+	IpAddress         net.IP
+	Name              string `json:",omitempty"`
+	Quiesce           bool   `json:",omitempty"` // Requires a QEMU guest agent.
+}
+
+type BackupVmResponse struct {
+	Error        string
+	ManifestHash hash.Hash
+	NewBytes     uint64 `json:",omitempty"` // Sent to the object server.
+	NewChunks    uint64 `json:",omitempty"`
+	TotalChunks  uint64 `json:",omitempty"`
+}
+
 type BecomePrimaryVmOwnerRequest struct {
 	IpAddress net.IP
 }
@@ -159,6 +224,15 @@ type ChangeVmMachineTypeResponse struct {
 	Error string
 }
 
+type ChangeVmNetworkLimitsRequest struct {
+	IpAddress     net.IP
+	NetworkLimits NetworkLimits // Zero values: no limit.
+}
+
+type ChangeVmNetworkLimitsResponse struct {
+	Error string
+}
+
 type ChangeVmNumNetworkQueuesRequest struct {
 	IpAddress             net.IP
 	NumQueuesPerInterface []uint
@@ -186,6 +260,15 @@ type ChangeVmOwnerUsersResponse struct {
 	Error string
 }
 
+type ChangeVmRestartPolicyRequest struct {
+	IpAddress     net.IP
+	RestartPolicy RestartPolicy
+}
+
+type ChangeVmRestartPolicyResponse struct {
+	Error string
+}
+
 type ChangeVmSizeRequest struct {
 	IpAddress   net.IP
 	MemoryInMiB uint64
@@ -208,6 +291,15 @@ type ChangeVmSizeResponse struct {
 	Error string
 }
 
+type ChangeVmSnapshotScheduleRequest struct {
+	IpAddress        net.IP
+	SnapshotSchedule SnapshotSchedule // Zero Interval: disable schedule.
+}
+
+type ChangeVmSnapshotScheduleResponse struct {
+	Error string
+}
+
 type ChangeVmTagsRequest struct {
 	IpAddress net.IP
 	Tags      tags.Tags
@@ -265,6 +357,22 @@ type ConnectToVmConsoleResponse struct {
 	Error string
 }
 
+// The ConnectToVmLiveMigration RPC is fully streamed. After the
+// request/response, the connection/client is hijacked and each side of the
+// connection will send a stream of bytes. It is used by the destination
+// Hypervisor to carry the memory state or the volume data of a VM which is
+// being live migrated.
+type ConnectToVmLiveMigrationRequest struct {
+	AccessToken []byte
+	IpAddress   net.IP
+	Memory      bool // If false, VolumeIndex specifies the volume.
+	VolumeIndex uint
+}
+
+type ConnectToVmLiveMigrationResponse struct {
+	Error string
+}
+
 // The ConnectToVmManger RPC is fully streamed. After the request/response,
 // the connection/client is hijacked and each side of the connection will send
 // a stream of bytes.
@@ -438,11 +546,12 @@ type FirmwareType uint
 type GetCapacityRequest struct{}
 
 type GetCapacityResponse struct {
-	Error                string `json:",omitempty"`
-	AvailableMemoryInMiB uint64 `json:",omitempty"`
-	MemoryInMiB          uint64 `json:",omitempty"`
-	NumCPUs              uint   `json:",omitempty"`
-	TotalVolumeBytes     uint64 `json:",omitempty"`
+	Error                string             `json:",omitempty"`
+	AvailableMemoryInMiB uint64             `json:",omitempty"`
+	MemoryInMiB          uint64             `json:",omitempty"`
+	NumaNodes            []NumaNodeCapacity `json:",omitempty"`
+	NumCPUs              uint               `json:",omitempty"`
+	TotalVolumeBytes     uint64             `json:",omitempty"`
 }
 
 type GetIdentityProviderRequest struct{}
@@ -520,6 +629,7 @@ type GetVmInfoRequest struct {
 type GetVmInfoResponse struct {
 	VmInfo VmInfo
 	Error  string
+	Usage  *VmUsage `json:",omitempty"` // nil if not running.
 }
 
 type GetVmInfosRequest struct {
@@ -675,6 +785,7 @@ type MigrateVmRequest struct {
 	AccessToken      []byte
 	DhcpTimeout      time.Duration
 	IpAddress        net.IP
+	Live             bool // Fall back to cold migration if live fails.
 	SkipMemoryCheck  bool
 	SourceHypervisor string
 }
@@ -709,6 +820,33 @@ type NetworkEntry struct {
 	NumQueues uint `json:",omitempty"`
 }
 
+// NetworkLimits specifies the maximum rates for network traffic for each
+// interface of a VM. Egress traffic is sent by the VM and ingress traffic is
+// received by the VM. Zero values mean no limit.
+type NetworkLimits struct {
+	EgressBitsPerSecond     uint64 `json:",omitempty"`
+	EgressPacketsPerSecond  uint64 `json:",omitempty"`
+	IngressBitsPerSecond    uint64 `json:",omitempty"`
+	IngressPacketsPerSecond uint64 `json:",omitempty"`
+}
+
+// NumaNodeCapacity is the capacity of a NUMA node which is used for NUMA-aware
+// VM placement. Only VMs which are placed on the node are allocated from it.
+type NumaNodeCapacity struct {
+	MemoryInMiB            uint64 `json:",omitempty"`
+	NodeId                 uint
+	NumCPUs                uint   `json:",omitempty"`
+	UnallocatedMemoryInMiB uint64 `json:",omitempty"`
+	UnallocatedMilliCPUs   uint   `json:",omitempty"`
+}
+
+// NumaPlacement is the NUMA node a VM is placed on while it is running. The VM
+// vCPUs are pinned to the node CPUs and its memory is bound to the node.
+type NumaPlacement struct {
+	CPUs   []uint `json:",omitempty"` // Host CPU for each vCPU.
+	NodeId uint
+}
+
 type PatchVmImageRequest struct {
 	ImageName    string
 	ImageTimeout time.Duration
@@ -822,6 +960,8 @@ type ReplaceVmUserDataResponse struct {
 	Error string
 }
 
+type RestartPolicy uint
+
 type RestoreVmFromSnapshotRequest struct {
 	IpAddress         net.IP
 	ForceIfNotStopped bool
@@ -869,6 +1009,32 @@ type ScanVmRootResponse struct {
 	FileSystem *filesystem.FileSystem
 }
 
+type SeedVolumeType uint
+
+// The ServeVmLiveMigration RPC is called by the destination Hypervisor on the
+// source Hypervisor. The source sends the extra files for the VM and then waits
+// for a ServeVmLiveMigrationResponseResponse with Continue=true, after which
+// it copies the volumes and memory state over ConnectToVmLiveMigration
+// connections. Once the VM is paused on the source it sends a response with
+// SwitchedOver=true and waits for the decision to commit (Continue=true) or
+// abandon the migration, after which it sends the final response.
+type ServeVmLiveMigrationRequest struct {
+	AccessToken []byte
+	IpAddress   net.IP
+}
+
+type ServeVmLiveMigrationResponse struct { // Multiple responses are sent.
+	Error           string
+	ExtraFiles      map[string][]byte // Sent in the first response.
+	Final           bool              // If true, this is the final response.
+	ProgressMessage string
+	SwitchedOver    bool // VM is paused on the source and may be resumed.
+}
+
+type ServeVmLiveMigrationResponseResponse struct {
+	Continue bool // If false, the migration is abandoned.
+}
+
 type SetDisabledStateRequest struct {
 	Disable bool
 }
@@ -877,10 +1043,30 @@ type SetDisabledStateResponse struct {
 	Error string
 }
 
+// SnapshotInfo describes a snapshot of a VM. The size of the snapshot of each
+// volume is recorded in the Snapshots field of the Volume.
+type SnapshotInfo struct {
+	CreatedOn time.Time
+	Name      string
+	Quiesced  bool `json:",omitempty"` // Guest file-systems were frozen.
+	Scheduled bool `json:",omitempty"` // Created by the snapshot schedule.
+}
+
+// SnapshotSchedule specifies how often the Hypervisor should snapshot a VM and
+// how many of the scheduled snapshots to retain. Manually created snapshots are
+// not counted and are never automatically discarded.
+type SnapshotSchedule struct {
+	Interval       time.Duration
+	Quiesce        bool `json:",omitempty"` // Requires a QEMU guest agent.
+	RetentionCount uint
+	RootOnly       bool `json:",omitempty"`
+}
+
 type SnapshotVmRequest struct {
 	IpAddress         net.IP
 	ForceIfNotStopped bool
 	Name              string
+	Quiesce           bool // Requires a QEMU guest agent.
 	RootOnly          bool
 }
 
@@ -930,6 +1116,8 @@ type Subnet struct {
 	AllowedUsers      []string  `json:",omitempty"`
 	FirstDynamicIP    net.IP    `json:",omitempty"`
 	LastDynamicIP     net.IP    `json:",omitempty"`
+	Ipv6Gateway       net.IP    `json:",omitempty"`
+	Ipv6Prefix        net.IP    `json:",omitempty"` // A /64 prefix.
 	Tags              tags.Tags `json:",omitempty"`
 }
 
@@ -956,7 +1144,9 @@ type UserId = types.UserId
 type VmInfo struct {
 	Address              Address
 	ArchitectureType     ArchitectureType `json:",omitempty"`
+	Backups              []BackupInfo     `json:",omitempty"`
 	ChangedStateOn       time.Time        `json:",omitempty"`
+	CloudInitSeedVolume  SeedVolumeType   `json:",omitempty"`
 	ConsoleType          ConsoleType      `json:",omitempty"`
 	CreatedOn            time.Time        `json:",omitempty"`
 	CpuPriority          int              `json:",omitempty"`
@@ -970,25 +1160,58 @@ type VmInfo struct {
 	IdentityName         string           `json:",omitempty"`
 	ImageName            string           `json:",omitempty"`
 	ImageURL             string           `json:",omitempty"`
+	LastRestartTime      time.Time        `json:",omitempty"`
 	MachineType          MachineType      `json:",omitempty"`
 	MemoryInMiB          uint64
 	MilliCPUs            uint
 	NetworkEntries       []NetworkEntry `json:",omitempty"`
+	NetworkLimits        *NetworkLimits `json:",omitempty"`
+	NoCloudSmbiosSerial  bool           `json:",omitempty"` // Use metadata.
+	NumaPlacement        *NumaPlacement `json:",omitempty"` // Automatic.
+	NumRestarts          uint           `json:",omitempty"` // Automatic.
 	OwnerGroups          []string       `json:",omitempty"`
 	OwnerUsers           []string       `json:",omitempty"`
+	RestartPolicy        RestartPolicy  `json:",omitempty"`
 	RootFileSystemLabel  string         `json:",omitempty"`
 	SpreadVolumes        bool           `json:",omitempty"`
 	State                State
-	SecondaryAddresses   []Address      `json:",omitempty"`
-	SecondarySubnetIDs   []string       `json:",omitempty"`
-	SubnetId             string         `json:",omitempty"`
-	Tags                 tags.Tags      `json:",omitempty"`
-	Uncommitted          bool           `json:",omitempty"`
-	VirtualCPUs          uint           `json:",omitempty"`
-	VirtualiserImageName string         `json:",omitempty"`
-	Volumes              []Volume       `json:",omitempty"`
-	WatchdogAction       WatchdogAction `json:",omitempty"`
-	WatchdogModel        WatchdogModel  `json:",omitempty"`
+	SecondaryAddresses   []Address         `json:",omitempty"`
+	SecondarySubnetIDs   []string          `json:",omitempty"`
+	SnapshotSchedule     *SnapshotSchedule `json:",omitempty"`
+	Snapshots            []SnapshotInfo    `json:",omitempty"`
+	SshPublicKeys        []string          `json:",omitempty"`
+	SubnetId             string            `json:",omitempty"`
+	Tags                 tags.Tags         `json:",omitempty"`
+	Uncommitted          bool              `json:",omitempty"`
+	VirtualCPUs          uint              `json:",omitempty"`
+	VirtualiserImageName string            `json:",omitempty"`
+	Volumes              []Volume          `json:",omitempty"`
+	WatchdogAction       WatchdogAction    `json:",omitempty"`
+	WatchdogModel        WatchdogModel     `json:",omitempty"`
+}
+
+// VmIoUsage contains the totals and recent rates for I/O (block device or
+// network) for a VM.
+type VmIoUsage struct {
+	Bytes               uint64
+	BytesPerSecond      uint64
+	Operations          uint64 // Requests or packets.
+	OperationsPerSecond uint64
+}
+
+// VmUsage contains the resources actually used by a VM (as opposed to the
+// resources it is configured to have). Rates are averaged over Period.
+type VmUsage struct {
+	BalloonMemoryInMiB uint64 `json:",omitempty"` // Zero: no balloon.
+	BlockRead          VmIoUsage
+	BlockWrite         VmIoUsage
+	CpuTime            time.Duration // Total used by the virtualiser.
+	MemoryInMiB        uint64        // Resident memory of the virtualiser.
+	MilliCPUs          uint64
+	NetworkReceive     VmIoUsage // Received by the VM.
+	NetworkTransmit    VmIoUsage // Transmitted by the VM.
+	Period             time.Duration
+	SampleTime         time.Time
 }
 
 type Volume struct {
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net"
 	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
 )
 
 const (
@@ -12,6 +14,8 @@ const (
 	consoleTypeUnknown      = "UNKNOWN ConsoleType"
 	firmwareTypeUnknown     = "UNKNOWN FirmwareType"
 	machineTypeUnknown      = "UNKNOWN MachineType"
+	restartPolicyUnknown    = "UNKNOWN RestartPolicy"
+	seedVolumeTypeUnknown   = "UNKNOWN SeedVolumeType"
 	stateUnknown            = "UNKNOWN State"
 	volumeFormatUnknown     = "UNKNOWN VolumeFormat"
 	volumeInterfaceUnknown  = "UNKNOWN VolumeInterface"
@@ -50,6 +54,20 @@ var (
 	}
 	textToMachineType map[string]MachineType
 
+	restartPolicyToText = map[RestartPolicy]string{
+		RestartPolicyNever:   "never",
+		RestartPolicyOnCrash: "on-crash",
+		RestartPolicyAlways:  "always",
+	}
+	textToRestartPolicy map[string]RestartPolicy
+
+	seedVolumeTypeToText = map[SeedVolumeType]string{
+		SeedVolumeNone:        "none",
+		SeedVolumeNoCloud:     "nocloud",
+		SeedVolumeConfigDrive: "configdrive",
+	}
+	textToSeedVolumeType map[string]SeedVolumeType
+
 	stateToText = map[State]string{
 		StateStarting:      "starting",
 		StateRunning:       "running",
@@ -118,6 +136,16 @@ func init() {
 	for format, text := range machineTypeToText {
 		textToMachineType[text] = format
 	}
+	textToRestartPolicy = make(map[string]RestartPolicy,
+		len(restartPolicyToText))
+	for policy, text := range restartPolicyToText {
+		textToRestartPolicy[text] = policy
+	}
+	textToSeedVolumeType = make(map[string]SeedVolumeType,
+		len(seedVolumeTypeToText))
+	for seedVolumeType, text := range seedVolumeTypeToText {
+		textToSeedVolumeType[text] = seedVolumeType
+	}
 	textToState = make(map[string]State, len(stateToText))
 	for state, text := range stateToText {
 		textToState[text] = state
@@ -179,6 +207,9 @@ func (left *Address) Equal(right *Address) bool {
 	if !CompareIPs(left.IpAddress, right.IpAddress) {
 		return false
 	}
+	if !CompareIPs(left.Ipv6Address, right.Ipv6Address) {
+		return false
+	}
 	if left.MacAddress != right.MacAddress {
 		return false
 	}
@@ -235,6 +266,31 @@ func (al *AddressList) Set(value string) error {
 	return nil
 }
 
+func (left *BackupInfo) Equal(right *BackupInfo) bool {
+	if !left.CreatedOn.Equal(right.CreatedOn) {
+		return false
+	}
+	if !left.ExpiresAt.Equal(right.ExpiresAt) {
+		return false
+	}
+	if left.ImageName != right.ImageName {
+		return false
+	}
+	if left.ImageServer != right.ImageServer {
+		return false
+	}
+	if left.ManifestHash != right.ManifestHash {
+		return false
+	}
+	if left.Name != right.Name {
+		return false
+	}
+	if left.Quiesced != right.Quiesced {
+		return false
+	}
+	return true
+}
+
 func stringSlicesEqual(left, right []string) bool {
 	if len(left) != len(right) {
 		return false
@@ -426,6 +482,122 @@ func (left *NetworkEntry) Equal(right *NetworkEntry) bool {
 	return true
 }
 
+func (left *NetworkLimits) Equal(right *NetworkLimits) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+	return *left == *right
+}
+
+// IsZero returns true if no limits are specified.
+func (limits *NetworkLimits) IsZero() bool {
+	return limits == nil || *limits == NetworkLimits{}
+}
+
+func (left *NumaPlacement) Equal(right *NumaPlacement) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+	if left.NodeId != right.NodeId {
+		return false
+	}
+	if len(left.CPUs) != len(right.CPUs) {
+		return false
+	}
+	for index, cpu := range left.CPUs {
+		if cpu != right.CPUs[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func (restartPolicy *RestartPolicy) CheckValid() error {
+	if _, ok := restartPolicyToText[*restartPolicy]; !ok {
+		return errors.New(restartPolicyUnknown)
+	} else {
+		return nil
+	}
+}
+
+func (restartPolicy RestartPolicy) MarshalText() ([]byte, error) {
+	if text := restartPolicy.String(); text == restartPolicyUnknown {
+		return nil, errors.New(text)
+	} else {
+		return []byte(text), nil
+	}
+}
+
+func (restartPolicy *RestartPolicy) Set(value string) error {
+	if val, ok := textToRestartPolicy[value]; !ok {
+		return errors.New(restartPolicyUnknown)
+	} else {
+		*restartPolicy = val
+		return nil
+	}
+}
+
+func (restartPolicy RestartPolicy) String() string {
+	if str, ok := restartPolicyToText[restartPolicy]; !ok {
+		return restartPolicyUnknown
+	} else {
+		return str
+	}
+}
+
+func (restartPolicy *RestartPolicy) UnmarshalText(text []byte) error {
+	txt := string(text)
+	if val, ok := textToRestartPolicy[txt]; ok {
+		*restartPolicy = val
+		return nil
+	} else {
+		return errors.New("unknown RestartPolicy: " + txt)
+	}
+}
+
+func (seedVolumeType *SeedVolumeType) CheckValid() error {
+	if _, ok := seedVolumeTypeToText[*seedVolumeType]; !ok {
+		return errors.New(seedVolumeTypeUnknown)
+	} else {
+		return nil
+	}
+}
+
+func (seedVolumeType SeedVolumeType) MarshalText() ([]byte, error) {
+	if text := seedVolumeType.String(); text == seedVolumeTypeUnknown {
+		return nil, errors.New(text)
+	} else {
+		return []byte(text), nil
+	}
+}
+
+func (seedVolumeType *SeedVolumeType) Set(value string) error {
+	if val, ok := textToSeedVolumeType[value]; !ok {
+		return errors.New(seedVolumeTypeUnknown)
+	} else {
+		*seedVolumeType = val
+		return nil
+	}
+}
+
+func (seedVolumeType SeedVolumeType) String() string {
+	if str, ok := seedVolumeTypeToText[seedVolumeType]; !ok {
+		return seedVolumeTypeUnknown
+	} else {
+		return str
+	}
+}
+
+func (seedVolumeType *SeedVolumeType) UnmarshalText(text []byte) error {
+	txt := string(text)
+	if val, ok := textToSeedVolumeType[txt]; ok {
+		*seedVolumeType = val
+		return nil
+	} else {
+		return errors.New("unknown SeedVolumeType: " + txt)
+	}
+}
+
 func (state State) MarshalText() ([]byte, error) {
 	if text := state.String(); text == stateUnknown {
 		return nil, errors.New(text)
@@ -452,6 +624,29 @@ func (state *State) UnmarshalText(text []byte) error {
 	}
 }
 
+func (left *SnapshotInfo) Equal(right *SnapshotInfo) bool {
+	if !left.CreatedOn.Equal(right.CreatedOn) {
+		return false
+	}
+	if left.Name != right.Name {
+		return false
+	}
+	if left.Quiesced != right.Quiesced {
+		return false
+	}
+	if left.Scheduled != right.Scheduled {
+		return false
+	}
+	return true
+}
+
+func (left *SnapshotSchedule) Equal(right *SnapshotSchedule) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+	return *left == *right
+}
+
 func (left *Subnet) Equal(right *Subnet) bool {
 	if left.Id != right.Id {
 		return false
@@ -486,6 +681,12 @@ func (left *Subnet) Equal(right *Subnet) bool {
 	if !CompareIPs(left.FirstDynamicIP, right.FirstDynamicIP) {
 		return false
 	}
+	if !CompareIPs(left.Ipv6Gateway, right.Ipv6Gateway) {
+		return false
+	}
+	if !CompareIPs(left.Ipv6Prefix, right.Ipv6Prefix) {
+		return false
+	}
 	if !left.Tags.Equal(right.Tags) {
 		return false
 	}
@@ -504,6 +705,20 @@ func IpListsEqual(left, right []net.IP) bool {
 	return true
 }
 
+// MakeIpv6Address returns the IPv6 address which an interface with the
+// specified MAC address will autoconfigure (SLAAC) on the subnet. If the subnet
+// does not have an IPv6 prefix, nil is returned.
+func (subnet *Subnet) MakeIpv6Address(macAddress string) (net.IP, error) {
+	if len(subnet.Ipv6Prefix) < 1 {
+		return nil, nil
+	}
+	hwAddr, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return nil, err
+	}
+	return util.MakeEui64Address(subnet.Ipv6Prefix, hwAddr)
+}
+
 func (subnet *Subnet) Shrink() {
 	subnet.IpGateway = ShrinkIP(subnet.IpGateway)
 	subnet.IpMask = ShrinkIP(subnet.IpMask)
@@ -519,9 +734,20 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if left.ArchitectureType != right.ArchitectureType {
 		return false
 	}
+	if len(left.Backups) != len(right.Backups) {
+		return false
+	}
+	for index, leftBackup := range left.Backups {
+		if !leftBackup.Equal(&right.Backups[index]) {
+			return false
+		}
+	}
 	if !left.ChangedStateOn.Equal(right.ChangedStateOn) {
 		return false
 	}
+	if left.CloudInitSeedVolume != right.CloudInitSeedVolume {
+		return false
+	}
 	if left.ConsoleType != right.ConsoleType {
 		return false
 	}
@@ -561,6 +787,9 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if left.ImageURL != right.ImageURL {
 		return false
 	}
+	if !left.LastRestartTime.Equal(right.LastRestartTime) {
+		return false
+	}
 	if left.MachineType != right.MachineType {
 		return false
 	}
@@ -578,12 +807,27 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 			return false
 		}
 	}
+	if !left.NetworkLimits.Equal(right.NetworkLimits) {
+		return false
+	}
+	if left.NoCloudSmbiosSerial != right.NoCloudSmbiosSerial {
+		return false
+	}
+	if !left.NumaPlacement.Equal(right.NumaPlacement) {
+		return false
+	}
+	if left.NumRestarts != right.NumRestarts {
+		return false
+	}
 	if !stringSlicesEqual(left.OwnerGroups, right.OwnerGroups) {
 		return false
 	}
 	if !stringSlicesEqual(left.OwnerUsers, right.OwnerUsers) {
 		return false
 	}
+	if left.RestartPolicy != right.RestartPolicy {
+		return false
+	}
 	if left.SpreadVolumes != right.SpreadVolumes {
 		return false
 	}
@@ -607,6 +851,20 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if !stringSlicesEqual(left.SecondarySubnetIDs, right.SecondarySubnetIDs) {
 		return false
 	}
+	if !left.SnapshotSchedule.Equal(right.SnapshotSchedule) {
+		return false
+	}
+	if len(left.Snapshots) != len(right.Snapshots) {
+		return false
+	}
+	for index, leftSnapshot := range left.Snapshots {
+		if !leftSnapshot.Equal(&right.Snapshots[index]) {
+			return false
+		}
+	}
+	if !stringSlicesEqual(left.SshPublicKeys, right.SshPublicKeys) {
+		return false
+	}
 	if left.SubnetId != right.SubnetId {
 		return false
 	}
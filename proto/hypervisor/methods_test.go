@@ -1,11 +1,13 @@
 package hypervisor
 
 import (
+	"net"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/types"
 )
 
@@ -65,12 +67,24 @@ func makeVmInfo(t *testing.T, nonZeroFill bool, invertIndex int,
 				reflect.ValueOf("value"))
 		case reflect.Slice:
 			switch fieldName {
+			case "Backups":
+				backups := []BackupInfo{{
+					startTime,
+					startTime.Add(time.Hour),
+					"backups/vm",
+					"imageserver",
+					hash.Hash{1, 2, 3},
+					"backup",
+					true,
+				}}
+				fieldValue.Set(reflect.ValueOf(backups))
 			case "NetworkEntries":
 				networkEntries := []NetworkEntry{{
 					1,
 				}}
 				fieldValue.Set(reflect.ValueOf(networkEntries))
-			case "OwnerGroups", "OwnerUsers", "SecondarySubnetIDs":
+			case "OwnerGroups", "OwnerUsers", "SecondarySubnetIDs",
+				"SshPublicKeys":
 				sliceValue := reflect.MakeSlice(stringType, 2, 2)
 				fieldValue.Set(sliceValue)
 				sliceValue.Index(0).SetString(fieldName)
@@ -78,9 +92,19 @@ func makeVmInfo(t *testing.T, nonZeroFill bool, invertIndex int,
 			case "SecondaryAddresses":
 				addresses := []Address{{
 					[]byte{1, 2, 3, 4},
+					[]byte{0x20, 1, 0x0d, 0xb8, 0, 0, 0, 0,
+						0, 0, 0, 0, 1, 2, 3, 4},
 					"01:02:03",
 				}}
 				fieldValue.Set(reflect.ValueOf(addresses))
+			case "Snapshots":
+				snapshots := []SnapshotInfo{{
+					startTime,
+					"snapshot",
+					true,
+					true,
+				}}
+				fieldValue.Set(reflect.ValueOf(snapshots))
 			case "Volumes":
 				volumes := []Volume{{
 					DfmParams{
@@ -106,10 +130,13 @@ func makeVmInfo(t *testing.T, nonZeroFill bool, invertIndex int,
 			case "Address":
 				address := Address{
 					[]byte{1, 2, 3, 4},
+					[]byte{0x20, 1, 0x0d, 0xb8, 0, 0, 0, 0,
+						0, 0, 0, 0, 1, 2, 3, 4},
 					"01:02:03",
 				}
 				fieldValue.Set(reflect.ValueOf(address))
-			case "ChangedStateOn", "CreatedOn", "IdentityExpires":
+			case "ChangedStateOn", "CreatedOn", "IdentityExpires",
+				"LastRestartTime":
 				fieldValue.Set(reflect.ValueOf(startTime))
 			default:
 				t.Fatalf("Unsupported struct field: %s", fieldName)
@@ -180,3 +207,24 @@ func TestCompareEachField(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeIpv6Address(t *testing.T) {
+	subnet := Subnet{}
+	if ip, err := subnet.MakeIpv6Address("52:54:0a:01:02:03"); err != nil {
+		t.Fatal(err)
+	} else if ip != nil {
+		t.Errorf("MakeIpv6Address() = %s for subnet without prefix", ip)
+	}
+	subnet.Ipv6Prefix = net.ParseIP("2001:db8:1:2::")
+	ip, err := subnet.MakeIpv6Address("52:54:0a:01:02:03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := net.ParseIP("2001:db8:1:2:5054:aff:fe01:203"); !ip.Equal(
+		expected) {
+		t.Errorf("MakeIpv6Address() = %s, expected: %s", ip, expected)
+	}
+	if _, err := subnet.MakeIpv6Address("bogus"); err == nil {
+		t.Error("MakeIpv6Address() with bogus MAC address did not fail")
+	}
+}
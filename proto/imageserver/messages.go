@@ -7,8 +7,19 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/vulnerability"
 )
 
+// The build cache objects are kept until they have not been added again for the
+// build cache lifetime of the image server.
+type AddBuildCacheObjectsRequest struct {
+	Hashes []hash.Hash
+}
+
+type AddBuildCacheObjectsResponse struct {
+	Error string
+}
+
 type AddImageRequest struct {
 	ImageName string
 	Image     *image.Image
@@ -69,6 +80,42 @@ type DeleteUnreferencedObjectsRequest struct {
 
 type DeleteUnreferencedObjectsResponse struct{}
 
+type DirectoryUsage struct {
+	NumImages   uint
+	NumObjects  uint64
+	QuotaBytes  uint64 // Zero: no quota.
+	SharedBytes uint64 // Objects also used by images outside the tree.
+	UniqueBytes uint64 // Objects only used by images in the tree.
+}
+
+type FindImagesWithObjectRequest struct {
+	Hash hash.Hash
+}
+
+type FindImagesWithObjectResponse struct {
+	Error      string
+	ImageNames []string
+}
+
+type FindImagesWithPackageRequest struct {
+	PackageName string
+	Version     string // Empty: match all versions.
+}
+
+type FindImagesWithPackageResponse struct {
+	Error  string
+	Images []ImagePackage
+}
+
+type FindImagesWithPathRequest struct {
+	Pathname string
+}
+
+type FindImagesWithPathResponse struct {
+	Error      string
+	ImageNames []string
+}
+
 type FindLatestImageRequest struct {
 	BuildCommitId        string // Optional.
 	DirectoryName        string
@@ -81,6 +128,15 @@ type FindLatestImageResponse struct {
 	Error     string
 }
 
+type GetDirectoryUsageRequest struct {
+	DirectoryName string
+}
+
+type GetDirectoryUsageResponse struct {
+	Error string
+	Usage DirectoryUsage
+}
+
 type GetImageArchiveRequest struct {
 	ImageName string
 }
@@ -154,12 +210,23 @@ type GetImageUsageEstimateResponse struct {
 	UsageEstimate uint64
 }
 
+type GetImageVulnerabilitiesRequest struct {
+	ImageName string
+}
+
+type GetImageVulnerabilitiesResponse struct {
+	Error        string
+	FeedLoadedAt time.Time
+	Findings     []vulnerability.Finding
+}
+
 // The GetFilteredImageUpdates() RPC is fully streamed.
 // The client sends a GetFilteredImageUpdatesRequest message to the server.
 // The server sends a stream of ImageUpdate messages.
 
 type GetFilteredImageUpdatesRequest struct {
-	IgnoreExpiring bool
+	IgnoreExpiring   bool
+	IncludeDeletions bool // Send deleted images in the initial list.
 }
 
 type GetObjectStatisticsForImagesRequest struct {
@@ -182,6 +249,7 @@ type GetReplicationMasterRequest struct{}
 type GetReplicationMasterResponse struct {
 	Error             string
 	ReplicationMaster string
+	ReplicationPeers  []string // Multi-master mode.
 }
 
 type ImageArchive struct {
@@ -189,10 +257,16 @@ type ImageArchive struct {
 	image.Image
 } // HMAC-SHA512 checksum is written after GOB encoded data.
 
+type ImagePackage struct {
+	ImageName string
+	Version   string
+}
+
 type ImageUpdate struct {
 	Name      string // "" signifies initial list is sent, changes to follow.
 	Directory *image.Directory
 	Operation uint
+	DeletedOn time.Time // Only for OperationDeleteImage.
 }
 
 type ImportTreeRequest struct {
@@ -260,3 +334,12 @@ type RestoreImageFromArchiveResponse struct {
 	Error             string
 	ReplicationMaster string // If not empty, go here instead.
 }
+
+type SetDirectoryQuotaRequest struct {
+	DirectoryName string
+	QuotaBytes    uint64 // Zero: remove quota.
+}
+
+type SetDirectoryQuotaResponse struct {
+	Error string
+}
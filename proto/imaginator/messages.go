@@ -3,10 +3,23 @@ package imaginator
 import (
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/image/testresults"
 )
 
+type BuildCache struct {
+	Entries []BuildCacheEntry
+}
+
+type BuildCacheEntry struct {
+	Hash     hash.Hash
+	Pathname string // Relative to the cache directory.
+	Size     uint64
+}
+
 type BuildImageRequest struct {
+	BuildCache            *BuildCache // Remote cache contents for slave.
 	DisableRecursiveBuild bool
 	ExpiresIn             time.Duration
 	GitBranch             string
@@ -15,18 +28,33 @@ type BuildImageRequest struct {
 	ReturnImage           bool
 	StreamBuildLog        bool
 	StreamName            string
+	TestPolicy            *TestPolicy // Policy for slave.
 	Variables             map[string]string
 }
 
 type BuildImageResponse struct {
 	Image                     *image.Image
 	ImageName                 string
+	BuildCache                *BuildCache // Streamed by slave.
 	BuildLog                  []byte
 	ErrorString               string
 	NeedSourceImage           bool // True if source image missing/too old.
+	QueuePosition             uint // Streamed while waiting. 1: next to build.
 	SourceImage               string
 	SourceImageBuildVariables map[string]string
 	SourceImageGitCommitId    string
+	TestResults               []testresults.Result // Streamed after tests.
+}
+
+type BuildQueueEntry struct {
+	// One of: "auto-rebuild", "cascade" (rebuild of a stream whose source
+	// image was rebuilt), "request", "dependency".
+	Priority   string
+	QueuedAt   time.Time
+	Running    bool
+	StartedAt  time.Time // Zero if waiting.
+	StreamName string
+	Username   string // Empty for automatic builds.
 }
 
 type DisableAutoBuildsRequest struct {
@@ -47,6 +75,13 @@ type DisableBuildRequestsResponse struct {
 	Error         string
 }
 
+type GetBuildQueueRequest struct{}
+
+type GetBuildQueueResponse struct {
+	Entries []BuildQueueEntry // Running builds first, then in queue order.
+	Error   string
+}
+
 type GetDependenciesRequest struct {
 	MaxAge time.Duration
 }
@@ -100,3 +135,8 @@ type StartAutoBuildsRequest struct {
 type StartAutoBuildsResponse struct {
 	Error string
 }
+
+type TestPolicy struct {
+	IgnoreFailures  []string `json:",omitempty"` // Test names (i.e. flaky).
+	MaximumFailures uint     `json:",omitempty"`
+}